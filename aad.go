@@ -0,0 +1,213 @@
+package main
+
+// functions for authenticating to Cognitive Services with Azure AD tokens, instead of subscription keys
+//
+// (with client credentials of a service principal, or with a managed identity when there is no client secret)
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// for config
+	cfg "github.com/meinside/telegram-ms-cognitive-bot/internal/config"
+)
+
+// constants for Azure AD
+const (
+	azureADIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token" // for VMs
+
+	azureADTokenRefreshMargin = 5 * time.Minute // tokens are refreshed before they expire
+)
+
+// AzureADConfig struct for authenticating with Azure AD
+type AzureADConfig = cfg.AzureADConfig
+
+// services which accept Azure AD tokens on their custom subdomain endpoints
+//
+// (Speech and Translator need extra resource ids, so they are not supported)
+var azureADServices = []string{
+	serviceFace,
+	serviceComputerVision,
+	serviceTextAnalytics,
+	serviceFormRecognizer,
+	serviceContentModerator,
+	serviceCustomVision,
+}
+
+// cached token
+var azureADToken struct {
+	sync.Mutex
+
+	accessToken string
+	expiresOn   time.Time
+}
+
+// check if given service can be authenticated with Azure AD
+func isAzureADService(service string) bool {
+	for _, s := range azureADServices {
+		if s == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check if given service is configured to be authenticated with Azure AD
+func usesAzureAD(service string) bool {
+	for _, s := range conf().AzureADServices {
+		if s == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check if there are credentials (a subscription key, or Azure AD) for given service
+func hasCredentials(service, key string) bool {
+	return key != "" || usesAzureAD(service)
+}
+
+// replace the subscription key in given headers with an Azure AD token, if given service is configured to use it
+func withAzureADToken(ctx context.Context, service string, headers map[string]string) (map[string]string, error) {
+	if !usesAzureAD(service) {
+		return headers, nil
+	}
+
+	token, err := getAzureADToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure AD token: %s", err)
+	}
+
+	replaced := map[string]string{}
+	for k, v := range headers {
+		replaced[k] = v
+	}
+	for _, h := range subscriptionKeyHeaders {
+		delete(replaced, h)
+	}
+	replaced["Authorization"] = "Bearer " + token
+
+	return replaced, nil
+}
+
+// get a cached Azure AD token, or a new one if it is (about to be) expired
+func getAzureADToken(ctx context.Context) (string, error) {
+	azureADToken.Lock()
+	defer azureADToken.Unlock()
+
+	if azureADToken.accessToken != "" && time.Now().Add(azureADTokenRefreshMargin).Before(azureADToken.expiresOn) {
+		return azureADToken.accessToken, nil
+	}
+
+	var req *http.Request
+	var err error
+	if conf().AzureAD.ClientSecret != "" {
+		req, err = newClientCredentialsRequest(ctx, conf().AzureAD)
+	} else {
+		req, err = newManagedIdentityRequest(ctx, conf().AzureAD)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := azureHTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// (`expires_in` is a number from Azure AD, but a string from managed identity endpoints)
+	var token struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	expiresIn, err := strconv.Atoi(strings.Trim(string(token.ExpiresIn), `"`))
+	if err != nil {
+		return "", fmt.Errorf("malformed expires_in: %s", token.ExpiresIn)
+	}
+
+	azureADToken.accessToken = token.AccessToken
+	azureADToken.expiresOn = time.Now().Add(time.Duration(expiresIn) * time.Second)
+
+	logger.Debug(fmt.Sprintf("Got a new Azure AD token, expiring at %s", azureADToken.expiresOn.Format(time.RFC3339)))
+
+	return azureADToken.accessToken, nil
+}
+
+// new request for a token with client credentials of a service principal
+func newClientCredentialsRequest(ctx context.Context, config AzureADConfig) (*http.Request, error) {
+	authorityHost := config.AuthorityHost
+	if authorityHost == "" {
+		authorityHost = currentCloud().authorityHost
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", config.ClientID)
+	form.Set("client_secret", config.ClientSecret)
+	form.Set("scope", currentCloud().azureADResource+"/.default")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authorityHost, "/"), config.TenantID), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
+
+// new request for a token of the managed identity
+//
+// (endpoint of App Service and Functions is used when it exists, otherwise the one of VMs)
+func newManagedIdentityRequest(ctx context.Context, config AzureADConfig) (*http.Request, error) {
+	params := url.Values{}
+	params.Set("resource", currentCloud().azureADResource)
+	if config.ClientID != "" {
+		params.Set("client_id", config.ClientID)
+	}
+
+	endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER")
+	if endpoint != "" && header != "" {
+		params.Set("api-version", "2019-08-01")
+
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?%s", endpoint, params.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-IDENTITY-HEADER", header)
+
+		return req, nil
+	}
+
+	params.Set("api-version", "2018-02-01")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?%s", azureADIMDSEndpoint, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	return req, nil
+}
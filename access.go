@@ -0,0 +1,54 @@
+package main
+
+// functions for access control
+
+import (
+	"fmt"
+)
+
+// check if given user in given chat is allowed to use this bot
+//
+// (when no allowed user/chat ids are configured, everyone except banned users is allowed)
+func isAllowed(userID int, chatID int64) bool {
+	if isAdmin(userID) {
+		return true
+	}
+
+	if db != nil {
+		if banned, err := db.IsBanned(userID); err == nil {
+			if banned {
+				return false
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to check if user is banned: %s", err))
+		}
+	}
+
+	if len(conf().AllowedUserIDs) <= 0 && len(conf().AllowedChatIDs) <= 0 {
+		return true
+	}
+
+	for _, id := range conf().AllowedUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	for _, id := range conf().AllowedChatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check if given user is an admin
+func isAdmin(userID int) bool {
+	for _, id := range conf().AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+// functions for admin commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// admin commands
+const (
+	adminCommandStats     = "/stats"
+	adminCommandBroadcast = "/broadcast"
+	adminCommandBan       = "/ban"
+	adminCommandUnban     = "/unban"
+
+	numDaysForStats = 7
+)
+
+// parse a slash command and its argument from given text
+//
+// (eg. "/ban@some_bot 12345" => "/ban", "12345")
+func parseCommand(text string) (command, argument string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+
+	splitted := strings.SplitN(text, " ", 2)
+	command = splitted[0]
+	if index := strings.Index(command, "@"); index >= 0 {
+		command = command[:index]
+	}
+	if len(splitted) > 1 {
+		argument = strings.TrimSpace(splitted[1])
+	}
+
+	return command, argument
+}
+
+// check if given message is an admin command
+func isAdminCommand(message *bot.Message) bool {
+	if message.From == nil || !message.HasText() || !isAdmin(message.From.ID) {
+		return false
+	}
+
+	command, _ := parseCommand(*message.Text)
+	switch command {
+	case adminCommandStats, adminCommandBroadcast, adminCommandBan, adminCommandUnban:
+		return true
+	}
+
+	return false
+}
+
+// process admin command, and return the result message
+func processAdminCommand(b Messenger, message *bot.Message) string {
+	if db == nil {
+		return localizeFor(message.From.ID, messageNoDatabase)
+	}
+
+	command, argument := parseCommand(*message.Text)
+
+	switch command {
+	case adminCommandStats:
+		return adminStats()
+	case adminCommandBroadcast:
+		if argument == "" {
+			return fmt.Sprintf("Usage: %s <text>", adminCommandBroadcast)
+		}
+		return adminBroadcast(b, argument)
+	case adminCommandBan, adminCommandUnban:
+		var userID int
+		if message.ReplyToMessage != nil && message.ReplyToMessage.From != nil {
+			userID = message.ReplyToMessage.From.ID
+		} else if id, err := strconv.Atoi(argument); err == nil {
+			userID = id
+		} else {
+			return fmt.Sprintf("Usage: %s <user id> (or reply to a message of the user)", command)
+		}
+
+		if command == adminCommandBan {
+			if err := db.BanUser(userID); err != nil {
+				return fmt.Sprintf("Failed to ban user %d: %s", userID, err)
+			}
+			return fmt.Sprintf("Banned user %d.", userID)
+		}
+
+		if err := db.UnbanUser(userID); err != nil {
+			return fmt.Sprintf("Failed to unban user %d: %s", userID, err)
+		}
+		return fmt.Sprintf("Unbanned user %d.", userID)
+	}
+
+	return messageUnprocessable
+}
+
+// build up statistics message
+func adminStats() string {
+	lines := []string{}
+
+	lines = append(lines, "[Requests per command]")
+	if stats, err := db.CountRequestsPerCommand(); err == nil {
+		for _, s := range stats {
+			lines = append(lines, fmt.Sprintf("  %s: %d", s.Key, s.Count))
+		}
+	} else {
+		lines = append(lines, fmt.Sprintf("  (failed: %s)", err))
+	}
+
+	lines = append(lines, "", fmt.Sprintf("[Requests per day (recent %d days)]", numDaysForStats))
+	if stats, err := db.CountRequestsPerDay(numDaysForStats); err == nil {
+		for _, s := range stats {
+			lines = append(lines, fmt.Sprintf("  %s: %d", s.Key, s.Count))
+		}
+	} else {
+		lines = append(lines, fmt.Sprintf("  (failed: %s)", err))
+	}
+
+	lines = append(lines, "")
+	lines = append(lines, transactionStats()...)
+
+	return strings.Join(lines, "\n")
+}
+
+// broadcast given text to all known chats
+func adminBroadcast(b Messenger, text string) string {
+	chatIDs, err := db.GetChatIDs()
+	if err != nil {
+		return fmt.Sprintf("Failed to get chats: %s", err)
+	}
+
+	numSent := 0
+	for _, chatID := range chatIDs {
+		if sent := b.SendMessage(chatID, text, nil); sent.Ok {
+			numSent++
+		} else {
+			logger.Error(fmt.Sprintf("Failed to broadcast to chat %d: %s", chatID, *sent.Description))
+		}
+	}
+
+	return fmt.Sprintf("Broadcasted to %d of %d chat(s).", numSent, len(chatIDs))
+}
@@ -0,0 +1,247 @@
+package main
+
+// functions for processing albums (media groups)
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for albums
+const (
+	albumCollectDelay = 2 * time.Second // wait for the rest of an album for this duration
+	albumTTL          = 1 * time.Hour   // albums older than this will be forgotten
+
+	albumCallbackPrefix = "#" // (not used in file ids)
+
+	maxAlbumImages = 10 // limit of Telegram
+)
+
+// album struct for images in a media group
+type album struct {
+	chatID    int64
+	messageID int // id of the first message of the album
+	fileIDs   []string
+	language  string // language of messages for the sender
+	timer     *time.Timer
+	createdOn time.Time
+}
+
+// albums which are being collected or waiting for a command
+var albums = map[string]*album{}
+var albumsLock sync.Mutex
+
+// check if given message belongs to an album which is being collected
+func isCollectingAlbum(message *bot.Message) bool {
+	if message.MediaGroupID == nil {
+		return false
+	}
+
+	albumsLock.Lock()
+	defer albumsLock.Unlock()
+
+	_, exists := albums[*message.MediaGroupID]
+
+	return exists
+}
+
+// collect an image of an album,
+//
+// and send inline keyboards for the album after all of its images are collected
+func collectAlbum(b Messenger, message *bot.Message, fileID string) {
+	language := defaultLanguage
+	if message.From != nil {
+		language = languageFor(message.From.ID)
+	}
+
+	albumsLock.Lock()
+	defer albumsLock.Unlock()
+
+	// forget old albums
+	for id, a := range albums {
+		if time.Since(a.createdOn) > albumTTL {
+			delete(albums, id)
+		}
+	}
+
+	albumID := *message.MediaGroupID
+
+	if a, exists := albums[albumID]; exists {
+		a.fileIDs = append(a.fileIDs, fileID)
+
+		// wait more for the rest
+		a.timer.Reset(albumCollectDelay)
+	} else {
+		albums[albumID] = &album{
+			chatID:    message.Chat.ID,
+			messageID: message.MessageID,
+			fileIDs:   []string{fileID},
+			language:  language,
+			timer: time.AfterFunc(albumCollectDelay, func() {
+				sendAlbumInlineKeyboards(b, albumID)
+			}),
+			createdOn: time.Now(),
+		}
+	}
+}
+
+// send inline keyboards for selecting action on an album
+func sendAlbumInlineKeyboards(b Messenger, albumID string) {
+	albumsLock.Lock()
+	a, exists := albums[albumID]
+	albumsLock.Unlock()
+
+	if !exists {
+		return
+	}
+
+	if sent := b.SendMessage(a.chatID, fmt.Sprintf(localize(a.language, messageActionAlbum), len(a.fileIDs)), map[string]interface{}{
+		"reply_to_message_id": a.messageID,
+		"reply_markup": bot.InlineKeyboardMarkup{
+			InlineKeyboard: genInlineKeyboards(commandsFor(MediaAlbum), albumCallbackPrefix+albumID),
+		},
+	}); sent.Ok {
+		// expire it later
+		trackPrompt(a.chatID, sent.Result.MessageID, a.language)
+	} else {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+	}
+}
+
+// parse album id from given target of callback data
+func parseAlbumID(data string) (albumID string, isAlbum bool) {
+	if strings.HasPrefix(data, albumCallbackPrefix) {
+		return strings.TrimPrefix(data, albumCallbackPrefix), true
+	}
+
+	return "", false
+}
+
+// process callback query for an album, and return the message for the callback query (and whether it was queued)
+func processAlbumCallback(ctx context.Context, b Messenger, query bot.CallbackQuery, username, albumID string, command CognitiveCommand, language string) (message string, queued bool) {
+	albumsLock.Lock()
+	a, exists := albums[albumID]
+	albumsLock.Unlock()
+
+	if !exists {
+		return localize(language, messageAlbumExpired), false
+	}
+
+	fileURLs := []string{}
+	for _, fileID := range a.fileIDs {
+		if fileResult := b.GetFile(fileID); fileResult.Ok {
+			fileURL := b.GetFileURL(*fileResult.Result)
+			fileURLs = append(fileURLs, fileURL)
+
+			// log request
+			logRequest(username, fileID, command)
+
+			// save request for quotas
+			if db != nil {
+				if err := saveRequest(query.From.ID, username, command); err != nil {
+					logger.Error(fmt.Sprintf("Failed to save request: %s", err))
+				}
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to get file from url: %s", *fileResult.Description))
+
+			return localize(language, messageFailedToGetFile), false
+		}
+	}
+
+	if err := enqueueJob(ctx, Job{
+		Kind:      JobKindAlbum,
+		ChatID:    query.Message.Chat.ID,
+		UserID:    query.From.ID,
+		MessageID: query.Message.MessageID,
+		FileIDs:   a.fileIDs,
+		Command:   command,
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+		return localize(language, messageFailedToEnqueue), false
+	}
+
+	return fmt.Sprintf(localize(language, messageProcessingAlbum), command, len(fileURLs)), true
+}
+
+// process requested image processing on all images of an album,
+//
+// then send result images and a combined report
+func processAlbum(b Messenger, chatID int64, userID int, messageIDToDelete int, fileIDs, fileUniqueIDs, fileURLs []string, command CognitiveCommand) {
+	reports := []string{}
+
+	// edit the status message with progress periodically
+	progress := startProgress(b, chatID, messageIDToDelete, userID, command)
+
+	for i, fileURL := range fileURLs {
+		// 'typing...'
+		b.SendChatAction(chatID, bot.ChatActionTyping)
+
+		progress.setStage(fmt.Sprintf(localizeFor(userID, messageStageImageOf), i+1, len(fileURLs)))
+
+		var result ProcessResult
+		errorMessage := ""
+
+		ctx, cancel := context.WithTimeout(withProgress(withFileID(withChatID(jobContext(chatID, messageIDToDelete), chatID), fileIDs[i]), progress), commandTimeout(command))
+
+		cacheKey := resultCacheKey(fileUniqueIDs[i], command)
+		if cached, exists := resultCache.Get(cacheKey); exists {
+			result = cached
+		} else if imageBytes, err := loadImage(ctx, fileURL); err == nil {
+			if result, err = runCommand(ctx, uprightImageFor(imageBytes, command), command, nil); err == nil {
+				resultCache.Set(cacheKey, userID, result)
+			} else {
+				errorMessage = err.Error()
+			}
+		} else {
+			errorMessage = openImageErrorMessage(userID, err)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), command)
+		}
+		canceled := isCanceled(ctx)
+		cancel()
+
+		if canceled {
+			reports = append(reports, localizeFor(userID, messageCanceled))
+			break
+		}
+
+		if errorMessage == "" && result.Image != nil {
+			if _, err := sendResultImage(ctx, b, chatID, userID, command, fmt.Sprintf(localizeFor(userID, messageAlbumResultCaption), i+1, command), result.Image); err != nil {
+				errorMessage = err.Error()
+			}
+		}
+
+		if errorMessage != "" {
+			logJobError(errorMessage, chatID, userID, command, fileIDs[i])
+
+			reports = append(reports, fmt.Sprintf("[Image #%d]\n(%s)", i+1, errorMessage))
+		} else if len(result.Message) > 0 {
+			reports = append(reports, fmt.Sprintf("[Image #%d]\n%s", i+1, strings.TrimSpace(result.Message)))
+		}
+	}
+
+	progress.stop()
+
+	// delete original message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// send combined report
+	if len(reports) > 0 {
+		text := strings.Join(reports, "\n\n")
+		if sentMessageID, err := sendLongText(b, chatID, text, fmt.Sprintf(localizeFor(userID, messageResultCaption), command), nil); err == nil {
+			saveHistory(chatID, userID, sentMessageID, command, text)
+			publishResult(b, chatID, userID, sentMessageID, command, ProcessResult{Message: text})
+		} else {
+			logger.Error(fmt.Sprintf("Failed to send report: %s", err))
+		}
+	}
+}
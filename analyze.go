@@ -0,0 +1,166 @@
+package main
+
+// functions for analyzing an image with multiple services at once
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+)
+
+func init() {
+	registerCommand(newCommand(AnalyzeEverything, "A", handleAnalyzeEverything), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// analyze everything on given image bytes
+func handleAnalyzeEverything(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	errorMessage := ""
+
+	if report, annotated, err := analyzeEverything(ctx, imageBytes); err == nil {
+		result.Message = report
+
+		// the annotated photo
+		if result.Image, err = encodeImage(annotated); err != nil {
+			errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to analyze image: %s", err)
+	}
+
+	if errorMessage != "" {
+		return result, errors.New(errorMessage)
+	}
+
+	return result, nil
+}
+
+// analyze given image bytes with Describe, Tag, Face, and Read in parallel,
+//
+// and return a consolidated report with an annotated image
+func analyzeEverything(ctx context.Context, imageBytes []byte) (report string, annotated *image.RGBA, err error) {
+	var described DescribeResult
+	var tagged TagResult
+	var faces []DetectedFace
+	var recognized ReadResult
+	var describeErr, tagErr, faceErr, readErr error
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		defer recoverAsError("description", &describeErr)
+		described, describeErr = cognitive.Describe(ctx, imageBytes, 0)
+	}()
+	go func() {
+		defer wg.Done()
+		defer recoverAsError("tags", &tagErr)
+		tagged, tagErr = cognitive.Tag(ctx, imageBytes)
+	}()
+	go func() {
+		defer wg.Done()
+		defer recoverAsError("faces", &faceErr)
+		faces, faceErr = cognitive.DetectFaces(ctx, imageBytes, false, false, []string{"age", "gender", "smile", "glasses", "emotion"})
+	}()
+	go func() {
+		defer wg.Done()
+		defer recoverAsError("text", &readErr)
+		recognized, readErr = cognitive.Read(ctx, imageBytes, nil)
+	}()
+	wg.Wait()
+
+	// decode image
+	var img image.Image
+	if img, _, err = image.Decode(bytes.NewReader(imageBytes)); err != nil {
+		return "", nil, err
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+	sections := []string{}
+
+	// description
+	if describeErr == nil {
+		captions := []string{}
+		for _, c := range described.Description.Captions {
+			captions = append(captions, fmt.Sprintf("  %s (%.3f%%)", c.Text, c.Confidence*100.0))
+		}
+		sections = append(sections, fmt.Sprintf("[Description]\n%s", strings.Join(captions, "\n")))
+	} else {
+		sections = append(sections, fmt.Sprintf("[Description]\n  (failed: %s)", describeErr))
+	}
+
+	// tags
+	if tagErr == nil {
+		tags := []string{}
+		for _, t := range tagged.Tags {
+			tags = append(tags, t.Name)
+		}
+		sections = append(sections, fmt.Sprintf("[Tags]\n  %s", strings.Join(tags, ", ")))
+	} else {
+		sections = append(sections, fmt.Sprintf("[Tags]\n  (failed: %s)", tagErr))
+	}
+
+	// faces
+	if faceErr == nil {
+		descriptions := []string{}
+		for i, f := range faces {
+			// set color
+			color := colorForIndex(i)
+			gc.SetStrokeColor(color)
+			fc.SetSrc(&image.Uniform{color})
+
+			// draw rectangles and their indices on detected faces
+			drawRectangle(gc, f.FaceRectangle)
+			drawLabel(fc, fmt.Sprintf("Face #%d", i+1), f.FaceRectangle, fontSize)
+
+			descriptions = append(descriptions, fmt.Sprintf("  Face #%d: %s, %.0f, smile %.1f%%, %s (%s)",
+				i+1,
+				f.FaceAttributes.Gender,
+				f.FaceAttributes.Age,
+				f.FaceAttributes.Smile*100.0,
+				f.FaceAttributes.Glasses,
+				strongestEmotion(f.FaceAttributes.Emotion),
+			))
+		}
+		gc.Save()
+
+		if len(descriptions) > 0 {
+			sections = append(sections, fmt.Sprintf("[Faces]\n%s", strings.Join(descriptions, "\n")))
+		} else {
+			sections = append(sections, "[Faces]\n  (no face detected)")
+		}
+	} else {
+		sections = append(sections, fmt.Sprintf("[Faces]\n  (failed: %s)", faceErr))
+	}
+
+	// text
+	if readErr == nil {
+		if text := recognized.Text(); len(strings.TrimSpace(text)) > 0 {
+			sections = append(sections, fmt.Sprintf("[Text]\n%s", text))
+		} else {
+			sections = append(sections, "[Text]\n  (no text recognized)")
+		}
+	} else {
+		sections = append(sections, fmt.Sprintf("[Text]\n  (failed: %s)", readErr))
+	}
+
+	return strings.Join(sections, "\n\n"), newImg, nil
+}
+
+// get the name of the emotion with the highest score
+func strongestEmotion(scores map[string]float64) string {
+	strongest := "unknown"
+	highest := -1.0
+	for k, v := range scores {
+		if v > highest {
+			strongest, highest = k, v
+		}
+	}
+
+	return strongest
+}
@@ -0,0 +1,226 @@
+package main
+
+// HTTP API for running commands on images, for other tools (not from Telegram)
+//
+//	$ curl -H "X-API-Key: $KEY" -F "command=describe" -F "image=@photo.jpg" http://localhost:8080/analyze
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// constants for HTTP API
+const (
+	apiMaxImageBytes = 20 * 1024 * 1024 // same as the maximum size of files which bots can download from Telegram
+)
+
+// apiResult struct for results of `POST /analyze`
+//
+// (images are base64-encoded)
+type apiResult struct {
+	Command    CognitiveCommand `json:"command"`
+	Message    string           `json:"message,omitempty"`
+	Image      []byte           `json:"image,omitempty"`
+	Images     [][]byte         `json:"images,omitempty"`
+	Attachment []byte           `json:"attachment,omitempty"`
+	Contact    *apiContact      `json:"contact,omitempty"`
+}
+
+// apiContact struct for contacts in results
+type apiContact struct {
+	PhoneNumber string `json:"phone_number"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name,omitempty"`
+	VCard       string `json:"vcard,omitempty"`
+}
+
+// apiError struct for errors
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// start HTTP API server in the background, if `api-listen-port` is set
+func startAPIServer() {
+	if conf().APIListenPort <= 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/analyze", handleAPIAnalyze)
+
+	addr := fmt.Sprintf(":%d", conf().APIListenPort)
+
+	logger.Info(fmt.Sprintf("Starting API server on %s", addr))
+
+	go func() {
+		var err error
+		if conf().APICertFilepath != "" && conf().APIKeyFilepath != "" {
+			err = http.ListenAndServeTLS(addr, conf().APICertFilepath, conf().APIKeyFilepath, mux)
+		} else {
+			err = http.ListenAndServe(addr, mux)
+		}
+
+		logger.Error(fmt.Sprintf("API server stopped: %s", err))
+	}()
+}
+
+// check if given request has one of `api-keys`
+//
+// (in `X-API-Key` header, or as a bearer token)
+func isAuthorizedAPIRequest(r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return false
+	}
+
+	for _, k := range conf().APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handle `POST /analyze` with a multipart form of an image (`image`) and a command (`command`)
+//
+// (commands are the same as the captions of images, eg. "ocr", "F", or "describe in spanish")
+func handleAPIAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !isAuthorizedAPIRequest(r) {
+		writeAPIError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, apiMaxImageBytes+1024*1024) // (with some room for other fields)
+	if err := r.ParseMultipartForm(apiMaxImageBytes); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Malformed form: %s", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	command, language, ok := parseShortcut(r.FormValue("command"))
+	if !ok || !isDirectlyRunnable(command) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Command not supported: %s", r.FormValue("command")))
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("No image: %s", err))
+		return
+	}
+	defer file.Close()
+
+	imageBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read image: %s", err))
+		return
+	}
+
+	// (converted to JPEG or PNG as images from Telegram, eg. HEIC, WebP, or GIF)
+	if imageBytes, err = normalizeImage(r.Context(), imageBytes); err == nil {
+		err = checkImageLimits(imageBytes)
+	}
+	if err != nil {
+		if _, tooLarge := err.(imageTooLargeError); tooLarge {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Image too large: %s", err))
+		} else {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported image: %s", err))
+		}
+		return
+	}
+
+	ctx, span := startSpan(r.Context(), "api analyze", spanKindServer)
+	span.setAttribute("command", string(command))
+	defer span.finish(nil)
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout(command))
+	defer cancel()
+
+	// correct orientation before sending to services and annotating
+	imageBytes = uprightImageFor(imageBytes, command)
+
+	result, err := runCommand(ctx, imageBytes, command, nil)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			writeAPIError(w, http.StatusGatewayTimeout, fmt.Sprintf(messageTimedOut, command))
+		} else {
+			writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		}
+
+		logger.Warn(fmt.Sprintf("API request of '%s' failed: %s", command, err))
+		return
+	}
+	if language != "" {
+		result = translateResult(ctx, result, language)
+	}
+
+	logger.Debug(fmt.Sprintf("API request of '%s' from %s succeeded", command, r.RemoteAddr))
+
+	if conf().ResultWebhookURL != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+			defer cancel()
+
+			notifyResultWebhook(ctx, resultWebhookPayload{
+				Source:      resultSourceAPI,
+				Command:     command,
+				Message:     result.Message,
+				CompletedAt: time.Now().UTC(),
+			})
+		}()
+	}
+
+	writeAPIResult(w, http.StatusOK, newAPIResult(command, result))
+}
+
+// convert given result of a command for HTTP API
+//
+// (related images are file ids of Telegram, so they are not included)
+func newAPIResult(command CognitiveCommand, result ProcessResult) apiResult {
+	converted := apiResult{
+		Command:    command,
+		Message:    result.Message,
+		Image:      result.Image,
+		Images:     result.Images,
+		Attachment: result.Attachment,
+	}
+	if result.Contact != nil {
+		converted.Contact = &apiContact{
+			PhoneNumber: result.Contact.PhoneNumber,
+			FirstName:   result.Contact.FirstName,
+			LastName:    result.Contact.LastName,
+			VCard:       result.Contact.VCard,
+		}
+	}
+
+	return converted
+}
+
+// write given error as JSON
+func writeAPIError(w http.ResponseWriter, statusCode int, message string) {
+	writeAPIResult(w, statusCode, apiError{Error: message})
+}
+
+// write given value as JSON
+func writeAPIResult(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write API response: %s", err))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// new request of `POST /analyze` with given command and image bytes
+func newAPIAnalyzeRequest(t *testing.T, command string, imageBytes []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("command", command)
+	if part, err := form.CreateFormFile("image", "image"); err != nil {
+		t.Fatal(err)
+	} else {
+		part.Write(imageBytes)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/analyze", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("X-API-Key", "test-key")
+
+	return r
+}
+
+func TestAPIAnalyzeNormalizesImage(t *testing.T) {
+	useConfig(t, Config{APIKeys: []string{"test-key"}})
+
+	mock := &mockCognitive{
+		tags: TagResult{Tags: []ImageTag{{Name: "cat", Confidence: 0.99}}},
+	}
+	useCognitive(t, mock)
+
+	img := image.NewPaletted(image.Rect(0, 0, 16, 16), []color.Color{color.White, color.Black})
+	var data bytes.Buffer
+	if err := gif.Encode(&data, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handleAPIAnalyze(w, newAPIAnalyzeRequest(t, "tag", data.Bytes()))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d (%s)", w.Code, w.Body.String())
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(mock.image)); err != nil || format != "png" {
+		t.Errorf("GIF image was not converted to PNG: %s (%v)", format, err)
+	}
+}
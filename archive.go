@@ -0,0 +1,364 @@
+package main
+
+// functions for archiving results to object storage (Amazon S3, or Azure Blob Storage)
+//
+// (for audit trails beyond chat histories of Telegram)
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// object storages for archiving
+const (
+	archiveStorageS3        = "s3"
+	archiveStorageAzureBlob = "azure-blob"
+
+	defaultArchiveShareLinkHours = 24
+	maxArchiveShareLinkHours     = 7 * 24 // (the maximum of presigned urls of S3)
+
+	azureBlobVersion  = "2020-12-06"
+	s3Service         = "s3"
+	archiveJSONSuffix = ".json"
+)
+
+// archivedResult struct for JSON results in archives
+type archivedResult struct {
+	ChatID     int64            `json:"chat_id"`
+	UserID     int              `json:"user_id"`
+	MessageID  int              `json:"message_id"`
+	Command    CognitiveCommand `json:"command"`
+	Message    string           `json:"message,omitempty"`
+	ImageKey   string           `json:"image_key,omitempty"`
+	ArchivedAt time.Time        `json:"archived_at"`
+}
+
+// check if given name is of a known object storage
+func isValidArchiveStorage(name string) bool {
+	return name == archiveStorageS3 || name == archiveStorageAzureBlob
+}
+
+// key of archived objects for given result message
+//
+// (eg. "-1001234/5678/2021-03-04/91011-F", then appended with extensions)
+func archiveKey(chatID int64, userID int, messageID int, command CognitiveCommand, t time.Time) string {
+	return fmt.Sprintf("%d/%d/%s/%d-%s", chatID, userID, t.Format("2006-01-02"), messageID, shortIDOf(command))
+}
+
+// archive given result, and return the keys of its annotated image (empty if there is none) and its JSON result
+func archive(ctx context.Context, chatID int64, userID int, messageID int, command CognitiveCommand, result ProcessResult) (imageKey, jsonKey string, err error) {
+	now := time.Now().UTC()
+	key := archiveKey(chatID, userID, messageID, command, now)
+
+	archived := archivedResult{
+		ChatID:     chatID,
+		UserID:     userID,
+		MessageID:  messageID,
+		Command:    command,
+		Message:    result.Message,
+		ArchivedAt: now,
+	}
+
+	if result.Image != nil {
+		contentType := http.DetectContentType(result.Image)
+		archived.ImageKey = key + imageExtension(contentType)
+
+		if err = putObject(ctx, archived.ImageKey, contentType, result.Image); err != nil {
+			return "", "", fmt.Errorf("failed to archive result image: %s", err)
+		}
+		saveArchivedKey(userID, archived.ImageKey)
+	}
+
+	var data []byte
+	if data, err = json.MarshalIndent(archived, "", "  "); err != nil {
+		return "", "", err
+	}
+	if err = putObject(ctx, key+archiveJSONSuffix, "application/json", data); err != nil {
+		return "", "", fmt.Errorf("failed to archive result: %s", err)
+	}
+	saveArchivedKey(userID, key+archiveJSONSuffix)
+
+	logger.Debug(fmt.Sprintf("Archived result of '%s' to %s", command, key))
+
+	return archived.ImageKey, key + archiveJSONSuffix, nil
+}
+
+// save the key of an archived object of given user, for deleting it with `/forgetme`
+func saveArchivedKey(userID int, key string) {
+	if db == nil {
+		return
+	}
+
+	if err := db.SaveArchivedKey(userID, key); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save archived key: %s", err))
+	}
+}
+
+// archivedObjects struct for deleting archived objects of users
+//
+// (keys of archived objects are saved in the local database, so it should be deleted before the database)
+type archivedObjects struct{}
+
+// DeleteUserData deletes archived objects of given user from the configured object storage
+func (archivedObjects) DeleteUserData(userID int) error {
+	keys, err := db.GetArchivedKeys(userID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf().TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	for _, key := range keys {
+		if err := deleteObject(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete archived object %s: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+// send given share link of an archived result to the user, as a reply to the result message
+func sendShareLink(b Messenger, chatID int64, userID int, messageID int, link string) {
+	if sent := b.SendMessage(chatID, fmt.Sprintf(localizeFor(userID, messageArchived), conf().ArchiveShareLinkHours, link), map[string]interface{}{
+		"reply_to_message_id":      messageID,
+		"disable_web_page_preview": true,
+	}); !sent.Ok {
+		logger.Error(fmt.Sprintf("Failed to send share link: %s", *sent.Description))
+	}
+}
+
+// extension of files with given content type
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+
+	return ".png"
+}
+
+// upload given data to the configured object storage
+func putObject(ctx context.Context, key, contentType string, data []byte) error {
+	return requestObject(ctx, "PUT", key, contentType, data)
+}
+
+// delete given object from the configured object storage
+//
+// (objects which do not exist are regarded as deleted)
+func deleteObject(ctx context.Context, key string) error {
+	// (content type is signed with requests to S3, so it is sent even without any data)
+	err := requestObject(ctx, "DELETE", key, "application/octet-stream", nil)
+	if apiErr, ok := err.(APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// send a request for given object to the configured object storage
+func requestObject(ctx context.Context, method, key, contentType string, data []byte) error {
+	var resp *http.Response
+	var err error
+
+	switch conf().ArchiveStorage {
+	case archiveStorageS3:
+		host, path := s3HostAndPath(key)
+
+		payloadHash := sha256.Sum256(data)
+		headers := map[string]string{
+			"X-Amz-Content-Sha256": hex.EncodeToString(payloadHash[:]),
+		}
+		signAWSRequest(method, path, headers, host, s3Region(), s3Service, contentType, data, time.Now().UTC())
+
+		resp, err = doRequestWithHeaders(ctx, method, fmt.Sprintf("https://%s%s", host, path), headers, contentType, data)
+	case archiveStorageAzureBlob:
+		headers := map[string]string{
+			"X-Ms-Date":    time.Now().UTC().Format(http.TimeFormat),
+			"X-Ms-Version": azureBlobVersion,
+		}
+		if method == "PUT" {
+			headers["X-Ms-Blob-Type"] = "BlockBlob"
+		}
+		headers["Authorization"] = azureBlobSharedKey(method, key, contentType, len(data), headers)
+
+		resp, err = doRequestWithHeaders(ctx, method, azureBlobURL(key), headers, contentType, data)
+	default:
+		return fmt.Errorf("unknown archive storage: %s", conf().ArchiveStorage)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readJSON(resp, nil)
+}
+
+// generate a link to given archived object, which expires after given duration
+func shareLinkOf(key string, expiresIn time.Duration) (string, error) {
+	switch conf().ArchiveStorage {
+	case archiveStorageS3:
+		return presignS3URL(key, expiresIn, time.Now().UTC()), nil
+	case archiveStorageAzureBlob:
+		return azureBlobSASURL(key, expiresIn, time.Now().UTC())
+	}
+
+	return "", fmt.Errorf("unknown archive storage: %s", conf().ArchiveStorage)
+}
+
+// region of the S3 bucket
+func s3Region() string {
+	if conf().ArchiveS3Region != "" {
+		return conf().ArchiveS3Region
+	} else if conf().AWSRegion != "" {
+		return conf().AWSRegion
+	}
+
+	return defaultAWSRegion
+}
+
+// host (virtual-hosted style) and path of given key in the S3 bucket
+func s3HostAndPath(key string) (host, path string) {
+	return fmt.Sprintf("%s.s3.%s.amazonaws.com", conf().ArchiveBucket, s3Region()), "/" + key
+}
+
+// presign a url for getting given key in the S3 bucket, with AWS Signature Version 4
+func presignS3URL(key string, expiresIn time.Duration, now time.Time) string {
+	host, path := s3HostAndPath(key)
+	region := s3Region()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, s3Service)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", fmt.Sprintf("%s/%s", conf().AWSAccessKeyID, scope))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expiresIn.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if conf().AWSSessionToken != "" {
+		query.Set("X-Amz-Security-Token", conf().AWSSessionToken)
+	}
+	canonicalQuery := strings.Replace(query.Encode(), "+", "%20", -1) // (sorted by keys)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		path,
+		canonicalQuery,
+		fmt.Sprintf("host:%s\n", host),
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(date, region, s3Service), stringToSign))
+
+	return fmt.Sprintf("https://%s%s?%s&X-Amz-Signature=%s", host, path, canonicalQuery, signature)
+}
+
+// url of given key in the Azure Blob Storage container
+func azureBlobURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", fmt.Sprintf(currentCloud().blobURLFormat, conf().ArchiveAzureAccount), conf().ArchiveBucket, key)
+}
+
+// authorization header of given request to Azure Blob Storage, with Shared Key
+func azureBlobSharedKey(method, key, contentType string, contentLength int, headers map[string]string) string {
+	// canonicalized headers (`x-ms-*` ones, sorted by their lowercased names)
+	names := []string{}
+	for name := range headers {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += fmt.Sprintf("%s:%s\n", strings.ToLower(name), strings.TrimSpace(headers[name]))
+	}
+
+	length := ""
+	if contentLength > 0 {
+		length = fmt.Sprintf("%d", contentLength)
+	}
+
+	stringToSign := strings.Join([]string{
+		method,
+		"", // Content-Encoding
+		"", // Content-Language
+		length,
+		"", // Content-MD5
+		contentType,
+		"", // Date (`x-ms-date` is used instead)
+		"", // If-Modified-Since
+		"", // If-Match
+		"", // If-None-Match
+		"", // If-Unmodified-Since
+		"", // Range
+		canonicalHeaders + fmt.Sprintf("/%s/%s/%s", conf().ArchiveAzureAccount, conf().ArchiveBucket, key),
+	}, "\n")
+
+	accountKey, err := base64.StdEncoding.DecodeString(conf().ArchiveAzureAccountKey)
+	if err != nil { // (should not happen, for it is validated when config is loaded)
+		logger.Error(fmt.Sprintf("Malformed account key of Azure Blob Storage: %s", err))
+	}
+
+	return fmt.Sprintf("SharedKey %s:%s", conf().ArchiveAzureAccount, base64.StdEncoding.EncodeToString(hmacSHA256(accountKey, stringToSign)))
+}
+
+// generate a url with a read-only service SAS for given key in the Azure Blob Storage container
+func azureBlobSASURL(key string, expiresIn time.Duration, now time.Time) (string, error) {
+	accountKey, err := base64.StdEncoding.DecodeString(conf().ArchiveAzureAccountKey)
+	if err != nil {
+		return "", err
+	}
+
+	expiry := now.Add(expiresIn).Format("2006-01-02T15:04:05Z")
+
+	stringToSign := strings.Join([]string{
+		"r", // signed permissions
+		"",  // signed start
+		expiry,
+		fmt.Sprintf("/blob/%s/%s/%s", conf().ArchiveAzureAccount, conf().ArchiveBucket, key),
+		"",      // signed identifier
+		"",      // signed ip
+		"https", // signed protocol
+		azureBlobVersion,
+		"b", // signed resource (blob)
+		"",  // signed snapshot time
+		"",  // signed encryption scope
+		"",  // rscc
+		"",  // rscd
+		"",  // rsce
+		"",  // rscl
+		"",  // rsct
+	}, "\n")
+
+	query := url.Values{}
+	query.Set("sv", azureBlobVersion)
+	query.Set("sr", "b")
+	query.Set("sp", "r")
+	query.Set("se", expiry)
+	query.Set("spr", "https")
+	query.Set("sig", base64.StdEncoding.EncodeToString(hmacSHA256(accountKey, stringToSign)))
+
+	return fmt.Sprintf("%s?%s", azureBlobURL(key), query.Encode()), nil
+}
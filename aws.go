@@ -0,0 +1,497 @@
+package main
+
+// VisionProvider implementation with AWS Rekognition
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// constants for AWS Rekognition
+const (
+	defaultAWSRegion = "us-east-1"
+
+	rekognitionService     = "rekognition"
+	rekognitionContentType = "application/x-amz-json-1.1"
+	rekognitionMaxLabels   = 20
+)
+
+// VisionProvider implementation with AWS Rekognition
+type awsRekognition struct{}
+
+// RekognitionBoundingBox struct for a bounding box (normalized to 0.0 - 1.0)
+type RekognitionBoundingBox struct {
+	Left   float64 `json:"Left"`
+	Top    float64 `json:"Top"`
+	Width  float64 `json:"Width"`
+	Height float64 `json:"Height"`
+}
+
+// convert to a rectangle on an image with given size
+func (b RekognitionBoundingBox) toRectangle(width, height int) cog.Rectangle {
+	return cog.Rectangle{
+		Left:   int(b.Left * float64(width)),
+		Top:    int(b.Top * float64(height)),
+		Width:  int(b.Width * float64(width)),
+		Height: int(b.Height * float64(height)),
+	}
+}
+
+// RekognitionFeature struct for a boolean feature with confidence
+type RekognitionFeature struct {
+	Value      bool    `json:"Value"`
+	Confidence float64 `json:"Confidence"` // 0 - 100
+}
+
+// score of the feature (0.0 - 1.0)
+func (f RekognitionFeature) score() float64 {
+	if f.Value {
+		return f.Confidence / 100.0
+	}
+	return 1.0 - f.Confidence/100.0
+}
+
+// RekognitionFaceDetail struct for a detected face
+type RekognitionFaceDetail struct {
+	BoundingBox RekognitionBoundingBox `json:"BoundingBox"`
+	AgeRange    struct {
+		Low  int `json:"Low"`
+		High int `json:"High"`
+	} `json:"AgeRange"`
+	Smile      RekognitionFeature `json:"Smile"`
+	Eyeglasses RekognitionFeature `json:"Eyeglasses"`
+	Sunglasses RekognitionFeature `json:"Sunglasses"`
+	Beard      RekognitionFeature `json:"Beard"`
+	Mustache   RekognitionFeature `json:"Mustache"`
+	Gender     struct {
+		Value string `json:"Value"`
+	} `json:"Gender"`
+	Emotions []struct {
+		Type       string  `json:"Type"`
+		Confidence float64 `json:"Confidence"`
+	} `json:"Emotions"`
+	Landmarks []struct {
+		Type string  `json:"Type"`
+		X    float64 `json:"X"`
+		Y    float64 `json:"Y"`
+	} `json:"Landmarks"`
+	Pose struct {
+		Roll  float64 `json:"Roll"`
+		Yaw   float64 `json:"Yaw"`
+		Pitch float64 `json:"Pitch"`
+	} `json:"Pose"`
+}
+
+// RekognitionLabel struct for a detected label
+type RekognitionLabel struct {
+	Name       string  `json:"Name"`
+	Confidence float64 `json:"Confidence"`
+	Instances  []struct {
+		BoundingBox RekognitionBoundingBox `json:"BoundingBox"`
+		Confidence  float64                `json:"Confidence"`
+	} `json:"Instances"`
+	Parents []struct {
+		Name string `json:"Name"`
+	} `json:"Parents"`
+}
+
+// landmarks of AWS Rekognition, in names of Face API
+var rekognitionLandmarks = map[string]string{
+	"leftPupil":     "pupilLeft",
+	"rightPupil":    "pupilRight",
+	"nose":          "noseTip",
+	"mouthLeft":     "mouthLeft",
+	"mouthRight":    "mouthRight",
+	"leftEyeUp":     "eyeLeftTop",
+	"leftEyeDown":   "eyeLeftBottom",
+	"leftEyeLeft":   "eyeLeftOuter",
+	"rightEyeUp":    "eyeRightTop",
+	"rightEyeDown":  "eyeRightBottom",
+	"rightEyeRight": "eyeRightOuter",
+}
+
+// emotions of AWS Rekognition, in names of Face API
+var rekognitionEmotions = map[string]string{
+	"HAPPY":     "happiness",
+	"SAD":       "sadness",
+	"ANGRY":     "anger",
+	"CONFUSED":  "confusion",
+	"DISGUSTED": "disgust",
+	"SURPRISED": "surprise",
+	"CALM":      "neutral",
+	"FEAR":      "fear",
+}
+
+// call an action of AWS Rekognition with given request, and unmarshal the response into `out`
+func (awsRekognition) call(ctx context.Context, action string, request interface{}, out interface{}) error {
+	if conf().AWSAccessKeyID == "" || conf().AWSSecretAccessKey == "" {
+		return errors.New("no access key for AWS Rekognition")
+	}
+
+	region := conf().AWSRegion
+	if region == "" {
+		region = defaultAWSRegion
+	}
+	host := fmt.Sprintf("%s.%s.amazonaws.com", rekognitionService, region)
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"X-Amz-Target": fmt.Sprintf("RekognitionService.%s", action),
+	}
+	signAWSRequest("POST", "/", headers, host, region, rekognitionService, rekognitionContentType, data, time.Now().UTC())
+
+	resp, err := doRequestWithHeaders(ctx, "POST", fmt.Sprintf("https://%s/", host), headers, rekognitionContentType, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readJSON(resp, out)
+}
+
+// sign a request to given path of given host with AWS Signature Version 4,
+// and add `X-Amz-Date` and `Authorization` to given headers
+func signAWSRequest(method, path string, headers map[string]string, host, region, service, contentType string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	headers["X-Amz-Date"] = amzDate
+	if conf().AWSSessionToken != "" {
+		headers["X-Amz-Security-Token"] = conf().AWSSessionToken
+	}
+
+	// canonical headers (sorted by their lowercased names)
+	canonical := map[string]string{
+		"content-type": contentType,
+		"host":         host,
+	}
+	for k, v := range headers {
+		canonical[strings.ToLower(k)] = v
+	}
+	names := []string{}
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += fmt.Sprintf("%s:%s\n", name, strings.TrimSpace(canonical[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(date, region, service), stringToSign))
+
+	headers["Authorization"] = fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", conf().AWSAccessKeyID, scope, signedHeaders, signature)
+}
+
+// signing key of AWS Signature Version 4 for given date, region, and service
+func awsSigningKey(date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+conf().AWSSecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+
+	return hmacSHA256(key, "aws4_request")
+}
+
+// HMAC-SHA256 of given data with a key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// image of a request (marshalled as base64)
+func rekognitionImage(image []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"Bytes": image,
+	}
+}
+
+// DetectFaces detects faces on given image bytes
+//
+// (face ids are not supported)
+func (a awsRekognition) DetectFaces(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) (result []DetectedFace, err error) {
+	width, height, err := imageSize(image)
+	if err != nil {
+		return result, err
+	}
+
+	attributes := []string{"DEFAULT"}
+	if len(returnFaceAttributes) > 0 {
+		attributes = []string{"ALL"}
+	}
+
+	var detected struct {
+		FaceDetails []RekognitionFaceDetail `json:"FaceDetails"`
+	}
+	if err = a.call(ctx, "DetectFaces", map[string]interface{}{
+		"Image":      rekognitionImage(image),
+		"Attributes": attributes,
+	}, &detected); err != nil {
+		return result, err
+	}
+
+	for _, f := range detected.FaceDetails {
+		face := DetectedFace{
+			FaceRectangle: f.BoundingBox.toRectangle(width, height),
+			FaceAttributes: FaceAttributes{
+				Age:    float64(f.AgeRange.Low+f.AgeRange.High) / 2.0,
+				Gender: strings.ToLower(f.Gender.Value),
+				Smile:  f.Smile.score(),
+				FacialHair: map[string]float64{
+					"beard":     f.Beard.score(),
+					"moustache": f.Mustache.score(),
+				},
+				HeadPose: map[string]float64{
+					"roll":  f.Pose.Roll,
+					"yaw":   f.Pose.Yaw,
+					"pitch": f.Pose.Pitch,
+				},
+				Glasses: "NoGlasses",
+				Emotion: map[string]float64{},
+			},
+		}
+		if f.Sunglasses.Value {
+			face.FaceAttributes.Glasses = "Sunglasses"
+		} else if f.Eyeglasses.Value {
+			face.FaceAttributes.Glasses = "ReadingGlasses"
+		}
+		for _, e := range f.Emotions {
+			if name, exists := rekognitionEmotions[e.Type]; exists {
+				face.FaceAttributes.Emotion[name] = e.Confidence / 100.0
+			}
+		}
+
+		if returnFaceLandmarks {
+			face.FaceLandmarks = map[string]cog.Point{}
+			for _, l := range f.Landmarks {
+				if name, exists := rekognitionLandmarks[l.Type]; exists {
+					face.FaceLandmarks[name] = cog.Point{X: l.X * float64(width), Y: l.Y * float64(height)}
+				}
+			}
+		}
+
+		result = append(result, face)
+	}
+
+	return result, nil
+}
+
+// detect labels on given image bytes
+func (a awsRekognition) detectLabels(ctx context.Context, image []byte) (labels []RekognitionLabel, err error) {
+	var detected struct {
+		Labels []RekognitionLabel `json:"Labels"`
+	}
+	err = a.call(ctx, "DetectLabels", map[string]interface{}{
+		"Image":     rekognitionImage(image),
+		"MaxLabels": rekognitionMaxLabels,
+	}, &detected)
+
+	return detected.Labels, err
+}
+
+// Tag tags given image bytes with labels
+func (a awsRekognition) Tag(ctx context.Context, image []byte) (result TagResult, err error) {
+	labels, err := a.detectLabels(ctx, image)
+	if err != nil {
+		return result, err
+	}
+
+	for _, l := range labels {
+		result.Tags = append(result.Tags, ImageTag{Name: strings.ToLower(l.Name), Confidence: l.Confidence / 100.0})
+	}
+
+	return result, nil
+}
+
+// Analyze analyzes given image bytes
+//
+// (only "Objects" and "Adult" are supported)
+func (a awsRekognition) Analyze(ctx context.Context, image []byte, visualFeatures []string) (result AnalyzeResult, err error) {
+	for _, f := range visualFeatures {
+		switch f {
+		case "Objects":
+			if result.Objects, err = a.detectObjects(ctx, image); err != nil {
+				return result, err
+			}
+		case "Adult":
+			if result.Adult, err = a.detectModerationLabels(ctx, image); err != nil {
+				return result, err
+			}
+		default:
+			return result, unsupportedFeatureError("AWS Rekognition", f)
+		}
+	}
+
+	return result, nil
+}
+
+// detect objects (labels with bounding boxes) on given image bytes
+func (a awsRekognition) detectObjects(ctx context.Context, image []byte) (objects []DetectedObject, err error) {
+	width, height, err := imageSize(image)
+	if err != nil {
+		return objects, err
+	}
+
+	labels, err := a.detectLabels(ctx, image)
+	if err != nil {
+		return objects, err
+	}
+
+	for _, l := range labels {
+		var parent *ObjectParent
+		if len(l.Parents) > 0 {
+			parent = &ObjectParent{Object: strings.ToLower(l.Parents[0].Name)}
+		}
+
+		for _, i := range l.Instances {
+			rect := i.BoundingBox.toRectangle(width, height)
+
+			objects = append(objects, DetectedObject{
+				Rectangle:  ObjectRectangle{X: rect.Left, Y: rect.Top, W: rect.Width, H: rect.Height},
+				Object:     strings.ToLower(l.Name),
+				Confidence: i.Confidence / 100.0,
+				Parent:     parent,
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// detect adult, racy, and violent contents on given image bytes
+func (a awsRekognition) detectModerationLabels(ctx context.Context, image []byte) (adult AdultResult, err error) {
+	var detected struct {
+		ModerationLabels []struct {
+			Name       string  `json:"Name"`
+			ParentName string  `json:"ParentName"`
+			Confidence float64 `json:"Confidence"`
+		} `json:"ModerationLabels"`
+	}
+	if err = a.call(ctx, "DetectModerationLabels", map[string]interface{}{
+		"Image": rekognitionImage(image),
+	}, &detected); err != nil {
+		return adult, err
+	}
+
+	// (only top-level categories)
+	for _, l := range detected.ModerationLabels {
+		if l.ParentName != "" {
+			continue
+		}
+
+		score := l.Confidence / 100.0
+		switch l.Name {
+		case "Explicit Nudity":
+			adult.AdultScore = score
+		case "Suggestive":
+			adult.RacyScore = score
+		case "Violence", "Visually Disturbing":
+			if score > adult.GoreScore {
+				adult.GoreScore = score
+			}
+		}
+	}
+	adult.IsAdultContent = adult.AdultScore >= minFlaggedScore
+	adult.IsRacyContent = adult.RacyScore >= minFlaggedScore
+	adult.IsGoryContent = adult.GoreScore >= minFlaggedScore
+
+	return adult, nil
+}
+
+// Read recognizes texts on given image bytes
+//
+// (it is a synchronous operation, so `progress` is not called)
+func (a awsRekognition) Read(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (result ReadResult, err error) {
+	width, height, err := imageSize(image)
+	if err != nil {
+		return result, err
+	}
+
+	var detected struct {
+		TextDetections []struct {
+			DetectedText string  `json:"DetectedText"`
+			Type         string  `json:"Type"` // "LINE" or "WORD"
+			ID           int     `json:"Id"`
+			ParentID     *int    `json:"ParentId,omitempty"`
+			Confidence   float64 `json:"Confidence"`
+			Geometry     struct {
+				Polygon []cog.Point `json:"Polygon"`
+			} `json:"Geometry"`
+		} `json:"TextDetections"`
+	}
+	if err = a.call(ctx, "DetectText", map[string]interface{}{
+		"Image": rekognitionImage(image),
+	}, &detected); err != nil {
+		return result, err
+	}
+
+	page := ReadPage{
+		Page:   1,
+		Width:  float64(width),
+		Height: float64(height),
+		Unit:   "pixel",
+	}
+
+	// lines first, then their words
+	indices := map[int]int{}
+	for _, t := range detected.TextDetections {
+		if t.Type == "LINE" {
+			indices[t.ID] = len(page.Lines)
+			page.Lines = append(page.Lines, ReadLine{
+				BoundingBox: flattenPoints(denormalizePoints(t.Geometry.Polygon, width, height)),
+				Text:        t.DetectedText,
+			})
+		}
+	}
+	for _, t := range detected.TextDetections {
+		if t.Type == "WORD" && t.ParentID != nil {
+			if index, exists := indices[*t.ParentID]; exists {
+				page.Lines[index].Words = append(page.Lines[index].Words, ReadWord{
+					BoundingBox: flattenPoints(denormalizePoints(t.Geometry.Polygon, width, height)),
+					Text:        t.DetectedText,
+					Confidence:  t.Confidence / 100.0,
+				})
+			}
+		}
+	}
+
+	result.Status = "succeeded"
+	result.AnalyzeResult.ReadResults = []ReadPage{page}
+
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+// functions for scanning business cards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(newCommand(ScanBusinessCard, "SB", handleScanBusinessCard), MediaImage)
+}
+
+// scan a business card on given image bytes, and return its contact
+func handleScanBusinessCard(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := cognitive.AnalyzeForm(ctx, formModelBusinessCard, imageBytes, func(status string, elapsed time.Duration) {
+		if progress != nil {
+			progress(fmt.Sprintf("scanning business card: %s", status))
+		}
+	})
+	if err != nil {
+		return result, fmt.Errorf("Failed to scan business card: %s", err)
+	}
+
+	fields := analyzed.Fields()
+	if len(fields) <= 0 {
+		return result, errors.New("Could not find any business card on given image.")
+	}
+
+	// name
+	var firstName, lastName string
+	if names := fields["ContactNames"].ValueArray; len(names) > 0 {
+		firstName = names[0].ValueObject["FirstName"].String()
+		lastName = names[0].ValueObject["LastName"].String()
+		if firstName == "" && lastName == "" {
+			firstName = names[0].Text
+		}
+	}
+	company := firstValue(fields["CompanyNames"])
+	title := firstValue(fields["JobTitles"])
+	email := firstValue(fields["Emails"])
+	website := firstValue(fields["Websites"])
+	address := firstValue(fields["Addresses"])
+	phone := firstValue(fields["MobilePhones"])
+	if phone == "" {
+		phone = firstValue(fields["WorkPhones"])
+	}
+	if phone == "" {
+		phone = firstValue(fields["OtherPhones"])
+	}
+
+	lines := []string{}
+	for _, l := range []struct {
+		label string
+		value string
+	}{
+		{"Name", strings.TrimSpace(firstName + " " + lastName)},
+		{"Company", company},
+		{"Title", title},
+		{"Phone", phone},
+		{"Email", email},
+		{"Website", website},
+		{"Address", address},
+	} {
+		if l.value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", l.label, l.value))
+		}
+	}
+	if len(lines) <= 0 {
+		return result, errors.New("Could not read any contact from given business card.")
+	}
+	result.Message = strings.Join(lines, "\n")
+
+	card := vCard(firstName, lastName, company, title, phone, email, website, address)
+	result.Attachment = []byte(card)
+
+	// (a Telegram contact needs a phone number and a first name)
+	if phone != "" {
+		if firstName == "" {
+			firstName, lastName = lastName, ""
+		}
+		if firstName == "" {
+			firstName = company
+		}
+		result.Contact = &ContactCard{
+			PhoneNumber: phone,
+			FirstName:   firstName,
+			LastName:    lastName,
+			VCard:       card,
+		}
+	}
+
+	return result, nil
+}
+
+// first value of an array field
+func firstValue(field FormField) string {
+	if len(field.ValueArray) > 0 {
+		return field.ValueArray[0].String()
+	}
+
+	return ""
+}
+
+// generate a vCard (3.0) with given values
+func vCard(firstName, lastName, company, title, phone, email, website, address string) string {
+	escape := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		fmt.Sprintf("N:%s;%s;;;", escape.Replace(lastName), escape.Replace(firstName)),
+		fmt.Sprintf("FN:%s", escape.Replace(strings.TrimSpace(firstName+" "+lastName))),
+	}
+	for _, p := range []struct {
+		property string
+		value    string
+	}{
+		{"ORG", company},
+		{"TITLE", title},
+		{"TEL;TYPE=CELL", phone},
+		{"EMAIL", email},
+		{"URL", website},
+	} {
+		if p.value != "" {
+			lines = append(lines, fmt.Sprintf("%s:%s", p.property, escape.Replace(p.value)))
+		}
+	}
+	if address != "" {
+		// (whole address as a street address)
+		lines = append(lines, fmt.Sprintf("ADR:;;%s;;;;", escape.Replace(address)))
+	}
+	lines = append(lines, "END:VCARD")
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
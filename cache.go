@@ -0,0 +1,36 @@
+package main
+
+// keys of cached results (see internal/storage/cache.go for the cache itself)
+
+import (
+	"fmt"
+
+	// for the result cache
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// ResultCache type for the LRU cache of process results
+type ResultCache = storage.ResultCache
+
+// ResultStore type for persisting cached results
+type ResultStore = storage.ResultStore
+
+// commands whose results should not be cached (eg. results which depend on chats)
+var uncachedCommands = map[CognitiveCommand]bool{}
+
+// generate a cache key for given unique id of file and command
+//
+// (file ids differ for each bot and may change, while unique ids are the same for the same file;
+// returns an empty string for commands which should not be cached)
+func resultCacheKey(fileUniqueID string, command CognitiveCommand) string {
+	if uncachedCommands[command] || fileUniqueID == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s", command, fileUniqueID)
+}
+
+// log failures of the persistent store of the result cache
+func logCacheError(err error) {
+	logger.Error(fmt.Sprintf("Failed to access the persistent result cache: %s", err))
+}
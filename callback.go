@@ -0,0 +1,128 @@
+package main
+
+// functions for signed callback data
+//
+// all callback data are in the format of: "{payload}:{signature}", where signature is a truncated HMAC of the payload,
+// and payloads of commands are in the format of: "{short id of command}:{target}", where target is a token of a file or an album id
+//
+// (file ids are too long to be in callback data which can be 64 bytes at most, so they are saved on the server with short random tokens)
+//
+// (payloads of others are their own, eg. "sentiment", "translate:ko", or "cancel-job")
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// constants for callback data
+const (
+	callbackDataSeparator   = ":"
+	callbackSignatureLength = 8 // max length of callback data is 64 bytes, so keep it short
+
+	callbackTokenBytes = 9 // (12 characters when encoded)
+	callbackTargetTTL  = 30 * 24 * time.Hour
+)
+
+// CallbackTarget type for targets of inline keyboards, which are saved on the server
+type CallbackTarget = storage.CallbackTarget
+
+// key for signing callback data
+//
+// (`callback-secret` of config, or derived from the telegram api token if it is empty)
+func callbackSecret() []byte {
+	if conf().CallbackSecret != "" {
+		return []byte(conf().CallbackSecret)
+	}
+
+	derived := sha256.Sum256([]byte("callback:" + conf().TelegramAPIToken))
+	return derived[:]
+}
+
+// signature of given payload
+func callbackSignature(payload string) string {
+	mac := hmac.New(sha256.New, callbackSecret())
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:callbackSignatureLength]
+}
+
+// generate signed callback data with given payload
+func signCallbackData(payload string) string {
+	return payload + callbackDataSeparator + callbackSignature(payload)
+}
+
+// validate given callback data, and return its payload
+func verifyCallbackData(data string) (payload string, err error) {
+	i := strings.LastIndex(data, callbackDataSeparator)
+	if i < 0 {
+		return "", fmt.Errorf("malformed callback data: %s", data)
+	}
+
+	payload, signature := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(callbackSignature(payload))) {
+		return "", fmt.Errorf("invalid signature of callback data: %s", data)
+	}
+
+	return payload, nil
+}
+
+// generate signed callback data for given command and target
+func genCallbackData(command CognitiveCommand, target string) string {
+	return signCallbackData(shortIDOf(command) + callbackDataSeparator + target)
+}
+
+// parse given payload of (already verified) callback data for a command
+func parseCallbackData(payload string) (command CognitiveCommand, target string, err error) {
+	parts := strings.SplitN(payload, callbackDataSeparator, 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("malformed callback data: %s", payload)
+	}
+
+	var exists bool
+	if command, exists = commandByShortID(parts[0]); !exists {
+		return "", "", fmt.Errorf("unknown command in callback data: %s", payload)
+	}
+
+	return command, parts[1], nil
+}
+
+// save given file id (and its media type) as a target of inline keyboards, and return its token for callback data
+//
+// (keyboards with a token which failed to be saved will be answered as expired)
+func callbackTargetOf(fileID string, media MediaType) (token string) {
+	buf := make([]byte, callbackTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Error(fmt.Sprintf("Failed to generate token of callback target: %s", err))
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+
+	if callbackTargets != nil {
+		if err := callbackTargets.SaveCallbackTarget(token, CallbackTarget{FileID: fileID, Media: media}, callbackTargetTTL); err != nil {
+			logger.Error(fmt.Sprintf("Failed to save callback target: %s", err))
+		}
+	}
+
+	return token
+}
+
+// load the target of inline keyboards with given token
+func loadCallbackTarget(token string) (target CallbackTarget, exists bool) {
+	if callbackTargets == nil {
+		return target, false
+	}
+
+	target, exists, err := callbackTargets.GetCallbackTarget(token)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to load callback target: %s", err))
+	}
+
+	return target, exists
+}
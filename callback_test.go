@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/telegram"
+)
+
+func TestSignCallbackData(t *testing.T) {
+	useConfig(t, Config{})
+
+	signed := signCallbackData("payload:with:separators")
+	if len(signed) > 64 {
+		t.Errorf("signed callback data is longer than 64 bytes: %s", signed)
+	}
+
+	payload, err := verifyCallbackData(signed)
+	if err != nil || payload != "payload:with:separators" {
+		t.Errorf("failed to verify signed callback data: %s, %v", payload, err)
+	}
+}
+
+func TestVerifyTamperedCallbackData(t *testing.T) {
+	useConfig(t, Config{})
+
+	signed := signCallbackData("T:file")
+	signature := signed[strings.LastIndex(signed, callbackDataSeparator)+1:]
+
+	for name, data := range map[string]string{
+		"changed payload":   "F:file" + callbackDataSeparator + signature,
+		"changed signature": "T:file" + callbackDataSeparator + strings.Repeat("A", len(signature)),
+		"no signature":      "T",
+		"empty":             "",
+	} {
+		if _, err := verifyCallbackData(data); err == nil {
+			t.Errorf("callback data with %s was verified", name)
+		}
+	}
+
+	// (signed with another key)
+	useConfig(t, Config{CallbackSecret: "another secret"})
+	if _, err := verifyCallbackData(signed); err == nil {
+		t.Errorf("callback data signed with another key was verified")
+	}
+}
+
+func TestGenCallbackData(t *testing.T) {
+	useConfig(t, Config{})
+
+	payload, err := verifyCallbackData(genCallbackData(Tag, "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command, target, err := parseCallbackData(payload)
+	if err != nil || command != Tag || target != "token" {
+		t.Errorf("wrong parsed callback data: %s, %s, %v", command, target, err)
+	}
+
+	if _, _, err := parseCallbackData("unknown-short-id:target"); err == nil {
+		t.Errorf("callback data of unknown command was parsed")
+	}
+}
+
+func TestGenFileInlineKeyboards(t *testing.T) {
+	useConfig(t, Config{})
+	useDatabase(t)
+
+	// (file ids of Telegram are usually 70 ~ 90 characters long)
+	fileID := "AgACAgUAAxkBAAIBY2Zr0x1abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTU"
+	if len(fileID) != 80 {
+		t.Fatalf("file id for testing should be 80 characters long: %d", len(fileID))
+	}
+
+	for _, row := range genFileInlineKeyboards(MediaImage, fileID) {
+		for _, button := range row {
+			data := *button.CallbackData
+			if len(data) > 64 {
+				t.Errorf("callback data of '%s' is longer than 64 bytes: %s (%d)", button.Text, data, len(data))
+			}
+
+			payload, err := verifyCallbackData(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload == commandCancel {
+				continue
+			}
+
+			_, token, err := parseCallbackData(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target, exists := loadCallbackTarget(token); !exists || target.FileID != fileID {
+				t.Errorf("file id was not saved with the token: %+v, %v", target, exists)
+			}
+		}
+	}
+}
+
+func TestExpiredCallbackTarget(t *testing.T) {
+	useConfig(t, Config{})
+	useDatabase(t)
+
+	mock := telegram.NewMock()
+	processCallbackQuery(context.Background(), mock, newCallbackQuery(1, genCallbackData(Tag, "unknown-token")))
+
+	if edited := mock.CallsOf("EditMessageText"); len(edited) != 1 || edited[0].Text != localize(defaultLanguage, messageKeyboardExpired) {
+		t.Errorf("callback query with an unknown token was not answered as expired: %+v", mock.Calls)
+	}
+	if count, _ := jobQueue.CountQueuedJobs(); count != 0 {
+		t.Errorf("job was queued with an unknown token: %d", count)
+	}
+}
+
+func TestRejectTamperedCallbackQuery(t *testing.T) {
+	useConfig(t, Config{})
+	useDatabase(t)
+
+	mock := telegram.NewMock()
+	if processCallbackQuery(context.Background(), mock, newCallbackQuery(1, "T:file:forged")) {
+		t.Errorf("forged callback query was processed")
+	}
+
+	if len(mock.Calls) != 1 || mock.Calls[0].Method != "AnswerCallbackQuery" {
+		t.Errorf("forged callback query was not only answered: %+v", mock.Calls)
+	}
+}
+
+func TestCallbackWithMediaOfTarget(t *testing.T) {
+	useConfig(t, Config{})
+	database := useDatabase(t)
+
+	mock := telegram.NewMock()
+	mock.Files["sticker-file-id"] = bot.File{FileID: "sticker-file-id"}
+
+	// (message of the keyboard has no text, eg. a caption of media)
+	query := newCallbackQuery(1, genCallbackData(Tag, callbackTargetOf("sticker-file-id", MediaSticker)))
+	if !processCallbackQuery(context.Background(), mock, query) {
+		t.Fatalf("callback query was not processed: %+v", mock.Calls)
+	}
+
+	job, exists, err := database.DequeueJob()
+	if err != nil || !exists {
+		t.Fatalf("job was not queued: %v, %v", exists, err)
+	}
+	if job.Kind != JobKindSticker || job.Command != Tag || len(job.FileIDs) != 1 || job.FileIDs[0] != "sticker-file-id" {
+		t.Errorf("wrong job was queued: %+v", job)
+	}
+}
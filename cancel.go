@@ -0,0 +1,191 @@
+package main
+
+// functions for canceling queued or running jobs from their status messages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for canceling jobs
+const (
+	jobCancelCallback = "cancel-job" // (payload of callback data, which is not for a command)
+
+	cancelRequestPollingInterval = 2 * time.Second // (for jobs canceled on other instances)
+)
+
+// runningJob struct for a job which is being processed
+type runningJob struct {
+	userID int
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// running jobs, keyed by their status messages
+var runningJobs = map[string]runningJob{}
+var runningJobsLock sync.Mutex
+
+// key of a status message
+func statusMessageKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d/%d", chatID, messageID)
+}
+
+// mark given job as running with given context, and return a function for unmarking it
+func startRunningJob(ctx context.Context, job Job) (done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := statusMessageKey(job.ChatID, job.MessageID)
+
+	runningJobsLock.Lock()
+	runningJobs[key] = runningJob{userID: job.UserID, ctx: ctx, cancel: cancel}
+	runningJobsLock.Unlock()
+
+	// (cancel button can be pressed on other instances)
+	if coordinator != nil {
+		go pollCancelRequest(ctx, cancel, job.ChatID, job.MessageID)
+	}
+
+	return func() {
+		runningJobsLock.Lock()
+		delete(runningJobs, key)
+		runningJobsLock.Unlock()
+
+		cancel()
+	}
+}
+
+// cancel the context when canceling the job was requested on another instance
+func pollCancelRequest(ctx context.Context, cancel context.CancelFunc, chatID int64, messageID int) {
+	ticker := time.NewTicker(cancelRequestPollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if requested, err := coordinator.IsCancelRequested(chatID, messageID); err == nil && requested {
+				logger.Info(fmt.Sprintf("Canceling running job of status message %s (requested on another instance)", statusMessageKey(chatID, messageID)))
+
+				cancel()
+				return
+			} else if err != nil {
+				logger.Error(fmt.Sprintf("Failed to check cancel request: %s", err))
+			}
+		}
+	}
+}
+
+// context of the running job with given status message
+//
+// (it will be canceled with the cancel button, and is a background context if there is no such job)
+func jobContext(chatID int64, messageID int) context.Context {
+	runningJobsLock.Lock()
+	defer runningJobsLock.Unlock()
+
+	if job, exists := runningJobs[statusMessageKey(chatID, messageID)]; exists {
+		return job.ctx
+	}
+
+	return context.Background()
+}
+
+// check if given context was canceled with the cancel button
+func isCanceled(ctx context.Context) bool {
+	return ctx.Err() == context.Canceled
+}
+
+// generate inline keyboards for canceling a job on its status message
+func genJobCancelInlineKeyboards() [][]bot.InlineKeyboardButton {
+	data := signCallbackData(jobCancelCallback)
+
+	return [][]bot.InlineKeyboardButton{
+		[]bot.InlineKeyboardButton{
+			bot.InlineKeyboardButton{Text: strings.Title(commandCancel), CallbackData: &data},
+		},
+	}
+}
+
+// check if given callback data is for canceling a job
+func isJobCancelCallback(data string) bool {
+	return data == jobCancelCallback
+}
+
+// process callback query for canceling a job:
+//
+// cancel its context if it is running, or delete it from the queue if it is not started yet
+//
+// (only the user who requested it, or admins can cancel it)
+func processJobCancelCallback(b Messenger, query bot.CallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	userID := query.From.ID
+	language := languageFor(userID)
+
+	options := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}
+
+	// running job
+	runningJobsLock.Lock()
+	job, running := runningJobs[statusMessageKey(chatID, messageID)]
+	runningJobsLock.Unlock()
+	if running {
+		if job.userID != userID && !isAdmin(userID) {
+			return
+		}
+
+		logger.Info(fmt.Sprintf("Canceling running job of status message %s", statusMessageKey(chatID, messageID)))
+
+		// (status message will be deleted by the job, and canceled message will be sent)
+		job.cancel()
+		return
+	}
+
+	// queued job
+	if db != nil {
+		if owner, exists, err := jobQueue.QueuedJobUserID(chatID, messageID); err == nil && exists {
+			if owner != userID && !isAdmin(userID) {
+				return
+			}
+
+			if deleted, err := jobQueue.DeleteQueuedJob(chatID, messageID); err == nil && deleted {
+				b.EditMessageText(localize(language, messageCanceled), options)
+				return
+			} else if err != nil {
+				logger.Error(fmt.Sprintf("Failed to delete queued job: %s", err))
+			}
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get queued job: %s", err))
+		}
+	}
+
+	// job running on another instance
+	if coordinator != nil {
+		if owner, exists, err := coordinator.RunningJobUserID(chatID, messageID); err == nil && exists {
+			if owner != userID && !isAdmin(userID) {
+				return
+			}
+
+			// (status message will be deleted by the job on the instance, and canceled message will be sent)
+			if err := coordinator.RequestCancel(chatID, messageID); err != nil {
+				logger.Error(fmt.Sprintf("Failed to request canceling job: %s", err))
+			} else {
+				return
+			}
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get running job: %s", err))
+		}
+	}
+
+	// (already finished, or being started)
+	b.EditMessageReplyMarkup(options)
+}
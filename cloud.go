@@ -0,0 +1,85 @@
+package main
+
+// hosts of Cognitive Services (and Azure AD) in each Azure cloud
+//
+// (Azure Government and Azure China have their own hosts, which differ from the public cloud)
+
+// names of Azure clouds
+const (
+	azureCloudPublic       = "public"
+	azureCloudUSGovernment = "usgovernment"
+	azureCloudChina        = "china"
+)
+
+// azureCloud struct for hosts of an Azure cloud
+type azureCloud struct {
+	defaultRegion string
+
+	apiURLFormat       string // region
+	sttURLFormat       string // region
+	ttsURLFormat       string // region
+	translatorEndpoint string
+	blobURLFormat      string // storage account
+
+	authorityHost   string // of Azure AD
+	azureADResource string
+}
+
+// known Azure clouds
+var azureClouds = map[string]azureCloud{
+	azureCloudPublic: {
+		defaultRegion:      "westus",
+		apiURLFormat:       "https://%s.api.cognitive.microsoft.com",
+		sttURLFormat:       "https://%s.stt.speech.microsoft.com",
+		ttsURLFormat:       "https://%s.tts.speech.microsoft.com",
+		translatorEndpoint: "https://api.cognitive.microsofttranslator.com",
+		blobURLFormat:      "https://%s.blob.core.windows.net",
+		authorityHost:      "https://login.microsoftonline.com",
+		azureADResource:    "https://cognitiveservices.azure.com",
+	},
+	azureCloudUSGovernment: {
+		defaultRegion:      "usgovvirginia",
+		apiURLFormat:       "https://%s.api.cognitive.microsoft.us",
+		sttURLFormat:       "https://%s.stt.speech.azure.us",
+		ttsURLFormat:       "https://%s.tts.speech.azure.us",
+		translatorEndpoint: "https://api.cognitive.microsofttranslator.us",
+		blobURLFormat:      "https://%s.blob.core.usgovcloudapi.net",
+		authorityHost:      "https://login.microsoftonline.us",
+		azureADResource:    "https://cognitiveservices.azure.us",
+	},
+	azureCloudChina: {
+		defaultRegion:      "chinaeast2",
+		apiURLFormat:       "https://%s.api.cognitive.azure.cn",
+		sttURLFormat:       "https://%s.stt.speech.azure.cn",
+		ttsURLFormat:       "https://%s.tts.speech.azure.cn",
+		translatorEndpoint: "https://api.translator.azure.cn",
+		blobURLFormat:      "https://%s.blob.core.chinacloudapi.cn",
+		authorityHost:      "https://login.chinacloudapi.cn",
+		azureADResource:    "https://cognitiveservices.azure.cn",
+	},
+}
+
+// check if given name is of a known Azure cloud
+func isValidAzureCloud(name string) bool {
+	_, exists := azureClouds[name]
+
+	return exists
+}
+
+// the configured Azure cloud (`azure-cloud`, defaults to the public cloud)
+func currentCloud() azureCloud {
+	if cloud, exists := azureClouds[conf().AzureCloud]; exists {
+		return cloud
+	}
+
+	return azureClouds[azureCloudPublic]
+}
+
+// region of given value, or the default one of the configured cloud if it is empty
+func regionOrDefault(region string) string {
+	if region == "" {
+		return currentCloud().defaultRegion
+	}
+
+	return region
+}
@@ -0,0 +1,815 @@
+package main
+
+// functions for calling MS Cognitive Services APIs with image bytes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// constants for MS Cognitive Services APIs
+const (
+	faceAPIPath        = "/face/v1.0"
+	computervisionPath = "/vision/v1.0"
+	readAPIPath        = "/vision/v3.0/read"
+
+	asyncOperationPollingIntervalSeconds = 1
+	asyncOperationMaxPollingCount        = 30
+)
+
+// APIError struct for unsuccessful responses from APIs
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error returns the status code and body of the response
+func (e APIError) Error() string {
+	return fmt.Sprintf("HTTP %d (%s)", e.StatusCode, e.Body)
+}
+
+// DetectedFace struct for the result of face detection
+type DetectedFace struct {
+	FaceID         string               `json:"faceId,omitempty"`
+	FaceRectangle  cog.Rectangle        `json:"faceRectangle"`
+	FaceLandmarks  map[string]cog.Point `json:"faceLandmarks,omitempty"`
+	FaceAttributes FaceAttributes       `json:"faceAttributes,omitempty"`
+}
+
+// FaceAttributes struct
+type FaceAttributes struct {
+	Age        float64            `json:"age,omitempty"`
+	Gender     string             `json:"gender,omitempty"`
+	Smile      float64            `json:"smile,omitempty"`
+	FacialHair map[string]float64 `json:"facialHair,omitempty"`
+	HeadPose   map[string]float64 `json:"headPose,omitempty"`
+	Glasses    string             `json:"glasses,omitempty"`
+	Emotion    map[string]float64 `json:"emotion,omitempty"`
+}
+
+// VerifyResult struct for the result of face verification
+type VerifyResult struct {
+	IsIdentical bool    `json:"isIdentical"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// IdentifyResult struct for the result of face identification
+type IdentifyResult struct {
+	FaceID     string `json:"faceId"`
+	Candidates []struct {
+		PersonID   string  `json:"personId"`
+		Confidence float64 `json:"confidence"`
+	} `json:"candidates"`
+}
+
+// FaceList struct for a face list and its persisted faces
+type FaceList struct {
+	FaceListID     string `json:"faceListId"`
+	Name           string `json:"name"`
+	PersistedFaces []struct {
+		PersistedFaceID string `json:"persistedFaceId"`
+		UserData        string `json:"userData,omitempty"`
+	} `json:"persistedFaces"`
+}
+
+// CelebritiesResult struct for the result of celebrity recognition
+type CelebritiesResult struct {
+	Result struct {
+		Celebrities []struct {
+			Name          string        `json:"name"`
+			Confidence    float64       `json:"confidence"`
+			FaceRectangle cog.Rectangle `json:"faceRectangle"`
+		} `json:"celebrities"`
+	} `json:"result"`
+}
+
+// SimilarFace struct for a similar face found in a face list
+type SimilarFace struct {
+	PersistedFaceID string  `json:"persistedFaceId"`
+	Confidence      float64 `json:"confidence"`
+}
+
+// DescribeResult struct for the result of image description
+type DescribeResult struct {
+	Description struct {
+		Tags     []string `json:"tags"`
+		Captions []struct {
+			Text       string  `json:"text"`
+			Confidence float64 `json:"confidence"`
+		} `json:"captions"`
+	} `json:"description"`
+}
+
+// TagResult struct for the result of image tagging
+type TagResult struct {
+	Tags []ImageTag `json:"tags"`
+}
+
+// ImageTag struct for a tag of an image
+type ImageTag struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// AnalyzeResult struct for the result of image analysis
+//
+// (only the requested visual features are filled)
+type AnalyzeResult struct {
+	Adult     AdultResult      `json:"adult"`
+	Objects   []DetectedObject `json:"objects"`
+	Color     ColorResult      `json:"color"`
+	ImageType ImageTypeResult  `json:"imageType"`
+}
+
+// ImageTypeResult struct for the type of an image
+type ImageTypeResult struct {
+	ClipArtType     int `json:"clipArtType"`     // 0: non-clip-art, 1: ambiguous, 2: normal-clip-art, 3: good-clip-art
+	LineDrawingType int `json:"lineDrawingType"` // 0: non-line-drawing, 1: line-drawing
+}
+
+// ColorResult struct for colors of an image
+type ColorResult struct {
+	DominantColorForeground string   `json:"dominantColorForeground"`
+	DominantColorBackground string   `json:"dominantColorBackground"`
+	DominantColors          []string `json:"dominantColors"`
+	AccentColor             string   `json:"accentColor"` // hex code (eg. "C8A216")
+	IsBWImg                 bool     `json:"isBwImg"`
+}
+
+// AdultResult struct for adult, racy, and gory contents
+type AdultResult struct {
+	IsAdultContent bool    `json:"isAdultContent"`
+	IsRacyContent  bool    `json:"isRacyContent"`
+	IsGoryContent  bool    `json:"isGoryContent"`
+	AdultScore     float64 `json:"adultScore"`
+	RacyScore      float64 `json:"racyScore"`
+	GoreScore      float64 `json:"goreScore"`
+}
+
+// DetectedObject struct for a detected object
+type DetectedObject struct {
+	Rectangle  ObjectRectangle `json:"rectangle"`
+	Object     string          `json:"object"`
+	Confidence float64         `json:"confidence"`
+	Parent     *ObjectParent   `json:"parent,omitempty"`
+}
+
+// ObjectParent struct for the parent (more generic) object of a detected object
+type ObjectParent struct {
+	Object     string        `json:"object"`
+	Confidence float64       `json:"confidence"`
+	Parent     *ObjectParent `json:"parent,omitempty"`
+}
+
+// ObjectRectangle struct for the bounding box of a detected object
+type ObjectRectangle struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// convert to a rectangle for drawing
+func (r ObjectRectangle) toRectangle() cog.Rectangle {
+	return cog.Rectangle{Left: r.X, Top: r.Y, Width: r.W, Height: r.H}
+}
+
+// ReadResult struct for the result of Read API
+type ReadResult struct {
+	Status        string `json:"status"`
+	AnalyzeResult struct {
+		ReadResults []ReadPage `json:"readResults"`
+	} `json:"analyzeResult"`
+}
+
+// ReadPage struct
+type ReadPage struct {
+	Page   int        `json:"page"`
+	Angle  float64    `json:"angle"` // in degrees, clockwise
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Unit   string     `json:"unit"`
+	Lines  []ReadLine `json:"lines"`
+}
+
+// ReadLine struct
+type ReadLine struct {
+	BoundingBox []float64  `json:"boundingBox"` // 4 points (x1, y1, ..., x4, y4) clockwise from top-left
+	Text        string     `json:"text"`
+	Words       []ReadWord `json:"words"`
+}
+
+// ReadWord struct
+type ReadWord struct {
+	BoundingBox []float64 `json:"boundingBox"`
+	Text        string    `json:"text"`
+	Confidence  float64   `json:"confidence"`
+}
+
+// Text returns recognized lines of all pages, in reading order
+func (r ReadResult) Text() string {
+	lines := []string{}
+	for _, page := range r.AnalyzeResult.ReadResults {
+		for _, line := range page.Lines {
+			lines = append(lines, line.Text)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// base url of Face API
+func faceAPIURL() string {
+	return serviceAPIURL(conf().MsFaceEndpoint, conf().MsFaceRegion, faceAPIPath)
+}
+
+// base url of Computer Vision API
+func computervisionAPIURL() string {
+	return serviceAPIURL(conf().MsComputervisionEndpoint, conf().MsComputervisionRegion, computervisionPath)
+}
+
+// build up base url of an API with given endpoint or region
+//
+// (endpoint has precedence over region, and region is of the configured cloud)
+func serviceAPIURL(endpoint, region, path string) string {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf(currentCloud().apiURLFormat, regionOrDefault(region))
+	}
+
+	return strings.TrimRight(endpoint, "/") + path
+}
+
+// detect faces on given image bytes
+func detectFacesBytes(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) (result []DetectedFace, err error) {
+	params := url.Values{}
+	params.Set("returnFaceId", fmt.Sprintf("%t", returnFaceID))
+	params.Set("returnFaceLandmarks", fmt.Sprintf("%t", returnFaceLandmarks))
+	if len(returnFaceAttributes) > 0 {
+		params.Set("returnFaceAttributes", strings.Join(returnFaceAttributes, ","))
+	}
+
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/detect?%s", faceAPIURL(), params.Encode()),
+		conf().MsFaceSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// verify if two detected faces belong to the same person
+func verifyFaces(ctx context.Context, faceID1, faceID2 string) (result VerifyResult, err error) {
+	var data []byte
+	if data, err = json.Marshal(map[string]string{
+		"faceId1": faceID1,
+		"faceId2": faceID2,
+	}); err != nil {
+		return result, err
+	}
+
+	err = postBytes(
+		ctx,
+		fmt.Sprintf("%s/verify", faceAPIURL()),
+		conf().MsFaceSubscriptionKey,
+		"application/json",
+		data,
+		&result,
+	)
+
+	return result, err
+}
+
+// create a person group with given id
+//
+// (succeeds if it already exists)
+func createPersonGroup(ctx context.Context, personGroupID string) error {
+	err := requestJSON(
+		ctx,
+		"PUT",
+		fmt.Sprintf("%s/persongroups/%s", faceAPIURL(), personGroupID),
+		conf().MsFaceSubscriptionKey,
+		map[string]string{"name": personGroupID},
+		nil,
+	)
+
+	if apiErr, ok := err.(APIError); ok && apiErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+
+	return err
+}
+
+// delete a person group with given id, and all persons in it
+//
+// (succeeds if it does not exist)
+func deletePersonGroup(ctx context.Context, personGroupID string) error {
+	return deleteResource(ctx, fmt.Sprintf("%s/persongroups/%s", faceAPIURL(), personGroupID), conf().MsFaceSubscriptionKey)
+}
+
+// create a person with given name in a person group, and return its id
+func createPerson(ctx context.Context, personGroupID, name string) (personID string, err error) {
+	var result struct {
+		PersonID string `json:"personId"`
+	}
+
+	// (retrying it may create duplicated persons)
+	err = requestJSON(
+		withNonIdempotent(ctx),
+		"POST",
+		fmt.Sprintf("%s/persongroups/%s/persons", faceAPIURL(), personGroupID),
+		conf().MsFaceSubscriptionKey,
+		map[string]string{"name": name},
+		&result,
+	)
+
+	return result.PersonID, err
+}
+
+// add a face on given image bytes to a person
+//
+// (`targetFace` is needed when there are multiple faces on the image)
+func addPersonFace(ctx context.Context, personGroupID, personID string, image []byte, targetFace cog.Rectangle) error {
+	params := url.Values{}
+	params.Set("targetFace", fmt.Sprintf("%d,%d,%d,%d", targetFace.Left, targetFace.Top, targetFace.Width, targetFace.Height))
+
+	// (retrying it may add duplicated faces)
+	return postImageBytes(
+		withNonIdempotent(ctx),
+		fmt.Sprintf("%s/persongroups/%s/persons/%s/persistedFaces?%s", faceAPIURL(), personGroupID, personID, params.Encode()),
+		conf().MsFaceSubscriptionKey,
+		image,
+		nil,
+	)
+}
+
+// start training a person group
+func trainPersonGroup(ctx context.Context, personGroupID string) error {
+	return postBytes(
+		ctx,
+		fmt.Sprintf("%s/persongroups/%s/train", faceAPIURL(), personGroupID),
+		conf().MsFaceSubscriptionKey,
+		"application/json",
+		nil,
+		nil,
+	)
+}
+
+// identify detected faces with persons in a person group
+//
+// (up to 10 faces at once)
+func identifyFaces(ctx context.Context, personGroupID string, faceIDs []string) (result []IdentifyResult, err error) {
+	err = requestJSON(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s/identify", faceAPIURL()),
+		conf().MsFaceSubscriptionKey,
+		map[string]interface{}{
+			"personGroupId":              personGroupID,
+			"faceIds":                    faceIDs,
+			"maxNumOfCandidatesReturned": 1,
+		},
+		&result,
+	)
+
+	return result, err
+}
+
+// create a face list with given id (no error if it already exists)
+func createFaceList(ctx context.Context, faceListID string) error {
+	err := requestJSON(
+		ctx,
+		"PUT",
+		fmt.Sprintf("%s/facelists/%s", faceAPIURL(), faceListID),
+		conf().MsFaceSubscriptionKey,
+		map[string]string{"name": faceListID},
+		nil,
+	)
+
+	if apiErr, ok := err.(APIError); ok && apiErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+
+	return err
+}
+
+// delete a face list with given id, and all faces in it (no error if it does not exist)
+func deleteFaceList(ctx context.Context, faceListID string) error {
+	return deleteResource(ctx, fmt.Sprintf("%s/facelists/%s", faceAPIURL(), faceListID), conf().MsFaceSubscriptionKey)
+}
+
+// add a face on given image bytes to a face list, and return its persisted id
+//
+// (`targetFace` is needed when there are multiple faces on the image, and `userData` is optional)
+func addFaceListFace(ctx context.Context, faceListID string, image []byte, targetFace cog.Rectangle, userData string) (persistedFaceID string, err error) {
+	var result struct {
+		PersistedFaceID string `json:"persistedFaceId"`
+	}
+
+	params := url.Values{}
+	params.Set("targetFace", fmt.Sprintf("%d,%d,%d,%d", targetFace.Left, targetFace.Top, targetFace.Width, targetFace.Height))
+	if userData != "" {
+		params.Set("userData", userData)
+	}
+
+	// (retrying it may add duplicated faces)
+	err = postImageBytes(
+		withNonIdempotent(ctx),
+		fmt.Sprintf("%s/facelists/%s/persistedfaces?%s", faceAPIURL(), faceListID, params.Encode()),
+		conf().MsFaceSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result.PersistedFaceID, err
+}
+
+// get a face list with its persisted faces
+func getFaceList(ctx context.Context, faceListID string) (result FaceList, err error) {
+	err = getJSON(
+		ctx,
+		fmt.Sprintf("%s/facelists/%s", faceAPIURL(), faceListID),
+		conf().MsFaceSubscriptionKey,
+		&result,
+	)
+
+	return result, err
+}
+
+// find faces in a face list which are similar to a detected face
+//
+// (`mode` is "matchPerson" for the same person, or "matchFace" for just similar-looking faces)
+func findSimilarFaces(ctx context.Context, faceID, faceListID string, maxCandidates int, mode string) (result []SimilarFace, err error) {
+	err = requestJSON(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s/findsimilars", faceAPIURL()),
+		conf().MsFaceSubscriptionKey,
+		map[string]interface{}{
+			"faceId":                     faceID,
+			"faceListId":                 faceListID,
+			"maxNumOfCandidatesReturned": maxCandidates,
+			"mode":                       mode,
+		},
+		&result,
+	)
+
+	return result, err
+}
+
+// recognize celebrities on given image bytes
+func recognizeCelebrities(ctx context.Context, image []byte) (result CelebritiesResult, err error) {
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/models/celebrities/analyze", computervisionAPIURL()),
+		conf().MsComputervisionSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// describe given image bytes
+func describeBytes(ctx context.Context, image []byte, maxCandidates int) (result DescribeResult, err error) {
+	params := url.Values{}
+	if maxCandidates > 0 {
+		params.Set("maxCandidates", fmt.Sprintf("%d", maxCandidates))
+	}
+
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/describe?%s", computervisionAPIURL(), params.Encode()),
+		conf().MsComputervisionSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// tag given image bytes
+func tagBytes(ctx context.Context, image []byte) (result TagResult, err error) {
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/tag", computervisionAPIURL()),
+		conf().MsComputervisionSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// analyze given image bytes with visual features (eg. "Adult")
+func analyzeBytes(ctx context.Context, image []byte, visualFeatures []string) (result AnalyzeResult, err error) {
+	params := url.Values{}
+	params.Set("visualFeatures", strings.Join(visualFeatures, ","))
+
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/analyze?%s", computervisionAPIURL(), params.Encode()),
+		conf().MsComputervisionSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// generate a smart-cropped thumbnail of given image bytes with width and height (up to 1024 pixels),
+// and return its bytes
+func generateThumbnail(ctx context.Context, image []byte, width, height int) (thumbnail []byte, err error) {
+	params := url.Values{}
+	params.Set("width", fmt.Sprintf("%d", width))
+	params.Set("height", fmt.Sprintf("%d", height))
+	params.Set("smartCropping", "true")
+
+	resp, err := doRequest(ctx, "POST", fmt.Sprintf("%s/generateThumbnail?%s", computervisionAPIURL(), params.Encode()), conf().MsComputervisionSubscriptionKey, "application/octet-stream", image)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, nil
+}
+
+// base url of Read API
+func readAPIURL() string {
+	return serviceAPIURL(conf().MsComputervisionEndpoint, conf().MsComputervisionRegion, readAPIPath)
+}
+
+// recognize printed and handwritten text on given image bytes with Read API
+//
+// (it is an asynchronous operation, so the result will be polled until it succeeds,
+// and `progress` will be called with the status and elapsed time on each polling)
+func readBytes(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (result ReadResult, err error) {
+	var operationURL string
+	if operationURL, err = postImageBytesAsync(
+		ctx,
+		fmt.Sprintf("%s/analyze", readAPIURL()),
+		conf().MsComputervisionSubscriptionKey,
+		image,
+	); err != nil {
+		return result, err
+	}
+
+	started := time.Now()
+	for i := 0; i < asyncOperationMaxPollingCount; i++ {
+		if err = sleep(ctx, asyncOperationPollingIntervalSeconds*time.Second); err != nil {
+			return result, err
+		}
+
+		if err = getJSON(withPolling(ctx), operationURL, conf().MsComputervisionSubscriptionKey, &result); err != nil {
+			return result, err
+		}
+
+		switch strings.ToLower(result.Status) {
+		case "succeeded":
+			return result, nil
+		case "failed":
+			return result, fmt.Errorf("operation failed")
+		}
+
+		if progress != nil {
+			progress(result.Status, time.Since(started))
+		}
+	}
+
+	return result, fmt.Errorf("operation timed out")
+}
+
+// post image bytes to given API url, and unmarshal the response into `out`
+func postImageBytes(ctx context.Context, apiURL, subscriptionKey string, image []byte, out interface{}) error {
+	return postBytes(ctx, apiURL, subscriptionKey, "application/octet-stream", image, out)
+}
+
+// post bytes to given API url, and unmarshal the response into `out`
+func postBytes(ctx context.Context, apiURL, subscriptionKey, contentType string, data []byte, out interface{}) error {
+	resp, err := doRequest(ctx, "POST", apiURL, subscriptionKey, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readJSON(resp, out)
+}
+
+// post image bytes to given API url for an asynchronous operation, and return the url of the operation
+func postImageBytesAsync(ctx context.Context, apiURL, subscriptionKey string, image []byte) (operationURL string, err error) {
+	resp, err := doRequest(ctx, "POST", apiURL, subscriptionKey, "application/octet-stream", image)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("HTTP %d (%s)", resp.StatusCode, string(body))
+	}
+
+	if operationURL = resp.Header.Get("Operation-Location"); operationURL == "" {
+		return "", fmt.Errorf("no operation location in the response")
+	}
+
+	return operationURL, nil
+}
+
+// get JSON from given API url, and unmarshal it into `out`
+func getJSON(ctx context.Context, apiURL, subscriptionKey string, out interface{}) error {
+	resp, err := doRequest(ctx, "GET", apiURL, subscriptionKey, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readJSON(resp, out)
+}
+
+// send a request to given API url
+//
+// (throttled or failed requests will be retried with backoff, as configured)
+func doRequest(ctx context.Context, method, apiURL, subscriptionKey, contentType string, data []byte) (resp *http.Response, err error) {
+	return doRequestWithHeaders(ctx, method, apiURL, map[string]string{
+		"Ocp-Apim-Subscription-Key": subscriptionKey,
+	}, contentType, data)
+}
+
+// send a request with given headers to given API url
+//
+// (throttled or failed requests will be retried with backoff, as configured,
+// but requests with contexts from `withNonIdempotent` are retried only when they failed before being processed)
+func doRequestWithHeaders(ctx context.Context, method, apiURL string, headers map[string]string, contentType string, data []byte) (resp *http.Response, err error) {
+	reportCallStarted(ctx)
+	defer reportCallFinished(ctx)
+
+	// (query strings are not traced, for they may contain keys)
+	ctx, span := startSpan(ctx, fmt.Sprintf("%s %s", method, serviceOrHostOf(apiURL)), spanKindClient)
+	if u, err := url.Parse(apiURL); err == nil {
+		span.setAttribute("server.address", u.Host)
+		span.setAttribute("url.path", u.Path)
+	}
+	span.setAttribute("http.request.method", method)
+	defer func() {
+		if err == nil {
+			span.setAttribute("http.response.status_code", resp.StatusCode)
+			if resp.StatusCode >= 400 {
+				span.finish(fmt.Errorf("HTTP %d", resp.StatusCode))
+				return
+			}
+		}
+		span.finish(err)
+	}()
+
+	// (for budgets of transactions, and daily summaries)
+	defer func() {
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			// (polling results of asynchronous operations is not billed)
+			if !isPolling(ctx) {
+				countTransaction(apiURL)
+			}
+		} else if ctx.Err() == nil {
+			countServiceError(apiURL)
+		}
+	}()
+
+	service := serviceOfURL(apiURL)
+	failovers := 0
+
+	for attempt := 1; ; attempt++ {
+		// (fail over to other keys of the service, if there are any)
+		requestHeaders, keyIndex := withActiveKey(service, apiURL, headers)
+
+		// (or authenticate with Azure AD, if configured)
+		if requestHeaders, err = withAzureADToken(ctx, service, requestHeaders); err != nil {
+			return nil, err
+		}
+
+		var body io.Reader
+		if data != nil {
+			body = bytes.NewReader(data)
+		}
+
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, method, apiURL, body); err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range requestHeaders {
+			req.Header.Set(k, v)
+		}
+
+		resp, err = azureHTTPClient().Do(req)
+		if err == nil && keyIndex >= 0 && isKeyRejected(resp) {
+			if numKeys := len(keysOf(service, "")); failovers < numKeys-1 {
+				failovers++
+				rotateKey(service, keyIndex, numKeys)
+
+				// drain and close the body, then retry with the next key right away
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				attempt--
+				continue
+			}
+		}
+		if err == nil {
+			saveOperationKey(service, resp, requestHeaders)
+		}
+		if !shouldRetry(ctx, resp, err) || attempt >= conf().RetryMaxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		if err == nil {
+			logger.Warn(fmt.Sprintf("Request failed with HTTP %d, retrying in %s (%d/%d)", resp.StatusCode, delay, attempt, conf().RetryMaxAttempts))
+
+			// drain and close the body for reusing the connection
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			logger.Warn(fmt.Sprintf("Request failed with error: %s, retrying in %s (%d/%d)", err, delay, attempt, conf().RetryMaxAttempts))
+		}
+
+		if err = sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// read JSON from given response, and unmarshal it into `out`
+func readJSON(resp *http.Response, out interface{}) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// (for developer mode)
+	recordRawResponse(resp, body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// some APIs respond with empty bodies
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// delete a resource at given API url
+//
+// (succeeds if it does not exist)
+func deleteResource(ctx context.Context, apiURL, subscriptionKey string) error {
+	resp, err := doRequest(ctx, "DELETE", apiURL, subscriptionKey, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readJSON(resp, nil)
+	if apiErr, ok := err.(APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// send JSON to given API url, and unmarshal the response into `out`
+func requestJSON(ctx context.Context, method, apiURL, subscriptionKey string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	resp, err := doRequest(ctx, method, apiURL, subscriptionKey, "application/json", data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readJSON(resp, out)
+}
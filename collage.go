@@ -0,0 +1,129 @@
+package main
+
+// functions for generating a collage (contact sheet) of detected faces
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+	"github.com/golang/freetype"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// constants for face collages
+const (
+	collageTileSize        = 256 // width and height of each face
+	collageCaptionLines    = 3
+	collageFontSize        = 20.0
+	collagePadding         = 8
+	collageFaceMarginRatio = 0.2
+)
+
+func init() {
+	registerCommand(newCommand(FaceCollage, "FG", handleFaceCollage), MediaImage, MediaVideo)
+}
+
+// build a grid of detected faces on given image bytes, with their indices and attributes beneath each of them
+func handleFaceCollage(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	faces, err := visionFor(FaceCollage).DetectFaces(ctx, imageBytes, false, false, []string{"age", "gender", "emotion"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// layout of tiles
+	columns := int(math.Ceil(math.Sqrt(float64(len(faces)))))
+	rows := (len(faces) + columns - 1) / columns
+	lineHeight := int(collageFontSize * 1.2)
+	tileWidth := collageTileSize + collagePadding*2
+	tileHeight := collageTileSize + lineHeight*collageCaptionLines + collagePadding*2
+
+	collage := image.NewRGBA(image.Rect(0, 0, tileWidth*columns, tileHeight*rows))
+	draw.Draw(collage, collage.Bounds(), image.White, image.Point{}, draw.Src)
+
+	fc := freetype.NewContext()
+	fc.SetFont(loaded().font)
+	fc.SetDPI(72)
+	fc.SetClip(collage.Bounds())
+	fc.SetDst(collage)
+	fc.SetSrc(image.Black)
+	fc.SetFontSize(collageFontSize)
+
+	g := gift.New(
+		gift.Resize(collageTileSize, collageTileSize, gift.LinearResampling),
+	)
+	for i, f := range faces {
+		left := (i%columns)*tileWidth + collagePadding
+		top := (i/columns)*tileHeight + collagePadding
+
+		// face (cropped as a square)
+		g.DrawAt(
+			collage,
+			cropFace(img, squareRectangle(f.FaceRectangle), collageFaceMarginRatio),
+			image.Pt(left, top),
+			gift.CopyOperator,
+		)
+
+		// captions
+		for j, caption := range faceCaptions(i, f.FaceAttributes) {
+			if _, err := fc.DrawString(caption, freetype.Pt(left, top+collageTileSize+lineHeight*(j+1))); err != nil {
+				logger.Error(fmt.Sprintf("Failed to draw string: %s", err))
+			}
+		}
+	}
+
+	if result.Image, err = encodeImage(collage); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// square rectangle which has the same center as given one
+func squareRectangle(rect cog.Rectangle) cog.Rectangle {
+	size := rect.Width
+	if rect.Height > size {
+		size = rect.Height
+	}
+
+	return cog.Rectangle{
+		Left:   rect.Left + rect.Width/2 - size/2,
+		Top:    rect.Top + rect.Height/2 - size/2,
+		Width:  size,
+		Height: size,
+	}
+}
+
+// captions of a face (attributes which were not detected are omitted)
+func faceCaptions(index int, attributes FaceAttributes) []string {
+	captions := []string{fmt.Sprintf("Face #%d", index+1)}
+
+	if attributes.Age > 0 && attributes.Gender != "" {
+		captions = append(captions, fmt.Sprintf("%.0f, %s", attributes.Age, attributes.Gender))
+	} else if attributes.Age > 0 {
+		captions = append(captions, fmt.Sprintf("%.0f", attributes.Age))
+	} else if attributes.Gender != "" {
+		captions = append(captions, attributes.Gender)
+	}
+
+	if len(attributes.Emotion) > 0 {
+		captions = append(captions, strongestEmotion(attributes.Emotion))
+	}
+
+	return captions
+}
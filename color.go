@@ -0,0 +1,139 @@
+package main
+
+// functions for analyzing colors of images
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// constants for palette images
+const (
+	paletteSwatchWidth  = 120
+	paletteSwatchHeight = 120
+)
+
+// colors for the names of dominant colors in Computer Vision API
+var namedColors = map[string]color.RGBA{
+	"black":  {0, 0, 0, 255},
+	"blue":   {0, 0, 255, 255},
+	"brown":  {139, 69, 19, 255},
+	"gray":   {128, 128, 128, 255},
+	"grey":   {128, 128, 128, 255},
+	"green":  {0, 128, 0, 255},
+	"orange": {255, 165, 0, 255},
+	"pink":   {255, 192, 203, 255},
+	"purple": {128, 0, 128, 255},
+	"red":    {255, 0, 0, 255},
+	"teal":   {0, 128, 128, 255},
+	"white":  {255, 255, 255, 255},
+	"yellow": {255, 255, 0, 255},
+}
+
+func init() {
+	registerCommand(newCommand(ColorAnalysis, "CA", handleColorAnalysis), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+}
+
+// analyze colors of given image bytes, and generate a palette image of them
+func handleColorAnalysis(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := cognitive.Analyze(ctx, imageBytes, []string{"Color"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to analyze colors: %s", err)
+	}
+	c := analyzed.Color
+
+	isBW := "No"
+	if c.IsBWImg {
+		isBW = "Yes"
+	}
+	result.Message = fmt.Sprintf(`Foreground: %s
+Background: %s
+Dominant colors: %s
+Accent color: #%s
+Black & white: %s`,
+		c.DominantColorForeground,
+		c.DominantColorBackground,
+		strings.Join(c.DominantColors, ", "),
+		c.AccentColor,
+		isBW,
+	)
+
+	// palette: accent color, then dominant colors
+	palette := []color.RGBA{}
+	if accent, ok := parseHexColor(c.AccentColor); ok {
+		palette = append(palette, accent)
+	}
+	for _, name := range c.DominantColors {
+		if named, exists := namedColors[strings.ToLower(name)]; exists {
+			palette = append(palette, named)
+		}
+	}
+	if len(palette) > 0 {
+		if result.Image, err = encodeImage(paletteImage(palette)); err != nil {
+			return result, fmt.Errorf("Failed to encode image: %s", err)
+		}
+	}
+
+	return result, nil
+}
+
+// generate a strip image of given colors
+func paletteImage(palette []color.RGBA) *image.RGBA {
+	return imaging.Palette(palette, paletteSwatchWidth, paletteSwatchHeight)
+}
+
+// load colors of annotations and the mask color from given hex codes or names, or the default ones if they are empty
+func loadColors(palette []string, mask string) (loadedColors []color.RGBA, loadedMaskColor color.RGBA, err error) {
+	loadedColors, loadedMaskColor = defaultColors, defaultMaskColor
+
+	if len(palette) > 0 {
+		loadedColors = []color.RGBA{}
+		for _, p := range palette {
+			if c, ok := parseColor(p); ok {
+				loadedColors = append(loadedColors, c)
+			} else {
+				return nil, loadedMaskColor, fmt.Errorf("invalid annotation color '%s'", p)
+			}
+		}
+	}
+
+	if mask != "" {
+		var ok bool
+		if loadedMaskColor, ok = parseColor(mask); !ok {
+			return nil, loadedMaskColor, fmt.Errorf("invalid mask color '%s'", mask)
+		}
+	}
+
+	return loadedColors, loadedMaskColor, nil
+}
+
+// parse given hex code (eg. "#C8A216") or name (eg. "yellow") of a color
+func parseColor(value string) (c color.RGBA, ok bool) {
+	if c, ok = namedColors[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return c, true
+	}
+
+	return parseHexColor(strings.TrimSpace(value))
+}
+
+// parse given hex code of a color (eg. "C8A216")
+func parseHexColor(hex string) (c color.RGBA, ok bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return c, false
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return c, false
+	}
+
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 255}, true
+}
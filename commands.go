@@ -0,0 +1,170 @@
+package main
+
+// command registry
+//
+// each command is implemented in its own file, and registers itself in `init()` with `registerCommand`:
+//
+//	func init() {
+//		registerCommand(newCommand("My Command", "X", handleMyCommand), MediaImage, MediaVideo, MediaAlbum)
+//	}
+//
+// (commands and the registry themselves are in internal/commands, and this file adds what depends on the config)
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	// for commands and their registry
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// MediaType type for the kind of media which commands can process
+type MediaType = commands.MediaType
+
+// media types
+const (
+	MediaImage   = commands.MediaImage
+	MediaVideo   = commands.MediaVideo // (processed with its representative frame)
+	MediaAlbum   = commands.MediaAlbum // (each image is processed one by one)
+	MediaSticker = commands.MediaSticker
+	MediaAudio   = commands.MediaAudio
+	MediaPDF     = commands.MediaPDF
+)
+
+// CommandHandler type for functions which process given media bytes
+//
+// (`progress` will be called with progress messages of slow operations, if it is not nil)
+type CommandHandler = commands.Handler
+
+// Command interface for commands
+type Command = commands.Command
+
+// create a new command with given name, short id, and handler function
+func newCommand(name CognitiveCommand, shortID string, handler CommandHandler) Command {
+	return commands.New(name, shortID, handler)
+}
+
+// key type for values in contexts
+type contextKey string
+
+// context keys
+const (
+	contextKeyChatID contextKey = "chat-id"
+	contextKeyFileID contextKey = "file-id"
+
+	contextKeySelectedFaces contextKey = "selected-faces"
+	contextKeyRawResponses  contextKey = "raw-responses"
+	contextKeyProgress      contextKey = "progress"
+)
+
+// return a new context with given chat id, for commands which depend on chats
+func withChatID(ctx context.Context, chatID int64) context.Context {
+	return context.WithValue(ctx, contextKeyChatID, chatID)
+}
+
+// get chat id from given context
+func chatIDFromContext(ctx context.Context) (chatID int64, exists bool) {
+	chatID, exists = ctx.Value(contextKeyChatID).(int64)
+	return chatID, exists
+}
+
+// return a new context with given file id, for commands which refer to the original file
+func withFileID(ctx context.Context, fileID string) context.Context {
+	return context.WithValue(ctx, contextKeyFileID, fileID)
+}
+
+// get file id from given context
+func fileIDFromContext(ctx context.Context) (fileID string, exists bool) {
+	fileID, exists = ctx.Value(contextKeyFileID).(string)
+	return fileID, exists
+}
+
+// registered commands
+//
+// (short ids cannot contain the separator of callback data)
+var registry = commands.NewRegistry(callbackDataSeparator)
+
+// register a command for given media types
+//
+// (panics if its name or short id is duplicated)
+func registerCommand(command Command, media ...MediaType) {
+	registry.Register(command, media...)
+}
+
+// check if given command is registered
+func isRegisteredCommand(command CognitiveCommand) bool {
+	_, exists := registry.Lookup(command)
+	return exists
+}
+
+// names of commands for given media type
+//
+// (disabled commands are excluded)
+func commandsFor(media MediaType) []CognitiveCommand {
+	return registry.For(media, isDisabledCommand)
+}
+
+// label of the button of given command (`command-labels`, or its name)
+func labelOf(command CognitiveCommand) string {
+	if label, exists := conf().CommandLabels[command]; exists && label != "" {
+		return label
+	}
+
+	return string(command)
+}
+
+// check if given command is disabled with `disabled-commands`
+func isDisabledCommand(command CognitiveCommand) bool {
+	for _, c := range conf().DisabledCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// get command with given short id
+func commandByShortID(shortID string) (command CognitiveCommand, exists bool) {
+	if c, exists := registry.ByShortID(shortID); exists {
+		return c.Name(), true
+	}
+
+	return "", false
+}
+
+// get short id of given command
+func shortIDOf(command CognitiveCommand) string {
+	if c, exists := registry.Lookup(command); exists {
+		return c.ShortID()
+	}
+
+	return ""
+}
+
+// run command on given media bytes
+//
+// (`progress` will be called with progress messages of slow operations, if it is not nil)
+func runCommand(ctx context.Context, input []byte, command CognitiveCommand, progress func(message string)) (result ProcessResult, err error) {
+	// (from old inline keyboards, or other ways of running commands)
+	if isDisabledCommand(command) {
+		return result, fmt.Errorf("Command disabled: %s", command)
+	}
+
+	if c, exists := registry.Lookup(command); exists {
+		// (calls to services are traced as its children, and the rest is for rendering results)
+		ctx, span := startSpan(ctx, fmt.Sprintf("command %s", command), spanKindInternal)
+		span.setAttribute("command.input_bytes", len(input))
+
+		started := time.Now()
+		if result, err = c.Handle(ctx, input, progress); err == nil {
+			recordLatency(command, time.Since(started))
+		}
+		span.finish(err)
+
+		return result, err
+	}
+
+	return result, fmt.Errorf("Command not supported: %s", command)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+func TestRunCommand(t *testing.T) {
+	useConfig(t, Config{})
+
+	mock := &mockCognitive{
+		tags: TagResult{Tags: []ImageTag{
+			{Name: "cat", Confidence: 0.99},
+			{Name: "indoor", Confidence: 0.5},
+		}},
+	}
+	useCognitive(t, mock)
+
+	result, err := runCommand(context.Background(), []byte("image"), Tag, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Message != "cat (99.000%)\nindoor (50.000%)" {
+		t.Errorf("unexpected message: %s", result.Message)
+	}
+
+	mock.tags, mock.err = TagResult{}, errors.New("throttled")
+	if _, err := runCommand(context.Background(), []byte("image"), Tag, nil); err == nil {
+		t.Errorf("error of the client was not returned")
+	}
+}
+
+func TestRunDisabledCommand(t *testing.T) {
+	useConfig(t, Config{DisabledCommands: []CognitiveCommand{Tag}})
+
+	mock := &mockCognitive{}
+	useCognitive(t, mock)
+
+	if _, err := runCommand(context.Background(), []byte("image"), Tag, nil); err == nil {
+		t.Errorf("disabled command was run")
+	}
+	if mock.calls > 0 {
+		t.Errorf("client was called for a disabled command")
+	}
+
+	for _, c := range commandsFor(MediaImage) {
+		if c == Tag {
+			t.Errorf("disabled command is listed")
+		}
+	}
+}
+
+func TestAnalyzeEverythingWithPanic(t *testing.T) {
+	useConfig(t, Config{})
+
+	// (Describe and Read of the mock panic)
+	useCognitive(t, &mockCognitive{
+		tags: TagResult{Tags: []ImageTag{{Name: "cat", Confidence: 0.99}}},
+	})
+
+	report, _, err := analyzeEverything(context.Background(), testImageBytes(t, 64, 64, color.White))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report, "[Description]\n  (failed: panic:") || !strings.Contains(report, "[Text]\n  (failed: panic:") {
+		t.Errorf("panics were not reported as errors of their sections: %s", report)
+	}
+	if !strings.Contains(report, "[Tags]\n  cat") {
+		t.Errorf("other sections were not reported: %s", report)
+	}
+}
+
+func TestMaskFaces(t *testing.T) {
+	useConfig(t, Config{MaskFacesStyle: maskStyleSolid, MaskColor: "#FF0000"})
+	useCognitive(t, &mockCognitive{
+		faces: []DetectedFace{
+			{FaceRectangle: cog.Rectangle{Left: 10, Top: 10, Width: 20, Height: 20}},
+		},
+	})
+
+	result, err := runCommand(context.Background(), testImageBytes(t, 64, 48, color.Black), MaskFaces, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(result.Image))
+	if err != nil {
+		t.Fatalf("failed to decode result image: %s", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("wrong size of result image: %v", img.Bounds())
+	}
+
+	red := color.RGBAModel.Convert(color.RGBA{R: 255, A: 255})
+	if c := color.RGBAModel.Convert(img.At(15, 15)); c != red {
+		t.Errorf("face was not masked: %v", c)
+	}
+	if c := color.RGBAModel.Convert(img.At(50, 40)); c == red {
+		t.Errorf("outside of face was masked")
+	}
+}
+
+func TestMaskFacesWithoutFaces(t *testing.T) {
+	useConfig(t, Config{})
+	useCognitive(t, &mockCognitive{})
+
+	if _, err := runCommand(context.Background(), testImageBytes(t, 64, 48, color.Black), MaskFaces, nil); err == nil {
+		t.Errorf("no error without detected faces")
+	}
+}
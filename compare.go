@@ -0,0 +1,16 @@
+package main
+
+// functions for comparing original images with processed ones
+//
+// (they are put side by side with `imaging.SideBySide`)
+
+// commands whose results can be compared with the original images side by side
+var compareCommands = map[CognitiveCommand]bool{
+	CensorEyes: true,
+	MaskFaces:  true,
+}
+
+// check if the result of given command should be compared with the original image
+func shouldCompare(command CognitiveCommand) bool {
+	return conf().CompareBeforeAfter && compareCommands[command]
+}
@@ -0,0 +1,383 @@
+package main
+
+// functions for loading configurations
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"net/url"
+	"sync/atomic"
+
+	// for using .ttf
+	"github.com/golang/freetype/truetype"
+
+	// for config
+	cfg "github.com/meinside/telegram-ms-cognitive-bot/internal/config"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// snapshot struct for the config, and resources loaded with it
+//
+// (replaced as a whole on reloads, so goroutines always read a consistent one without locks)
+type snapshot struct {
+	config *Config
+
+	font          *truetype.Font
+	sunglasses    image.Image
+	watermarkLogo image.Image // (can be nil)
+	colors        []color.RGBA
+	maskColor     color.RGBA
+}
+
+// the current snapshot (*snapshot)
+var current atomic.Value
+
+// (before setup)
+var emptySnapshot = &snapshot{
+	config:    &Config{},
+	colors:    defaultColors,
+	maskColor: defaultMaskColor,
+}
+
+// get the current snapshot
+func loaded() *snapshot {
+	if s, ok := current.Load().(*snapshot); ok {
+		return s
+	}
+
+	return emptySnapshot
+}
+
+// get the current config
+//
+// (should not be modified, for it is shared between goroutines)
+func conf() *Config {
+	return loaded().config
+}
+
+// load resources of given config into a new snapshot
+func loadSnapshot(config *Config) (s *snapshot, err error) {
+	s = &snapshot{config: config}
+
+	if s.font, err = loadFont(config.FontFilepath); err != nil {
+		return nil, err
+	}
+	if s.sunglasses, err = loadSunglasses(config.SunglassesFilepath); err != nil {
+		return nil, err
+	}
+	if s.watermarkLogo, err = loadWatermarkLogo(config.WatermarkFilepath); err != nil {
+		return nil, err
+	}
+	if s.colors, s.maskColor, err = loadColors(config.AnnotationColors, config.MaskColor); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load config from given file, overridden by environment variables
+//
+// (the file is optional when all needed values are given from environment variables)
+func loadConfig(filepath string) (config Config, err error) {
+	if config, err = cfg.Read(filepath); err != nil {
+		return config, err
+	}
+
+	if config.TelegramAPIToken == "" {
+		return config, fmt.Errorf("no telegram api token in %s or environment variables", filepath)
+	}
+
+	for command, provider := range config.VisionProviders {
+		if !isValidVisionProvider(provider) {
+			return config, fmt.Errorf("unknown vision provider '%s' for '%s'", provider, command)
+		}
+	}
+
+	if config.APIListenPort > 0 && len(config.APIKeys) <= 0 {
+		return config, fmt.Errorf("api-keys are needed for api-listen-port")
+	}
+
+	if config.ArchiveStorage != "" {
+		if !isValidArchiveStorage(config.ArchiveStorage) {
+			return config, fmt.Errorf("unknown archive storage '%s'", config.ArchiveStorage)
+		}
+		if config.ArchiveBucket == "" {
+			return config, fmt.Errorf("no archive-bucket for archive storage '%s'", config.ArchiveStorage)
+		}
+		if config.ArchiveStorage == archiveStorageS3 && (config.AWSAccessKeyID == "" || config.AWSSecretAccessKey == "") {
+			return config, fmt.Errorf("no aws access key for archive storage '%s'", config.ArchiveStorage)
+		}
+		if config.ArchiveStorage == archiveStorageAzureBlob {
+			if config.ArchiveAzureAccount == "" {
+				return config, fmt.Errorf("no archive-azure-account for archive storage '%s'", config.ArchiveStorage)
+			}
+			if _, err := base64.StdEncoding.DecodeString(config.ArchiveAzureAccountKey); err != nil || config.ArchiveAzureAccountKey == "" {
+				return config, fmt.Errorf("invalid archive-azure-account-key for archive storage '%s'", config.ArchiveStorage)
+			}
+		}
+		if config.ArchiveShareLinkHours > maxArchiveShareLinkHours {
+			return config, fmt.Errorf("archive-share-link-hours should be up to %d", maxArchiveShareLinkHours)
+		}
+	}
+
+	if config.DailySummarySchedule != "" {
+		if _, err := parseCronSchedule(config.DailySummarySchedule); err != nil {
+			return config, fmt.Errorf("invalid daily-summary-schedule: %s", err)
+		}
+	}
+
+	for _, command := range config.DisabledCommands {
+		if !isRegisteredCommand(command) {
+			return config, fmt.Errorf("unknown command '%s' in disabled-commands", command)
+		}
+	}
+	for command := range config.CommandLabels {
+		if !isRegisteredCommand(command) {
+			return config, fmt.Errorf("unknown command '%s' in command-labels", command)
+		}
+	}
+	for _, row := range config.CommandRows {
+		for _, command := range row {
+			if !isRegisteredCommand(command) {
+				return config, fmt.Errorf("unknown command '%s' in command-rows", command)
+			}
+		}
+	}
+
+	if config.WebhookSecretToken != "" && !webhookSecretTokenRegexp.MatchString(config.WebhookSecretToken) {
+		return config, fmt.Errorf("webhook-secret-token should be 1-256 characters of A-Z, a-z, 0-9, _, and -")
+	}
+
+	if config.TracingOTLPEndpoint != "" {
+		if u, err := url.Parse(config.TracingOTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return config, fmt.Errorf("invalid tracing-otlp-endpoint '%s'", config.TracingOTLPEndpoint)
+		}
+	}
+
+	if config.ResultWebhookURL != "" {
+		if u, err := url.Parse(config.ResultWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return config, fmt.Errorf("invalid result-webhook-url '%s'", config.ResultWebhookURL)
+		}
+	}
+
+	if config.StorageBackend != "" && !storage.IsValidBackend(config.StorageBackend) {
+		return config, fmt.Errorf("unknown storage backend '%s'", config.StorageBackend)
+	}
+	if config.StorageBackend == storage.BackendRedis && config.RedisURL == "" {
+		return config, fmt.Errorf("no redis-url for storage backend '%s'", config.StorageBackend)
+	}
+
+	// (urls are not printed, for they may contain passwords)
+	for key, proxyURL := range map[string]string{
+		"telegram-proxy-url": config.TelegramProxyURL,
+		"azure-proxy-url":    config.AzureProxyURL,
+	} {
+		if proxyURL != "" {
+			if err := validateProxyURL(proxyURL); err != nil {
+				return config, fmt.Errorf("invalid %s: %s", key, err)
+			}
+		}
+	}
+
+	if config.AzureCloud != "" && !isValidAzureCloud(config.AzureCloud) {
+		return config, fmt.Errorf("unknown azure cloud '%s'", config.AzureCloud)
+	}
+
+	for _, service := range config.AzureADServices {
+		if !isAzureADService(service) {
+			return config, fmt.Errorf("service '%s' cannot be authenticated with Azure AD", service)
+		}
+	}
+	if len(config.AzureADServices) > 0 && config.AzureAD.ClientSecret != "" && (config.AzureAD.TenantID == "" || config.AzureAD.ClientID == "") {
+		return config, fmt.Errorf("no tenant id or client id for Azure AD client credentials")
+	}
+
+	for service := range config.SubscriptionKeys {
+		if !isCountedService(service) {
+			return config, fmt.Errorf("unknown service '%s' for subscription keys", service)
+		}
+	}
+
+	for _, budgets := range []map[string]int{config.TransactionBudgetsPerDay, config.TransactionBudgetsPerMonth} {
+		for service := range budgets {
+			if !isCountedService(service) {
+				return config, fmt.Errorf("unknown service '%s' for transaction budgets", service)
+			}
+		}
+	}
+
+	if _, err := compileRedactPatterns(config.RedactTextPatterns); err != nil {
+		return config, err
+	}
+
+	if config.WatermarkPosition != "" && !imaging.IsValidWatermarkPosition(config.WatermarkPosition) {
+		return config, fmt.Errorf("unknown watermark position '%s'", config.WatermarkPosition)
+	}
+	if config.WatermarkOpacity < 0 || config.WatermarkOpacity > 1 {
+		return config, fmt.Errorf("invalid watermark opacity %f (should be 0.0-1.0)", config.WatermarkOpacity)
+	}
+
+	if config.OutputFormat != "" && !isValidOutputFormat(config.OutputFormat) {
+		return config, fmt.Errorf("unknown output format '%s'", config.OutputFormat)
+	}
+	if config.JPEGQuality != 0 && !isValidJPEGQuality(config.JPEGQuality) {
+		return config, fmt.Errorf("invalid jpeg quality %d (should be 1-100)", config.JPEGQuality)
+	}
+
+	if config.MaskFacesStyle != "" && !imaging.IsValidMaskStyle(config.MaskFacesStyle) {
+		return config, fmt.Errorf("unknown mask style '%s'", config.MaskFacesStyle)
+	}
+
+	setDefaults(&config)
+
+	return config, nil
+}
+
+// set default values for missing ones
+func setDefaults(config *Config) {
+	if config.TelegramMonitorIntervalSeconds <= 0 {
+		config.TelegramMonitorIntervalSeconds = 1
+	}
+	if config.WebhookPort <= 0 {
+		config.WebhookPort = defaultWebhookPort
+	}
+	if config.WebhookListenPort <= 0 {
+		config.WebhookListenPort = config.WebhookPort
+	}
+	if config.DbFilepath == "" {
+		config.DbFilepath = defaultDbFilepath
+	}
+
+	if config.CacheTTLSeconds <= 0 {
+		config.CacheTTLSeconds = defaultCacheTTLSeconds
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	if config.RetryMaxAttempts <= 0 {
+		config.RetryMaxAttempts = defaultRetryMaxAttempts
+	}
+	if config.RetryInitialDelayMs <= 0 {
+		config.RetryInitialDelayMs = defaultRetryInitialDelayMs
+	}
+	if config.RetryMaxDelayMs <= 0 {
+		config.RetryMaxDelayMs = defaultRetryMaxDelayMs
+	}
+	if config.MsMaxImageBytes <= 0 {
+		config.MsMaxImageBytes = defaultMaxImageBytes
+	}
+	if config.MsMaxImageDimension <= 0 {
+		config.MsMaxImageDimension = defaultMaxImageDimension
+	}
+	if config.MaxInputImageDimension <= 0 {
+		config.MaxInputImageDimension = defaultMaxInputImageDimension
+	}
+	if config.MaxInputImageMegapixels <= 0 {
+		config.MaxInputImageMegapixels = defaultMaxInputImageMegapixels
+	}
+	if config.FontSizeRatio <= 0 {
+		config.FontSizeRatio = defaultFontSizeRatio
+	}
+	if config.StrokeWidth <= 0 {
+		config.StrokeWidth = defaultStrokeWidth
+	}
+	if config.CircleRadius <= 0 {
+		config.CircleRadius = defaultCircleRadius
+	}
+	if config.MaxConcurrentJobs <= 0 {
+		config.MaxConcurrentJobs = defaultMaxConcurrentJobs
+	}
+	if config.WatermarkPosition == "" {
+		config.WatermarkPosition = watermarkBottomRight
+	}
+	if config.WatermarkOpacity <= 0 {
+		config.WatermarkOpacity = defaultWatermarkOpacity
+	}
+	if config.OutputFormat == "" {
+		config.OutputFormat = outputFormatPNG
+	}
+	if config.JPEGQuality <= 0 {
+		config.JPEGQuality = defaultJPEGQuality
+	}
+	if config.MaxSplitMessages <= 0 {
+		config.MaxSplitMessages = defaultMaxSplitMessages
+	}
+	if config.StorageBackend == "" {
+		config.StorageBackend = storage.BackendSqlite
+	}
+	if config.RedisKeyPrefix == "" {
+		config.RedisKeyPrefix = storage.DefaultRedisKeyPrefix
+	}
+	if config.ArchiveShareLinkHours <= 0 {
+		config.ArchiveShareLinkHours = defaultArchiveShareLinkHours
+	}
+	if config.MaskFacesStyle == "" {
+		config.MaskFacesStyle = maskStylePixelate
+	}
+	if config.MaskFacesStrength <= 0 {
+		config.MaskFacesStrength = defaultMaskStrength
+	}
+	if config.CustomVisionProjectType == "" {
+		config.CustomVisionProjectType = customVisionClassification
+	}
+	if len(config.TranslatorLanguages) <= 0 {
+		config.TranslatorLanguages = defaultTranslatorLanguages
+	}
+}
+
+// reload config from given file, and apply it
+//
+// (values which are used only on startup, eg. telegram api token, webhook, local database, cache, and job queue,
+// are kept as they are)
+func reloadConfig(filepath string) error {
+	config, err := loadConfig(filepath)
+	if err != nil {
+		return err
+	}
+
+	config.TelegramAPIToken = conf().TelegramAPIToken
+	config.TelegramMonitorIntervalSeconds = conf().TelegramMonitorIntervalSeconds
+	config.WebhookHost = conf().WebhookHost
+	config.WebhookPort = conf().WebhookPort
+	config.WebhookListenPort = conf().WebhookListenPort
+	config.WebhookCertFilepath = conf().WebhookCertFilepath
+	config.WebhookKeyFilepath = conf().WebhookKeyFilepath
+	config.WebhookSecretToken = conf().WebhookSecretToken
+	config.APIListenPort = conf().APIListenPort
+	config.APICertFilepath = conf().APICertFilepath
+	config.APIKeyFilepath = conf().APIKeyFilepath
+	config.DiagnosticsListenPort = conf().DiagnosticsListenPort
+	config.DiagnosticsListenHost = conf().DiagnosticsListenHost
+	config.DbFilepath = conf().DbFilepath
+	config.CacheSize = conf().CacheSize
+	config.CacheTTLSeconds = conf().CacheTTLSeconds
+	config.CachePersistent = conf().CachePersistent
+	config.StorageBackend = conf().StorageBackend
+	config.RedisURL = conf().RedisURL
+	config.RedisKeyPrefix = conf().RedisKeyPrefix
+	config.MaxConcurrentJobs = conf().MaxConcurrentJobs
+	config.IsVerbose = conf().IsVerbose // (of the bot client, which is read without locks)
+
+	s, err := loadSnapshot(&config)
+	if err != nil {
+		return err
+	}
+	l, err := newConfiguredLogger(config)
+	if err != nil {
+		return err
+	}
+
+	current.Store(s)
+
+	// (old sinks are closed after logs being written to them)
+	logger.Replace(l)
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+// functions for multi-step commands, which wait for the next message of a user
+
+import (
+	"sync"
+	"time"
+)
+
+// constants for conversations
+const (
+	conversationTTLMinutes = 10
+)
+
+// Conversation struct for a multi-step command in progress
+type Conversation struct {
+	Command   CognitiveCommand
+	FileIDs   []string // files received so far
+	ExpiresOn time.Time
+}
+
+// key of a conversation (a user in a chat)
+type conversationKey struct {
+	chatID int64
+	userID int
+}
+
+var conversations = map[conversationKey]Conversation{}
+var conversationsLock sync.Mutex
+
+// start (or replace) a conversation of given user in given chat
+func startConversation(chatID int64, userID int, command CognitiveCommand, fileIDs []string) {
+	conversationsLock.Lock()
+	defer conversationsLock.Unlock()
+
+	// delete expired ones
+	now := time.Now()
+	for key, c := range conversations {
+		if now.After(c.ExpiresOn) {
+			delete(conversations, key)
+		}
+	}
+
+	conversations[conversationKey{chatID, userID}] = Conversation{
+		Command:   command,
+		FileIDs:   fileIDs,
+		ExpiresOn: now.Add(conversationTTLMinutes * time.Minute),
+	}
+}
+
+// check if given user has a conversation in progress in given chat
+func hasConversation(chatID int64, userID int) bool {
+	conversationsLock.Lock()
+	defer conversationsLock.Unlock()
+
+	c, exists := conversations[conversationKey{chatID, userID}]
+
+	return exists && time.Now().Before(c.ExpiresOn)
+}
+
+// take (and end) the conversation of given user in given chat
+func takeConversation(chatID int64, userID int) (conversation Conversation, exists bool) {
+	conversationsLock.Lock()
+	defer conversationsLock.Unlock()
+
+	key := conversationKey{chatID, userID}
+	if conversation, exists = conversations[key]; exists {
+		delete(conversations, key)
+
+		if time.Now().After(conversation.ExpiresOn) {
+			return conversation, false
+		}
+	}
+
+	return conversation, exists
+}
@@ -0,0 +1,110 @@
+package main
+
+// cron-like schedules (eg. "55 23 * * *")
+//
+// fields are minute, hour, day of month, month, and day of week (0-7, Sunday is 0 or 7),
+// and each of them can be "*", a number, a range ("1-5"), a step ("*/15", "0-30/10", or "5/15" which is "5-59/15"), or a list of them ("0,30")
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule struct for a parsed schedule
+type cronSchedule struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	daysRestricted     bool // (when both days and weekdays are restricted, either of them matches like cron)
+	weekdaysRestricted bool
+}
+
+// parse given cron-like schedule
+func parseCronSchedule(spec string) (schedule cronSchedule, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("schedule should have 5 fields: '%s'", spec)
+	}
+
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return schedule, err
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return schedule, err
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return schedule, err
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return schedule, err
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return schedule, err
+	}
+	if schedule.weekdays[7] { // (Sunday can be 7 too, like cron)
+		schedule.weekdays[0] = true
+		delete(schedule.weekdays, 7)
+	}
+	schedule.daysRestricted = fields[2] != "*"
+	schedule.weekdaysRestricted = fields[4] != "*"
+
+	return schedule, nil
+}
+
+// parse a field of cron-like schedule into matching values
+func parseCronField(field string, min, max int) (values map[int]bool, err error) {
+	values = map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if index := strings.Index(part, "/"); index >= 0 {
+			if step, err = strconv.Atoi(part[index+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in '%s'", field)
+			}
+			part, stepped = part[:index], true
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value in '%s'", field)
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range in '%s'", field)
+				}
+			} else if !stepped { // (a step from a single value continues to the max, eg. "5/15")
+				to = from
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("'%s' is out of range (%d-%d)", field, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
+
+// check if given time (in minutes) matches the schedule
+func (s cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	if s.daysRestricted && s.weekdaysRestricted {
+		return day || weekday
+	}
+
+	return day && weekday
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	for _, test := range []struct {
+		field    string
+		min, max int
+		expected []int
+	}{
+		{"*", 0, 6, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"5", 0, 59, []int{5}},
+		{"1-3", 1, 31, []int{1, 2, 3}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"0-30/10", 0, 59, []int{0, 10, 20, 30}},
+		{"5/15", 0, 59, []int{5, 20, 35, 50}},
+		{"10/5", 0, 23, []int{10, 15, 20}},
+		{"0,30", 0, 59, []int{0, 30}},
+		{"1-2,5/2", 1, 9, []int{1, 2, 5, 7, 9}},
+	} {
+		values, err := parseCronField(test.field, test.min, test.max)
+		if err != nil {
+			t.Errorf("failed to parse '%s': %s", test.field, err)
+			continue
+		}
+
+		parsed := []int{}
+		for v := range values {
+			parsed = append(parsed, v)
+		}
+		sort.Ints(parsed)
+
+		if !reflect.DeepEqual(parsed, test.expected) {
+			t.Errorf("'%s' was parsed as %v, expected %v", test.field, parsed, test.expected)
+		}
+	}
+}
+
+func TestParseInvalidCronField(t *testing.T) {
+	for _, field := range []string{"", "a", "60", "5-1", "1-a", "*/0", "*/a", "60/5"} {
+		if _, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("invalid field '%s' was parsed", field)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	sunday := time.Date(2023, 1, 1, 9, 5, 0, 0, time.UTC)
+	monday := sunday.AddDate(0, 0, 1)
+
+	for _, test := range []struct {
+		spec     string
+		time     time.Time
+		expected bool
+	}{
+		{"5 9 * * *", sunday, true},
+		{"5 9 * * 0", sunday, true},
+		{"5 9 * * 7", sunday, true}, // (Sunday is 7 too)
+		{"5 9 * * 7", monday, false},
+		{"5 9 * * 5-7", sunday, true},
+		{"5 9 * * 1-5", sunday, false},
+		{"5 9 * * 1-5", monday, true},
+		{"5/15 * * * *", sunday, true},
+		{"5/15 * * * *", sunday.Add(15 * time.Minute), true},
+		{"5/15 * * * *", sunday.Add(time.Minute), false},
+		{"5 9 2 * 0", monday, true}, // (either day of month or day of week, like cron)
+	} {
+		schedule, err := parseCronSchedule(test.spec)
+		if err != nil {
+			t.Errorf("failed to parse '%s': %s", test.spec, err)
+			continue
+		}
+
+		if matched := schedule.matches(test.time); matched != test.expected {
+			t.Errorf("'%s' matched %s: %t, expected %t", test.spec, test.time, matched, test.expected)
+		}
+	}
+}
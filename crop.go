@@ -0,0 +1,110 @@
+package main
+
+// functions for cropping images smartly with aspect ratios
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for smart cropping
+const (
+	maxThumbnailSize = 1024 // limit of Computer Vision API
+)
+
+// aspect ratio for smart cropping
+type aspectRatio struct {
+	command CognitiveCommand
+	shortID string
+	width   int
+	height  int
+}
+
+// selectable aspect ratios (in the order of buttons)
+var smartCropRatios = []aspectRatio{
+	{command: "Smart Crop (1:1)", shortID: "K1", width: 1, height: 1},
+	{command: "Smart Crop (16:9)", shortID: "K16", width: 16, height: 9},
+	{command: "Smart Crop (4:3)", shortID: "K4", width: 4, height: 3},
+}
+
+func init() {
+	registerCommand(newCommand(SmartCrop, "K", handleSmartCrop), MediaImage)
+
+	// commands for each aspect ratio are selected from a second keyboard, so they are not bound to any media
+	for _, r := range smartCropRatios {
+		registerCommand(newCommand(r.command, r.shortID, handleSmartCropWithRatio(r)))
+	}
+}
+
+// (aspect ratio should be selected first, so it is not processed like other commands)
+func handleSmartCrop(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	return result, fmt.Errorf("'%s' needs an aspect ratio.", SmartCrop)
+}
+
+// generate inline keyboards for selecting an aspect ratio of smart cropping
+//
+// (target is the token of the file, which was saved for the first keyboard)
+func genAspectRatioInlineKeyboards(target string) [][]bot.InlineKeyboardButton {
+	buttons := []bot.InlineKeyboardButton{}
+	for _, r := range smartCropRatios {
+		data := genCallbackData(r.command, target)
+		buttons = append(buttons, bot.InlineKeyboardButton{
+			Text:         fmt.Sprintf("%d:%d", r.width, r.height),
+			CallbackData: &data,
+		})
+	}
+
+	cancel := signCallbackData(commandCancel)
+	return [][]bot.InlineKeyboardButton{
+		buttons,
+		[]bot.InlineKeyboardButton{
+			bot.InlineKeyboardButton{Text: strings.Title(commandCancel), CallbackData: &cancel},
+		},
+	}
+}
+
+// crop given image bytes smartly with an aspect ratio
+func handleSmartCropWithRatio(ratio aspectRatio) CommandHandler {
+	return func(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+		config, _, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+		if err != nil {
+			return result, fmt.Errorf("Failed to decode image: %s", err)
+		}
+
+		width, height := fitAspectRatio(config.Width, config.Height, ratio.width, ratio.height, maxThumbnailSize)
+		if width <= 0 || height <= 0 {
+			return result, fmt.Errorf("Image is too small for cropping with %d:%d.", ratio.width, ratio.height)
+		}
+
+		if result.Image, err = cognitive.GenerateThumbnail(ctx, imageBytes, width, height); err != nil {
+			return result, fmt.Errorf("Failed to crop image: %s", err)
+		}
+		result.Message = fmt.Sprintf("Cropped to %dx%d (%d:%d)", width, height, ratio.width, ratio.height)
+
+		return result, nil
+	}
+}
+
+// largest size with given aspect ratio, which fits in the original size and the max size
+func fitAspectRatio(originalWidth, originalHeight, ratioWidth, ratioHeight, maxSize int) (width, height int) {
+	if originalWidth > maxSize {
+		originalWidth = maxSize
+	}
+	if originalHeight > maxSize {
+		originalHeight = maxSize
+	}
+
+	if originalWidth*ratioHeight > originalHeight*ratioWidth {
+		// limited by height
+		return originalHeight * ratioWidth / ratioHeight, originalHeight
+	}
+
+	// limited by width
+	return originalWidth, originalWidth * ratioHeight / ratioWidth
+}
@@ -0,0 +1,167 @@
+package main
+
+// functions for classifying images or detecting objects with a trained model of Custom Vision
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	// for drawing
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// constants for Custom Vision
+const (
+	customVisionPredictionPath = "/customvision/v3.0/Prediction"
+
+	// project types
+	customVisionClassification = "classification"
+	customVisionDetection      = "detection"
+
+	minCustomVisionProbability = 0.5 // predictions less probable than this will be ignored
+)
+
+func init() {
+	registerCommand(newCommand(CustomModel, "CV", handleCustomModel), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// CustomVisionResult struct for the result of Custom Vision prediction
+type CustomVisionResult struct {
+	Iteration   string                   `json:"iteration"`
+	Predictions []CustomVisionPrediction `json:"predictions"`
+}
+
+// CustomVisionPrediction struct for a predicted tag
+type CustomVisionPrediction struct {
+	Probability float64             `json:"probability"`
+	TagID       string              `json:"tagId"`
+	TagName     string              `json:"tagName"`
+	BoundingBox *CustomVisionRegion `json:"boundingBox,omitempty"` // only for object detection
+}
+
+// CustomVisionRegion struct for a bounding box (normalized to 0.0 - 1.0)
+type CustomVisionRegion struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// convert to a rectangle on an image with given size
+func (r CustomVisionRegion) toRectangle(width, height int) cog.Rectangle {
+	return cog.Rectangle{
+		Left:   int(r.Left * float64(width)),
+		Top:    int(r.Top * float64(height)),
+		Width:  int(r.Width * float64(width)),
+		Height: int(r.Height * float64(height)),
+	}
+}
+
+// check if a Custom Vision project is configured
+func customVisionAvailable() bool {
+	return hasCredentials(serviceCustomVision, conf().MsCustomVisionPredictionKey) && conf().CustomVisionProjectID != "" && conf().CustomVisionIteration != ""
+}
+
+// base url of Custom Vision prediction API
+func customVisionAPIURL() string {
+	return serviceAPIURL(conf().MsCustomVisionEndpoint, conf().MsCustomVisionRegion, customVisionPredictionPath)
+}
+
+// predict given image bytes with the configured project and (published) iteration
+func predictCustomVision(ctx context.Context, image []byte) (result CustomVisionResult, err error) {
+	action := "classify"
+	if conf().CustomVisionProjectType == customVisionDetection {
+		action = "detect"
+	}
+
+	resp, err := doRequestWithHeaders(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s/%s/%s/iterations/%s/image", customVisionAPIURL(), conf().CustomVisionProjectID, action, conf().CustomVisionIteration),
+		map[string]string{
+			"Prediction-Key": conf().MsCustomVisionPredictionKey,
+		},
+		"application/octet-stream",
+		image,
+	)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	return result, readJSON(resp, &result)
+}
+
+// classify given image bytes, or detect objects on them, with the configured Custom Vision project
+func handleCustomModel(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	if !customVisionAvailable() {
+		return result, errors.New("No Custom Vision project is configured.")
+	}
+
+	predicted, err := cognitive.PredictCustomVision(ctx, imageBytes)
+	if err != nil {
+		return result, fmt.Errorf("Failed to predict with custom model: %s", err)
+	}
+
+	predictions := []CustomVisionPrediction{}
+	for _, p := range predicted.Predictions {
+		if p.Probability >= minCustomVisionProbability {
+			predictions = append(predictions, p)
+		}
+	}
+	if len(predictions) <= 0 {
+		return result, errors.New("Nothing was recognized with the custom model.")
+	}
+
+	// classification
+	if conf().CustomVisionProjectType != customVisionDetection {
+		strs := []string{}
+		for _, p := range predictions {
+			strs = append(strs, fmt.Sprintf("%s (%.3f%%)", p.TagName, p.Probability*100.0))
+		}
+		result.Message = strings.Join(strs, "\n")
+
+		return result, nil
+	}
+
+	// object detection
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	strs := []string{}
+	for i, p := range predictions {
+		strs = append(strs, fmt.Sprintf("[#%d] %s (%.3f%%)", i+1, p.TagName, p.Probability*100.0))
+
+		if p.BoundingBox == nil {
+			continue
+		}
+		rect := p.BoundingBox.toRectangle(width, height)
+
+		// set color
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		fc.SetSrc(&image.Uniform{color})
+
+		// draw rectangles and tag names on detected objects
+		drawRectangle(gc, rect)
+		drawLabel(fc, fmt.Sprintf("#%d %s", i+1, p.TagName), rect, fontSize)
+	}
+	gc.Save()
+
+	result.Message = strings.Join(strs, "\n")
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
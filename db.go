@@ -0,0 +1,32 @@
+package main
+
+// local database and other stores of states (see internal/storage)
+
+import (
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// Database type for the local database
+type Database = storage.Database
+
+// RedisStore type for states in Redis
+type RedisStore = storage.RedisStore
+
+// Stat type for statistics
+type Stat = storage.Stat
+
+// Job type for queued jobs
+type Job = storage.Job
+
+// Request type for requests from users
+type Request = storage.Request
+
+// History type for processed requests, with their result messages
+type History = storage.History
+
+// Metric type for a daily metric (eg. errors of a service, or latencies of a command)
+type Metric = storage.Metric
+
+// Prompt type for messages with inline keyboards for choosing actions
+type Prompt = storage.Prompt
@@ -0,0 +1,242 @@
+package main
+
+// functions for skipping duplicated updates
+//
+// (Telegram can deliver the same updates again, eg. when the bot restarts before confirming them)
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for skipping duplicated updates
+const (
+	stateKeyLastUpdateID    = "last-update-id"
+	stateKeyRecentUpdateIDs = "recent-update-ids"
+
+	recentUpdatesWindow       = 1000             // updates older than the latest one by this are regarded as processed
+	updateStateSavingInterval = 10 * time.Second // (ids of processed updates are saved in batches, not on every update)
+
+	callbackQueryIDsTTL = 24 * time.Hour // ids of callback queries are remembered for this duration
+)
+
+// ids of recently processed updates
+var recentUpdates = newUpdateWindow(recentUpdatesWindow)
+
+// updateWindow struct for ids of processed updates in a window of the latest ones
+//
+// (updates from webhook can arrive out of order through parallel connections, so they are not compared with the latest one only)
+type updateWindow struct {
+	size   int
+	latest int
+	ids    map[int]bool
+	dirty  bool // (changed after it was saved)
+
+	sync.Mutex
+}
+
+// create a new window of given size
+func newUpdateWindow(size int) *updateWindow {
+	return &updateWindow{
+		size: size,
+		ids:  map[int]bool{},
+	}
+}
+
+// add given id of update, and return false if it was already added (or is too old to be in the window)
+func (w *updateWindow) add(id int) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.ids[id] || id <= w.latest-w.size {
+		return false
+	}
+	w.ids[id] = true
+	w.dirty = true
+
+	// slide the window, and forget ids out of it
+	if id > w.latest {
+		w.latest = id
+
+		for seen := range w.ids {
+			if seen <= w.latest-w.size {
+				delete(w.ids, seen)
+			}
+		}
+	}
+
+	return true
+}
+
+// the latest id, and all ids in the window (sorted), if changed after they were saved
+func (w *updateWindow) takeChanges() (latest int, ids []int, changed bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.dirty {
+		return w.latest, nil, false
+	}
+	w.dirty = false
+
+	for id := range w.ids {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return w.latest, ids, true
+}
+
+// restore the window with saved ids
+func (w *updateWindow) restore(latest int, ids []int) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.latest = latest
+	w.ids = map[int]bool{}
+	for _, id := range ids {
+		if id > latest-w.size {
+			w.ids[id] = true
+		}
+	}
+	w.dirty = false
+}
+
+// load ids of processed updates from the local database
+//
+// (returns the offset for getting updates, which is 0 if there is none)
+func loadLastUpdateID() (offset int) {
+	if db == nil {
+		return 0
+	}
+
+	value, err := db.GetState(stateKeyLastUpdateID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to load last update id: %s", err))
+		return 0
+	}
+	if value == "" {
+		return 0
+	}
+
+	latest, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Malformed last update id: %s", value))
+		return 0
+	}
+
+	ids := []int{}
+	if value, err = db.GetState(stateKeyRecentUpdateIDs); err == nil {
+		for _, v := range strings.Split(value, ",") {
+			if id, err := strconv.Atoi(v); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to load recent update ids: %s", err))
+	}
+
+	recentUpdates.restore(latest, ids)
+
+	return latest + 1
+}
+
+// save ids of processed updates to the local database, if they were changed
+func saveUpdateIDs() {
+	if db == nil {
+		return
+	}
+
+	latest, ids, changed := recentUpdates.takeChanges()
+	if !changed {
+		return
+	}
+
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.Itoa(id)
+	}
+
+	if err := db.SetState(stateKeyRecentUpdateIDs, strings.Join(values, ",")); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save recent update ids: %s", err))
+	}
+	if err := db.SetState(stateKeyLastUpdateID, strconv.Itoa(latest)); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save last update id: %s", err))
+	}
+}
+
+// save ids of processed updates periodically, forever
+//
+// (they are also saved when the bot stops, so only updates of the last interval can be processed again after a crash)
+func startSavingUpdateIDs() {
+	go func() {
+		for range time.Tick(updateStateSavingInterval) {
+			saveUpdateIDs()
+		}
+	}()
+}
+
+// check if given update is a duplicated one, and remember it if not
+func isDuplicatedUpdate(update bot.Update) bool {
+	// (with multiple instances, each update is claimed by only one of them)
+	if coordinator != nil {
+		return isClaimedUpdate(update)
+	}
+
+	if !recentUpdates.add(update.UpdateID) {
+		logger.Warn(fmt.Sprintf("Skipping duplicated update: %d", update.UpdateID))
+		return true
+	}
+
+	if db == nil {
+		return false
+	}
+
+	// callback queries can also be delivered again in new updates
+	if update.HasCallbackQuery() {
+		if saved, err := db.SaveCallbackQueryID(update.CallbackQuery.ID, time.Now().Add(-callbackQueryIDsTTL)); err == nil {
+			if !saved {
+				logger.Warn(fmt.Sprintf("Skipping duplicated callback query: %s", update.CallbackQuery.ID))
+				return true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to save callback query id: %s", err))
+		}
+	}
+
+	return false
+}
+
+// check if given update was already claimed by any instance, and claim it if not
+//
+// (updates can be delivered to any instance, and out of order, so their ids are not compared)
+func isClaimedUpdate(update bot.Update) bool {
+	if claimed, err := coordinator.Claim(fmt.Sprintf("updates:%d", update.UpdateID), callbackQueryIDsTTL); err == nil {
+		if !claimed {
+			logger.Debug(fmt.Sprintf("Skipping update claimed by another instance: %d", update.UpdateID))
+			return true
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to claim update: %s", err))
+	}
+
+	// callback queries can also be delivered again in new updates
+	if update.HasCallbackQuery() {
+		if claimed, err := coordinator.Claim(fmt.Sprintf("callbacks:%s", update.CallbackQuery.ID), callbackQueryIDsTTL); err == nil {
+			if !claimed {
+				logger.Warn(fmt.Sprintf("Skipping duplicated callback query: %s", update.CallbackQuery.ID))
+				return true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to claim callback query: %s", err))
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// use a new window of recently processed updates in the test
+func useRecentUpdates(t *testing.T) {
+	t.Helper()
+
+	previous := recentUpdates
+	recentUpdates = newUpdateWindow(recentUpdatesWindow)
+	t.Cleanup(func() {
+		recentUpdates = previous
+	})
+}
+
+func TestUpdateWindow(t *testing.T) {
+	w := newUpdateWindow(10)
+
+	for i, test := range []struct {
+		id    int
+		added bool
+	}{
+		{100, true},
+		{102, true},
+		{101, true},  // (out of order)
+		{102, false}, // (duplicated)
+		{110, true},
+		{100, false}, // (out of the window)
+		{105, true},  // (out of order, but still in the window)
+		{101, false}, // (duplicated, and still in the window)
+		{111, true},
+		{101, false}, // (out of the window)
+	} {
+		if added := w.add(test.id); added != test.added {
+			t.Errorf("#%d: add(%d) = %v, expected %v", i, test.id, added, test.added)
+		}
+	}
+
+	latest, ids, changed := w.takeChanges()
+	if latest != 111 || !reflect.DeepEqual(ids, []int{102, 105, 110, 111}) || !changed {
+		t.Errorf("wrong changes: %d, %v, %v", latest, ids, changed)
+	}
+	if _, _, changed := w.takeChanges(); changed {
+		t.Errorf("changes were taken again")
+	}
+}
+
+func TestSkipDuplicatedUpdates(t *testing.T) {
+	useConfig(t, Config{})
+	useDatabase(t)
+	useRecentUpdates(t)
+
+	for _, test := range []struct {
+		id         int
+		duplicated bool
+	}{
+		{5, false},
+		{7, false},
+		{6, false}, // (out of order, eg. from parallel connections of webhook)
+		{7, true},
+	} {
+		if duplicated := isDuplicatedUpdate(bot.Update{UpdateID: test.id}); duplicated != test.duplicated {
+			t.Errorf("update %d: duplicated = %v, expected %v", test.id, duplicated, test.duplicated)
+		}
+	}
+
+	// (saved, and loaded after a restart)
+	saveUpdateIDs()
+	recentUpdates = newUpdateWindow(recentUpdatesWindow)
+
+	if offset := loadLastUpdateID(); offset != 8 {
+		t.Errorf("wrong offset: %d", offset)
+	}
+	if !isDuplicatedUpdate(bot.Update{UpdateID: 6}) {
+		t.Errorf("update processed before the restart was not skipped")
+	}
+	if isDuplicatedUpdate(bot.Update{UpdateID: 4}) {
+		t.Errorf("update which was not processed before the restart was skipped")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+// functions for developer mode, which attaches raw responses of Cognitive Services to results
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// rawResponse struct for a raw response of Cognitive Services
+type rawResponse struct {
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	StatusCode int             `json:"statusCode"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Text       string          `json:"text,omitempty"` // (for bodies which are not JSON)
+}
+
+// rawResponses struct for collecting raw responses while processing a command
+type rawResponses struct {
+	sync.Mutex
+
+	responses []rawResponse
+}
+
+// return a new context which collects raw responses of Cognitive Services
+func withRawResponses(ctx context.Context) (context.Context, *rawResponses) {
+	raw := &rawResponses{}
+
+	return context.WithValue(ctx, contextKeyRawResponses, raw), raw
+}
+
+// record given response body, if raw responses are collected for its request
+func recordRawResponse(resp *http.Response, body []byte) {
+	if resp.Request == nil {
+		return
+	}
+
+	raw, exists := resp.Request.Context().Value(contextKeyRawResponses).(*rawResponses)
+	if !exists {
+		return
+	}
+
+	response := rawResponse{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+	}
+	if json.Valid(body) {
+		response.Body = json.RawMessage(body)
+	} else {
+		response.Text = string(body)
+	}
+
+	raw.Lock()
+	raw.responses = append(raw.responses, response)
+	raw.Unlock()
+}
+
+// check if developer mode is on for given user
+func isDeveloperMode(userID int) bool {
+	return getBoolPreference(userID, preferenceDeveloperMode)
+}
+
+// send collected raw responses as a .json document
+func sendRawResponses(b Messenger, chatID int64, command CognitiveCommand, raw *rawResponses) (errorMessage string) {
+	raw.Lock()
+	responses := raw.responses
+	raw.Unlock()
+
+	if len(responses) <= 0 {
+		return ""
+	}
+
+	data, err := json.MarshalIndent(responses, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("Failed to encode raw responses: %s", err)
+	}
+
+	// 'uploading document...'
+	b.SendChatAction(chatID, bot.ChatActionUploadDocument)
+
+	if sent := b.SendDocument(chatID, bot.InputFileFromBytes(data), map[string]interface{}{
+		"caption":              fmt.Sprintf("Raw responses of '%s' (%d)", command, len(responses)),
+		"disable_notification": true,
+	}); !sent.Ok {
+		return fmt.Sprintf("Failed to send raw responses: %s", *sent.Description)
+	}
+
+	return ""
+}
@@ -0,0 +1,95 @@
+package main
+
+// functions for serving pprof and runtime diagnostics to admins
+//
+// (listens on `diagnostics-listen-host`, which is localhost by default, so it should be reached through an SSH tunnel)
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// constants for diagnostics
+const (
+	defaultDiagnosticsListenHost = "127.0.0.1"
+)
+
+// when the bot was started (for uptime)
+var startedOn = time.Now()
+
+// runtimeDiagnostics struct for runtime statistics
+type runtimeDiagnostics struct {
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	NumGoroutines int   `json:"num_goroutines"`
+	NumCPUs       int   `json:"num_cpus"`
+
+	// (in bytes)
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapReleased uint64 `json:"heap_released"`
+	Sys          uint64 `json:"sys"`
+
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+
+	RunningJobs int `json:"running_jobs"`
+}
+
+// start a server of pprof and runtime diagnostics, if `diagnostics-listen-port` is set
+//
+// (handlers are registered on its own mux, not to be exposed on webhook or API servers)
+func startDiagnosticsServer() {
+	if conf().DiagnosticsListenPort <= 0 {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/runtime", handleRuntimeDiagnostics)
+
+	host := conf().DiagnosticsListenHost
+	if host == "" {
+		host = defaultDiagnosticsListenHost
+	}
+	addr := fmt.Sprintf("%s:%d", host, conf().DiagnosticsListenPort)
+
+	logger.Info(fmt.Sprintf("Starting diagnostics server on %s", addr))
+
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+
+		logger.Error(fmt.Sprintf("Diagnostics server stopped: %s", err))
+	}()
+}
+
+// handle requests for runtime statistics
+func handleRuntimeDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	runningJobsLock.Lock()
+	numRunningJobs := len(runningJobs)
+	runningJobsLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runtimeDiagnostics{
+		UptimeSeconds: int64(time.Since(startedOn).Seconds()),
+		NumGoroutines: runtime.NumGoroutine(),
+		NumCPUs:       runtime.NumCPU(),
+		HeapAlloc:     stats.HeapAlloc,
+		HeapInuse:     stats.HeapInuse,
+		HeapReleased:  stats.HeapReleased,
+		Sys:           stats.Sys,
+		NumGC:         stats.NumGC,
+		PauseTotalNs:  stats.PauseTotalNs,
+		RunningJobs:   numRunningJobs,
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+// functions for running commands on images directly, without inline keyboards
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// commands which need more input from users (eg. another image, or an aspect ratio), so cannot be run directly
+var interactiveCommands = map[CognitiveCommand]bool{
+	VerifyFaces: true,
+	SmartCrop:   true,
+}
+
+// short aliases of commands for captions
+var captionShortcuts = map[string]CognitiveCommand{
+	"ocr":      ReadText,
+	"read":     ReadText,
+	"text":     ReadText,
+	"face":     Face,
+	"faces":    Face,
+	"emotion":  Emotion,
+	"emotions": Emotion,
+	"describe": Describe,
+	"tag":      Tag,
+	"tags":     Tag,
+	"objects":  DetectObjects,
+	"censor":   CensorEyes,
+	"mask":     MaskFaces,
+	"redact":   RedactText,
+	"info":     ImageInfo,
+	"receipt":  ScanReceipt,
+}
+
+// names of languages for captions (eg. "describe in spanish")
+var languageCodes = map[string]string{
+	"english":    "en",
+	"korean":     "ko",
+	"japanese":   "ja",
+	"chinese":    "zh-Hans",
+	"spanish":    "es",
+	"french":     "fr",
+	"german":     "de",
+	"italian":    "it",
+	"portuguese": "pt",
+	"russian":    "ru",
+	"arabic":     "ar",
+	"hindi":      "hi",
+	"vietnamese": "vi",
+	"thai":       "th",
+	"indonesian": "id",
+	"dutch":      "nl",
+	"turkish":    "tr",
+}
+
+// parse the caption of an image for running a command directly
+//
+// (eg. "ocr", "faces", "Detect Objects", or "describe in Spanish" with a target language of translation)
+func parseCaptionShortcut(message *bot.Message) (command CognitiveCommand, language string, ok bool) {
+	if message.From == nil || !message.HasCaption() || strings.HasPrefix(strings.TrimSpace(*message.Caption), "/") {
+		return "", "", false
+	}
+
+	return parseShortcut(*message.Caption)
+}
+
+// parse a slash command in a reply to an image for running it directly
+//
+// (eg. "/ocr", "/faces@botname", or "/describe in Spanish")
+func parseReplyShortcut(message *bot.Message) (fileID string, command CognitiveCommand, language string, ok bool) {
+	if message.From == nil || !message.HasText() || message.ReplyToMessage == nil {
+		return "", "", "", false
+	}
+
+	text := strings.TrimSpace(*message.Text)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", "", false
+	}
+	if fileID, ok = imageFileID(message.ReplyToMessage); !ok {
+		return "", "", "", false
+	}
+
+	if command, language, ok = parseShortcut(strings.Replace(strings.TrimPrefix(text, "/"), "_", " ", -1)); !ok {
+		return "", "", "", false
+	}
+
+	return fileID, command, language, true
+}
+
+// parse given text for a command (and a target language of translation, if any)
+func parseShortcut(text string) (command CognitiveCommand, language string, ok bool) {
+	text = strings.TrimSpace(text)
+	if botUsername != "" {
+		text = strings.TrimSpace(strings.Replace(text, "@"+botUsername, "", -1))
+	}
+	if text == "" {
+		return "", "", false
+	}
+
+	// target language, if any
+	if index := strings.LastIndex(strings.ToLower(text), " in "); index > 0 {
+		if language, ok = languageCode(text[index+len(" in "):]); ok {
+			text = strings.TrimSpace(text[:index])
+		}
+	}
+
+	if command, exists := captionShortcuts[strings.ToLower(text)]; exists {
+		return command, language, true
+	}
+	if command, exists := findCommand(text, MediaImage); exists {
+		return command, language, true
+	}
+
+	return "", "", false
+}
+
+// parse the payload of a deep link for a command (eg. "ocr", "F", or "Detect_Objects")
+//
+// (payloads can have only alphanumeric characters, underscores, and hyphens)
+func parseDeepLinkPayload(payload string) (command CognitiveCommand, exists bool) {
+	if command, exists = captionShortcuts[strings.ToLower(payload)]; !exists {
+		command, exists = findCommand(strings.Replace(payload, "_", " ", -1), MediaImage)
+	}
+
+	return command, exists && isDirectlyRunnable(command)
+}
+
+// language code of given name (eg. "Spanish") or code (eg. "es") of a language
+func languageCode(name string) (code string, ok bool) {
+	name = strings.TrimSpace(name)
+	if code, ok = languageCodes[strings.ToLower(name)]; ok {
+		return code, true
+	}
+
+	for _, l := range append(conf().TranslatorLanguages, defaultTranslatorLanguages...) {
+		if strings.EqualFold(l, name) {
+			return l, true
+		}
+	}
+
+	return "", false
+}
+
+// find a command for given media type with its name or short id (case-insensitive)
+func findCommand(query string, media MediaType) (command CognitiveCommand, exists bool) {
+	query = strings.TrimSpace(query)
+	for _, c := range commandsFor(media) {
+		if strings.EqualFold(string(c), query) || strings.EqualFold(shortIDOf(c), query) {
+			return c, true
+		}
+	}
+
+	return "", false
+}
+
+// check if given command can be run on images directly
+func isDirectlyRunnable(command CognitiveCommand) bool {
+	if interactiveCommands[command] {
+		return false
+	}
+
+	for _, c := range commandsFor(MediaImage) {
+		if c == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// default action of a user for images (not exists if not set, or no longer available)
+func defaultActionFor(userID int) (command CognitiveCommand, exists bool) {
+	command = CognitiveCommand(getPreference(userID, preferenceDefaultAction))
+	if command == "" || !isDirectlyRunnable(command) {
+		return "", false
+	}
+
+	return command, true
+}
+
+// run given command on the image of given message directly
+//
+// (result message will be translated to given language, if it is not empty)
+func runImageCommandDirectly(ctx context.Context, b Messenger, message *bot.Message, fileID string, command CognitiveCommand, language string) bool {
+	chatID, userID := message.Chat.ID, message.From.ID
+	userLanguage := languageFor(userID)
+
+	var username string
+	if message.From.Username == nil {
+		username = message.From.FirstName
+	} else {
+		username = *message.From.Username
+	}
+
+	reply := func(text string) bool {
+		if sent := b.SendMessage(chatID, text, map[string]interface{}{
+			"reply_to_message_id": message.MessageID,
+		}); !sent.Ok {
+			logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+
+			return false
+		}
+
+		return true
+	}
+
+	if available, retryAt := checkQuota(userID); !available {
+		return reply(quotaExceededMessage(userLanguage, retryAt))
+	}
+
+	fileResult := b.GetFile(fileID)
+	if !fileResult.Ok {
+		logger.Error(fmt.Sprintf("Failed to get file from url: %s", *fileResult.Description))
+
+		return reply(localize(userLanguage, messageFailedToGetFile))
+	}
+
+	kind := JobKindImage
+	status := fmt.Sprintf(localize(userLanguage, messageProcessingImage), command)
+	argument := ""
+	if language != "" {
+		argument = translationArgument(language)
+	} else if isFaceSelectable(command) {
+		// detect and number faces first, for selecting them
+		kind = JobKindFaces
+		status = fmt.Sprintf(localize(userLanguage, messageDetectingFaces), command)
+	}
+
+	// (this status message will be edited with progress, and deleted after processing)
+	sent := b.SendMessage(chatID, status, map[string]interface{}{
+		"reply_to_message_id": message.MessageID,
+		"reply_markup": bot.InlineKeyboardMarkup{
+			InlineKeyboard: genJobCancelInlineKeyboards(),
+		},
+	})
+	if !sent.Ok {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+
+		return false
+	}
+
+	if err := enqueueJob(ctx, Job{
+		Kind:      kind,
+		ChatID:    chatID,
+		UserID:    userID,
+		MessageID: sent.Result.MessageID,
+		FileIDs:   []string{fileID},
+		Command:   command,
+		Argument:  argument,
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+		b.EditMessageText(localize(userLanguage, messageFailedToEnqueue), map[string]interface{}{
+			"chat_id":    chatID,
+			"message_id": sent.Result.MessageID,
+		})
+
+		return false
+	}
+
+	// log request
+	logRequest(username, fileID, command)
+
+	// save request for quotas
+	if db != nil {
+		if err := saveRequest(userID, username, command); err != nil {
+			logger.Error(fmt.Sprintf("Failed to save request: %s", err))
+		}
+	}
+
+	return true
+}
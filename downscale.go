@@ -0,0 +1,147 @@
+package main
+
+// functions for downscaling oversized images before sending them to Cognitive Services
+//
+// (coordinates in the results are scaled back to the original resolution, so they can be drawn on original images)
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+
+	"github.com/disintegration/gift"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// constants for downscaling images
+const (
+	defaultMaxImageBytes     = 4 * 1024 * 1024 // 4MB
+	defaultMaxImageDimension = 4096            // (Face API does not accept images larger than 4096x4096)
+
+	downscaledJPEGQuality  = 90
+	downscaleRatioStep     = 0.75 // ratio for shrinking again when still too large in bytes
+	downscaleMaxIterations = 5
+)
+
+// downscale given image bytes when they exceed the configured size or dimension
+//
+// returns the (possibly) downscaled bytes, and the scale for converting coordinates on them back to the original
+func downscaleForAzure(data []byte) (downscaled []byte, scale float64, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// (let the APIs report unsupported images)
+		return data, 1.0, nil
+	}
+
+	longer := config.Width
+	if config.Height > longer {
+		longer = config.Height
+	}
+	if len(data) <= conf().MsMaxImageBytes && longer <= conf().MsMaxImageDimension {
+		return data, 1.0, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 1.0, fmt.Errorf("failed to decode image for downscaling: %s", err)
+	}
+
+	ratio := 1.0
+	if longer > conf().MsMaxImageDimension {
+		ratio = float64(conf().MsMaxImageDimension) / float64(longer)
+	}
+
+	for i := 0; i < downscaleMaxIterations; i++ {
+		width := int(math.Max(1, math.Round(float64(config.Width)*ratio)))
+		height := int(math.Max(1, math.Round(float64(config.Height)*ratio)))
+
+		g := gift.New(
+			gift.Resize(width, height, gift.LinearResampling),
+		)
+		resized := image.NewRGBA(g.Bounds(img.Bounds()))
+		g.Draw(resized, img)
+
+		var downscaled []byte
+		if downscaled, err = imaging.EncodeWithPool(func(w io.Writer) error {
+			return jpeg.Encode(w, resized, &jpeg.Options{Quality: downscaledJPEGQuality})
+		}); err != nil {
+			return nil, 1.0, fmt.Errorf("failed to encode downscaled image: %s", err)
+		}
+
+		if len(downscaled) <= conf().MsMaxImageBytes {
+			logger.Debug(fmt.Sprintf("Downscaled image from %dx%d (%d bytes) to %dx%d (%d bytes)", config.Width, config.Height, len(data), width, height, len(downscaled)))
+
+			return downscaled, float64(config.Width) / float64(width), nil
+		}
+
+		ratio *= downscaleRatioStep
+	}
+
+	return nil, 1.0, fmt.Errorf("image is too large to be downscaled under %d bytes", conf().MsMaxImageBytes)
+}
+
+// scale given rectangle with given scale
+func scaleRectangle(rect cog.Rectangle, scale float64) cog.Rectangle {
+	if scale == 1.0 {
+		return rect
+	}
+
+	return cog.Rectangle{
+		Left:   int(math.Round(float64(rect.Left) * scale)),
+		Top:    int(math.Round(float64(rect.Top) * scale)),
+		Width:  int(math.Round(float64(rect.Width) * scale)),
+		Height: int(math.Round(float64(rect.Height) * scale)),
+	}
+}
+
+// scale coordinates of given detected faces back to the original resolution
+func scaleDetectedFaces(faces []DetectedFace, scale float64) []DetectedFace {
+	if scale == 1.0 {
+		return faces
+	}
+
+	for i, f := range faces {
+		faces[i].FaceRectangle = scaleRectangle(f.FaceRectangle, scale)
+		for name, p := range f.FaceLandmarks {
+			f.FaceLandmarks[name] = cog.Point{X: p.X * scale, Y: p.Y * scale}
+		}
+	}
+
+	return faces
+}
+
+// scale coordinates of given read result back to the original resolution
+func scaleReadResult(result ReadResult, scale float64) ReadResult {
+	if scale == 1.0 {
+		return result
+	}
+
+	for i, page := range result.AnalyzeResult.ReadResults {
+		result.AnalyzeResult.ReadResults[i].Width = page.Width * scale
+		result.AnalyzeResult.ReadResults[i].Height = page.Height * scale
+
+		for _, line := range page.Lines {
+			scaleBoundingBox(line.BoundingBox, scale)
+			for _, word := range line.Words {
+				scaleBoundingBox(word.BoundingBox, scale)
+			}
+		}
+	}
+
+	return result
+}
+
+// scale given bounding box (x1, y1, ..., x4, y4) in place
+func scaleBoundingBox(box []float64, scale float64) {
+	for i := range box {
+		box[i] *= scale
+	}
+}
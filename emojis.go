@@ -0,0 +1,65 @@
+package main
+
+// functions for the emojis of 'Emojify Faces'
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// emojis for each emotion (eg. 'happiness.png'), embedded in the binary
+//
+//go:embed assets/emojis/*.png
+var emojiFiles embed.FS
+
+// emotion whose emoji is drawn when there is no emoji for the strongest one
+const defaultEmojiEmotion = "neutral"
+
+var emojis map[string]image.Image
+
+// load all embedded emojis
+func loadEmojis() (map[string]image.Image, error) {
+	entries, err := emojiFiles.ReadDir("assets/emojis")
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := map[string]image.Image{}
+	for _, e := range entries {
+		data, err := emojiFiles.ReadFile(path.Join("assets/emojis", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode emoji '%s': %s", e.Name(), err)
+		}
+		loaded[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = img
+	}
+
+	return loaded, nil
+}
+
+// draw the emoji of given emotion over a face rectangle
+func drawEmoji(img *image.RGBA, rect cog.Rectangle, emotion string) {
+	emoji, exists := emojis[emotion]
+	if !exists {
+		if emoji, exists = emojis[defaultEmojiEmotion]; !exists {
+			return
+		}
+	}
+
+	// (a square which covers the whole face)
+	imaging.DrawCovering(img, emoji, image.Rect(rect.Left, rect.Top, rect.Left+rect.Width, rect.Top+rect.Height))
+}
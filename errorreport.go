@@ -0,0 +1,124 @@
+package main
+
+// functions for reporting errors to a Telegram chat (eg. of admins)
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// constants for error reports
+const (
+	defaultErrorReportIntervalSeconds = 60
+	maxErrorReportLength              = 1024
+)
+
+// errorContext struct for the context of an error while processing a job
+type errorContext struct {
+	ChatID  int64            `json:"chatId"`
+	UserID  int              `json:"userId"`
+	Command CognitiveCommand `json:"command,omitempty"`
+	FileID  string           `json:"fileId,omitempty"`
+}
+
+// log an error which occurred while processing a job, with its context
+//
+// (cancellations by users are not errors)
+func logJobError(message string, chatID int64, userID int, command CognitiveCommand, fileID string) {
+	level := LevelError
+	if message == messageCanceled || message == localizeFor(userID, messageCanceled) {
+		level = LevelInfo
+	}
+
+	logger.Log(level, message, errorContext{
+		ChatID:  chatID,
+		UserID:  userID,
+		Command: command,
+		FileID:  fileID,
+	})
+}
+
+// sink which sends error logs to a Telegram chat
+//
+// (same messages are sent at most once per interval, with the number of suppressed ones)
+type telegramSink struct {
+	chatID   int64
+	interval time.Duration
+
+	reported   map[string]time.Time // last reported time of each message
+	suppressed map[string]int       // number of suppressed reports of each message
+	sync.Mutex
+}
+
+// create a new telegram sink with given config
+func newTelegramSink(config LogSinkConfig) (*telegramSink, error) {
+	if config.ChatID == 0 {
+		return nil, fmt.Errorf("no chat id for telegram sink")
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = defaultErrorReportIntervalSeconds
+	}
+
+	return &telegramSink{
+		chatID:     config.ChatID,
+		interval:   time.Duration(config.IntervalSeconds) * time.Second,
+		reported:   map[string]time.Time{},
+		suppressed: map[string]int{},
+	}, nil
+}
+
+// Write sends an error log to the chat
+func (s *telegramSink) Write(entry LogEntry) error {
+	if entry.Level != LevelError.String() || client == nil {
+		return nil
+	}
+
+	s.Lock()
+	if last, exists := s.reported[entry.Message]; exists && time.Since(last) < s.interval {
+		s.suppressed[entry.Message]++
+		s.Unlock()
+		return nil
+	}
+	suppressed := s.suppressed[entry.Message]
+	s.reported[entry.Message] = entry.Time
+	delete(s.suppressed, entry.Message)
+
+	// (forget old ones)
+	for message, last := range s.reported {
+		if time.Since(last) >= s.interval {
+			delete(s.reported, message)
+		}
+	}
+	s.Unlock()
+
+	text := fmt.Sprintf("[%s] %s", appName, entry.Message)
+	if entry.Object != nil {
+		if bytes, err := json.Marshal(entry.Object); err == nil {
+			text += "\n" + string(bytes)
+		}
+	}
+	if suppressed > 0 {
+		text += fmt.Sprintf("\n(+%d same error(s) during the last %s)", suppressed, s.interval)
+	}
+	if runes := []rune(text); len(runes) > maxErrorReportLength {
+		text = string(runes[:maxErrorReportLength]) + "..."
+	}
+
+	// (not to block the caller)
+	go func() {
+		if sent := client.SendMessage(s.chatID, text, map[string]interface{}{
+			"disable_web_page_preview": true,
+		}); !sent.Ok {
+			logger.Warn(fmt.Sprintf("Failed to report error: %s", *sent.Description))
+		}
+	}()
+
+	return nil
+}
+
+// Close does nothing for Telegram
+func (s *telegramSink) Close() error {
+	return nil
+}
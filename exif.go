@@ -0,0 +1,294 @@
+package main
+
+// functions for inspecting and stripping EXIF metadata of images
+//
+// (photos are stripped by Telegram, so only images sent as documents have EXIF)
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// EXIF tags
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagSoftware         = 0x0131
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	exifTagLensModel        = 0xA434
+
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitude     = 0x0006
+)
+
+// quality of re-encoded JPEG images without metadata
+const strippedJPEGQuality = 95
+
+// sizes of TIFF field types (in bytes)
+var tiffTypeSizes = map[uint16]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+func init() {
+	registerCommand(newCommand(ImageInfo, "II", handleImageInfo), MediaImage)
+	registerCommand(newCommand(StripMetadata, "SX", handleStripMetadata), MediaImage)
+
+	// (both of them need EXIF of original images)
+	originalImageCommands[ImageInfo] = true
+	originalImageCommands[StripMetadata] = true
+
+	// (images without metadata should not be recompressed by Telegram)
+	documentOnlyCommands[StripMetadata] = true
+}
+
+// ExifInfo struct for EXIF metadata of an image
+type ExifInfo struct {
+	Make     string
+	Model    string
+	Lens     string
+	Software string
+	TakenAt  string
+
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// tiffEntry struct for an entry of an IFD
+type tiffEntry struct {
+	kind  uint16
+	count int
+	value []byte
+}
+
+// read entries of the IFD at given offset of TIFF bytes
+func readIFD(tiff []byte, order binary.ByteOrder, offset int) map[uint16]tiffEntry {
+	entries := map[uint16]tiffEntry{}
+	if offset <= 0 || offset+2 > len(tiff) {
+		return entries
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		tag, kind, n := order.Uint16(tiff[entry:]), order.Uint16(tiff[entry+2:]), int(order.Uint32(tiff[entry+4:]))
+		size, known := tiffTypeSizes[kind]
+		if !known || n <= 0 {
+			continue
+		}
+
+		// (values larger than 4 bytes are stored at the offset)
+		start := entry + 8
+		if size*n > 4 {
+			start = int(order.Uint32(tiff[entry+8:]))
+		}
+		if start < 0 || start+size*n > len(tiff) {
+			continue
+		}
+
+		entries[tag] = tiffEntry{kind: kind, count: n, value: tiff[start : start+size*n]}
+	}
+
+	return entries
+}
+
+// ASCII value of an entry
+func (e tiffEntry) ascii() string {
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// integer value of a SHORT or LONG entry
+func (e tiffEntry) integer(order binary.ByteOrder) int {
+	switch e.kind {
+	case 3:
+		return int(order.Uint16(e.value))
+	case 4:
+		return int(order.Uint32(e.value))
+	}
+
+	return 0
+}
+
+// values of a RATIONAL entry
+func (e tiffEntry) rationals(order binary.ByteOrder) []float64 {
+	values := []float64{}
+	if e.kind != 5 {
+		return values
+	}
+
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		numerator, denominator := order.Uint32(e.value[i:]), order.Uint32(e.value[i+4:])
+		if denominator == 0 {
+			values = append(values, 0)
+		} else {
+			values = append(values, float64(numerator)/float64(denominator))
+		}
+	}
+
+	return values
+}
+
+// read EXIF metadata from given JPEG bytes
+func readExif(data []byte) (info ExifInfo, exists bool) {
+	tiff := exifTIFF(data)
+	if len(tiff) < 8 {
+		return info, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info, false
+	}
+
+	ifd0 := readIFD(tiff, order, int(order.Uint32(tiff[4:])))
+	info.Make = ifd0[exifTagMake].ascii()
+	info.Model = ifd0[exifTagModel].ascii()
+	info.Software = ifd0[exifTagSoftware].ascii()
+	info.TakenAt = ifd0[exifTagDateTime].ascii()
+
+	if e, exists := ifd0[exifTagExifIFD]; exists {
+		exif := readIFD(tiff, order, e.integer(order))
+		if taken := exif[exifTagDateTimeOriginal].ascii(); taken != "" {
+			info.TakenAt = taken
+		}
+		info.Lens = exif[exifTagLensModel].ascii()
+	}
+
+	if e, exists := ifd0[exifTagGPSIFD]; exists {
+		gps := readIFD(tiff, order, e.integer(order))
+
+		lat, latExists := gps[gpsTagLatitude]
+		lon, lonExists := gps[gpsTagLongitude]
+		if latExists && lonExists {
+			info.HasGPS = true
+			info.Latitude = degreesOf(lat.rationals(order), gps[gpsTagLatitudeRef].ascii() == "S")
+			info.Longitude = degreesOf(lon.rationals(order), gps[gpsTagLongitudeRef].ascii() == "W")
+			if alt := gps[gpsTagAltitude].rationals(order); len(alt) > 0 {
+				info.Altitude = alt[0]
+			}
+		}
+	}
+
+	return info, true
+}
+
+// convert degrees, minutes, and seconds to degrees
+func degreesOf(dms []float64, negative bool) float64 {
+	degrees := 0.0
+	for i, divisor := range []float64{1, 60, 3600} {
+		if i < len(dms) {
+			degrees += dms[i] / divisor
+		}
+	}
+
+	if negative {
+		return -degrees
+	}
+
+	return degrees
+}
+
+// report format, size, and EXIF metadata of given image bytes
+func handleImageInfo(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	lines := []string{
+		fmt.Sprintf("Format: %s", format),
+		fmt.Sprintf("Size: %dx%d (%.1f KB)", config.Width, config.Height, float64(len(imageBytes))/1024.0),
+	}
+
+	if info, exists := readExif(imageBytes); exists {
+		for _, field := range [][2]string{
+			{"Camera", strings.TrimSpace(info.Make + " " + info.Model)},
+			{"Lens", info.Lens},
+			{"Software", info.Software},
+			{"Taken at", info.TakenAt},
+		} {
+			if field[1] != "" {
+				lines = append(lines, fmt.Sprintf("%s: %s", field[0], field[1]))
+			}
+		}
+		if orientation := exifOrientation(imageBytes); orientation > 1 {
+			lines = append(lines, fmt.Sprintf("Orientation: %d", orientation))
+		}
+
+		if info.HasGPS {
+			lines = append(lines,
+				fmt.Sprintf("GPS: %.6f, %.6f (altitude: %.1fm)", info.Latitude, info.Longitude, info.Altitude),
+				"",
+				fmt.Sprintf("⚠️ This image reveals where it was taken. Use '%s' before sharing it.", StripMetadata),
+			)
+		}
+	} else {
+		lines = append(lines, "", "No EXIF metadata. (Photos are stripped by Telegram, so send images as files for inspecting them.)")
+	}
+
+	result.Message = strings.Join(lines, "\n")
+
+	return result, nil
+}
+
+// re-encode given image bytes without any metadata (orientation is applied to the pixels)
+func handleStripMetadata(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	info, hasExif := readExif(imageBytes)
+
+	img, format, err := image.Decode(bytes.NewReader(uprightImage(imageBytes)))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	if format == "jpeg" {
+		if result.Image, err = imaging.EncodeWithPool(func(w io.Writer) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: strippedJPEGQuality})
+		}); err != nil {
+			return result, fmt.Errorf("Failed to encode image: %s", err)
+		}
+	} else if result.Image, err = encodeImage(img); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	if hasExif && info.HasGPS {
+		result.Message = "⚠️ GPS location was found on this image, and removed with other metadata."
+	} else if hasExif {
+		result.Message = "Removed metadata from this image."
+	} else {
+		result.Message = "There was no EXIF metadata, but the image was re-encoded anyway."
+	}
+
+	return result, nil
+}
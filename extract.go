@@ -0,0 +1,75 @@
+package main
+
+// functions for extracting detected faces as separate images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// margin around each extracted face, relative to its size
+const extractedFaceMarginRatio = 0.3
+
+func init() {
+	registerCommand(newCommand(ExtractFaces, "XF", handleExtractFaces), MediaImage, MediaVideo)
+}
+
+// crop every detected face on given image bytes, and send them as an album
+func handleExtractFaces(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	faces, err := visionFor(ExtractFaces).DetectFaces(ctx, imageBytes, false, false, nil)
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	for i, f := range faces {
+		if i >= maxAlbumImages {
+			break
+		}
+
+		if encoded, err := encodeImage(cropFace(img, f.FaceRectangle, extractedFaceMarginRatio)); err == nil {
+			result.Images = append(result.Images, encoded)
+		} else {
+			return result, fmt.Errorf("Failed to encode image: %s", err)
+		}
+	}
+
+	if len(faces) > maxAlbumImages {
+		result.Message = fmt.Sprintf("Extracted %d of %d faces.", maxAlbumImages, len(faces))
+	} else {
+		result.Message = fmt.Sprintf("Extracted %d face(s).", len(faces))
+	}
+
+	return result, nil
+}
+
+// crop given face rectangle with a margin (relative to its size) from an image
+func cropFace(img image.Image, rect cog.Rectangle, marginRatio float64) *image.RGBA {
+	marginX, marginY := int(float64(rect.Width)*marginRatio), int(float64(rect.Height)*marginRatio)
+
+	bounds := image.Rect(
+		rect.Left-marginX,
+		rect.Top-marginY,
+		rect.Left+rect.Width+marginX,
+		rect.Top+rect.Height+marginY,
+	).Intersect(img.Bounds())
+
+	cropped := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, bounds.Min, draw.Src)
+
+	return cropped
+}
@@ -0,0 +1,450 @@
+package main
+
+// commands for faces on images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/llgcode/draw2d/draw2dimg"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// styles of masking faces
+const (
+	maskStylePixelate = imaging.MaskStylePixelate // default
+	maskStyleBlur     = imaging.MaskStyleBlur
+	maskStyleSolid    = imaging.MaskStyleSolid
+
+	defaultMaskStrength = 0.125 // (1/8 of the face width)
+)
+
+// sizes of drawings, relative to the width of each face
+const (
+	headPoseArrowRatio = 0.8
+	countFacesDotRatio = 0.1
+)
+
+func init() {
+	registerCommand(newCommand(Emotion, "E", handleEmotion), MediaImage, MediaVideo, MediaAlbum)
+	registerCommand(newCommand(Face, "F", handleFaces(Face)), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+	registerCommand(newCommand(CensorEyes, "C", handleFaces(CensorEyes)), MediaImage, MediaVideo, MediaAlbum)
+	registerCommand(newCommand(MaskFaces, "M", handleFaces(MaskFaces)), MediaImage, MediaVideo, MediaAlbum)
+	registerCommand(newCommand(DealWithIt, "DW", handleFaces(DealWithIt)), MediaImage, MediaVideo, MediaAlbum)
+	registerCommand(newCommand(EmojifyFaces, "EF", handleFaces(EmojifyFaces)), MediaImage, MediaVideo, MediaAlbum)
+	registerCommand(newCommand(CountFaces, "CF", handleCountFaces), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// recognize emotions of faces on given image bytes
+func handleEmotion(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	errorMessage := ""
+
+	// a photo (draw squares on detected faces) and emotions in text
+	if faces, err := visionFor(Emotion).DetectFaces(ctx, imageBytes, false, false, []string{"emotion"}); err == nil {
+		if len(faces) > 0 {
+			// decode image
+			if img, _, err := image.Decode(bytes.NewReader(imageBytes)); err == nil {
+				var rect cog.Rectangle
+				var emos []string
+
+				// copy to a new image, and prepare for drawing
+				newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+				for i, f := range faces {
+					var scores []string
+					rect = f.FaceRectangle
+
+					// set color
+					color := colorForIndex(i)
+					gc.SetStrokeColor(color)
+					fc.SetSrc(&image.Uniform{color})
+
+					// draw rectangles and their indices on detected faces
+					drawRectangle(gc, rect)
+
+					// draw face label
+					drawLabel(fc, fmt.Sprintf("Face #%d", i+1), rect, fontSize)
+
+					// emotion string
+					for k, v := range f.FaceAttributes.Emotion {
+						scores = append(scores, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
+					}
+					emos = append(emos, strings.Join(scores, "\n"))
+				}
+				gc.Save()
+
+				// build up emotions string
+				var strs []string
+				for i, e := range emos {
+					strs = append(strs,
+						fmt.Sprintf(`[Face #%d]
+%s`,
+							i+1,
+							e,
+						),
+					)
+				}
+				result.Message = strings.Join(strs, "\n\n")
+
+				// a photo with rectangles drawn on detected faces
+				if result.Image, err = encodeImage(newImg); err != nil {
+					errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
+				}
+			} else {
+				errorMessage = fmt.Sprintf("Failed to decode image: %s", err)
+			}
+		} else {
+			errorMessage = "No emotion recognized on this image."
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to recognize emotion: %s", err)
+	}
+
+	if errorMessage != "" {
+		return result, errors.New(errorMessage)
+	}
+
+	return result, nil
+}
+
+// count faces on given image bytes, and mark them with dots
+//
+// (no attributes nor landmarks are requested, for speed)
+func handleCountFaces(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	faces, err := visionFor(CountFaces).DetectFaces(ctx, imageBytes, false, false, nil)
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	newImg, gc, _, _ := prepareAnnotation(img)
+	for i, f := range faces {
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		gc.SetFillColor(color)
+
+		// (dots are sized relative to faces)
+		r := float64(f.FaceRectangle.Width) * countFacesDotRatio
+		if r < conf().CircleRadius {
+			r = conf().CircleRadius
+		}
+		x := float64(f.FaceRectangle.Left) + float64(f.FaceRectangle.Width)/2.0
+		y := float64(f.FaceRectangle.Top) + float64(f.FaceRectangle.Height)/2.0
+		gc.MoveTo(x+r, y)
+		gc.ArcTo(x, y, r, r, 0, -math.Pi*2)
+		gc.Close()
+		gc.FillStroke()
+	}
+	gc.Save()
+
+	if len(faces) == 1 {
+		result.Message = "1 person detected."
+	} else {
+		result.Message = fmt.Sprintf("%d people detected.", len(faces))
+	}
+
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// detect faces on given image bytes, and annotate (Face), censor eyes (CensorEyes), mask (MaskFaces), put sunglasses on (DealWithIt), or emojify (EmojifyFaces) them
+func handleFaces(command CognitiveCommand) CommandHandler {
+	return func(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+		errorMessage := ""
+
+		if faces, err := visionFor(command).DetectFaces(ctx, imageBytes, true, true, []string{"age", "gender", "headPose", "smile", "facialHair", "glasses", "emotion"}); err == nil {
+			if len(faces) > 0 {
+				// decode image
+				if img, _, err := image.Decode(bytes.NewReader(imageBytes)); err == nil {
+					var rect cog.Rectangle
+
+					// copy to a new image, and prepare for drawing
+					//
+					// (the original one is kept intact for comparing)
+					annotated := img
+					if shouldCompare(command) {
+						annotated = imaging.CopyRGBA(img)
+					}
+					newImg, gc, fc, fontSize := prepareAnnotation(annotated)
+
+					// build up facial attributes string
+					strs := []string{}
+					var facialHairs, headPoses, emotions []string
+					for i, f := range faces {
+						// skip faces which were not selected
+						if !isFaceSelected(ctx, i) {
+							continue
+						}
+
+						switch command {
+						case Face:
+							// set color
+							color := colorForIndex(i)
+							gc.SetStrokeColor(color)
+							fc.SetSrc(&image.Uniform{color})
+
+							// draw rectangles and their indices on detected faces
+							rect = f.FaceRectangle
+							drawRectangle(gc, rect)
+
+							// draw face label (with age and gender, if detected)
+							drawLabel(fc, faceLabel(i, f.FaceAttributes), rect, fontSize)
+
+							// mark face landmarks
+							if hasAllKeys([]string{
+								"noseTip",
+								"pupilRight",
+								"pupilLeft",
+								"mouthRight",
+								"mouthLeft",
+							}, f.FaceLandmarks) {
+								// mark nose tip
+								n, _ := f.FaceLandmarks["noseTip"]
+								gc.MoveTo(n.X, n.Y)
+								gc.ArcTo(n.X, n.Y, conf().CircleRadius, conf().CircleRadius, 0, -math.Pi*2)
+								gc.Close()
+								gc.FillStroke()
+
+								// mark right pupil
+								r, _ := f.FaceLandmarks["pupilRight"]
+								gc.MoveTo(r.X, r.Y)
+								gc.ArcTo(r.X, r.Y, conf().CircleRadius, conf().CircleRadius, 0, -math.Pi*2)
+								gc.Close()
+								gc.FillStroke()
+
+								// mark left pupil
+								l, _ := f.FaceLandmarks["pupilLeft"]
+								gc.MoveTo(l.X, l.Y)
+								gc.ArcTo(l.X, l.Y, conf().CircleRadius, conf().CircleRadius, 0, -math.Pi*2)
+								gc.Close()
+								gc.FillStroke()
+
+								// mark mouth
+								m1, _ := f.FaceLandmarks["mouthRight"]
+								m2, _ := f.FaceLandmarks["mouthLeft"]
+								gc.MoveTo(m1.X, m1.Y)
+								gc.LineTo(m2.X, m2.Y)
+								gc.Close()
+								gc.FillStroke()
+							}
+
+							// draw head pose (from the nose tip, or the center of the face)
+							if len(f.FaceAttributes.HeadPose) > 0 {
+								origin := cog.Point{X: float64(rect.Left) + float64(rect.Width)/2.0, Y: float64(rect.Top) + float64(rect.Height)/2.0}
+								if n, exists := f.FaceLandmarks["noseTip"]; exists {
+									origin = n
+								}
+								drawHeadPose(gc, origin, float64(rect.Width)*headPoseArrowRatio, f.FaceAttributes.HeadPose)
+							}
+
+							// descriptions
+							facialHairs = []string{}
+							for k, v := range f.FaceAttributes.FacialHair {
+								facialHairs = append(facialHairs, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
+							}
+							headPoses = []string{}
+							for k, v := range f.FaceAttributes.HeadPose {
+								headPoses = append(headPoses, fmt.Sprintf("  %s: %.2f°", k, v))
+							}
+							emotions = []string{}
+							for k, v := range f.FaceAttributes.Emotion {
+								emotions = append(emotions, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
+							}
+
+							strs = append(strs,
+								fmt.Sprintf(`[Face #%d]
+> Age: %s
+> Gender: %s
+> Smile: %.3f%%
+> Glasses: %s
+> Facial Hair
+%s
+> Head Pose
+%s
+> Emotion
+%s`,
+									i+1,
+									valueOrUnknown(fmt.Sprintf("%.0f", f.FaceAttributes.Age), f.FaceAttributes.Age > 0),
+									valueOrUnknown(f.FaceAttributes.Gender, f.FaceAttributes.Gender != ""),
+									f.FaceAttributes.Smile*100.0,
+									valueOrUnknown(f.FaceAttributes.Glasses, f.FaceAttributes.Glasses != ""),
+									strings.Join(facialHairs, "\n"),
+									strings.Join(headPoses, "\n"),
+									strings.Join(emotions, "\n"),
+								),
+							)
+						case CensorEyes:
+							if hasAllKeys([]string{
+								"eyeLeftTop",
+								"eyeLeftBottom",
+								"eyeLeftOuter",
+								"eyeRightTop",
+								"eyeRightBottom",
+								"eyeRightOuter",
+							}, f.FaceLandmarks) {
+								// eye points
+								lt, _ := f.FaceLandmarks["eyeLeftTop"]
+								lb, _ := f.FaceLandmarks["eyeLeftBottom"]
+								lo, _ := f.FaceLandmarks["eyeLeftOuter"]
+								rt, _ := f.FaceLandmarks["eyeRightTop"]
+								rb, _ := f.FaceLandmarks["eyeRightBottom"]
+								ro, _ := f.FaceLandmarks["eyeRightOuter"]
+
+								// get mask points
+								lu, ll, rl, ru := genMaskPoints(lt, lb, lo, rt, rb, ro)
+
+								// set mask color
+								gc.SetFillColor(loaded().maskColor)
+
+								// fill mask
+								gc.MoveTo(lu.X, lu.Y)
+								gc.LineTo(ll.X, ll.Y)
+								gc.LineTo(rl.X, rl.Y)
+								gc.LineTo(ru.X, ru.Y)
+								gc.LineTo(lu.X, lu.Y)
+								gc.Close()
+								gc.Fill()
+							}
+						case MaskFaces:
+							// pixelate, blur, or fill face rects
+							maskFace(newImg, f.FaceRectangle, conf().MaskFacesStyle, conf().MaskFacesStrength)
+						case DealWithIt:
+							if hasAllKeys([]string{
+								"pupilLeft",
+								"pupilRight",
+							}, f.FaceLandmarks) {
+								l, _ := f.FaceLandmarks["pupilLeft"]
+								r, _ := f.FaceLandmarks["pupilRight"]
+
+								drawSunglasses(newImg, l, r)
+							}
+						case EmojifyFaces:
+							// cover the face with the emoji of its strongest emotion
+							drawEmoji(newImg, f.FaceRectangle, strongestEmotion(f.FaceAttributes.Emotion))
+						}
+					}
+					gc.Save()
+
+					// build up message
+					if command == Face {
+						result.Message = strings.Join(strs, "\n\n")
+					}
+
+					// a photo with rectangles drawn on detected faces
+					// (or the original and censored ones side by side)
+					var output image.Image = newImg
+					if shouldCompare(command) {
+						output = imaging.SideBySide(img, newImg)
+					}
+					if result.Image, err = encodeImage(output); err != nil {
+						errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
+					}
+				} else {
+					errorMessage = fmt.Sprintf("Failed to decode image: %s", err)
+				}
+			} else {
+				errorMessage = "No face detected on this image."
+			}
+		} else {
+			errorMessage = fmt.Sprintf("Failed to detect faces: %s", err)
+		}
+
+		if errorMessage != "" {
+			return result, errors.New(errorMessage)
+		}
+
+		return result, nil
+	}
+}
+
+// mask given face rectangle with a style and its strength
+//
+// (strength is the size of pixels, or the sigma of blur, relative to the width of the face)
+func maskFace(img *image.RGBA, rect cog.Rectangle, style string, strength float64) {
+	imaging.Mask(img, image.Rect(rect.Left, rect.Top, rect.Left+rect.Width, rect.Top+rect.Height), style, strength, loaded().maskColor)
+}
+
+// label of a face, with its gender and age if detected (eg. "Face #1 — M, 34")
+func faceLabel(index int, attributes FaceAttributes) string {
+	label := fmt.Sprintf("Face #%d", index+1)
+
+	details := []string{}
+	if attributes.Gender != "" {
+		details = append(details, strings.ToUpper(attributes.Gender[:1]))
+	}
+	if attributes.Age > 0 {
+		details = append(details, fmt.Sprintf("%.0f", attributes.Age))
+	}
+	if len(details) > 0 {
+		label += " — " + strings.Join(details, ", ")
+	}
+
+	return label
+}
+
+// given value, or "unknown" if it is not available
+func valueOrUnknown(value string, available bool) string {
+	if available {
+		return value
+	}
+
+	return "unknown"
+}
+
+// draw an arrow for the direction of a head pose, and a shorter line for its up direction (rolled)
+//
+// (yaw, pitch, and roll are in degrees)
+func drawHeadPose(gc *draw2dimg.GraphicContext, origin cog.Point, length float64, headPose map[string]float64) {
+	yaw := headPose["yaw"] * math.Pi / 180.0
+	pitch := headPose["pitch"] * math.Pi / 180.0
+	roll := headPose["roll"] * math.Pi / 180.0
+
+	// up direction
+	gc.MoveTo(origin.X, origin.Y)
+	gc.LineTo(origin.X+math.Sin(roll)*length/2.0, origin.Y-math.Cos(roll)*length/2.0)
+	gc.Stroke()
+
+	// facing direction, projected on the image
+	dx, dy := math.Sin(yaw)*math.Cos(pitch)*length, -math.Sin(pitch)*length
+	tipX, tipY := origin.X+dx, origin.Y+dy
+	if math.Hypot(dx, dy) < conf().CircleRadius {
+		// (facing straight to the camera)
+		gc.MoveTo(origin.X+conf().CircleRadius*2, origin.Y)
+		gc.ArcTo(origin.X, origin.Y, conf().CircleRadius*2, conf().CircleRadius*2, 0, -math.Pi*2)
+		gc.Close()
+		gc.Stroke()
+		return
+	}
+	gc.MoveTo(origin.X, origin.Y)
+	gc.LineTo(tipX, tipY)
+	gc.Stroke()
+
+	// arrow head
+	angle := math.Atan2(dy, dx)
+	headLength := length * 0.2
+	for _, a := range []float64{angle + math.Pi*5.0/6.0, angle - math.Pi*5.0/6.0} {
+		gc.MoveTo(tipX, tipY)
+		gc.LineTo(tipX+math.Cos(a)*headLength, tipY+math.Sin(a)*headLength)
+		gc.Stroke()
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+// functions for fonts of annotations
+
+import (
+	// for embedding the default font
+	_ "embed"
+	"io/ioutil"
+
+	// for using .ttf
+	"github.com/golang/freetype/truetype"
+)
+
+// default font, embedded in the binary
+//
+//go:embed fonts/RobotoCondensed-Regular.ttf
+var defaultFontBytes []byte
+
+// default size of fonts, relative to the height of an image
+const defaultFontSizeRatio = 1.0 / 24.0
+
+// load font from given filepath, or the default font if it is empty
+func loadFont(filepath string) (*truetype.Font, error) {
+	fontBytes := defaultFontBytes
+	if filepath != "" {
+		var err error
+		if fontBytes, err = ioutil.ReadFile(filepath); err != nil {
+			return nil, err
+		}
+	}
+
+	return truetype.Parse(fontBytes)
+}
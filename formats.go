@@ -0,0 +1,113 @@
+package main
+
+// functions for loading images in various formats
+//
+// images are converted to PNG unless they are in JPEG or PNG, which all vision services accept
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	// for registering decoders of other formats
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// constants for image formats
+const (
+	heicConverterCommand = "heif-convert" // in libheif-examples
+)
+
+// brands of HEIF/HEIC images (in their 'ftyp' boxes)
+var heicBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"}
+
+// download an image from given url, and convert it to JPEG or PNG if needed
+func loadImage(ctx context.Context, fileURL string) ([]byte, error) {
+	data, err := downloadBytes(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return normalizeImage(ctx, data)
+}
+
+// convert given image bytes to PNG, unless they are in JPEG or PNG
+func normalizeImage(ctx context.Context, data []byte) ([]byte, error) {
+	if isHEIC(data) {
+		converted, err := convertHEIC(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return converted, checkImageLimits(converted)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image format: %s", err)
+	}
+	if err = checkImageDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+	if format == "jpeg" || format == "png" {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeImage(img)
+}
+
+// check if given bytes are of a HEIF/HEIC image
+func isHEIC(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+
+	brand := string(data[8:12])
+	for _, b := range heicBrands {
+		if brand == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// convert given HEIF/HEIC bytes to PNG with an external command
+func convertHEIC(ctx context.Context, data []byte) (converted []byte, err error) {
+	var dir string
+	if dir, err = ioutil.TempDir("", "heic"); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inputFilepath := filepath.Join(dir, "input.heic")
+	outputFilepath := filepath.Join(dir, "output.png")
+	if err = ioutil.WriteFile(inputFilepath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, heicConverterCommand, inputFilepath, outputFilepath)
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to convert HEIC image: %s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ioutil.ReadFile(outputFilepath)
+}
@@ -0,0 +1,125 @@
+package main
+
+// functions for analyzing forms with prebuilt models of Form Recognizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// constants for Form Recognizer
+const (
+	formRecognizerPath = "/formrecognizer/v2.1/prebuilt"
+
+	// prebuilt models
+	formModelReceipt      = "receipt"
+	formModelBusinessCard = "businessCard"
+)
+
+// FormResult struct for the result of Form Recognizer
+type FormResult struct {
+	Status        string `json:"status"`
+	AnalyzeResult struct {
+		DocumentResults []struct {
+			DocType string               `json:"docType"`
+			Fields  map[string]FormField `json:"fields"`
+		} `json:"documentResults"`
+	} `json:"analyzeResult"`
+}
+
+// FormField struct for a recognized field
+type FormField struct {
+	Type             string               `json:"type"`
+	ValueString      string               `json:"valueString,omitempty"`
+	ValueDate        string               `json:"valueDate,omitempty"`
+	ValueTime        string               `json:"valueTime,omitempty"`
+	ValuePhoneNumber string               `json:"valuePhoneNumber,omitempty"`
+	ValueNumber      float64              `json:"valueNumber,omitempty"`
+	ValueInteger     int                  `json:"valueInteger,omitempty"`
+	ValueArray       []FormField          `json:"valueArray,omitempty"`
+	ValueObject      map[string]FormField `json:"valueObject,omitempty"`
+	Text             string               `json:"text"`
+	Confidence       float64              `json:"confidence"`
+}
+
+// String returns the value of a field as a string
+func (f FormField) String() string {
+	switch f.Type {
+	case "string":
+		return f.ValueString
+	case "date":
+		return f.ValueDate
+	case "time":
+		return f.ValueTime
+	case "phoneNumber":
+		return f.ValuePhoneNumber
+	case "number":
+		return fmt.Sprintf("%.2f", f.ValueNumber)
+	case "integer":
+		return fmt.Sprintf("%d", f.ValueInteger)
+	case "array":
+		values := []string{}
+		for _, v := range f.ValueArray {
+			values = append(values, v.String())
+		}
+		return strings.Join(values, ", ")
+	}
+
+	return f.Text
+}
+
+// fields of the first document in the result
+func (r FormResult) Fields() map[string]FormField {
+	if len(r.AnalyzeResult.DocumentResults) > 0 {
+		return r.AnalyzeResult.DocumentResults[0].Fields
+	}
+
+	return map[string]FormField{}
+}
+
+// base url of Form Recognizer's prebuilt models
+func formRecognizerAPIURL() string {
+	return serviceAPIURL(conf().MsFormRecognizerEndpoint, conf().MsFormRecognizerRegion, formRecognizerPath)
+}
+
+// analyze given image bytes with a prebuilt model of Form Recognizer
+//
+// (it is an asynchronous operation, so the result will be polled until it succeeds,
+// and `progress` will be called with the status and elapsed time on each polling)
+func analyzeForm(ctx context.Context, model string, image []byte, progress func(status string, elapsed time.Duration)) (result FormResult, err error) {
+	var operationURL string
+	if operationURL, err = postImageBytesAsync(
+		ctx,
+		fmt.Sprintf("%s/%s/analyze", formRecognizerAPIURL(), model),
+		conf().MsFormRecognizerSubscriptionKey,
+		image,
+	); err != nil {
+		return result, err
+	}
+
+	started := time.Now()
+	for i := 0; i < asyncOperationMaxPollingCount; i++ {
+		if err = sleep(ctx, asyncOperationPollingIntervalSeconds*time.Second); err != nil {
+			return result, err
+		}
+
+		if err = getJSON(withPolling(ctx), operationURL, conf().MsFormRecognizerSubscriptionKey, &result); err != nil {
+			return result, err
+		}
+
+		switch strings.ToLower(result.Status) {
+		case "succeeded":
+			return result, nil
+		case "failed":
+			return result, fmt.Errorf("operation failed")
+		}
+
+		if progress != nil {
+			progress(result.Status, time.Since(started))
+		}
+	}
+
+	return result, fmt.Errorf("operation timed out")
+}
@@ -0,0 +1,13 @@
+module github.com/meinside/telegram-ms-cognitive-bot
+
+go 1.17
+
+require (
+	github.com/disintegration/gift v1.2.1
+	github.com/esimov/pigo v1.4.6
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+	github.com/gomodule/redigo v1.8.9
+	github.com/llgcode/draw2d v0.0.0-20180124133339-274031cf2abe
+	github.com/mattn/go-sqlite3 v1.14.0
+	golang.org/x/image v0.18.0
+)
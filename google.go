@@ -0,0 +1,361 @@
+package main
+
+// VisionProvider implementation with Google Cloud Vision
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// constants for Google Cloud Vision
+const (
+	googleVisionAPIURL = "https://vision.googleapis.com/v1/images:annotate"
+
+	googleVisionMaxLabels = 20
+)
+
+// VisionProvider implementation with Google Cloud Vision
+type googleVision struct{}
+
+// GoogleAnnotateResponse struct for the response of Google Cloud Vision
+type GoogleAnnotateResponse struct {
+	LabelAnnotations []struct {
+		Description string  `json:"description"`
+		Score       float64 `json:"score"`
+	} `json:"labelAnnotations"`
+	FaceAnnotations            []GoogleFaceAnnotation `json:"faceAnnotations"`
+	LocalizedObjectAnnotations []struct {
+		Name         string             `json:"name"`
+		Score        float64            `json:"score"`
+		BoundingPoly GoogleBoundingPoly `json:"boundingPoly"`
+	} `json:"localizedObjectAnnotations"`
+	SafeSearchAnnotation struct {
+		Adult    string `json:"adult"`
+		Racy     string `json:"racy"`
+		Violence string `json:"violence"`
+	} `json:"safeSearchAnnotation"`
+	FullTextAnnotation struct {
+		Pages []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+			Blocks []struct {
+				Paragraphs []struct {
+					Words []GoogleWord `json:"words"`
+				} `json:"paragraphs"`
+			} `json:"blocks"`
+		} `json:"pages"`
+	} `json:"fullTextAnnotation"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// GoogleBoundingPoly struct for a bounding polygon
+type GoogleBoundingPoly struct {
+	Vertices           []cog.Point `json:"vertices"`
+	NormalizedVertices []cog.Point `json:"normalizedVertices"`
+}
+
+// GoogleFaceAnnotation struct for a detected face
+type GoogleFaceAnnotation struct {
+	FdBoundingPoly GoogleBoundingPoly `json:"fdBoundingPoly"`
+	Landmarks      []struct {
+		Type     string    `json:"type"`
+		Position cog.Point `json:"position"`
+	} `json:"landmarks"`
+	RollAngle          float64 `json:"rollAngle"`
+	PanAngle           float64 `json:"panAngle"`
+	TiltAngle          float64 `json:"tiltAngle"`
+	JoyLikelihood      string  `json:"joyLikelihood"`
+	SorrowLikelihood   string  `json:"sorrowLikelihood"`
+	AngerLikelihood    string  `json:"angerLikelihood"`
+	SurpriseLikelihood string  `json:"surpriseLikelihood"`
+}
+
+// GoogleWord struct for a recognized word
+type GoogleWord struct {
+	BoundingBox GoogleBoundingPoly `json:"boundingBox"`
+	Symbols     []struct {
+		Text     string `json:"text"`
+		Property struct {
+			DetectedBreak struct {
+				Type string `json:"type"`
+			} `json:"detectedBreak"`
+		} `json:"property"`
+	} `json:"symbols"`
+	Confidence float64 `json:"confidence"`
+}
+
+// landmarks of Google Cloud Vision, in names of Face API
+var googleLandmarks = map[string]string{
+	"LEFT_EYE_PUPIL":            "pupilLeft",
+	"RIGHT_EYE_PUPIL":           "pupilRight",
+	"NOSE_TIP":                  "noseTip",
+	"MOUTH_LEFT":                "mouthLeft",
+	"MOUTH_RIGHT":               "mouthRight",
+	"LEFT_EYE_TOP_BOUNDARY":     "eyeLeftTop",
+	"LEFT_EYE_BOTTOM_BOUNDARY":  "eyeLeftBottom",
+	"LEFT_EYE_LEFT_CORNER":      "eyeLeftOuter",
+	"RIGHT_EYE_TOP_BOUNDARY":    "eyeRightTop",
+	"RIGHT_EYE_BOTTOM_BOUNDARY": "eyeRightBottom",
+	"RIGHT_EYE_RIGHT_CORNER":    "eyeRightOuter",
+}
+
+// annotate given image bytes with features of Google Cloud Vision
+func (googleVision) annotate(ctx context.Context, image []byte, features ...string) (result GoogleAnnotateResponse, err error) {
+	if conf().GoogleVisionAPIKey == "" {
+		return result, errors.New("no api key for Google Cloud Vision")
+	}
+
+	type feature struct {
+		Type       string `json:"type"`
+		MaxResults int    `json:"maxResults,omitempty"`
+	}
+	fs := []feature{}
+	for _, f := range features {
+		fs = append(fs, feature{Type: f, MaxResults: googleVisionMaxLabels})
+	}
+
+	var data []byte
+	if data, err = json.Marshal(map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{
+				"image": map[string]interface{}{
+					"content": image, // (marshalled as base64)
+				},
+				"features": fs,
+			},
+		},
+	}); err != nil {
+		return result, err
+	}
+
+	resp, err := doRequestWithHeaders(ctx, "POST", googleVisionAPIURL, map[string]string{
+		"X-Goog-Api-Key": conf().GoogleVisionAPIKey,
+	}, "application/json", data)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Responses []GoogleAnnotateResponse `json:"responses"`
+	}
+	if err = readJSON(resp, &response); err != nil {
+		return result, err
+	}
+	if len(response.Responses) <= 0 {
+		return result, errors.New("no response from Google Cloud Vision")
+	}
+
+	result = response.Responses[0]
+	if result.Error != nil {
+		return result, fmt.Errorf("%s (%d)", result.Error.Message, result.Error.Code)
+	}
+
+	return result, nil
+}
+
+// DetectFaces detects faces on given image bytes
+//
+// (face ids are not supported)
+func (g googleVision) DetectFaces(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) (result []DetectedFace, err error) {
+	annotated, err := g.annotate(ctx, image, "FACE_DETECTION")
+	if err != nil {
+		return result, err
+	}
+
+	for _, f := range annotated.FaceAnnotations {
+		face := DetectedFace{
+			FaceRectangle: boundingRectangle(f.FdBoundingPoly.Vertices),
+			FaceAttributes: FaceAttributes{
+				HeadPose: map[string]float64{
+					"roll":  f.RollAngle,
+					"yaw":   f.PanAngle,
+					"pitch": f.TiltAngle,
+				},
+				Emotion: map[string]float64{
+					"happiness": likelihoodScores[f.JoyLikelihood],
+					"sadness":   likelihoodScores[f.SorrowLikelihood],
+					"anger":     likelihoodScores[f.AngerLikelihood],
+					"surprise":  likelihoodScores[f.SurpriseLikelihood],
+				},
+			},
+		}
+
+		if returnFaceLandmarks {
+			face.FaceLandmarks = map[string]cog.Point{}
+			for _, l := range f.Landmarks {
+				if name, exists := googleLandmarks[l.Type]; exists {
+					face.FaceLandmarks[name] = l.Position
+				}
+			}
+		}
+
+		result = append(result, face)
+	}
+
+	return result, nil
+}
+
+// Tag tags given image bytes with labels
+func (g googleVision) Tag(ctx context.Context, image []byte) (result TagResult, err error) {
+	annotated, err := g.annotate(ctx, image, "LABEL_DETECTION")
+	if err != nil {
+		return result, err
+	}
+
+	for _, l := range annotated.LabelAnnotations {
+		result.Tags = append(result.Tags, ImageTag{Name: strings.ToLower(l.Description), Confidence: l.Score})
+	}
+
+	return result, nil
+}
+
+// Analyze analyzes given image bytes
+//
+// (only "Objects" and "Adult" are supported)
+func (g googleVision) Analyze(ctx context.Context, image []byte, visualFeatures []string) (result AnalyzeResult, err error) {
+	features := []string{}
+	for _, f := range visualFeatures {
+		switch f {
+		case "Objects":
+			features = append(features, "OBJECT_LOCALIZATION")
+		case "Adult":
+			features = append(features, "SAFE_SEARCH_DETECTION")
+		default:
+			return result, unsupportedFeatureError("Google Cloud Vision", f)
+		}
+	}
+
+	annotated, err := g.annotate(ctx, image, features...)
+	if err != nil {
+		return result, err
+	}
+
+	// objects (with normalized vertices)
+	if len(annotated.LocalizedObjectAnnotations) > 0 {
+		width, height, err := imageSize(image)
+		if err != nil {
+			return result, err
+		}
+
+		for _, o := range annotated.LocalizedObjectAnnotations {
+			bounds := boundingRectangle(denormalizePoints(o.BoundingPoly.NormalizedVertices, width, height))
+
+			result.Objects = append(result.Objects, DetectedObject{
+				Rectangle:  ObjectRectangle{X: bounds.Left, Y: bounds.Top, W: bounds.Width, H: bounds.Height},
+				Object:     strings.ToLower(o.Name),
+				Confidence: o.Score,
+			})
+		}
+	}
+
+	// adult, racy, and violent contents
+	safe := annotated.SafeSearchAnnotation
+	result.Adult = AdultResult{
+		AdultScore: likelihoodScores[safe.Adult],
+		RacyScore:  likelihoodScores[safe.Racy],
+		GoreScore:  likelihoodScores[safe.Violence],
+	}
+	result.Adult.IsAdultContent = result.Adult.AdultScore >= minFlaggedScore
+	result.Adult.IsRacyContent = result.Adult.RacyScore >= minFlaggedScore
+	result.Adult.IsGoryContent = result.Adult.GoreScore >= minFlaggedScore
+
+	return result, nil
+}
+
+// Read recognizes texts on given image bytes
+//
+// (it is a synchronous operation, so `progress` is not called)
+func (g googleVision) Read(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (result ReadResult, err error) {
+	annotated, err := g.annotate(ctx, image, "DOCUMENT_TEXT_DETECTION")
+	if err != nil {
+		return result, err
+	}
+
+	result.Status = "succeeded"
+	for i, p := range annotated.FullTextAnnotation.Pages {
+		page := ReadPage{
+			Page:   i + 1,
+			Width:  float64(p.Width),
+			Height: float64(p.Height),
+			Unit:   "pixel",
+		}
+
+		for _, b := range p.Blocks {
+			for _, para := range b.Paragraphs {
+				page.Lines = append(page.Lines, googleLines(para.Words)...)
+			}
+		}
+
+		result.AnalyzeResult.ReadResults = append(result.AnalyzeResult.ReadResults, page)
+	}
+
+	return result, nil
+}
+
+// split recognized words of a paragraph into lines
+func googleLines(words []GoogleWord) (lines []ReadLine) {
+	var line ReadLine
+	var first, last GoogleWord
+	for _, w := range words {
+		if len(line.Words) <= 0 {
+			first = w
+		}
+		last = w
+
+		text, space, lineBreak := "", "", false
+		for _, s := range w.Symbols {
+			text += s.Text
+
+			switch s.Property.DetectedBreak.Type {
+			case "SPACE", "SURE_SPACE":
+				space = " "
+			case "EOL_SURE_SPACE", "LINE_BREAK":
+				lineBreak = true
+			}
+		}
+
+		line.Text += text + space
+		line.Words = append(line.Words, ReadWord{
+			BoundingBox: flattenPoints(w.BoundingBox.Vertices),
+			Text:        text,
+			Confidence:  w.Confidence,
+		})
+
+		if lineBreak {
+			lines = append(lines, googleLine(line, first, last))
+			line = ReadLine{}
+		}
+	}
+	if len(line.Words) > 0 {
+		lines = append(lines, googleLine(line, first, last))
+	}
+
+	return lines
+}
+
+// finish a line with the bounding box from its first and last words
+func googleLine(line ReadLine, first, last GoogleWord) ReadLine {
+	line.Text = strings.TrimSpace(line.Text)
+
+	if len(first.BoundingBox.Vertices) == 4 && len(last.BoundingBox.Vertices) == 4 {
+		line.BoundingBox = flattenPoints([]cog.Point{
+			first.BoundingBox.Vertices[0],
+			last.BoundingBox.Vertices[1],
+			last.BoundingBox.Vertices[2],
+			first.BoundingBox.Vertices[3],
+		})
+	}
+
+	return line
+}
@@ -3,19 +3,19 @@ package main
 // helper functions
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	// for manipulating images
 	"image"
 	"image/color"
-	"image/draw"
-	"image/jpeg"
 	"math"
 
-	"github.com/disintegration/gift"
 	"github.com/golang/freetype"
 	"github.com/llgcode/draw2d/draw2dimg"
 
@@ -24,16 +24,22 @@ import (
 
 	// for Telegram bot
 	bot "github.com/meinside/telegram-bot-go"
+
+	// for commands and their registry
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
 )
 
-// constants for drawing
+// default values for drawing
 const (
-	CircleRadius = 6
-	StrokeWidth  = 7.0
+	defaultCircleRadius = 6.0
+	defaultStrokeWidth  = 7.0
 )
 
-// colors
-var colors = []color.RGBA{
+// default colors
+var defaultColors = []color.RGBA{
 	color.RGBA{255, 255, 0, 255}, // yellow
 	color.RGBA{0, 255, 255, 255}, // cyan
 	color.RGBA{255, 0, 255, 255}, // purple
@@ -41,553 +47,969 @@ var colors = []color.RGBA{
 	color.RGBA{0, 0, 255, 255},   // blue
 	color.RGBA{255, 0, 0, 255},   // red
 }
-var maskColor = color.RGBA{0, 0, 0, 255} // black
+var defaultMaskColor = color.RGBA{0, 0, 0, 255} // black
 
 // process incoming update from Telegram
-func processUpdate(b *bot.Bot, update bot.Update) bool {
+func processUpdate(ctx context.Context, b Messenger, update bot.Update) bool {
 	result := false // process result
 
+	// remember the language of user's Telegram client for localizing messages
+	rememberClientLanguage(update.Message.From)
+	language := defaultLanguage
+	if update.Message.From != nil {
+		language = languageFor(update.Message.From.ID)
+	}
+
+	// check every image automatically in configured chats
+	//
+	// (even when it is not meant for this bot, but only of allowed users, not to call services for banned ones)
+	if fileID, ok := imageFileID(update.Message); ok {
+		safety, moderation := isSafetyWarningChat(update.Message.Chat.ID), isModerationChat(update.Message.Chat.ID)
+
+		if (safety || moderation) && (update.Message.From == nil || isAllowed(update.Message.From.ID, update.Message.Chat.ID)) {
+			if safety {
+				enqueueAutomaticCheck(ctx, update.Message, fileID, JobKindSafety, SafetyCheck)
+			}
+			if moderation {
+				enqueueAutomaticCheck(ctx, update.Message, fileID, JobKindModeration, Moderate)
+			}
+		}
+	}
+
+	// in group chats, process only the messages which are meant for this bot
+	// (or the rest of an album whose first image was meant for this bot)
+	// (or the next image of a conversation)
+	if isGroupChat(update.Message.Chat) && !isCalledInGroup(update.Message) && !isAdminCommand(update.Message) && !isCollectingAlbum(update.Message) && !isInConversation(update.Message) {
+		return result
+	}
+
+	// reject users or chats which are not allowed
+	if update.Message.From != nil && !isAllowed(update.Message.From.ID, update.Message.Chat.ID) {
+		if sent := b.SendMessage(update.Message.Chat.ID, localize(language, messageNotAllowed), map[string]interface{}{
+			"reply_to_message_id": update.Message.MessageID,
+		}); sent.Ok {
+			result = true
+		} else {
+			logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+		}
+
+		return result
+	}
+
+	// save chat for broadcasting
+	if db != nil {
+		if err := db.SaveChat(update.Message.Chat.ID); err != nil {
+			logger.Error(fmt.Sprintf("Failed to save chat: %s", err))
+		}
+	}
+
+	// collect images of an album, and show inline keyboards only once for them
+	if fileID, ok := imageFileID(update.Message); ok && update.Message.MediaGroupID != nil {
+		collectAlbum(b, update.Message, fileID)
+
+		return true
+	}
+
+	// continue multi-step commands with the next image
+	if fileID, ok := imageFileID(update.Message); ok && continueConversation(ctx, b, update.Message, fileID) {
+		return true
+	}
+
+	// enroll a person with the face on an image
+	if fileID, name, ok := parseRememberCommand(update.Message); ok {
+		processRememberCommand(ctx, b, update.Message, fileID, name)
+
+		return true
+	}
+
+	// run the command replied to an image (eg. "/ocr") without inline keyboards
+	if fileID, command, language, ok := parseReplyShortcut(update.Message); ok && isDirectlyRunnable(command) {
+		return runImageCommandDirectly(ctx, b, update.Message, fileID, command, language)
+	}
+
+	// run the command in the caption, or the default action of the user without inline keyboards
+	if fileID, ok := imageFileID(update.Message); ok && update.Message.From != nil {
+		if command, language, ok := parseCaptionShortcut(update.Message); ok && isDirectlyRunnable(command) {
+			return runImageCommandDirectly(ctx, b, update.Message, fileID, command, language)
+		}
+		if command, exists := defaultActionFor(update.Message.From.ID); exists {
+			return runImageCommandDirectly(ctx, b, update.Message, fileID, command, "")
+		}
+	}
+
+	// enroll a celebrity for look-alikes (by admins)
+	if fileID, name, ok := parseCelebrityCommand(update.Message); ok {
+		processCelebrityCommand(ctx, b, update.Message, fileID, name)
+
+		return true
+	}
+
+	// show recent analyses with inline keyboards for jumping to their results
+	if isHistoryCommand(update.Message) {
+		return processHistoryCommand(b, update.Message)
+	}
+
+	// send data of the user as a document
+	if isExportCommand(update.Message) {
+		return processExportCommand(b, update.Message)
+	}
+
 	var message string
 	var options = map[string]interface{}{
 		"reply_to_message_id": update.Message.MessageID,
 	}
 
-	if update.Message.HasPhoto() {
-		lastIndex := len(update.Message.Photo) - 1 // XXX - last one is the largest
-
+	if isAdminCommand(update.Message) {
+		message = processAdminCommand(b, update.Message)
+	} else if isUserCommand(update.Message) {
+		message = processUserCommand(update.Message)
+	} else if fileID, ok := imageFileID(update.Message); ok {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genImageInlineKeyboards(fileID),
+		}
+		message = localize(language, messageActionImage)
+	} else if update.Message.HasDocument() && update.Message.Document.MimeType != nil && *update.Message.Document.MimeType == pdfMimeType {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genPDFInlineKeyboards(update.Message.Document.FileID),
+		}
+		message = localize(language, messageActionPDF)
+	} else if isUnsupportedSticker(update.Message) {
+		message = localize(language, messageUnsupportedSticker)
+	} else if fileID, ok := stickerFileID(update.Message); ok {
 		options["reply_markup"] = bot.InlineKeyboardMarkup{
-			InlineKeyboard: genImageInlineKeyboards(update.Message.Photo[lastIndex].FileID),
+			InlineKeyboard: genFileInlineKeyboards(MediaSticker, fileID),
 		}
-		message = messageActionImage
-	} else if update.Message.HasDocument() && strings.HasPrefix(*update.Message.Document.MimeType, "image/") {
+		message = localize(language, messageActionSticker)
+	} else if fileID, ok := videoFileID(update.Message); ok {
 		options["reply_markup"] = bot.InlineKeyboardMarkup{
-			InlineKeyboard: genImageInlineKeyboards(update.Message.Document.FileID),
+			InlineKeyboard: genFileInlineKeyboards(MediaVideo, fileID),
+		}
+		message = localize(language, messageActionVideo)
+	} else if fileID, ok := audioFileID(update.Message); ok {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genFileInlineKeyboards(MediaAudio, fileID),
+		}
+		message = localize(language, messageActionAudio)
+	} else if update.Message.ReplyToMessage != nil && isGroupChat(update.Message.Chat) {
+		// replied to an image with a command in group chats
+		if fileID, ok := imageFileID(update.Message.ReplyToMessage); ok {
+			options["reply_to_message_id"] = update.Message.ReplyToMessage.MessageID
+			options["reply_markup"] = bot.InlineKeyboardMarkup{
+				InlineKeyboard: genImageInlineKeyboards(fileID),
+			}
+			message = localize(language, messageActionImage)
+		} else {
+			message = localize(language, messageHelp)
 		}
-		message = messageActionImage
+	} else if isUnknownCommand(update.Message) {
+		message = localize(language, messageUnknownCommand)
 	} else {
-		message = messageHelp
+		message = localize(language, messageHelp)
 	}
 
 	// send message
 	if sent := b.SendMessage(update.Message.Chat.ID, message, options); sent.Ok {
 		result = true
+
+		// expire inline keyboards for choosing actions later
+		if _, exists := options["reply_markup"]; exists {
+			trackPrompt(update.Message.Chat.ID, sent.Result.MessageID, language)
+		}
 	} else {
-		logError(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
 	}
 
 	return result
 }
 
 // process incoming callback query
-func processCallbackQuery(b *bot.Bot, update bot.Update) bool {
+func processCallbackQuery(ctx context.Context, b Messenger, update bot.Update) bool {
 	// process result
 	result := false
 
-	var username string
 	message := ""
+	var keyboards [][]bot.InlineKeyboardButton // for editing the message with new inline keyboards
+	prompting := false                         // whether the new inline keyboards are for choosing an action
 	query := *update.CallbackQuery
-	data := *query.Data
+
+	var username string
+	if query.From.Username == nil {
+		username = query.From.FirstName
+	} else {
+		username = *query.From.Username
+	}
+
+	// (all callback data are signed, and handlers below read their verified payloads)
+	data, err := verifyCallbackData(*query.Data)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Rejected callback query from %s: %s", username, err))
+
+		b.AnswerCallbackQuery(query.ID, nil)
+
+		return result
+	}
+	query.Data = &data
+
+	// remember the language of user's Telegram client for localizing messages
+	rememberClientLanguage(&query.From)
+	language := languageFor(query.From.ID)
+
+	if isTextAnalysisCallback(data) {
+		// answer callback query, then analyze text
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			if isAllowed(query.From.ID, query.Message.Chat.ID) && acceptPaidCallback(b, query, username, CognitiveCommand(data)) {
+				processTextAnalysisCallback(b, query)
+
+				result = true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
+
+	if isReadAloudCallback(data) {
+		// answer callback query, then read text aloud
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			if isAllowed(query.From.ID, query.Message.Chat.ID) && acceptPaidCallback(b, query, username, CognitiveCommand(data)) {
+				processReadAloudCallback(b, query)
+
+				result = true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
+
+	if isFaceSelectionCallback(data) {
+		// answer callback query, then toggle or apply selected faces
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			if isAllowed(query.From.ID, query.Message.Chat.ID) {
+				processFaceSelectionCallback(ctx, b, query, username)
+
+				result = true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
+
+	if isJobCancelCallback(data) {
+		// answer callback query, then cancel the job
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			processJobCancelCallback(b, query)
+
+			result = true
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
+
+	if isHistoryCallback(data) {
+		// answer callback query, then jump to the result
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			if isAllowed(query.From.ID, query.Message.Chat.ID) {
+				processHistoryCallback(b, query)
+
+				result = true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
+
+	if isTranslationCallback(data) {
+		// answer callback query, then translate text
+		if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
+			// (choosing a language does not call services)
+			if isAllowed(query.From.ID, query.Message.Chat.ID) && (data == textCommandTranslate || acceptPaidCallback(b, query, username, textCommandTranslate)) {
+				processTranslationCallback(b, query)
+
+				result = true
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		}
+
+		return result
+	}
 
 	if data == commandCancel {
-		message = messageCanceled
+		message = localize(language, messageCanceled)
+	} else if !isAllowed(query.From.ID, query.Message.Chat.ID) {
+		message = localize(language, messageNotAllowed)
+	} else if command, target, err := parseCallbackData(data); err != nil {
+		logger.Warn(fmt.Sprintf("Rejected callback query from %s: %s", username, err))
+
+		message = localize(language, messageUnprocessable)
+	} else if available, retryAt := checkQuota(query.From.ID); !available {
+		message = quotaExceededMessage(language, retryAt)
+	} else if albumID, isAlbum := parseAlbumID(target); isAlbum {
+		var queued bool
+		if message, queued = processAlbumCallback(ctx, b, query, username, albumID, command, language); queued {
+			// for canceling it while being processed
+			keyboards = genJobCancelInlineKeyboards()
+		}
+	} else if callbackTarget, exists := loadCallbackTarget(target); !exists {
+		message = localize(language, messageKeyboardExpired)
 	} else {
-		command := cmdsMap[string(data[0])]
-		fileID := string(data[1:])
+		fileID := callbackTarget.FileID
 
 		if fileResult := b.GetFile(fileID); fileResult.Ok {
-			fileURL := b.GetFileURL(*fileResult.Result)
+			accepted := false
+
+			var kind JobKind
+			media := callbackTarget.Media
+			if command == VerifyFaces && media == MediaImage {
+				// wait for the next image
+				startConversation(query.Message.Chat.ID, query.From.ID, command, []string{fileID})
+
+				accepted = true
+				message = fmt.Sprintf(localize(language, messageSendNextImage), command)
+			} else if command == SmartCrop && media == MediaImage {
+				// select an aspect ratio with a second keyboard
+				keyboards = genAspectRatioInlineKeyboards(target)
+				prompting = true
+				message = localize(language, messageActionRatio)
+			} else if isFaceSelectable(command) && media == MediaImage {
+				// detect and number faces first, for selecting them
+				kind = JobKindFaces
+				message = fmt.Sprintf(localize(language, messageDetectingFaces), command)
+			} else {
+				switch media {
+				case MediaImage:
+					kind = JobKindImage
+					message = fmt.Sprintf(localize(language, messageProcessingImage), command)
+				case MediaSticker:
+					kind = JobKindSticker
+					message = fmt.Sprintf(localize(language, messageProcessingSticker), command)
+				case MediaVideo:
+					kind = JobKindVideo
+					message = fmt.Sprintf(localize(language, messageProcessingVideo), command)
+				case MediaAudio:
+					kind = JobKindAudio
+					message = fmt.Sprintf(localize(language, messageProcessingAudio), command)
+				case MediaPDF:
+					kind = JobKindPDF
+					message = fmt.Sprintf(localize(language, messageProcessingPDF), command)
+				default:
+					message = localize(language, messageUnprocessable)
+				}
+			}
 
-			if strings.Contains(*query.Message.Text, "image") {
-				go processImage(b, query.Message.Chat.ID, query.Message.MessageID, fileURL, command)
+			if kind != "" {
+				if err := enqueueJob(ctx, Job{
+					Kind:      kind,
+					ChatID:    query.Message.Chat.ID,
+					UserID:    query.From.ID,
+					MessageID: query.Message.MessageID,
+					FileIDs:   []string{fileID},
+					Command:   command,
+				}); err == nil {
+					accepted = true
+
+					// for canceling it while being processed
+					keyboards = genJobCancelInlineKeyboards()
+				} else {
+					logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
 
-				message = fmt.Sprintf("Processing '%s' on received image...", command)
+					message = localize(language, messageFailedToEnqueue)
+				}
+			}
 
+			if accepted {
 				// log request
-				if query.From.Username == nil {
-					username = query.From.FirstName
-				} else {
-					username = *query.From.Username
+				logRequest(username, fileID, command)
+
+				// save request for quotas
+				if db != nil {
+					if err := saveRequest(query.From.ID, username, command); err != nil {
+						logger.Error(fmt.Sprintf("Failed to save request: %s", err))
+					}
 				}
-				logRequest(username, fileURL, command)
-			} else {
-				message = messageUnprocessable
 			}
 		} else {
-			logError(fmt.Sprintf("Failed to get file from url: %s", *fileResult.Description))
+			logger.Error(fmt.Sprintf("Failed to get file from url: %s", *fileResult.Description))
 
-			message = messageFailedToGetFile
+			message = localize(language, messageFailedToGetFile)
 		}
 	}
 
 	// answer callback query
 	if apiResult := b.AnswerCallbackQuery(query.ID, nil); apiResult.Ok {
-		// edit message and remove inline keyboards
+		// edit message and remove (or replace) inline keyboards
 		options := map[string]interface{}{
 			"chat_id":    query.Message.Chat.ID,
 			"message_id": query.Message.MessageID,
 		}
+		if keyboards != nil {
+			options["reply_markup"] = bot.InlineKeyboardMarkup{
+				InlineKeyboard: keyboards,
+			}
+		}
 		if apiResult := b.EditMessageText(message, options); apiResult.Ok {
 			result = true
+
+			if prompting {
+				trackPrompt(query.Message.Chat.ID, query.Message.MessageID, language)
+			} else {
+				untrackPrompt(query.Message.Chat.ID, query.Message.MessageID)
+			}
 		} else {
-			logError(fmt.Sprintf("Failed to edit message text: %s", *apiResult.Description))
+			logger.Error(fmt.Sprintf("Failed to edit message text: %s", *apiResult.Description))
 		}
 	} else {
-		logError(fmt.Sprintf("Failed to answer callback query: %+v", query))
+		logger.Error(fmt.Sprintf("Failed to answer callback query: %+v", query))
 	}
 
 	return result
 }
 
+// ProcessResult struct for the result of image processing
+type ProcessResult = commands.Result
+
+// ContactCard struct for a contact, which will be sent as a Telegram contact
+type ContactCard = commands.ContactCard
+
 // process requested image processing
-func processImage(b *bot.Bot, chatID int64, messageIDToDelete int, fileURL string, command CognitiveCommand) {
-	message := ""
+//
+// (image bytes will be loaded from `fileURL` with `load`, and `argument` is the selected faces, if any)
+func processImage(b Messenger, chatID int64, userID int, messageIDToDelete int, fileID, fileUniqueID, fileURL string, command CognitiveCommand, argument string, load func(ctx context.Context, fileURL string) ([]byte, error)) {
 	errorMessage := ""
 
+	ctx, cancel := context.WithTimeout(withFileID(withChatID(jobContext(chatID, messageIDToDelete), chatID), fileID), commandTimeout(command))
+	defer cancel()
+
+	cacheKey := resultCacheKey(fileUniqueID, command)
+	language, translate := parseTranslationArgument(argument)
+	if argument != "" && !translate {
+		ctx = withSelectedFaces(ctx, argument)
+
+		// (results on selected faces are not cached)
+		cacheKey = ""
+	}
+
+	// collect raw responses of Cognitive Services for developers
+	var raw *rawResponses
+	if isDeveloperMode(userID) {
+		ctx, raw = withRawResponses(ctx)
+
+		// (cached results do not have raw responses)
+		cacheKey = ""
+	}
+
 	// 'typing...'
 	b.SendChatAction(chatID, bot.ChatActionTyping)
 
-	switch command {
-	case Emotion:
-		// send a photo (draw squares on detected faces) and emotions in text
-		if emotions, err := emotionClient.RecognizeImage(fileURL, nil); err == nil {
-			if len(emotions) > 0 {
-				// open image from url,
-				if resp, err := http.Get(fileURL); err == nil {
-					defer resp.Body.Close()
-					if img, _, err := image.Decode(resp.Body); err == nil {
-						var rect cog.Rectangle
-						var emos []string
-
-						// copy to a new image
-						newImg := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
-						draw.Draw(newImg, newImg.Bounds(), img, image.ZP, draw.Src)
-						gc := draw2dimg.NewGraphicContext(newImg)
-						gc.SetLineWidth(StrokeWidth)
-						gc.SetFillColor(color.Transparent)
-
-						// prepare freetype font
-						fc := freetype.NewContext()
-						fc.SetFont(font)
-						fc.SetDPI(72)
-						fc.SetClip(newImg.Bounds())
-						fc.SetDst(newImg)
-						fontSize := float64(newImg.Bounds().Dy()) / 24.0
-						fc.SetFontSize(fontSize)
-
-						for i, e := range emotions {
-							var scores []string
-							rect = e.FaceRectangle
-
-							// set color
-							color := colorForIndex(i)
-							gc.SetStrokeColor(color)
-							fc.SetSrc(&image.Uniform{color})
-
-							// draw rectangles and their indices on detected faces
-							gc.MoveTo(float64(rect.Left), float64(rect.Top))
-							gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top))
-							gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top+rect.Height))
-							gc.LineTo(float64(rect.Left), float64(rect.Top+rect.Height))
-							gc.LineTo(float64(rect.Left), float64(rect.Top))
-							gc.Close()
-							gc.FillStroke()
-
-							// draw face label
-							if _, err = fc.DrawString(
-								fmt.Sprintf("Face #%d", i+1),
-								freetype.Pt(
-									rect.Left,
-									int(fc.PointToFixed(float64(rect.Top+rect.Height)+fontSize)>>6),
-								),
-							); err != nil {
-								logError(fmt.Sprintf("Failed to draw string: %s", err))
-							}
-
-							// emotion string
-							for k, v := range e.Scores {
-								scores = append(scores, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
-							}
-							emos = append(emos, strings.Join(scores, "\n"))
-						}
-						gc.Save()
-
-						// build up emotions string
-						var strs []string
-						for i, e := range emos {
-							strs = append(strs,
-								fmt.Sprintf(`[Face #%d]
-%s`,
-									i+1,
-									e,
-								),
-							)
-						}
-						message = fmt.Sprintf("%s", strings.Join(strs, "\n\n"))
-
-						// 'uploading photo...'
-						b.SendChatAction(chatID, bot.ChatActionUploadPhoto)
-
-						// send a photo with rectangles drawn on detected faces
-						buf := new(bytes.Buffer)
-						if err := jpeg.Encode(buf, newImg, nil); err == nil {
-							if sent := b.SendPhoto(chatID, bot.InputFileFromBytes(buf.Bytes()), map[string]interface{}{
-								"caption": fmt.Sprintf("Process result of '%s'", command),
-							}); sent.Ok {
-								// send emotions string
-								if sent := b.SendMessage(chatID, message, map[string]interface{}{
-									"reply_to_message_id": sent.Result.MessageID,
-								}); !sent.Ok {
-									errorMessage = fmt.Sprintf("Failed to send emotions: %s", *sent.Description)
-								}
-							} else {
-								errorMessage = fmt.Sprintf("Failed to send image: %s", *sent.Description)
-							}
-						}
-					} else {
-						errorMessage = fmt.Sprintf("Failed to decode image: %s", err)
-					}
-				} else {
-					errorMessage = fmt.Sprintf("Failed to open image: %s", err)
+	// edit the status message with progress periodically
+	progress := startProgress(b, chatID, messageIDToDelete, userID, command)
+	ctx = withProgress(ctx, progress)
+
+	if cached, exists := resultCache.Get(cacheKey); exists {
+		// send cached result
+		if translate {
+			cached = translateResult(ctx, cached, language)
+		}
+		errorMessage = sendResult(ctx, b, chatID, userID, command, cached)
+	} else {
+		// download image only once (not to pass the file url, which includes the bot token, to other services)
+		progress.setStage(messageStageDownloading)
+		if imageBytes, err := load(ctx, fileURL); err == nil {
+			// correct orientation before sending to services and annotating
+			imageBytes = uprightImageFor(imageBytes, command)
+
+			if result, err := runCommand(ctx, imageBytes, command, progress.setStage); err == nil {
+				resultCache.Set(cacheKey, userID, result)
+
+				if translate {
+					result = translateResult(ctx, result, language)
 				}
-			} else {
-				errorMessage = "No emotion recognized on this image."
-			}
-		} else {
-			errorMessage = fmt.Sprintf("Failed to recognize emotion: %s", err)
-		}
-	case Face, CensorEyes, MaskFaces:
-		if faces, err := faceClient.Detect(fileURL, true, true, []string{"age", "gender", "headPose", "smile", "facialHair", "glasses", "emotion"}); err == nil {
-			if len(faces) > 0 {
-				// open image from url,
-				if resp, err := http.Get(fileURL); err == nil {
-					defer resp.Body.Close()
-					if img, _, err := image.Decode(resp.Body); err == nil {
-						var rect cog.Rectangle
-
-						// copy to a new image
-						newImg := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
-						draw.Draw(newImg, newImg.Bounds(), img, image.ZP, draw.Src)
-						gc := draw2dimg.NewGraphicContext(newImg)
-						gc.SetLineWidth(StrokeWidth)
-						gc.SetFillColor(color.Transparent)
-
-						// build up facial attributes string
-						strs := []string{}
-						var facialHairs, headPoses, emotions []string
-						for i, f := range faces {
-							switch command {
-							case Face:
-								// prepare freetype font
-								fc := freetype.NewContext()
-								fc.SetFont(font)
-								fc.SetDPI(72)
-								fc.SetClip(newImg.Bounds())
-								fc.SetDst(newImg)
-								fontSize := float64(newImg.Bounds().Dy()) / 24.0
-								fc.SetFontSize(fontSize)
-
-								// set color
-								color := colorForIndex(i)
-								gc.SetStrokeColor(color)
-								fc.SetSrc(&image.Uniform{color})
-
-								// draw rectangles and their indices on detected faces
-								rect = f.FaceRectangle
-								gc.MoveTo(float64(rect.Left), float64(rect.Top))
-								gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top))
-								gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top+rect.Height))
-								gc.LineTo(float64(rect.Left), float64(rect.Top+rect.Height))
-								gc.LineTo(float64(rect.Left), float64(rect.Top))
-								gc.Close()
-								gc.FillStroke()
-
-								// draw face label
-								if _, err = fc.DrawString(
-									fmt.Sprintf("Face #%d", i+1),
-									freetype.Pt(
-										rect.Left,
-										int(fc.PointToFixed(float64(rect.Top+rect.Height)+fontSize)>>6),
-									),
-								); err != nil {
-									logError(fmt.Sprintf("Failed to draw string: %s", err))
-								}
-
-								// mark face landmarks
-								if hasAllKeys([]string{
-									"noseTip",
-									"pupilRight",
-									"pupilLeft",
-									"mouthRight",
-									"mouthLeft",
-								}, f.FaceLandmarks) {
-									// mark nose tip
-									n, _ := f.FaceLandmarks["noseTip"]
-									gc.MoveTo(n.X, n.Y)
-									gc.ArcTo(n.X, n.Y, CircleRadius, CircleRadius, 0, -math.Pi*2)
-									gc.Close()
-									gc.FillStroke()
-
-									// mark right pupil
-									r, _ := f.FaceLandmarks["pupilRight"]
-									gc.MoveTo(r.X, r.Y)
-									gc.ArcTo(r.X, r.Y, CircleRadius, CircleRadius, 0, -math.Pi*2)
-									gc.Close()
-									gc.FillStroke()
-
-									// mark left pupil
-									l, _ := f.FaceLandmarks["pupilLeft"]
-									gc.MoveTo(l.X, l.Y)
-									gc.ArcTo(l.X, l.Y, CircleRadius, CircleRadius, 0, -math.Pi*2)
-									gc.Close()
-									gc.FillStroke()
-
-									// mark mouth
-									m1, _ := f.FaceLandmarks["mouthRight"]
-									m2, _ := f.FaceLandmarks["mouthLeft"]
-									gc.MoveTo(m1.X, m1.Y)
-									gc.LineTo(m2.X, m2.Y)
-									gc.Close()
-									gc.FillStroke()
-								}
-
-								// descriptions
-								facialHairs = []string{}
-								for k, v := range f.FaceAttributes.FacialHair {
-									facialHairs = append(facialHairs, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
-								}
-								headPoses = []string{}
-								for k, v := range f.FaceAttributes.HeadPose {
-									headPoses = append(headPoses, fmt.Sprintf("  %s: %.2f°", k, v))
-								}
-								emotions = []string{}
-								for k, v := range f.FaceAttributes.Emotion {
-									emotions = append(emotions, fmt.Sprintf("  %s: %.3f%%", k, v*100.0))
-								}
-
-								strs = append(strs,
-									fmt.Sprintf(`[Face #%d]
-> Facial Hair
-%s
-> Head Pose
-%s
-> Emotion
-%s`,
-										i+1,
-										strings.Join(facialHairs, "\n"),
-										strings.Join(headPoses, "\n"),
-										strings.Join(emotions, "\n"),
-									),
-								)
-							case CensorEyes:
-								if hasAllKeys([]string{
-									"eyeLeftTop",
-									"eyeLeftBottom",
-									"eyeLeftOuter",
-									"eyeRightTop",
-									"eyeRightBottom",
-									"eyeRightOuter",
-								}, f.FaceLandmarks) {
-									// eye points
-									lt, _ := f.FaceLandmarks["eyeLeftTop"]
-									lb, _ := f.FaceLandmarks["eyeLeftBottom"]
-									lo, _ := f.FaceLandmarks["eyeLeftOuter"]
-									rt, _ := f.FaceLandmarks["eyeRightTop"]
-									rb, _ := f.FaceLandmarks["eyeRightBottom"]
-									ro, _ := f.FaceLandmarks["eyeRightOuter"]
-
-									// get mask points
-									lu, ll, rl, ru := genMaskPoints(lt, lb, lo, rt, rb, ro)
-
-									// set mask color
-									gc.SetFillColor(maskColor)
-
-									// fill mask
-									gc.MoveTo(lu.X, lu.Y)
-									gc.LineTo(ll.X, ll.Y)
-									gc.LineTo(rl.X, rl.Y)
-									gc.LineTo(ru.X, ru.Y)
-									gc.LineTo(lu.X, lu.Y)
-									gc.Close()
-									gc.Fill()
-								}
-							case MaskFaces:
-								rect = f.FaceRectangle
-
-								// pixelate face rects
-								g := gift.New(
-									gift.Pixelate(rect.Width / 8),
-								)
-								g.DrawAt(
-									newImg,
-									newImg.SubImage(image.Rect(rect.Left, rect.Top, rect.Left+rect.Width, rect.Top+rect.Height)),
-									image.Pt(rect.Left, rect.Top),
-									gift.CopyOperator,
-								)
-							}
-						}
-						gc.Save()
-
-						// build up message
-						switch command {
-						case Face:
-							message = strings.Join(strs, "\n\n")
-						default:
-							message = ""
-						}
-
-						// 'uploading photo...'
-						b.SendChatAction(chatID, bot.ChatActionUploadPhoto)
-
-						// send a photo with rectangles drawn on detected faces
-						buf := new(bytes.Buffer)
-						if err := jpeg.Encode(buf, newImg, nil); err == nil {
-							if sent := b.SendPhoto(chatID, bot.InputFileFromBytes(buf.Bytes()), map[string]interface{}{
-								"caption": fmt.Sprintf("Process result of '%s'", command),
-							}); sent.Ok {
-								// reply to
-								var replyTo map[string]interface{} = nil
-								if command == Face {
-									replyTo = map[string]interface{}{
-										"reply_to_message_id": sent.Result.MessageID,
-									}
-								}
-
-								// send result string
-								if len(message) > 0 {
-									if sent := b.SendMessage(chatID, message, replyTo); !sent.Ok {
-										errorMessage = fmt.Sprintf("Failed to send faces: %s", *sent.Description)
-									}
-								}
-							} else {
-								errorMessage = fmt.Sprintf("Failed to send image: %s", *sent.Description)
-							}
-						} else {
-							errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
-						}
-					} else {
-						errorMessage = fmt.Sprintf("Failed to decode image: %s", err)
-					}
-				} else {
-					errorMessage = fmt.Sprintf("Failed to open image: %s", err)
+				progress.setStage(messageStageSending)
+				errorMessage = sendResult(ctx, b, chatID, userID, command, result)
+
+				if errorMessage == "" && raw != nil {
+					errorMessage = sendRawResponses(b, chatID, command, raw)
 				}
 			} else {
-				errorMessage = "No face detected on this image."
+				errorMessage = err.Error()
 			}
 		} else {
-			errorMessage = fmt.Sprintf("Failed to detect faces: %s", err)
+			errorMessage = openImageErrorMessage(userID, err)
 		}
-	case Describe:
-		if described, err := cvClient.DescribeImage(fileURL, 0); err == nil {
-			captions := []string{}
-			for _, c := range described.Description.Captions {
-				captions = append(captions, fmt.Sprintf("%s (%.3f%%)", c.Text, c.Confidence*100.0))
-			}
-			message = fmt.Sprintf("%s\n\n(%s)", strings.Join(captions, "\n"), strings.Join(described.Description.Tags, ", "))
 
-			if len(strings.TrimSpace(message)) > 0 {
-				// send described text
-				if sent := b.SendMessage(chatID, message, nil); !sent.Ok {
-					errorMessage = fmt.Sprintf("Failed to send described text: %s", *sent.Description)
-				}
-			} else {
-				errorMessage = "Could not describe given image."
-			}
-		} else {
-			errorMessage = fmt.Sprintf("Failed to describe image: %s", err)
-		}
-	case Ocr:
-		if recognized, err := cvClient.Ocr(fileURL, "unk", true); err == nil {
-			words := []string{}
-			for _, r := range recognized.Regions {
-				for _, l := range r.Lines {
-					for _, w := range l.Words {
-						words = append(words, w.Text)
-					}
-				}
-			}
-			message = fmt.Sprintf("%s\n", strings.Join(words, " "))
+		if ctx.Err() == context.DeadlineExceeded {
+			errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), command)
+		} else if isCanceled(ctx) {
+			errorMessage = messageCanceled
+		}
+	}
+	progress.stop()
 
-			if len(strings.TrimSpace(message)) > 0 {
-				// send detected text
-				if sent := b.SendMessage(chatID, message, nil); !sent.Ok {
-					errorMessage = fmt.Sprintf("Failed to send recognized text: %s", *sent.Description)
-				}
-			} else {
-				errorMessage = "Could not recognize any text from given image."
-			}
+	// delete original message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// if there was any error, send it back
+	if errorMessage != "" {
+		b.SendMessage(chatID, localizeFor(userID, errorMessage), nil)
+
+		logJobError(errorMessage, chatID, userID, command, fileID)
+	}
+}
+
+// send result of image processing
+//
+// (if there is a result image, result message will be sent as a reply to it)
+func sendResult(ctx context.Context, b Messenger, chatID int64, userID int, command CognitiveCommand, result ProcessResult) (errorMessage string) {
+	ctx, span := startSpan(ctx, "send result", spanKindInternal)
+	defer func() {
+		if errorMessage != "" {
+			span.finish(fmt.Errorf("%s", errorMessage))
 		} else {
-			errorMessage = fmt.Sprintf("Failed to recognize text: %s", err)
+			span.finish(nil)
 		}
-	case Handwritten:
-		if recognized, err := cvClient.RecognizeHandwritten(fileURL, true, nil); err == nil {
-			words := []string{}
-			for _, l := range recognized.Lines {
-				words = append(words, l.Text)
-			}
-			message = fmt.Sprintf("%s", strings.Join(words, " "))
+	}()
+
+	// inline keyboards for text analyses, if available
+	options := map[string]interface{}{}
+	if textAnalysesAvailable(command) {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genTextAnalysisInlineKeyboards(result.Message),
+		}
+	}
+
+	caption := fmt.Sprintf(localizeFor(userID, messageResultCaption), command)
+
+	if result.Image != nil {
+		if sentMessageID, err := sendResultImage(ctx, b, chatID, userID, command, caption, result.Image); err == nil {
+			saveHistory(chatID, userID, sentMessageID, command, result.Message)
+			publishResult(b, chatID, userID, sentMessageID, command, result)
+
+			// send result message
+			if len(result.Message) > 0 {
+				options["reply_to_message_id"] = sentMessageID
 
-			if len(strings.TrimSpace(message)) > 0 {
-				// send detected text
-				if sent := b.SendMessage(chatID, message, nil); !sent.Ok {
-					errorMessage = fmt.Sprintf("Failed to send recognized text: %s", *sent.Description)
+				if _, err := sendLongText(b, chatID, result.Message, caption, options); err != nil {
+					errorMessage = fmt.Sprintf("Failed to send result message: %s", err)
 				}
-			} else {
-				errorMessage = "Could not recognize any text from given image."
 			}
 		} else {
-			errorMessage = fmt.Sprintf("Failed to recognize handwritten text: %s", err)
+			errorMessage = err.Error()
+		}
+	} else if len(result.Message) > 0 {
+		// send result message
+		if sentMessageID, err := sendLongText(b, chatID, result.Message, caption, options); err == nil {
+			saveHistory(chatID, userID, sentMessageID, command, result.Message)
+			publishResult(b, chatID, userID, sentMessageID, command, result)
+		} else {
+			errorMessage = fmt.Sprintf("Failed to send result message: %s", err)
+		}
+	}
+
+	// send related images
+	if errorMessage == "" && len(result.Related) > 0 {
+		errorMessage = sendRelatedImages(b, chatID, result.Related)
+	}
+
+	// send additional images
+	if errorMessage == "" && len(result.Images) > 0 {
+		errorMessage = sendImagesAsAlbum(b, chatID, userID, result.Images)
+	}
+
+	// send contact
+	if errorMessage == "" && result.Contact != nil {
+		if sent := b.SendContact(chatID, result.Contact.PhoneNumber, result.Contact.FirstName, map[string]interface{}{
+			"last_name": result.Contact.LastName,
+			"vcard":     result.Contact.VCard,
+		}); !sent.Ok {
+			errorMessage = fmt.Sprintf("Failed to send contact: %s", *sent.Description)
+		}
+	}
+
+	// send attachment
+	if errorMessage == "" && result.Attachment != nil {
+		if sent := b.SendDocument(chatID, bot.InputFileFromBytes(result.Attachment), map[string]interface{}{
+			"caption": fmt.Sprintf("Attachment of '%s'", command),
+		}); !sent.Ok {
+			errorMessage = fmt.Sprintf("Failed to send attachment: %s", *sent.Description)
+		}
+	}
+
+	return errorMessage
+}
+
+// send related images as an album
+func sendRelatedImages(b Messenger, chatID int64, fileIDs []string) (errorMessage string) {
+	if len(fileIDs) > maxAlbumImages {
+		fileIDs = fileIDs[:maxAlbumImages]
+	}
+
+	media := []bot.InputMedia{}
+	for _, fileID := range fileIDs {
+		media = append(media, bot.InputMedia{
+			Type:  bot.InputMediaPhoto,
+			Media: fileID,
+		})
+	}
+
+	if len(media) == 1 {
+		// an album needs at least 2 images
+		if sent := b.SendPhoto(chatID, bot.InputFileFromFileID(fileIDs[0]), nil); !sent.Ok {
+			errorMessage = fmt.Sprintf("Failed to send related image: %s", *sent.Description)
+		}
+	} else if sent := b.SendMediaGroup(chatID, media, nil); !sent.Ok {
+		errorMessage = fmt.Sprintf("Failed to send related images: %s", *sent.Description)
+	}
+
+	return errorMessage
+}
+
+// send encoded images as an album
+//
+// (albums can only be sent with file ids, so each image is uploaded as a photo and deleted right away for getting its file id)
+func sendImagesAsAlbum(b Messenger, chatID int64, userID int, images [][]byte) (errorMessage string) {
+	if len(images) > maxAlbumImages {
+		images = images[:maxAlbumImages]
+	}
+
+	// 'uploading photo...'
+	b.SendChatAction(chatID, bot.ChatActionUploadPhoto)
+
+	fileIDs := []string{}
+	for _, img := range images {
+		img, err := watermarkImage(img)
+		if err != nil {
+			return fmt.Sprintf("Failed to watermark image: %s", err)
 		}
-	case Tag:
-		if recognized, err := cvClient.TagImage(fileURL); err == nil {
-			tags := []string{}
-			for _, t := range recognized.Tags {
-				tags = append(tags, fmt.Sprintf("%s (%.3f%%)", t.Name, t.Confidence*100.0))
+		photo, err := convertToJPEG(img, jpegQualityFor(userID))
+		if err != nil {
+			return fmt.Sprintf("Failed to encode image: %s", err)
+		}
+
+		// (an album needs at least 2 images, so a single image is just sent as it is)
+		if len(images) == 1 {
+			if sent := b.SendPhoto(chatID, bot.InputFileFromBytes(photo), nil); !sent.Ok {
+				errorMessage = fmt.Sprintf("Failed to send image: %s", *sent.Description)
 			}
-			message = strings.Join(tags, "\n")
 
-			if len(strings.TrimSpace(message)) > 0 {
-				// send tags
-				if sent := b.SendMessage(chatID, message, nil); !sent.Ok {
-					errorMessage = fmt.Sprintf("Failed to send tags: %s", *sent.Description)
-				}
-			} else {
-				errorMessage = "Could not tag given image."
+			return errorMessage
+		}
+
+		if sent := b.SendPhoto(chatID, bot.InputFileFromBytes(photo), map[string]interface{}{
+			"disable_notification": true,
+		}); sent.Ok {
+			if fileID, ok := imageFileID(sent.Result); ok {
+				fileIDs = append(fileIDs, fileID)
 			}
+			b.DeleteMessage(chatID, sent.Result.MessageID)
 		} else {
-			errorMessage = fmt.Sprintf("Failed to tag image: %s", err)
+			return fmt.Sprintf("Failed to upload image: %s", *sent.Description)
 		}
-	default:
-		errorMessage = fmt.Sprintf("Command not supported: %s", command)
 	}
 
-	// delete original message
-	b.DeleteMessage(chatID, messageIDToDelete)
+	return sendRelatedImages(b, chatID, fileIDs)
+}
 
-	// if there was any error, send it back
-	if errorMessage != "" {
-		b.SendMessage(chatID, errorMessage, nil)
+// send result image as a photo or a document, and return the id of the sent message
+func sendResultImage(ctx context.Context, b Messenger, chatID int64, userID int, command CognitiveCommand, caption string, image []byte) (sentMessageID int, err error) {
+	var sent bot.APIResponseMessage
+	options := map[string]interface{}{
+		"caption": caption,
+	}
+
+	// (encoding and sending are traced separately)
+	_, encodeSpan := startSpan(ctx, "encode image", spanKindInternal)
+
+	// (images which should be kept as they are, eg. without metadata, are not watermarked)
+	if !documentOnlyCommands[command] {
+		if image, err = watermarkImage(image); err != nil {
+			encodeSpan.finish(err)
+			return 0, fmt.Errorf("Failed to watermark image: %s", err)
+		}
+	}
+
+	if sendAsDocument(userID, command) {
+		// 'uploading document...'
+		b.SendChatAction(chatID, bot.ChatActionUploadDocument)
+
+		// send result image as a document in the output format, for avoiding recompression
+		var document []byte
+		document, err = convertToFormat(image, outputFormatFor(userID), jpegQualityFor(userID))
+		if encodeSpan.finish(err); err != nil {
+			return 0, fmt.Errorf("Failed to encode image: %s", err)
+		}
+		_, sendSpan := startSpan(ctx, "telegram sendDocument", spanKindClient)
+		sent = b.SendDocument(chatID, bot.InputFileFromBytes(document), options)
+		sendSpan.finish(nil)
+	} else {
+		// 'uploading photo...'
+		b.SendChatAction(chatID, bot.ChatActionUploadPhoto)
+
+		// send result image as a photo
+		var photo []byte
+		photo, err = convertToJPEG(image, jpegQualityFor(userID))
+		if encodeSpan.finish(err); err != nil {
+			return 0, fmt.Errorf("Failed to encode image: %s", err)
+		}
+		_, sendSpan := startSpan(ctx, "telegram sendPhoto", spanKindClient)
+		sent = b.SendPhoto(chatID, bot.InputFileFromBytes(photo), options)
+		sendSpan.finish(nil)
+	}
+
+	if !sent.Ok {
+		return 0, fmt.Errorf("Failed to send image: %s", *sent.Description)
+	}
+
+	return sent.Result.MessageID, nil
+}
+
+// encode given image losslessly (in PNG)
+func encodeImage(img image.Image) ([]byte, error) {
+	return imaging.EncodeWithPool(func(w io.Writer) error {
+		return imaging.PNGEncoder.Encode(w, img)
+	})
+}
+
+// commands whose result images should always be sent as documents (eg. for keeping them as they are)
+var documentOnlyCommands = map[CognitiveCommand]bool{}
+
+// check if result images should be sent as documents for given user and command
+func sendAsDocument(userID int, command CognitiveCommand) bool {
+	if documentOnlyCommands[command] {
+		return true
+	}
+
+	for _, c := range conf().DocumentCommands {
+		if c == command {
+			return true
+		}
+	}
+
+	return getBoolPreference(userID, preferenceSendAsDocument)
+}
+
+// timeout for processing given command
+func commandTimeout(command CognitiveCommand) time.Duration {
+	if seconds, exists := conf().CommandTimeoutSeconds[command]; exists && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return time.Duration(conf().TimeoutSeconds) * time.Second
+}
+
+// the longest timeout of all commands
+func maxCommandTimeout() time.Duration {
+	longest := time.Duration(conf().TimeoutSeconds) * time.Second
+	for _, seconds := range conf().CommandTimeoutSeconds {
+		if timeout := time.Duration(seconds) * time.Second; timeout > longest {
+			longest = timeout
+		}
+	}
+
+	return longest
+}
 
-		logError(errorMessage)
+// download file from given url as bytes
+func downloadBytes(ctx context.Context, fileURL string) (data []byte, err error) {
+	_, span := startSpan(ctx, "telegram download", spanKindClient)
+	defer func() {
+		span.setAttribute("http.response.body.size", len(data))
+		span.finish(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, err
 	}
+
+	resp, err := telegramHTTPClient().Do(req)
+	if err != nil {
+		// (errors have the url, which has the telegram api token in it)
+		return nil, fmt.Errorf("%s", redactToken(err.Error()))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(resp.Body)
 }
 
-// generate inline keyboards for selecting action
+// generate inline keyboards for selecting action on images
 func genImageInlineKeyboards(fileID string) [][]bot.InlineKeyboardButton {
+	return genFileInlineKeyboards(MediaImage, fileID)
+}
+
+// generate inline keyboards for selecting action on given file of given media type
+//
+// (the file id is saved on the server, for it is too long to be in callback data)
+func genFileInlineKeyboards(media MediaType, fileID string) [][]bot.InlineKeyboardButton {
+	return genInlineKeyboards(commandsFor(media), callbackTargetOf(fileID, media))
+}
+
+// generate inline keyboards for selecting one of given commands on given target (token of a file, or id of an album)
+func genInlineKeyboards(cmds []CognitiveCommand, target string) [][]bot.InlineKeyboardButton {
+	cancel := signCallbackData(commandCancel)
+	cancelButtons := []bot.InlineKeyboardButton{
+		bot.InlineKeyboardButton{Text: strings.Title(commandCancel), CallbackData: &cancel},
+	}
+
+	// (custom labels and rows, if configured)
+	if len(conf().CommandLabels) > 0 || len(conf().CommandRows) > 0 {
+		return append(genCommandRows(cmds, target), cancelButtons)
+	}
+
 	data := map[string]string{}
-	for _, cmd := range allCmds {
-		data[string(cmd)] = fmt.Sprintf("%s%s", shortCmdsMap[cmd], fileID)
+	for _, cmd := range cmds {
+		data[string(cmd)] = genCallbackData(cmd, target)
 	}
 
-	cancel := commandCancel
-	return append(bot.NewInlineKeyboardButtonsAsRowsWithCallbackData(data), []bot.InlineKeyboardButton{
-		bot.InlineKeyboardButton{Text: strings.Title(commandCancel), CallbackData: &cancel},
-	})
+	return append(bot.NewInlineKeyboardButtonsAsRowsWithCallbackData(data), cancelButtons)
+}
+
+// generate rows of buttons for given commands, grouped and ordered as `command-rows`, and labeled with `command-labels`
+//
+// (commands which are not in `command-rows` follow them, one per row)
+func genCommandRows(cmds []CognitiveCommand, target string) (rows [][]bot.InlineKeyboardButton) {
+	available := map[CognitiveCommand]bool{}
+	for _, cmd := range cmds {
+		available[cmd] = true
+	}
+
+	button := func(cmd CognitiveCommand) bot.InlineKeyboardButton {
+		data := genCallbackData(cmd, target)
+		return bot.InlineKeyboardButton{Text: labelOf(cmd), CallbackData: &data}
+	}
+
+	placed := map[CognitiveCommand]bool{}
+	for _, configured := range conf().CommandRows {
+		row := []bot.InlineKeyboardButton{}
+		for _, cmd := range configured {
+			if available[cmd] && !placed[cmd] {
+				row = append(row, button(cmd))
+				placed[cmd] = true
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	for _, cmd := range cmds {
+		if !placed[cmd] {
+			rows = append(rows, []bot.InlineKeyboardButton{button(cmd)})
+		}
+	}
+
+	return rows
+}
+
+// send inline keyboards for running another action on the same file (so that it does not have to be sent again)
+func sendRerunKeyboard(b Messenger, chatID int64, userID int, media MediaType, fileID string) {
+	var message string
+	switch media {
+	case MediaImage:
+		message = messageRerunImage
+	case MediaVideo:
+		message = messageRerunVideo
+	case MediaSticker:
+		message = messageRerunSticker
+	default:
+		return
+	}
+
+	language := languageFor(userID)
+	if sent := b.SendMessage(chatID, localize(language, message), map[string]interface{}{
+		"reply_markup": bot.InlineKeyboardMarkup{
+			InlineKeyboard: genFileInlineKeyboards(media, fileID),
+		},
+		"disable_notification": true,
+	}); sent.Ok {
+		// expire it later
+		trackPrompt(chatID, sent.Result.MessageID, language)
+	} else {
+		logger.Error(fmt.Sprintf("Failed to send keyboards for re-running: %s", *sent.Description))
+	}
+}
+
+// generate inline keyboards for selecting action on PDF documents
+func genPDFInlineKeyboards(fileID string) [][]bot.InlineKeyboardButton {
+	return genFileInlineKeyboards(MediaPDF, fileID)
+}
+
+// prepare a mutable image of given one, and contexts for drawing shapes and texts on it
+//
+// (given image is drawn on directly if it is already mutable, so it should not be used after this)
+func prepareAnnotation(img image.Image) (newImg *image.RGBA, gc *draw2dimg.GraphicContext, fc *freetype.Context, fontSize float64) {
+	newImg = imaging.MutableRGBA(img)
+	gc = draw2dimg.NewGraphicContext(newImg)
+	gc.SetLineWidth(conf().StrokeWidth)
+	gc.SetFillColor(color.Transparent)
+
+	// prepare freetype font
+	fc = freetype.NewContext()
+	fc.SetFont(loaded().font)
+	fc.SetDPI(72)
+	fc.SetClip(newImg.Bounds())
+	fc.SetDst(newImg)
+	fontSize = float64(newImg.Bounds().Dy()) * conf().FontSizeRatio
+	fc.SetFontSize(fontSize)
+
+	return newImg, gc, fc, fontSize
+}
+
+// draw a rectangle
+func drawRectangle(gc *draw2dimg.GraphicContext, rect cog.Rectangle) {
+	gc.MoveTo(float64(rect.Left), float64(rect.Top))
+	gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top))
+	gc.LineTo(float64(rect.Left+rect.Width), float64(rect.Top+rect.Height))
+	gc.LineTo(float64(rect.Left), float64(rect.Top+rect.Height))
+	gc.LineTo(float64(rect.Left), float64(rect.Top))
+	gc.Close()
+	gc.FillStroke()
+}
+
+// draw a polygon with given points (x1, y1, x2, y2, ...)
+func drawPolygon(gc *draw2dimg.GraphicContext, points []float64) {
+	if len(points) < 4 {
+		return
+	}
+
+	gc.MoveTo(points[0], points[1])
+	for i := 2; i+1 < len(points); i += 2 {
+		gc.LineTo(points[i], points[i+1])
+	}
+	gc.LineTo(points[0], points[1])
+	gc.Close()
+	gc.FillStroke()
+}
+
+// draw a label below given rectangle
+func drawLabel(fc *freetype.Context, label string, rect cog.Rectangle, fontSize float64) {
+	if _, err := fc.DrawString(
+		label,
+		freetype.Pt(
+			rect.Left,
+			int(fc.PointToFixed(float64(rect.Top+rect.Height)+fontSize)>>6),
+		),
+	); err != nil {
+		logger.Error(fmt.Sprintf("Failed to draw string: %s", err))
+	}
 }
 
 // rotate color
 func colorForIndex(i int) color.RGBA {
-	length := len(colors)
-	return colors[i%length]
+	colors := loaded().colors
+	return colors[i%len(colors)]
 }
 
 // check if give face landmarks has all requsted keys
@@ -623,3 +1045,71 @@ func genMaskPoints(lt, lb, lo, rt, rb, ro cog.Point) (lu, ll, rl, ru cog.Point)
 		cog.Point{X: rb.X + dX, Y: rb.Y + dY}, // right lower point
 		cog.Point{X: rt.X + dX, Y: rt.Y - dY} // right upper point
 }
+
+// get file id of the image in given message
+func imageFileID(message *bot.Message) (fileID string, exists bool) {
+	if message.HasPhoto() {
+		lastIndex := len(message.Photo) - 1 // XXX - last one is the largest
+
+		return message.Photo[lastIndex].FileID, true
+	} else if message.HasDocument() && message.Document.MimeType != nil && strings.HasPrefix(*message.Document.MimeType, "image/") && *message.Document.MimeType != "image/gif" {
+		// (gif images will be handled as animations)
+		return message.Document.FileID, true
+	}
+
+	return "", false
+}
+
+// get file id of the voice or audio in given message
+func audioFileID(message *bot.Message) (fileID string, exists bool) {
+	if message.HasVoice() {
+		return message.Voice.FileID, true
+	} else if message.HasAudio() {
+		return message.Audio.FileID, true
+	} else if message.HasDocument() && message.Document.MimeType != nil && strings.HasPrefix(*message.Document.MimeType, "audio/") {
+		return message.Document.FileID, true
+	}
+
+	return "", false
+}
+
+// check if given chat is a group chat
+func isGroupChat(chat bot.Chat) bool {
+	switch string(chat.Type) {
+	case "group", "supergroup":
+		return true
+	}
+
+	return false
+}
+
+// check if this bot was called in a group chat:
+//
+// mentioned in the text or caption, or replied to an image with a command
+func isCalledInGroup(message *bot.Message) bool {
+	mention := fmt.Sprintf("@%s", botUsername)
+
+	var text string
+	if message.HasText() {
+		text = *message.Text
+	} else if message.HasCaption() {
+		text = *message.Caption
+	}
+
+	if botUsername != "" && strings.Contains(strings.ToLower(text), strings.ToLower(mention)) {
+		return true
+	}
+
+	if message.ReplyToMessage != nil && strings.HasPrefix(text, "/") {
+		// commands with other bot's username are not for this bot
+		command := strings.Fields(text)[0]
+		if strings.Contains(command, "@") && !strings.EqualFold(command[strings.Index(command, "@"):], mention) {
+			return false
+		}
+
+		_, isImage := imageFileID(message.ReplyToMessage)
+		return isImage
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+// helpers for tests, which replace global clients and stores with mocks (and restore them after each test)
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// use given config (with its defaults, and resources loaded) in the test
+func useConfig(t *testing.T, config Config) {
+	t.Helper()
+
+	if config.TelegramAPIToken == "" {
+		config.TelegramAPIToken = "0123456789:test-token"
+	}
+	setDefaults(&config)
+
+	s, err := loadSnapshot(&config)
+	if err != nil {
+		t.Fatalf("failed to load resources of config: %s", err)
+	}
+
+	previous := loaded()
+	current.Store(s)
+	t.Cleanup(func() {
+		current.Store(previous)
+	})
+}
+
+// use a new local database (for quotas, preferences, and histories) in the test
+func useDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	database, err := storage.OpenDb(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+
+	previousDb, previousQueue, previousCounter, previousTargets := db, jobQueue, requestCounter, callbackTargets
+	db, jobQueue, requestCounter, callbackTargets = database, database, database, database
+	t.Cleanup(func() {
+		db, jobQueue, requestCounter, callbackTargets = previousDb, previousQueue, previousCounter, previousTargets
+		database.Close()
+	})
+
+	return database
+}
+
+// use given client of Cognitive Services in the test
+func useCognitive(t *testing.T, client CognitiveClient) {
+	t.Helper()
+
+	previous := cognitive
+	cognitive = client
+	t.Cleanup(func() {
+		cognitive = previous
+	})
+}
+
+// mockCognitive struct for a CognitiveClient which returns prepared results
+//
+// (methods which are not overridden here panic, for the embedded interface is nil)
+type mockCognitive struct {
+	CognitiveClient
+
+	faces []DetectedFace
+	tags  TagResult
+	err   error
+
+	calls int
+	image []byte // (last one given to Tag)
+}
+
+// DetectFaces returns prepared faces
+func (m *mockCognitive) DetectFaces(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) ([]DetectedFace, error) {
+	m.calls++
+	return m.faces, m.err
+}
+
+// Tag returns prepared tags
+func (m *mockCognitive) Tag(ctx context.Context, image []byte) (TagResult, error) {
+	m.calls++
+	m.image = image
+	return m.tags, m.err
+}
+
+// new callback query from given user, on a message of the bot in a private chat
+func newCallbackQuery(userID int, data string) bot.Update {
+	username := "tester"
+
+	return bot.Update{
+		CallbackQuery: &bot.CallbackQuery{
+			ID:   "query-id",
+			From: bot.User{ID: userID, Username: &username, FirstName: "Tester"},
+			Message: &bot.Message{
+				MessageID: 42,
+				Chat:      bot.Chat{ID: int64(userID), Type: bot.ChatTypePrivate},
+			},
+			Data: &data,
+		},
+	}
+}
+
+// encoded PNG of a solid image for testing
+func testImageBytes(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// (stripes, which are changed by masking)
+			if (x/4)%2 == 0 {
+				img.Set(x, y, c)
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
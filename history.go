@@ -0,0 +1,175 @@
+package main
+
+// functions for the history of processed requests
+//
+// each result is recorded with its message, so users can jump back to it with `/history`
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for history
+const (
+	historyCallbackPrefix = "history-" // (not in the format of signed callback data, for it only replies to a message)
+
+	defaultHistoryCount     = 10
+	maxHistoryCount         = 50
+	historyButtonsPerRow    = 5
+	maxHistorySummaryLength = 50
+)
+
+// record a processed request with its result message
+func saveHistory(chatID int64, userID int, messageID int, command CognitiveCommand, message string) {
+	if db == nil || messageID == 0 {
+		return
+	}
+
+	if err := db.SaveHistory(History{
+		UserID:    userID,
+		ChatID:    chatID,
+		MessageID: messageID,
+		Command:   command,
+		Summary:   summarize(message),
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save history: %s", err))
+	}
+}
+
+// summarize given result message with its first line
+func summarize(message string) string {
+	summary := ""
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			summary = line
+			break
+		}
+	}
+	if summary == "" {
+		return "(image)"
+	}
+
+	if utf8.RuneCountInString(summary) > maxHistorySummaryLength {
+		summary = string([]rune(summary)[:maxHistorySummaryLength]) + "..."
+	}
+
+	return summary
+}
+
+// check if given message is `/history [N]`
+//
+// (it is processed separately from other user commands, for it is answered with inline keyboards)
+func isHistoryCommand(message *bot.Message) bool {
+	if message.From == nil || !message.HasText() {
+		return false
+	}
+
+	command, _ := parseCommand(*message.Text)
+
+	return command == userCommandHistory
+}
+
+// process `/history [N]`, and send recent analyses of the user in the chat with buttons for jumping to their results
+func processHistoryCommand(b Messenger, message *bot.Message) bool {
+	chatID, userID := message.Chat.ID, message.From.ID
+	language := languageFor(userID)
+
+	options := map[string]interface{}{
+		"reply_to_message_id": message.MessageID,
+	}
+
+	var text string
+	_, argument := parseCommand(*message.Text)
+	count, err := strconv.Atoi(argument)
+	if argument == "" {
+		count = defaultHistoryCount
+	} else if err != nil || count < 1 || count > maxHistoryCount {
+		count = 0
+		text = fmt.Sprintf(localize(language, messageHistoryUsage), maxHistoryCount)
+	}
+
+	if count > 0 {
+		if db == nil {
+			text = localize(language, messageNoDatabase)
+		} else if history, err := db.GetHistory(chatID, userID, count); err != nil {
+			text = fmt.Sprintf("Failed to get history: %s", err)
+		} else if len(history) <= 0 {
+			text = localize(language, messageHistoryEmpty)
+		} else {
+			lines := []string{fmt.Sprintf(localize(language, messageHistory), len(history))}
+			for i, h := range history {
+				lines = append(lines, fmt.Sprintf("#%d %s %s: %s", i+1, h.ProcessedOn.Format("2006-01-02 15:04"), h.Command, h.Summary))
+			}
+			text = strings.Join(lines, "\n")
+
+			options["reply_markup"] = bot.InlineKeyboardMarkup{
+				InlineKeyboard: genHistoryInlineKeyboards(history),
+			}
+		}
+	}
+
+	if sent := b.SendMessage(chatID, text, options); !sent.Ok {
+		logger.Error(fmt.Sprintf("Failed to send history: %s", *sent.Description))
+
+		return false
+	}
+
+	return true
+}
+
+// generate inline keyboards for jumping to the results of given history
+func genHistoryInlineKeyboards(history []History) [][]bot.InlineKeyboardButton {
+	keyboards := [][]bot.InlineKeyboardButton{}
+
+	row := []bot.InlineKeyboardButton{}
+	for i, h := range history {
+		data := signCallbackData(fmt.Sprintf("%s%d", historyCallbackPrefix, h.MessageID))
+		row = append(row, bot.InlineKeyboardButton{Text: fmt.Sprintf("#%d", i+1), CallbackData: &data})
+
+		if len(row) >= historyButtonsPerRow {
+			keyboards = append(keyboards, row)
+			row = []bot.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		keyboards = append(keyboards, row)
+	}
+
+	return keyboards
+}
+
+// check if given callback data is for jumping to a result
+func isHistoryCallback(data string) bool {
+	return strings.HasPrefix(data, historyCallbackPrefix)
+}
+
+// process callback query for jumping to a result:
+//
+// reply to the result message, so it can be reached by tapping the reply
+func processHistoryCallback(b Messenger, query bot.CallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	chatID := query.Message.Chat.ID
+	language := languageFor(query.From.ID)
+
+	messageID, err := strconv.Atoi(strings.TrimPrefix(*query.Data, historyCallbackPrefix))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Malformed history callback data: %s", *query.Data))
+		return
+	}
+
+	if sent := b.SendMessage(chatID, localize(language, messageHistoryHere), map[string]interface{}{
+		"reply_to_message_id": messageID,
+	}); !sent.Ok {
+		// (fails if the result message was deleted)
+		b.SendMessage(chatID, localize(language, messageHistoryDeleted), map[string]interface{}{
+			"reply_to_message_id": query.Message.MessageID,
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+// functions for enrolling persons and identifying faces (person groups are scoped per chat)
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// user command for enrolling a person
+const (
+	userCommandRemember = "/remember"
+
+	maxFacesPerIdentification = 10 // limit of Face API
+)
+
+func init() {
+	registerCommand(newCommand(Identify, "W", handleIdentify), MediaImage, MediaVideo, MediaAlbum)
+
+	// enrolled persons differ in each chat
+	uncachedCommands[Identify] = true
+}
+
+// id of the person group for given chat
+func personGroupID(chatID int64) string {
+	return fmt.Sprintf("chat_%d", chatID)
+}
+
+// parse a '/remember' command from given message
+func parseRememberCommand(message *bot.Message) (fileID, name string, ok bool) {
+	return parseImageCommand(message, userCommandRemember)
+}
+
+// parse given slash command with a non-empty argument for an image
+//
+// (in the caption of an image, or in a reply to an image)
+func parseImageCommand(message *bot.Message, expected string) (fileID, argument string, ok bool) {
+	if message.From == nil {
+		return "", "", false
+	}
+
+	var text string
+	if message.HasText() && message.ReplyToMessage != nil {
+		if fileID, ok = imageFileID(message.ReplyToMessage); !ok {
+			return "", "", false
+		}
+		text = *message.Text
+	} else if message.HasCaption() {
+		if fileID, ok = imageFileID(message); !ok {
+			return "", "", false
+		}
+		text = *message.Caption
+	} else {
+		return "", "", false
+	}
+
+	command, argument := parseCommand(text)
+	if command != expected || argument == "" {
+		return "", "", false
+	}
+
+	return fileID, argument, true
+}
+
+// enqueue enrollment of a person with the face on given image
+func processRememberCommand(ctx context.Context, b Messenger, message *bot.Message, fileID, name string) {
+	if sent := b.SendMessage(message.Chat.ID, fmt.Sprintf("Remembering '%s'...", name), map[string]interface{}{
+		"reply_to_message_id": message.MessageID,
+	}); sent.Ok {
+		if err := enqueueJob(ctx, Job{
+			Kind:      JobKindRemember,
+			ChatID:    message.Chat.ID,
+			UserID:    message.From.ID,
+			MessageID: sent.Result.MessageID,
+			FileIDs:   []string{fileID},
+			Command:   Identify,
+			Argument:  name,
+		}); err != nil {
+			logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+			b.EditMessageText(localizeFor(message.From.ID, messageFailedToEnqueue), map[string]interface{}{
+				"chat_id":    message.Chat.ID,
+				"message_id": sent.Result.MessageID,
+			})
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+	}
+}
+
+// enroll the largest face on given image as a person with given name
+func processRemember(b Messenger, chatID int64, userID int, messageIDToDelete int, fileURL, name string) {
+	var message string
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout(Identify))
+	defer cancel()
+
+	if err := rememberPerson(ctx, chatID, fileURL, name); err == nil {
+		message = fmt.Sprintf("Remembered '%s'.", name)
+	} else {
+		message = fmt.Sprintf("Failed to remember '%s': %s", name, err)
+
+		if ctx.Err() == context.DeadlineExceeded {
+			message = fmt.Sprintf(localizeFor(userID, messageTimedOut), userCommandRemember)
+		}
+
+		logger.Error(message)
+	}
+
+	// delete status message, and send the result
+	b.DeleteMessage(chatID, messageIDToDelete)
+	b.SendMessage(chatID, message, nil)
+}
+
+// add the largest face on given image to a person (which will be created if needed) of the chat
+func rememberPerson(ctx context.Context, chatID int64, fileURL, name string) error {
+	groupID := personGroupID(chatID)
+
+	imageBytes, err := loadImage(ctx, fileURL)
+	if err != nil {
+		return err
+	}
+
+	faces, err := cognitive.DetectFaces(ctx, imageBytes, false, false, nil)
+	if err != nil {
+		return err
+	}
+	face, exists := largestFace(faces)
+	if !exists {
+		return errors.New("no face detected on this image")
+	}
+
+	if err = cognitive.CreatePersonGroup(ctx, groupID); err != nil {
+		return err
+	}
+
+	var personID string
+	if personID, err = db.GetPersonID(chatID, name); err != nil {
+		return err
+	}
+	if personID == "" {
+		if personID, err = cognitive.CreatePerson(ctx, groupID, name); err != nil {
+			return err
+		}
+		if err = db.SavePerson(chatID, name, personID); err != nil {
+			return err
+		}
+	}
+
+	if err = cognitive.AddPersonFace(ctx, groupID, personID, imageBytes, face.FaceRectangle); err != nil {
+		return err
+	}
+
+	return cognitive.TrainPersonGroup(ctx, groupID)
+}
+
+// identify faces on given image bytes with persons enrolled in the chat
+func handleIdentify(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	chatID, exists := chatIDFromContext(ctx)
+	if !exists {
+		return result, errors.New("No chat for identifying faces.")
+	}
+
+	names, err := db.GetPersonNames(chatID)
+	if err != nil {
+		return result, fmt.Errorf("Failed to load enrolled persons: %s", err)
+	}
+	if len(names) <= 0 {
+		return result, fmt.Errorf("No one is enrolled in this chat yet. Reply to an image with '%s <name>' first.", userCommandRemember)
+	}
+
+	faces, err := cognitive.DetectFaces(ctx, imageBytes, true, false, nil)
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+	if len(faces) > maxFacesPerIdentification {
+		faces = faces[:maxFacesPerIdentification]
+	}
+
+	faceIDs := []string{}
+	for _, f := range faces {
+		faceIDs = append(faceIDs, f.FaceID)
+	}
+	identified, err := cognitive.IdentifyFaces(ctx, personGroupID(chatID), faceIDs)
+	if err != nil {
+		return result, fmt.Errorf("Failed to identify faces: %s", err)
+	}
+
+	// name and confidence of each face
+	labels := map[string]string{}
+	for _, i := range identified {
+		if len(i.Candidates) > 0 {
+			if name, exists := names[i.Candidates[0].PersonID]; exists {
+				labels[i.FaceID] = fmt.Sprintf("%s (%.3f%%)", name, i.Candidates[0].Confidence*100.0)
+			}
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+	strs := []string{}
+	for i, f := range faces {
+		label, exists := labels[f.FaceID]
+		if !exists {
+			label = "Unknown"
+		}
+
+		// set color
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		fc.SetSrc(&image.Uniform{color})
+
+		// draw rectangles and names on detected faces
+		drawRectangle(gc, f.FaceRectangle)
+		drawLabel(fc, fmt.Sprintf("#%d %s", i+1, strings.SplitN(label, " (", 2)[0]), f.FaceRectangle, fontSize)
+
+		strs = append(strs, fmt.Sprintf("[Face #%d] %s", i+1, label))
+	}
+	gc.Save()
+
+	result.Message = strings.Join(strs, "\n")
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+// functions for rejecting images which are too large to be decoded safely
+//
+// (a decoded image takes 4 bytes per pixel, so a small but huge PNG, eg. of 20000x20000, can take up gigabytes of memory)
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// constants for limits of images
+const (
+	defaultMaxInputImageDimension  = 16384
+	defaultMaxInputImageMegapixels = 50 // (about 200MB when decoded)
+)
+
+// imageTooLargeError struct for images which exceed the limits
+type imageTooLargeError struct {
+	Width  int
+	Height int
+}
+
+// Error returns the description of the error
+func (e imageTooLargeError) Error() string {
+	return fmt.Sprintf("image is too large to be processed (%dx%d)", e.Width, e.Height)
+}
+
+// check if given image bytes are within the limits, from their header only (without decoding their pixels)
+func checkImageLimits(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	return checkImageDimensions(config.Width, config.Height)
+}
+
+// check if given dimensions of an image are within the limits
+//
+// (`max-input-image-dimension` and `max-input-image-megapixels`)
+func checkImageDimensions(width, height int) error {
+	if width > conf().MaxInputImageDimension || height > conf().MaxInputImageDimension ||
+		int64(width)*int64(height) > int64(conf().MaxInputImageMegapixels)*1000000 {
+		return imageTooLargeError{Width: width, Height: height}
+	}
+
+	return nil
+}
+
+// message for given error of opening an image, which will be sent to given user
+func openImageErrorMessage(userID int, err error) string {
+	if tooLarge, ok := err.(imageTooLargeError); ok {
+		return fmt.Sprintf(localizeFor(userID, messageImageTooLarge), tooLarge.Width, tooLarge.Height, conf().MaxInputImageDimension, conf().MaxInputImageMegapixels)
+	}
+
+	return fmt.Sprintf("Failed to open image: %s", err)
+}
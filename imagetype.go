@@ -0,0 +1,48 @@
+package main
+
+// functions for classifying types of images (clip arts and line drawings)
+
+import (
+	"context"
+	"fmt"
+)
+
+// descriptions of clip art types
+var clipArtTypes = []string{
+	"Not a clip art",
+	"Ambiguous",
+	"Normal clip art",
+	"Good clip art",
+}
+
+func init() {
+	registerCommand(newCommand(ImageType, "IT", handleImageType), MediaImage, MediaVideo, MediaAlbum, MediaPDF)
+}
+
+// classify the type of given image bytes
+func handleImageType(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := cognitive.Analyze(ctx, imageBytes, []string{"ImageType"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to classify image: %s", err)
+	}
+	t := analyzed.ImageType
+
+	clipArt := fmt.Sprintf("Unknown (%d)", t.ClipArtType)
+	if t.ClipArtType >= 0 && t.ClipArtType < len(clipArtTypes) {
+		clipArt = clipArtTypes[t.ClipArtType]
+	}
+
+	lineDrawing := "Not a line drawing"
+	if t.LineDrawingType == 1 {
+		lineDrawing = "Line drawing"
+	}
+
+	result.Message = fmt.Sprintf(`Clip art: %s (%d/3)
+Line drawing: %s`,
+		clipArt,
+		t.ClipArtType,
+		lineDrawing,
+	)
+
+	return result, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+// interfaces for external services, which can be replaced with other implementations (eg. mocks)
+
+import (
+	"context"
+	"time"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+
+	// for Telegram bot
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/telegram"
+)
+
+// Messenger interface for sending and editing messages on Telegram
+//
+// (satisfied by *bot.Bot, and *telegram.Mock for testing)
+type Messenger = telegram.Messenger
+
+// VisionProvider interface for vision services which can be selected per command (see providers.go)
+//
+// (satisfied by CognitiveClient, googleVision, and awsRekognition)
+type VisionProvider interface {
+	DetectFaces(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) ([]DetectedFace, error)
+	Tag(ctx context.Context, image []byte) (TagResult, error)
+	Analyze(ctx context.Context, image []byte, visualFeatures []string) (AnalyzeResult, error)
+	Read(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (ReadResult, error)
+}
+
+// CognitiveClient interface for calling Cognitive Services
+type CognitiveClient interface {
+	VisionProvider
+
+	VerifyFaces(ctx context.Context, faceID1, faceID2 string) (VerifyResult, error)
+	CreatePersonGroup(ctx context.Context, personGroupID string) error
+	DeletePersonGroup(ctx context.Context, personGroupID string) error
+	CreatePerson(ctx context.Context, personGroupID, name string) (string, error)
+	AddPersonFace(ctx context.Context, personGroupID, personID string, image []byte, targetFace cog.Rectangle) error
+	TrainPersonGroup(ctx context.Context, personGroupID string) error
+	IdentifyFaces(ctx context.Context, personGroupID string, faceIDs []string) ([]IdentifyResult, error)
+	CreateFaceList(ctx context.Context, faceListID string) error
+	DeleteFaceList(ctx context.Context, faceListID string) error
+	AddFaceListFace(ctx context.Context, faceListID string, image []byte, targetFace cog.Rectangle, userData string) (string, error)
+	GetFaceList(ctx context.Context, faceListID string) (FaceList, error)
+	FindSimilarFaces(ctx context.Context, faceID, faceListID string, maxCandidates int, mode string) ([]SimilarFace, error)
+	RecognizeCelebrities(ctx context.Context, image []byte) (CelebritiesResult, error)
+	Describe(ctx context.Context, image []byte, maxCandidates int) (DescribeResult, error)
+	GenerateThumbnail(ctx context.Context, image []byte, width, height int) ([]byte, error)
+	Transcribe(ctx context.Context, audio []byte, contentType string) (SpeechResult, error)
+	AnalyzeText(ctx context.Context, analysis, text string) (TextAnalyticsResult, error)
+	Translate(ctx context.Context, text, to string) (TranslationResult, error)
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+	Moderate(ctx context.Context, image []byte) (ModerationResult, error)
+	PredictCustomVision(ctx context.Context, image []byte) (CustomVisionResult, error)
+	AnalyzeForm(ctx context.Context, model string, image []byte, progress func(status string, elapsed time.Duration)) (FormResult, error)
+}
+
+// JobQueue interface for the persistent job queue
+type JobQueue = storage.JobQueue
+
+// RequestCounter interface for counting requests of users (for quotas)
+type RequestCounter = storage.RequestCounter
+
+// Coordinator interface for coordinating multiple instances of the bot
+type Coordinator = storage.Coordinator
+
+// CallbackTargetStore interface for saving targets of inline keyboards with short tokens
+type CallbackTargetStore = storage.CallbackTargetStore
+
+// UserDataStore interface for stores which keep data of users (for deleting them with `/forgetme`)
+type UserDataStore = storage.UserDataStore
+
+// client for Cognitive Services (can be replaced for testing)
+var cognitive CognitiveClient = azureClient{}
+
+// CognitiveClient implementation with Azure REST APIs
+type azureClient struct{}
+
+// DetectFaces detects faces on given image bytes
+func (azureClient) DetectFaces(ctx context.Context, image []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) ([]DetectedFace, error) {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return nil, err
+	}
+
+	faces, err := detectFacesBytes(ctx, image, returnFaceID, returnFaceLandmarks, returnFaceAttributes)
+
+	return scaleDetectedFaces(faces, scale), err
+}
+
+// VerifyFaces verifies if two detected faces belong to the same person
+func (azureClient) VerifyFaces(ctx context.Context, faceID1, faceID2 string) (VerifyResult, error) {
+	return verifyFaces(ctx, faceID1, faceID2)
+}
+
+// CreatePersonGroup creates a person group
+func (azureClient) CreatePersonGroup(ctx context.Context, personGroupID string) error {
+	return createPersonGroup(ctx, personGroupID)
+}
+
+// DeletePersonGroup deletes a person group
+func (azureClient) DeletePersonGroup(ctx context.Context, personGroupID string) error {
+	return deletePersonGroup(ctx, personGroupID)
+}
+
+// CreatePerson creates a person in a person group
+func (azureClient) CreatePerson(ctx context.Context, personGroupID, name string) (string, error) {
+	return createPerson(ctx, personGroupID, name)
+}
+
+// AddPersonFace adds a face to a person
+func (azureClient) AddPersonFace(ctx context.Context, personGroupID, personID string, image []byte, targetFace cog.Rectangle) error {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return err
+	}
+
+	return addPersonFace(ctx, personGroupID, personID, image, scaleRectangle(targetFace, 1.0/scale))
+}
+
+// TrainPersonGroup starts training a person group
+func (azureClient) TrainPersonGroup(ctx context.Context, personGroupID string) error {
+	return trainPersonGroup(ctx, personGroupID)
+}
+
+// IdentifyFaces identifies detected faces with persons in a person group
+func (azureClient) IdentifyFaces(ctx context.Context, personGroupID string, faceIDs []string) ([]IdentifyResult, error) {
+	return identifyFaces(ctx, personGroupID, faceIDs)
+}
+
+// CreateFaceList creates a face list
+func (azureClient) CreateFaceList(ctx context.Context, faceListID string) error {
+	return createFaceList(ctx, faceListID)
+}
+
+// DeleteFaceList deletes a face list
+func (azureClient) DeleteFaceList(ctx context.Context, faceListID string) error {
+	return deleteFaceList(ctx, faceListID)
+}
+
+// AddFaceListFace adds a face to a face list
+func (azureClient) AddFaceListFace(ctx context.Context, faceListID string, image []byte, targetFace cog.Rectangle, userData string) (string, error) {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return "", err
+	}
+
+	return addFaceListFace(ctx, faceListID, image, scaleRectangle(targetFace, 1.0/scale), userData)
+}
+
+// GetFaceList gets a face list with its persisted faces
+func (azureClient) GetFaceList(ctx context.Context, faceListID string) (FaceList, error) {
+	return getFaceList(ctx, faceListID)
+}
+
+// FindSimilarFaces finds similar faces in a face list
+func (azureClient) FindSimilarFaces(ctx context.Context, faceID, faceListID string, maxCandidates int, mode string) ([]SimilarFace, error) {
+	return findSimilarFaces(ctx, faceID, faceListID, maxCandidates, mode)
+}
+
+// RecognizeCelebrities recognizes celebrities on given image bytes
+func (azureClient) RecognizeCelebrities(ctx context.Context, image []byte) (CelebritiesResult, error) {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return CelebritiesResult{}, err
+	}
+
+	result, err := recognizeCelebrities(ctx, image)
+	for i, c := range result.Result.Celebrities {
+		result.Result.Celebrities[i].FaceRectangle = scaleRectangle(c.FaceRectangle, scale)
+	}
+
+	return result, err
+}
+
+// Describe describes given image bytes
+func (azureClient) Describe(ctx context.Context, image []byte, maxCandidates int) (DescribeResult, error) {
+	image, _, err := downscaleForAzure(image)
+	if err != nil {
+		return DescribeResult{}, err
+	}
+
+	return describeBytes(ctx, image, maxCandidates)
+}
+
+// Tag tags given image bytes
+func (azureClient) Tag(ctx context.Context, image []byte) (TagResult, error) {
+	image, _, err := downscaleForAzure(image)
+	if err != nil {
+		return TagResult{}, err
+	}
+
+	return tagBytes(ctx, image)
+}
+
+// Analyze analyzes given image bytes with visual features
+func (azureClient) Analyze(ctx context.Context, image []byte, visualFeatures []string) (AnalyzeResult, error) {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return AnalyzeResult{}, err
+	}
+
+	result, err := analyzeBytes(ctx, image, visualFeatures)
+	for i, o := range result.Objects {
+		rect := scaleRectangle(o.Rectangle.toRectangle(), scale)
+		result.Objects[i].Rectangle = ObjectRectangle{X: rect.Left, Y: rect.Top, W: rect.Width, H: rect.Height}
+	}
+
+	return result, err
+}
+
+// GenerateThumbnail generates a smart-cropped thumbnail of given image bytes
+func (azureClient) GenerateThumbnail(ctx context.Context, image []byte, width, height int) ([]byte, error) {
+	image, _, err := downscaleForAzure(image)
+	if err != nil {
+		return nil, err
+	}
+
+	return generateThumbnail(ctx, image, width, height)
+}
+
+// Read recognizes texts on given image bytes
+func (azureClient) Read(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (ReadResult, error) {
+	image, scale, err := downscaleForAzure(image)
+	if err != nil {
+		return ReadResult{}, err
+	}
+
+	result, err := readBytes(ctx, image, progress)
+
+	return scaleReadResult(result, scale), err
+}
+
+// Transcribe transcribes given audio bytes
+func (azureClient) Transcribe(ctx context.Context, audio []byte, contentType string) (SpeechResult, error) {
+	return transcribeBytes(ctx, audio, contentType)
+}
+
+// AnalyzeText analyzes given text
+func (azureClient) AnalyzeText(ctx context.Context, analysis, text string) (TextAnalyticsResult, error) {
+	return analyzeText(ctx, analysis, text)
+}
+
+// Translate translates given text to given language
+func (azureClient) Translate(ctx context.Context, text, to string) (TranslationResult, error) {
+	return translateText(ctx, text, to)
+}
+
+// Synthesize synthesizes speech of given text
+func (azureClient) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	return synthesizeSpeech(ctx, text)
+}
+
+// AnalyzeForm analyzes given image bytes with a prebuilt model of Form Recognizer
+func (azureClient) AnalyzeForm(ctx context.Context, model string, image []byte, progress func(status string, elapsed time.Duration)) (FormResult, error) {
+	return analyzeForm(ctx, model, image, progress)
+}
+
+// Moderate moderates given image bytes and the text on it
+func (azureClient) Moderate(ctx context.Context, image []byte) (ModerationResult, error) {
+	image, _, err := downscaleForAzure(image)
+	if err != nil {
+		return ModerationResult{}, err
+	}
+
+	return moderateImage(ctx, image)
+}
+
+// PredictCustomVision classifies given image bytes, or detects objects on them, with the configured Custom Vision project
+func (azureClient) PredictCustomVision(ctx context.Context, image []byte) (CustomVisionResult, error) {
+	image, _, err := downscaleForAzure(image)
+	if err != nil {
+		return CustomVisionResult{}, err
+	}
+
+	return predictCustomVision(ctx, image)
+}
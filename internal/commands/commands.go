@@ -0,0 +1,170 @@
+package commands
+
+// registry of commands which process media
+//
+// each command of the bot is implemented in its own file, and registers itself in `init()`:
+//
+//	func init() {
+//		registerCommand(newCommand("My Command", "X", handleMyCommand), MediaImage, MediaVideo, MediaAlbum)
+//	}
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Name type for names of commands
+type Name string
+
+// MediaType type for the kind of media which commands can process
+type MediaType string
+
+// media types
+const (
+	MediaImage   MediaType = "image"
+	MediaVideo   MediaType = "video" // (processed with its representative frame)
+	MediaAlbum   MediaType = "album" // (each image is processed one by one)
+	MediaSticker MediaType = "sticker"
+	MediaAudio   MediaType = "audio"
+	MediaPDF     MediaType = "pdf"
+)
+
+// ContactCard struct for a contact, which will be sent as a Telegram contact
+type ContactCard struct {
+	PhoneNumber string
+	FirstName   string
+	LastName    string
+	VCard       string
+}
+
+// Result struct for the result of a command
+type Result struct {
+	Message string // result message (can be empty)
+	Image   []byte // encoded result image (can be nil)
+
+	Related    []string     // file ids of related images, which will be sent as an album (can be nil)
+	Images     [][]byte     // additional encoded images, which will be sent as an album (can be nil)
+	Attachment []byte       // additional file (eg. CSV), which will be sent as a document (can be nil)
+	Contact    *ContactCard // contact, which will be sent as a Telegram contact (can be nil)
+}
+
+// Handler type for functions which process given media bytes
+//
+// (`progress` will be called with progress messages of slow operations, if it is not nil)
+type Handler func(ctx context.Context, input []byte, progress func(message string)) (Result, error)
+
+// Command interface for commands
+type Command interface {
+	Name() Name      // also used as the label of its button
+	ShortID() string // unique, short id for callback data
+	Handle(ctx context.Context, input []byte, progress func(message string)) (Result, error)
+}
+
+// command with a handler function
+type simpleCommand struct {
+	name    Name
+	shortID string
+	handler Handler
+}
+
+// New creates a new command with given name, short id, and handler function
+func New(name Name, shortID string, handler Handler) Command {
+	return simpleCommand{
+		name:    name,
+		shortID: shortID,
+		handler: handler,
+	}
+}
+
+// Name returns the name of the command
+func (c simpleCommand) Name() Name {
+	return c.name
+}
+
+// ShortID returns the short id of the command
+func (c simpleCommand) ShortID() string {
+	return c.shortID
+}
+
+// Handle processes given media bytes
+func (c simpleCommand) Handle(ctx context.Context, input []byte, progress func(message string)) (Result, error) {
+	return c.handler(ctx, input, progress)
+}
+
+// Registry struct for registered commands
+type Registry struct {
+	reserved string // (which cannot be in short ids, eg. the separator of callback data)
+
+	all       []Command
+	byName    map[Name]Command
+	byShortID map[string]Command
+	byMedia   map[MediaType][]Name
+}
+
+// NewRegistry creates a new registry, which rejects short ids containing `reserved`
+func NewRegistry(reserved string) *Registry {
+	return &Registry{
+		reserved:  reserved,
+		byName:    map[Name]Command{},
+		byShortID: map[string]Command{},
+		byMedia:   map[MediaType][]Name{},
+	}
+}
+
+// Register registers a command for given media types
+//
+// (panics if its name or short id is duplicated, or its short id is invalid)
+func (r *Registry) Register(command Command, media ...MediaType) {
+	if _, exists := r.byName[command.Name()]; exists {
+		panic(fmt.Sprintf("duplicated command name: %s", command.Name()))
+	}
+	if command.ShortID() == "" || (r.reserved != "" && strings.Contains(command.ShortID(), r.reserved)) {
+		panic(fmt.Sprintf("invalid short id of command '%s': '%s'", command.Name(), command.ShortID()))
+	}
+	if registered, exists := r.byShortID[command.ShortID()]; exists {
+		panic(fmt.Sprintf("short id '%s' of command '%s' is already used by '%s'", command.ShortID(), command.Name(), registered.Name()))
+	}
+
+	r.all = append(r.all, command)
+	r.byName[command.Name()] = command
+	r.byShortID[command.ShortID()] = command
+	for _, m := range media {
+		r.byMedia[m] = append(r.byMedia[m], command.Name())
+	}
+}
+
+// Lookup returns the command with given name
+func (r *Registry) Lookup(name Name) (command Command, exists bool) {
+	command, exists = r.byName[name]
+	return command, exists
+}
+
+// ByShortID returns the command with given short id
+func (r *Registry) ByShortID(shortID string) (command Command, exists bool) {
+	command, exists = r.byShortID[shortID]
+	return command, exists
+}
+
+// For returns names of commands for given media type, in the order of their registrations
+//
+// (commands for which `isDisabled` returns true are excluded, when it is not nil)
+func (r *Registry) For(media MediaType, isDisabled func(name Name) bool) []Name {
+	if isDisabled == nil {
+		return r.byMedia[media]
+	}
+
+	enabled := []Name{}
+	for _, name := range r.byMedia[media] {
+		if !isDisabled(name) {
+			enabled = append(enabled, name)
+		}
+	}
+
+	return enabled
+}
+
+// All returns all registered commands, in the order of their registrations
+func (r *Registry) All() []Command {
+	return r.all
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// handler which returns given message
+func handlerWithMessage(message string) Handler {
+	return func(ctx context.Context, input []byte, progress func(message string)) (Result, error) {
+		return Result{Message: message}, nil
+	}
+}
+
+// check if given function panics
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+
+	f()
+
+	return false
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry(":")
+	r.Register(New("Face", "F", handlerWithMessage("face")), MediaImage, MediaVideo)
+	r.Register(New("Tag", "T", handlerWithMessage("tag")), MediaImage)
+	r.Register(New("Transcribe", "S", handlerWithMessage("transcribe")), MediaAudio)
+
+	if c, exists := r.Lookup("Tag"); !exists || c.ShortID() != "T" {
+		t.Errorf("lookup by name failed: %v, %v", c, exists)
+	}
+	if c, exists := r.ByShortID("S"); !exists || c.Name() != "Transcribe" {
+		t.Errorf("lookup by short id failed: %v, %v", c, exists)
+	}
+	if _, exists := r.Lookup("Unknown"); exists {
+		t.Errorf("unknown command was found")
+	}
+
+	if names := r.For(MediaImage, nil); !reflect.DeepEqual(names, []Name{"Face", "Tag"}) {
+		t.Errorf("commands for images are in wrong order: %v", names)
+	}
+	if names := r.For(MediaVideo, nil); !reflect.DeepEqual(names, []Name{"Face"}) {
+		t.Errorf("wrong commands for videos: %v", names)
+	}
+	if names := r.For(MediaPDF, nil); len(names) != 0 {
+		t.Errorf("wrong commands for pdfs: %v", names)
+	}
+	if len(r.All()) != 3 {
+		t.Errorf("wrong number of registered commands: %d", len(r.All()))
+	}
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	r := NewRegistry(":")
+	r.Register(New("Face", "F", handlerWithMessage("face")), MediaImage)
+
+	for name, command := range map[string]Command{
+		"duplicated name":     New("Face", "G", handlerWithMessage("")),
+		"duplicated short id": New("Faces", "F", handlerWithMessage("")),
+		"empty short id":      New("Tag", "", handlerWithMessage("")),
+		"reserved short id":   New("Tag", "T:1", handlerWithMessage("")),
+	} {
+		if !panics(func() { r.Register(command, MediaImage) }) {
+			t.Errorf("%s was registered", name)
+		}
+	}
+
+	if len(r.All()) != 1 {
+		t.Errorf("invalid commands were registered: %d", len(r.All()))
+	}
+}
+
+func TestForWithDisabled(t *testing.T) {
+	r := NewRegistry(":")
+	r.Register(New("Face", "F", handlerWithMessage("face")), MediaImage)
+	r.Register(New("Tag", "T", handlerWithMessage("tag")), MediaImage)
+
+	names := r.For(MediaImage, func(name Name) bool {
+		return name == "Face"
+	})
+	if !reflect.DeepEqual(names, []Name{"Tag"}) {
+		t.Errorf("disabled command was not excluded: %v", names)
+	}
+
+	// (the registry itself is not changed)
+	if names := r.For(MediaImage, nil); len(names) != 2 {
+		t.Errorf("registered commands were changed: %v", names)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	r := NewRegistry(":")
+	r.Register(New("Tag", "T", handlerWithMessage("tagged")), MediaImage)
+
+	c, _ := r.Lookup("Tag")
+	result, err := c.Handle(context.Background(), nil, nil)
+	if err != nil || result.Message != "tagged" {
+		t.Errorf("unexpected result: %v, %v", result, err)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+// functions for reading config from a JSON file and environment variables
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Read reads config from given file, overridden by environment variables
+//
+// (the file is optional when all needed values are given from environment variables,
+// and values are not validated nor defaulted here)
+func Read(filepath string) (config Config, err error) {
+	if file, err := ioutil.ReadFile(filepath); err == nil {
+		if err := json.Unmarshal(file, &config); err != nil {
+			return config, err
+		}
+	} else if !os.IsNotExist(err) {
+		return config, err
+	}
+
+	if err = overrideWithEnv(&config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// EnvName returns the name of the environment variable for given json key
+//
+// (eg. "telegram-api-token" => "TELEGRAM_API_TOKEN")
+func EnvName(key string) string {
+	return strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// override config values with environment variables
+//
+// strings, numbers, and booleans are parsed as they are,
+// lists of strings or numbers are separated by commas,
+// and all others (eg. maps) are parsed as JSON
+func overrideWithEnv(config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		name := EnvName(key)
+		if value, exists := os.LookupEnv(name); exists {
+			if err := setValue(v.Field(i), value); err != nil {
+				return fmt.Errorf("invalid value for %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// set given string value to a field
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		switch field.Type().Elem().Kind() {
+		case reflect.String, reflect.Int, reflect.Int64:
+			values := reflect.MakeSlice(field.Type(), 0, 0)
+			for _, element := range strings.Split(value, ",") {
+				if element = strings.TrimSpace(element); element == "" {
+					continue
+				}
+
+				item := reflect.New(field.Type().Elem()).Elem()
+				if err := setValue(item, element); err != nil {
+					return err
+				}
+				values = reflect.Append(values, item)
+			}
+			field.Set(values)
+		default:
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+	default:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+
+	return nil
+}
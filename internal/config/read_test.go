@@ -0,0 +1,151 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// write given json to a temporary config file, and return its filepath
+func writeConfig(t *testing.T, json string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(json), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// set an environment variable for the test only
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	previous, existed := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestEnvName(t *testing.T) {
+	if name := EnvName("telegram-api-token"); name != "TELEGRAM_API_TOKEN" {
+		t.Errorf("unexpected name: %s", name)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := writeConfig(t, `{
+	"telegram-api-token": "0123456789:abcdefghijklmnopqrstuvwxyz",
+	"is-verbose": true,
+	"font-size-ratio": 0.05,
+	"disabled-commands": ["Face Detection"],
+	"command-labels": {"Tag This Image": "Tags"},
+	"log-sinks": [{"type": "file", "filepath": "bot.log"}],
+	"azure-ad": {"tenant-id": "tenant"}
+}`)
+
+	config, err := Read(path)
+	if err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	}
+
+	if config.TelegramAPIToken != "0123456789:abcdefghijklmnopqrstuvwxyz" || !config.IsVerbose || config.FontSizeRatio != 0.05 {
+		t.Errorf("wrong values: %+v", config)
+	}
+	if !reflect.DeepEqual(config.DisabledCommands, []commands.Name{"Face Detection"}) {
+		t.Errorf("wrong disabled commands: %v", config.DisabledCommands)
+	}
+	if config.CommandLabels["Tag This Image"] != "Tags" {
+		t.Errorf("wrong command labels: %v", config.CommandLabels)
+	}
+	if len(config.LogSinks) != 1 || config.LogSinks[0].Filepath != "bot.log" {
+		t.Errorf("wrong log sinks: %v", config.LogSinks)
+	}
+	if config.AzureAD.TenantID != "tenant" {
+		t.Errorf("wrong azure ad: %v", config.AzureAD)
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	setenv(t, "TELEGRAM_API_TOKEN", "from-env")
+
+	config, err := Read(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("missing file should be allowed: %s", err)
+	}
+	if config.TelegramAPIToken != "from-env" {
+		t.Errorf("value from environment variable was not read: %s", config.TelegramAPIToken)
+	}
+}
+
+func TestReadMalformedFile(t *testing.T) {
+	if _, err := Read(writeConfig(t, `{"telegram-api-token": `)); err == nil {
+		t.Errorf("malformed file was read without errors")
+	}
+}
+
+func TestOverrideWithEnv(t *testing.T) {
+	path := writeConfig(t, `{"telegram-api-token": "from-file", "max-concurrent-jobs": 2}`)
+
+	setenv(t, "TELEGRAM_API_TOKEN", "from-env")
+	setenv(t, "MAX_CONCURRENT_JOBS", "8")
+	setenv(t, "IS_VERBOSE", "true")
+	setenv(t, "ALLOWED_CHAT_IDS", "-100, 200,")
+	setenv(t, "DISABLED_COMMANDS", "Face Detection,Tag This Image")
+	setenv(t, "SUBSCRIPTION_KEYS", `{"face": ["key1", "key2"]}`)
+	setenv(t, "LOG_SINKS", `[{"type": "stdout", "format": "json"}]`)
+
+	config, err := Read(path)
+	if err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	}
+
+	if config.TelegramAPIToken != "from-env" {
+		t.Errorf("string was not overridden: %s", config.TelegramAPIToken)
+	}
+	if config.MaxConcurrentJobs != 8 {
+		t.Errorf("number was not overridden: %d", config.MaxConcurrentJobs)
+	}
+	if !config.IsVerbose {
+		t.Errorf("bool was not overridden")
+	}
+	if !reflect.DeepEqual(config.AllowedChatIDs, []int64{-100, 200}) {
+		t.Errorf("list of numbers was not overridden: %v", config.AllowedChatIDs)
+	}
+	if !reflect.DeepEqual(config.DisabledCommands, []commands.Name{"Face Detection", "Tag This Image"}) {
+		t.Errorf("list of strings was not overridden: %v", config.DisabledCommands)
+	}
+	if !reflect.DeepEqual(config.SubscriptionKeys, map[string][]string{"face": {"key1", "key2"}}) {
+		t.Errorf("map was not overridden: %v", config.SubscriptionKeys)
+	}
+	if len(config.LogSinks) != 1 || config.LogSinks[0].Format != "json" {
+		t.Errorf("list of structs was not overridden: %v", config.LogSinks)
+	}
+}
+
+func TestOverrideWithInvalidEnv(t *testing.T) {
+	for key, value := range map[string]string{
+		"MAX_CONCURRENT_JOBS": "many",
+		"IS_VERBOSE":          "sure",
+		"ALLOWED_USER_IDS":    "1,two",
+		"COMMAND_LABELS":      "{",
+	} {
+		t.Run(key, func(t *testing.T) {
+			setenv(t, key, value)
+
+			if _, err := Read(writeConfig(t, `{}`)); err == nil {
+				t.Errorf("invalid value of %s was accepted: %s", key, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package imaging
+
+// functions for reusing buffers of encoding images, and avoiding copies of decoded images
+//
+// (for less garbage to collect under load, as result images are large)
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"sync"
+)
+
+// constants for buffers
+const (
+	maxPooledBufferBytes = 16 * 1024 * 1024 // larger buffers are not pooled, not to be kept forever
+)
+
+// pool of buffers for encoding images
+var encodeBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// pngBufferPool struct for reusing internal buffers of PNG encoders
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+// Get returns a pooled buffer of PNG encoder, or nil if there is none
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	if b, ok := p.pool.Get().(*png.EncoderBuffer); ok {
+		return b
+	}
+
+	return nil
+}
+
+// Put returns given buffer of PNG encoder to the pool
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) {
+	p.pool.Put(b)
+}
+
+// PNGEncoder is a PNG encoder which reuses its buffers
+var PNGEncoder = &png.Encoder{BufferPool: &pngBufferPool{}}
+
+// EncodeWithPool encodes with given function into a pooled buffer, and returns a copy of the encoded bytes
+//
+// (the copy is of the exact size, while the buffer grows and is reused)
+func EncodeWithPool(encode func(w io.Writer) error) ([]byte, error) {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferBytes {
+			encodeBuffers.Put(buf)
+		}
+	}()
+
+	if err := encode(buf); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// MutableRGBA returns given image as a mutable *image.RGBA, without copying it if it already is one (eg. decoded from an opaque PNG)
+//
+// (given image may be drawn on, so callers which need the original one later should pass a copy from `CopyRGBA`)
+func MutableRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	return CopyRGBA(img)
+}
+
+// CopyRGBA returns a copy of given image as a new *image.RGBA
+func CopyRGBA(img image.Image) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	return rgba
+}
@@ -0,0 +1,24 @@
+package imaging
+
+// functions for comparing original images with processed ones
+
+import (
+	"image"
+	"image/draw"
+)
+
+// gap between the original and processed images, relative to the width of an image
+const compareGapRatio = 0.02
+
+// SideBySide puts given original (before) and processed (after) images side by side
+func SideBySide(before, after image.Image) *image.RGBA {
+	width, height := before.Bounds().Dx(), before.Bounds().Dy()
+	gap := int(float64(width) * compareGapRatio)
+
+	composite := image.NewRGBA(image.Rect(0, 0, width*2+gap, height))
+	draw.Draw(composite, composite.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(composite, image.Rect(0, 0, width, height), before, before.Bounds().Min, draw.Src)
+	draw.Draw(composite, image.Rect(width+gap, 0, width*2+gap, height), after, after.Bounds().Min, draw.Src)
+
+	return composite
+}
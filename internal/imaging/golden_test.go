@@ -0,0 +1,107 @@
+package imaging
+
+// helpers for comparing drawn images with golden images in testdata/
+//
+// (run `go test -update` to regenerate golden images after intended changes of the drawing code)
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden images in testdata/")
+
+// maximum difference of each channel, for small differences of floating point operations between platforms
+const goldenTolerance = 2
+
+// compare given image with the golden one of given name
+func assertGolden(t *testing.T, name string, img image.Image) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden.png")
+
+	if *update {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := readPNG(path)
+	if err != nil {
+		t.Fatalf("failed to read golden image (run with -update to generate it): %s", err)
+	}
+
+	if img.Bounds().Size() != golden.Bounds().Size() {
+		t.Fatalf("size of %s differs: %v (golden: %v)", name, img.Bounds().Size(), golden.Bounds().Size())
+	}
+
+	diffs := 0
+	var first image.Point
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			c1 := color.NRGBAModel.Convert(img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)).(color.NRGBA)
+			c2 := color.NRGBAModel.Convert(golden.At(golden.Bounds().Min.X+x, golden.Bounds().Min.Y+y)).(color.NRGBA)
+
+			if differs(c1.R, c2.R) || differs(c1.G, c2.G) || differs(c1.B, c2.B) || differs(c1.A, c2.A) {
+				if diffs == 0 {
+					first = image.Pt(x, y)
+				}
+				diffs++
+			}
+		}
+	}
+	if diffs > 0 {
+		t.Errorf("%d pixel(s) of %s differ from the golden image (first at %v)", diffs, name, first)
+	}
+}
+
+// check if given values of a channel differ more than the tolerance
+func differs(v1, v2 uint8) bool {
+	if v1 > v2 {
+		return v1-v2 > goldenTolerance
+	}
+
+	return v2-v1 > goldenTolerance
+}
+
+// read a PNG image from given filepath
+func readPNG(path string) (image.Image, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return png.Decode(bytes.NewReader(data))
+}
+
+// generate an opaque image of gradients and stripes for testing, which is not blank after any drawing
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: 128,
+				A: 255,
+			}
+			if (x/8+y/8)%2 == 0 {
+				c.B = 255
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,172 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// paths of resources of the bot
+var (
+	sunglassesPath = filepath.Join("..", "..", "assets", "sunglasses.png")
+	fontPath       = filepath.Join("..", "..", "fonts", "RobotoCondensed-Regular.ttf")
+)
+
+func TestEncodeWithPool(t *testing.T) {
+	img := testImage(64, 48)
+
+	encoded, err := EncodeWithPool(func(w io.Writer) error {
+		return PNGEncoder.Encode(w, img)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("failed to decode encoded image: %s", err)
+	}
+	if decoded.Bounds() != img.Bounds() || decoded.At(10, 20) != img.At(10, 20) {
+		t.Errorf("encoded image differs from the original one")
+	}
+}
+
+func TestMutableRGBA(t *testing.T) {
+	img := testImage(16, 16)
+	if MutableRGBA(img) != img {
+		t.Errorf("*image.RGBA at the origin was copied")
+	}
+
+	sub := img.SubImage(image.Rect(4, 4, 12, 12)).(*image.RGBA)
+	mutable := MutableRGBA(sub)
+	if mutable == sub || mutable.Bounds() != image.Rect(0, 0, 8, 8) || mutable.At(0, 0) != img.At(4, 4) {
+		t.Errorf("sub image was not copied to the origin: %v", mutable.Bounds())
+	}
+}
+
+func TestCopyRGBA(t *testing.T) {
+	img := testImage(16, 16)
+
+	copied := CopyRGBA(img)
+	copied.SetRGBA(0, 0, color.RGBA{A: 255})
+	if img.At(0, 0) == copied.At(0, 0) {
+		t.Errorf("original image was changed with its copy")
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	before := testImage(100, 60)
+	after := CopyRGBA(before)
+	Mask(after, image.Rect(20, 10, 70, 50), MaskStylePixelate, 0.2, color.Black)
+
+	assertGolden(t, "side_by_side", SideBySide(before, after))
+}
+
+func TestMask(t *testing.T) {
+	for _, style := range []string{MaskStylePixelate, MaskStyleBlur, MaskStyleSolid} {
+		t.Run(style, func(t *testing.T) {
+			img := testImage(120, 90)
+			Mask(img, image.Rect(30, 20, 90, 80), style, 0.125, color.RGBA{R: 255, A: 255})
+
+			assertGolden(t, "mask_"+style, img)
+		})
+	}
+
+	if !IsValidMaskStyle(MaskStyleBlur) || IsValidMaskStyle("mosaic") {
+		t.Errorf("wrong validation of mask styles")
+	}
+}
+
+func TestDrawSunglasses(t *testing.T) {
+	data, err := ioutil.ReadFile(sunglassesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sunglasses, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := testImage(200, 150)
+	DrawSunglasses(img, sunglasses, Point{X: 120, Y: 80}, Point{X: 70, Y: 60}) // (tilted, and given from the right one)
+
+	assertGolden(t, "sunglasses", img)
+}
+
+func TestDrawCovering(t *testing.T) {
+	overlay := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if (x-5)*(x-5)+(y-5)*(y-5) < 25 {
+				overlay.SetRGBA(x, y, color.RGBA{R: 255, G: 200, A: 255})
+			}
+		}
+	}
+
+	img := testImage(120, 90)
+	DrawCovering(img, overlay, image.Rect(40, 20, 70, 70)) // (covered with a square of 50x50)
+
+	assertGolden(t, "covering", img)
+}
+
+func TestPalette(t *testing.T) {
+	img := Palette([]color.RGBA{
+		{R: 255, A: 255},
+		{G: 255, A: 255},
+		{B: 255, A: 255},
+	}, 20, 10)
+
+	assertGolden(t, "palette", img)
+}
+
+func TestWatermark(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			logo.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+
+	for _, position := range []string{WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight} {
+		t.Run(position, func(t *testing.T) {
+			img := testImage(200, 100)
+			Watermark(img, WatermarkLogo(logo, img.Bounds()), position, 0.5)
+
+			assertGolden(t, "watermark_logo_"+position, img)
+		})
+	}
+
+	if !IsValidWatermarkPosition(WatermarkTopLeft) || IsValidWatermarkPosition("center") {
+		t.Errorf("wrong validation of watermark positions")
+	}
+}
+
+func TestWatermarkText(t *testing.T) {
+	data, err := ioutil.ReadFile(fontPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := truetype.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := testImage(240, 120)
+	mark, err := WatermarkText(img.Bounds(), "telegram-ms-cognitive-bot", font, 1.0/8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark.Bounds().Dx() > img.Bounds().Dx() {
+		t.Errorf("text is wider than the image: %d", mark.Bounds().Dx())
+	}
+	Watermark(img, mark, WatermarkBottomRight, 0.8)
+
+	assertGolden(t, "watermark_text", img)
+}
@@ -0,0 +1,58 @@
+package imaging
+
+// functions for masking regions of images (eg. faces)
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+// styles of masking
+const (
+	MaskStylePixelate = "pixelate"
+	MaskStyleBlur     = "blur"
+	MaskStyleSolid    = "solid"
+)
+
+// IsValidMaskStyle checks if given style of masking is known
+func IsValidMaskStyle(style string) bool {
+	switch style {
+	case MaskStylePixelate, MaskStyleBlur, MaskStyleSolid:
+		return true
+	}
+
+	return false
+}
+
+// Mask masks given region of an image with a style and its strength
+//
+// (strength is the size of pixels, or the sigma of blur, relative to the width of the region,
+// and `solid` is the color of the solid style)
+func Mask(img *image.RGBA, bounds image.Rectangle, style string, strength float64, solid color.Color) {
+	amount := int(float64(bounds.Dx()) * strength)
+	if amount < 1 {
+		amount = 1
+	}
+
+	var filter gift.Filter
+	switch style {
+	case MaskStyleSolid:
+		draw.Draw(img, bounds, &image.Uniform{solid}, image.Point{}, draw.Src)
+		return
+	case MaskStyleBlur:
+		filter = gift.GaussianBlur(float32(amount))
+	default:
+		filter = gift.Pixelate(amount)
+	}
+
+	g := gift.New(filter)
+	g.DrawAt(
+		img,
+		img.SubImage(bounds),
+		bounds.Min,
+		gift.CopyOperator,
+	)
+}
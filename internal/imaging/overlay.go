@@ -0,0 +1,83 @@
+package imaging
+
+// functions for putting images (eg. sunglasses and emojis) over others, and drawing color palettes
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+// width of sunglasses, relative to the distance between pupils
+const sunglassesWidthRatio = 2.2
+
+// Point struct for a point with sub-pixel precision (eg. of face landmarks)
+type Point struct {
+	X, Y float64
+}
+
+// DrawSunglasses puts given sunglasses on an image, scaled and rotated to the pupils
+func DrawSunglasses(img *image.RGBA, sunglasses image.Image, pupilLeft, pupilRight Point) {
+	// (left one on the image first)
+	if pupilLeft.X > pupilRight.X {
+		pupilLeft, pupilRight = pupilRight, pupilLeft
+	}
+
+	dx, dy := pupilRight.X-pupilLeft.X, pupilRight.Y-pupilLeft.Y
+	width := int(math.Hypot(dx, dy) * sunglassesWidthRatio)
+	if width <= 0 {
+		return
+	}
+	degrees := math.Atan2(dy, dx) * 180.0 / math.Pi
+
+	// scale, and rotate it along the line between pupils
+	g := gift.New(
+		gift.Resize(width, 0, gift.LinearResampling),
+		gift.Rotate(float32(-degrees), color.Transparent, gift.CubicInterpolation),
+	)
+	bounds := g.Bounds(sunglasses.Bounds())
+
+	// center it at the midpoint of pupils
+	cx, cy := (pupilLeft.X+pupilRight.X)/2.0, (pupilLeft.Y+pupilRight.Y)/2.0
+	g.DrawAt(
+		img,
+		sunglasses,
+		image.Pt(int(cx)-bounds.Dx()/2, int(cy)-bounds.Dy()/2),
+		gift.OverOperator,
+	)
+}
+
+// DrawCovering puts given overlay (eg. an emoji) over a region of an image,
+// scaled to a square which covers the whole region
+func DrawCovering(img *image.RGBA, overlay image.Image, region image.Rectangle) {
+	size := region.Dx()
+	if region.Dy() > size {
+		size = region.Dy()
+	}
+	if size <= 0 {
+		return
+	}
+
+	g := gift.New(
+		gift.Resize(size, size, gift.LinearResampling),
+	)
+	g.DrawAt(
+		img,
+		overlay,
+		image.Pt(region.Min.X+region.Dx()/2-size/2, region.Min.Y+region.Dy()/2-size/2),
+		gift.OverOperator,
+	)
+}
+
+// Palette generates a strip image of given colors, with swatches of given size
+func Palette(palette []color.RGBA, swatchWidth, swatchHeight int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, swatchWidth*len(palette), swatchHeight))
+	for i, c := range palette {
+		draw.Draw(img, image.Rect(swatchWidth*i, 0, swatchWidth*(i+1), swatchHeight), &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+
+	return img
+}
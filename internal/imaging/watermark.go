@@ -0,0 +1,102 @@
+package imaging
+
+// functions for watermarks on images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+)
+
+// positions of watermarks
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+)
+
+// constants for sizes of watermarks
+const (
+	watermarkLogoWidthRatio = 0.2  // width of a logo, relative to the width of an image
+	watermarkMarginRatio    = 0.02 // margin from the corner, relative to the shorter side of an image
+)
+
+// IsValidWatermarkPosition checks if given watermark position is valid
+func IsValidWatermarkPosition(position string) bool {
+	switch position {
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight:
+		return true
+	}
+
+	return false
+}
+
+// Watermark puts given mark (from `WatermarkLogo` or `WatermarkText`) on an image,
+// at a corner of given position with an opacity (0.0-1.0)
+func Watermark(img *image.RGBA, mark image.Image, position string, opacity float64) {
+	// position of the watermark
+	bounds, size := img.Bounds(), mark.Bounds().Size()
+	margin := bounds.Dx()
+	if bounds.Dy() < margin {
+		margin = bounds.Dy()
+	}
+	margin = int(float64(margin) * watermarkMarginRatio)
+
+	at := image.Pt(margin, margin)
+	switch position {
+	case WatermarkTopRight:
+		at.X = bounds.Dx() - size.X - margin
+	case WatermarkBottomLeft:
+		at.Y = bounds.Dy() - size.Y - margin
+	case WatermarkBottomRight:
+		at = image.Pt(bounds.Dx()-size.X-margin, bounds.Dy()-size.Y-margin)
+	}
+
+	// composite it with the opacity
+	mask := image.NewUniform(color.Alpha{uint8(opacity * 255)})
+	draw.DrawMask(img, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+}
+
+// WatermarkLogo returns given logo scaled for an image with given bounds
+func WatermarkLogo(logo image.Image, bounds image.Rectangle) image.Image {
+	g := gift.New(
+		gift.Resize(int(float64(bounds.Dx())*watermarkLogoWidthRatio), 0, gift.LinearResampling),
+	)
+	scaled := image.NewRGBA(g.Bounds(logo.Bounds()))
+	g.Draw(scaled, logo)
+
+	return scaled
+}
+
+// WatermarkText returns text rendered in white for an image with given bounds, cropped to its width
+//
+// (font size is relative to the height of the image, and the whole canvas is returned with an error when drawing fails)
+func WatermarkText(bounds image.Rectangle, text string, font *truetype.Font, fontSizeRatio float64) (image.Image, error) {
+	fontSize := float64(bounds.Dy()) * fontSizeRatio
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), int(fontSize*1.5)))
+
+	fc := freetype.NewContext()
+	fc.SetFont(font)
+	fc.SetDPI(72)
+	fc.SetClip(canvas.Bounds())
+	fc.SetDst(canvas)
+	fc.SetSrc(image.White)
+	fc.SetFontSize(fontSize)
+
+	end, err := fc.DrawString(text, freetype.Pt(0, int(fontSize)))
+	if err != nil {
+		return canvas, err
+	}
+
+	width := int(end.X >> 6)
+	if width > canvas.Bounds().Dx() {
+		width = canvas.Bounds().Dx()
+	}
+
+	return canvas.SubImage(image.Rect(0, 0, width, canvas.Bounds().Dy())), nil
+}
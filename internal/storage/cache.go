@@ -0,0 +1,184 @@
+package storage
+
+// LRU cache with TTL for process results
+//
+// (optionally backed by a persistent store, eg. the local database, for surviving restarts)
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	// for results of commands
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// ResultCache struct
+type ResultCache struct {
+	capacity int
+	ttl      time.Duration
+
+	items map[string]*list.Element
+	order *list.List // front: most recently used
+
+	store   ResultStore // (can be nil)
+	onError func(err error)
+
+	sync.Mutex
+}
+
+type cacheEntry struct {
+	key string
+
+	CachedResult
+}
+
+// NewResultCache creates a new result cache
+//
+// (when `capacity` is 0 or less, nothing will be cached)
+func NewResultCache(capacity int, ttl time.Duration) *ResultCache {
+	return &ResultCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// SetStore sets a persistent store, which cached results will also be saved to and loaded from
+//
+// (failures of the store are not returned, but reported to `onError`)
+func (c *ResultCache) SetStore(store ResultStore, onError func(err error)) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if onError == nil {
+		onError = func(err error) {}
+	}
+
+	c.store = store
+	c.onError = onError
+}
+
+// Get returns the cached result for given key
+//
+// (the persistent store is read without the lock, not to block others while waiting for it)
+func (c *ResultCache) Get(key string) (result commands.Result, exists bool) {
+	if c == nil || key == "" {
+		return result, false
+	}
+
+	c.Lock()
+	if element, ok := c.items[key]; ok {
+		entry := element.Value.(*cacheEntry)
+
+		if time.Now().After(entry.ExpireAt) {
+			c.order.Remove(element)
+			delete(c.items, key)
+			c.Unlock()
+
+			return result, false
+		}
+
+		c.order.MoveToFront(element)
+		c.Unlock()
+
+		return entry.Result, true
+	}
+	store, onError := c.store, c.onError
+	c.Unlock()
+
+	// load from the persistent store, and keep it in memory
+	if store != nil && c.capacity > 0 {
+		stored, exists, err := store.GetCachedResult(key)
+		if err != nil {
+			onError(fmt.Errorf("failed to load cached result: %s", err))
+		} else if exists {
+			c.Lock()
+			if _, ok := c.items[key]; !ok { // (unless it was set while being loaded)
+				c.put(key, stored)
+			}
+			c.Unlock()
+
+			return stored.Result, true
+		}
+	}
+
+	return result, false
+}
+
+// Set caches given result (requested by given user) with given key
+func (c *ResultCache) Set(key string, userID int, result commands.Result) {
+	if c == nil || c.capacity <= 0 || key == "" {
+		return
+	}
+
+	cached := CachedResult{
+		Result:   result,
+		UserID:   userID,
+		ExpireAt: time.Now().Add(c.ttl),
+	}
+
+	c.Lock()
+	c.put(key, cached)
+	store, onError := c.store, c.onError
+	c.Unlock()
+
+	// (saved without the lock, same as above)
+	if store != nil {
+		if err := store.SetCachedResult(key, cached); err != nil {
+			onError(fmt.Errorf("failed to save cached result: %s", err))
+		}
+	}
+}
+
+// put given result in memory, and evict least recently used ones
+//
+// (should be called with the lock held)
+func (c *ResultCache) put(key string, cached CachedResult) {
+	if element, ok := c.items[key]; ok {
+		element.Value.(*cacheEntry).CachedResult = cached
+
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{
+		key:          key,
+		CachedResult: cached,
+	})
+
+	// evict least recently used ones
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// DeleteUserData deletes results in memory which were requested by given user
+//
+// (ones loaded from the persistent store are deleted from it, with its own `DeleteUserData`)
+func (c *ResultCache) DeleteUserData(userID int) error {
+	if c == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for key, element := range c.items {
+		if element.Value.(*cacheEntry).UserID == userID {
+			c.order.Remove(element)
+			delete(c.items, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// open a database in a temporary directory
+func openTestDb(t *testing.T) *Database {
+	t.Helper()
+
+	database, err := OpenDb(filepath.Join(t.TempDir(), "db.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return database
+}
+
+// result store which always fails
+type failingStore struct{}
+
+func (failingStore) GetCachedResult(key string) (cached CachedResult, exists bool, err error) {
+	return cached, false, errors.New("failed to get")
+}
+
+func (failingStore) SetCachedResult(key string, cached CachedResult) error {
+	return errors.New("failed to set")
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	c := NewResultCache(2, time.Minute)
+	c.Set("a", 1, commands.Result{Message: "a"})
+	c.Set("b", 1, commands.Result{Message: "b"})
+	c.Get("a") // (b becomes the least recently used one)
+	c.Set("c", 1, commands.Result{Message: "c"})
+
+	if _, exists := c.Get("b"); exists {
+		t.Errorf("least recently used result was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if result, exists := c.Get(key); !exists || result.Message != key {
+			t.Errorf("result of %s was not cached: %v, %v", key, result, exists)
+		}
+	}
+}
+
+func TestResultCacheExpiration(t *testing.T) {
+	c := NewResultCache(2, -time.Second)
+	c.Set("a", 1, commands.Result{Message: "a"})
+
+	if _, exists := c.Get("a"); exists {
+		t.Errorf("expired result was returned")
+	}
+}
+
+func TestResultCacheWithStore(t *testing.T) {
+	database := openTestDb(t)
+
+	c := NewResultCache(2, time.Minute)
+	c.SetStore(database, func(err error) { t.Errorf("unexpected error: %s", err) })
+	c.Set("a", 1, commands.Result{Message: "a"})
+
+	// (another cache with the same store, eg. after a restart)
+	restarted := NewResultCache(2, time.Minute)
+	restarted.SetStore(database, nil)
+	if result, exists := restarted.Get("a"); !exists || result.Message != "a" {
+		t.Errorf("result was not loaded from the store: %v, %v", result, exists)
+	}
+}
+
+func TestResultCacheWithFailingStore(t *testing.T) {
+	var errs []error
+
+	c := NewResultCache(2, time.Minute)
+	c.SetStore(failingStore{}, func(err error) { errs = append(errs, err) })
+	c.Set("a", 1, commands.Result{Message: "a"})
+	c.Get("b")
+
+	if len(errs) != 2 {
+		t.Errorf("errors of the store were not reported: %v", errs)
+	}
+	if result, exists := c.Get("a"); !exists || result.Message != "a" {
+		t.Errorf("result was not cached in memory: %v, %v", result, exists)
+	}
+}
+
+func TestResultCacheDeleteUserData(t *testing.T) {
+	database := openTestDb(t)
+
+	c := NewResultCache(4, time.Minute)
+	c.SetStore(database, func(err error) { t.Errorf("unexpected error: %s", err) })
+	c.Set("a", 1, commands.Result{Message: "a"})
+	c.Set("b", 2, commands.Result{Message: "b"})
+
+	// (in memory, and in the store)
+	for _, store := range []UserDataStore{c, database} {
+		if err := store.DeleteUserData(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, exists := c.Get("a"); exists {
+		t.Errorf("result of the deleted user was not deleted")
+	}
+	if _, exists := c.Get("b"); !exists {
+		t.Errorf("result of another user was deleted")
+	}
+
+	// (loaded from the store with its user, then deleted)
+	restarted := NewResultCache(4, time.Minute)
+	restarted.SetStore(database, nil)
+	restarted.Get("b")
+	restarted.DeleteUserData(2)
+	database.DeleteUserData(2)
+	if _, exists := restarted.Get("b"); exists {
+		t.Errorf("loaded result of the deleted user was not deleted")
+	}
+}
@@ -0,0 +1,502 @@
+package storage
+
+// storage backend with Redis, for result cache, quotas, and job queue
+//
+// (for running multiple instances of the bot which share them)
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	// for Redis
+	"github.com/gomodule/redigo/redis"
+
+	// for names of commands and their results
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// constants for Redis
+const (
+	DefaultRedisKeyPrefix = "telegram-ms-cognitive-bot:"
+
+	redisRequestsRetention = 25 * time.Hour // (longer than a day, for quotas per day)
+	redisCancelRequestTTL  = time.Hour
+
+	redisDialTimeout    = 5 * time.Second
+	redisCommandTimeout = 5 * time.Second
+	redisMaxIdleConns   = 8
+	redisIdleTimeout    = 5 * time.Minute
+)
+
+// RedisStore struct for states in Redis
+type RedisStore struct {
+	pool   *redis.Pool
+	prefix string
+
+	leaseTTL time.Duration // (running jobs whose leases are not renewed in it are regarded as of crashed instances)
+}
+
+// script for taking the oldest queued job, marking it as running, and leasing it at once
+//
+// (so a job is not lost even if the instance crashes while taking it;
+// KEYS: queued jobs, running jobs / ARGV: prefix of keys of jobs, current time, prefix of keys of leases, lease ttl in milliseconds)
+var redisDequeueJobScript = redis.NewScript(2, `
+while true do
+	local id = redis.call('LPOP', KEYS[1])
+	if not id then
+		return false
+	end
+
+	local data = redis.call('GET', ARGV[1] .. id)
+	if data then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+		redis.call('SET', ARGV[3] .. id, 1, 'PX', ARGV[4])
+		return data
+	end
+	-- (already deleted, try the next one)
+end
+`)
+
+// script for putting running jobs whose leases have expired back to the front of the queue at once
+//
+// (KEYS: running jobs, queued jobs / ARGV: prefix of keys of leases)
+var redisRequeueRunningJobsScript = redis.NewScript(2, `
+local count = 0
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	if redis.call('EXISTS', ARGV[1] .. id) == 0 then
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('LPUSH', KEYS[2], id)
+		count = count + 1
+	end
+end
+return count
+`)
+
+// (for unique members of sorted sets of requests)
+var redisRequestSeq int64
+
+// redisCacheEntry struct for cached results in Redis
+type redisCacheEntry struct {
+	Result   commands.Result `json:"result"`
+	UserID   int             `json:"user_id"`
+	ExpireAt int64           `json:"expire_at"`
+}
+
+// NewRedisStore creates a new store with given redis url (eg. "redis://:password@localhost:6379/0", or "rediss://" for TLS) and prefix of keys
+//
+// (running jobs are leased for `leaseTTL`, and should be renewed with `RenewJobLease` before it expires)
+func NewRedisStore(redisURL, prefix string, leaseTTL time.Duration) (*RedisStore, error) {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(
+				redisURL,
+				redis.DialConnectTimeout(redisDialTimeout),
+				redis.DialReadTimeout(redisCommandTimeout),
+				redis.DialWriteTimeout(redisCommandTimeout),
+			)
+		},
+		MaxIdle:     redisMaxIdleConns,
+		IdleTimeout: redisIdleTimeout,
+	}
+	r := &RedisStore{pool: pool, prefix: prefix, leaseTTL: leaseTTL}
+
+	// check the connection
+	if _, err := r.do("PING"); err != nil {
+		pool.Close()
+
+		return nil, fmt.Errorf("failed to connect to redis: %s", err)
+	}
+
+	return r, nil
+}
+
+// send a command with a connection from the pool
+func (r *RedisStore) do(command string, args ...interface{}) (reply interface{}, err error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	return conn.Do(command, args...)
+}
+
+// run given script with a connection from the pool
+func (r *RedisStore) run(script *redis.Script, keysAndArgs ...interface{}) (reply interface{}, err error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	return script.Do(conn, keysAndArgs...)
+}
+
+// key with the prefix
+func (r *RedisStore) key(format string, args ...interface{}) string {
+	return r.prefix + fmt.Sprintf(format, args...)
+}
+
+// GetCachedResult returns a cached result which is not expired yet
+func (r *RedisStore) GetCachedResult(key string) (cached CachedResult, exists bool, err error) {
+	data, err := redis.Bytes(r.do("GET", r.key("cache:%s", key)))
+	if err == redis.ErrNil {
+		return cached, false, nil
+	} else if err != nil {
+		return cached, false, err
+	}
+
+	var entry redisCacheEntry
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return cached, false, err
+	}
+
+	return CachedResult{Result: entry.Result, UserID: entry.UserID, ExpireAt: time.Unix(entry.ExpireAt, 0)}, true, nil
+}
+
+// SetCachedResult saves a result to be cached until it expires
+//
+// (keys of cached results are also saved for each user, for deleting them with `/forgetme`)
+func (r *RedisStore) SetCachedResult(key string, cached CachedResult) error {
+	data, err := json.Marshal(redisCacheEntry{Result: cached.Result, UserID: cached.UserID, ExpireAt: cached.ExpireAt.Unix()})
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(cached.ExpireAt).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	if _, err = r.do("SET", r.key("cache:%s", key), data, "PX", ttl); err != nil {
+		return err
+	}
+
+	userKey := r.key("users:%d:cache", cached.UserID)
+	if _, err = r.do("SADD", userKey, key); err != nil {
+		return err
+	}
+	_, err = r.do("PEXPIRE", userKey, ttl)
+
+	return err
+}
+
+// DeleteUserData deletes requests, queued jobs, and cached results of given user
+func (r *RedisStore) DeleteUserData(userID int) error {
+	ids, err := redis.Int64s(r.do("LRANGE", r.key("jobs:queued"), 0, -1))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if job, exists, err := r.jobOf(id); err != nil {
+			return err
+		} else if exists && job.UserID == userID {
+			if _, err = r.removeQueuedJob(job); err != nil {
+				return err
+			}
+		}
+	}
+
+	userKey := r.key("users:%d:cache", userID)
+
+	keys, err := redis.Strings(r.do("SMEMBERS", userKey))
+	if err != nil {
+		return err
+	}
+
+	toBeDeleted := []interface{}{r.key("requests:%d", userID), userKey}
+	for _, key := range keys {
+		toBeDeleted = append(toBeDeleted, r.key("cache:%s", key))
+	}
+	_, err = r.do("DEL", toBeDeleted...)
+
+	return err
+}
+
+// SaveCallbackTarget saves a target of inline keyboards with given token, until it expires
+func (r *RedisStore) SaveCallbackTarget(token string, target CallbackTarget, ttl time.Duration) error {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.do("SET", r.key("callbacks:%s", token), data, "PX", ttl.Milliseconds())
+
+	return err
+}
+
+// GetCallbackTarget returns a target of inline keyboards with given token, which is not expired yet
+func (r *RedisStore) GetCallbackTarget(token string) (target CallbackTarget, exists bool, err error) {
+	data, err := redis.Bytes(r.do("GET", r.key("callbacks:%s", token)))
+	if err == redis.ErrNil {
+		return target, false, nil
+	} else if err != nil {
+		return target, false, err
+	}
+
+	if err = json.Unmarshal(data, &target); err != nil {
+		return target, false, err
+	}
+
+	return target, true, nil
+}
+
+// SaveRequest saves a request of given user (for quotas)
+//
+// (usernames and commands are saved only in the local database, for statistics)
+func (r *RedisStore) SaveRequest(userID int, username string, command commands.Name) error {
+	key := r.key("requests:%d", userID)
+	now := time.Now()
+
+	if _, err := r.do("ZADD", key, now.UnixNano(), fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddInt64(&redisRequestSeq, 1))); err != nil {
+		return err
+	}
+	if _, err := r.do("ZREMRANGEBYSCORE", key, "-inf", now.Add(-redisRequestsRetention).UnixNano()); err != nil {
+		return err
+	}
+	_, err := r.do("PEXPIRE", key, redisRequestsRetention.Milliseconds())
+
+	return err
+}
+
+// CountRequestsSince counts requests of given user since given time
+func (r *RedisStore) CountRequestsSince(userID int, since time.Time) (count int, err error) {
+	n, err := redis.Int(r.do("ZCOUNT", r.key("requests:%d", userID), since.UnixNano(), "+inf"))
+
+	return n, err
+}
+
+// OldestRequestSince returns the time of the oldest request of given user since given time
+func (r *RedisStore) OldestRequestSince(userID int, since time.Time) (oldest time.Time, err error) {
+	values, err := redis.Int64s(r.do("ZRANGEBYSCORE", r.key("requests:%d", userID), since.UnixNano(), "+inf", "WITHSCORES", "LIMIT", 0, 1))
+	if err != nil {
+		return oldest, err
+	}
+
+	// (member, and its score)
+	if len(values) == 2 {
+		return time.Unix(0, values[1]), nil
+	}
+
+	return oldest, fmt.Errorf("no request since %s", since)
+}
+
+// EnqueueJob saves a job at the end of the queue
+func (r *RedisStore) EnqueueJob(job Job) (err error) {
+	if job.ID, err = redis.Int64(r.do("INCR", r.key("jobs:seq"))); err != nil {
+		return err
+	}
+	job.QueuedOn = time.Now()
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	// (in a transaction, not to leave a partially queued job)
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("SET", r.key("jobs:%d", job.ID), data)
+	conn.Send("HSET", r.messageKey(job.ChatID, job.MessageID), string(job.Kind), job.ID)
+	conn.Send("RPUSH", r.key("jobs:queued"), job.ID)
+	_, err = conn.Do("EXEC")
+
+	return err
+}
+
+// DequeueJob takes the oldest queued job, marks it as running, and returns it
+func (r *RedisStore) DequeueJob() (job Job, exists bool, err error) {
+	data, err := redis.Bytes(r.run(redisDequeueJobScript, r.key("jobs:queued"), r.key("jobs:running"), r.key("jobs:"), time.Now().Unix(), r.key("jobs:lease:"), r.leaseTTL.Milliseconds()))
+	if err == redis.ErrNil {
+		return job, false, nil
+	} else if err != nil {
+		return job, false, err
+	}
+
+	if err = json.Unmarshal(data, &job); err != nil {
+		return job, false, err
+	}
+
+	return job, true, nil
+}
+
+// DeleteJob deletes a finished job
+func (r *RedisStore) DeleteJob(id int64) error {
+	job, exists, err := r.jobOf(id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if _, err = r.do("HDEL", r.messageKey(job.ChatID, job.MessageID), string(job.Kind)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = r.do("ZREM", r.key("jobs:running"), id); err != nil {
+		return err
+	}
+	_, err = r.do("DEL", r.key("jobs:%d", id), r.key("jobs:lease:%d", id))
+
+	return err
+}
+
+// key of the hash of jobs with given message, by their kinds
+//
+// (a message can have multiple jobs of different kinds, eg. automatic checks of an image)
+func (r *RedisStore) messageKey(chatID int64, messageID int) string {
+	return r.key("jobs:messages:%d:%d", chatID, messageID)
+}
+
+// ids of the jobs with given message
+func (r *RedisStore) jobIDsOf(chatID int64, messageID int) (ids []int64, err error) {
+	return redis.Int64s(r.do("HVALS", r.messageKey(chatID, messageID)))
+}
+
+// job with given id
+func (r *RedisStore) jobOf(id int64) (job Job, exists bool, err error) {
+	data, err := redis.Bytes(r.do("GET", r.key("jobs:%d", id)))
+	if err == redis.ErrNil {
+		return job, false, nil
+	} else if err != nil {
+		return job, false, err
+	}
+
+	if err = json.Unmarshal(data, &job); err != nil {
+		return job, false, err
+	}
+
+	return job, true, nil
+}
+
+// check if the job with given id is running
+func (r *RedisStore) isRunning(id int64) (running bool, err error) {
+	reply, err := r.do("ZSCORE", r.key("jobs:running"), id)
+
+	return reply != nil, err
+}
+
+// QueuedJobUserID returns the id of the user who requested a queued (not running) job with given status message
+func (r *RedisStore) QueuedJobUserID(chatID int64, messageID int) (userID int, exists bool, err error) {
+	ids, err := r.jobIDsOf(chatID, messageID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, id := range ids {
+		// (not running yet)
+		if running, err := r.isRunning(id); err != nil {
+			return 0, false, err
+		} else if running {
+			continue
+		}
+
+		if job, exists, err := r.jobOf(id); err != nil || exists {
+			return job.UserID, exists, err
+		}
+	}
+
+	return 0, false, nil
+}
+
+// DeleteQueuedJob deletes a queued (not running) job with given status message
+func (r *RedisStore) DeleteQueuedJob(chatID int64, messageID int) (deleted bool, err error) {
+	ids, err := r.jobIDsOf(chatID, messageID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range ids {
+		job, exists, err := r.jobOf(id)
+		if err != nil {
+			return false, err
+		} else if !exists {
+			continue
+		}
+
+		if removed, err := r.removeQueuedJob(job); err != nil || removed {
+			return removed, err
+		}
+	}
+
+	return false, nil
+}
+
+// remove given job from the queue, and delete it
+//
+// (only when it is removed from the queue before any worker takes it)
+func (r *RedisStore) removeQueuedJob(job Job) (removed bool, err error) {
+	if count, err := redis.Int(r.do("LREM", r.key("jobs:queued"), 1, job.ID)); err != nil || count <= 0 {
+		return false, err
+	}
+
+	if _, err = r.do("HDEL", r.messageKey(job.ChatID, job.MessageID), string(job.Kind)); err != nil {
+		return false, err
+	}
+	if _, err = r.do("DEL", r.key("jobs:%d", job.ID)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RequeueRunningJobs puts running jobs whose leases have expired (eg. of crashed instances) back to the front of the queue
+//
+// (jobs of other running instances are not requeued, for their leases are renewed while running)
+func (r *RedisStore) RequeueRunningJobs() (count int64, err error) {
+	// (atomically, so they are requeued only once even when instances do it at the same time)
+	return redis.Int64(r.run(redisRequeueRunningJobsScript, r.key("jobs:running"), r.key("jobs:queued"), r.key("jobs:lease:")))
+}
+
+// RenewJobLease extends the lease of a running job, so it is not requeued while running
+func (r *RedisStore) RenewJobLease(id int64) error {
+	_, err := r.do("SET", r.key("jobs:lease:%d", id), 1, "PX", r.leaseTTL.Milliseconds())
+
+	return err
+}
+
+// CountQueuedJobs counts jobs waiting in the queue
+func (r *RedisStore) CountQueuedJobs() (count int, err error) {
+	return redis.Int(r.do("LLEN", r.key("jobs:queued")))
+}
+
+// Claim claims given key for given duration, and returns false if it is already claimed (by any instance)
+func (r *RedisStore) Claim(key string, ttl time.Duration) (claimed bool, err error) {
+	reply, err := r.do("SET", r.key("claims:%s", key), 1, "NX", "PX", ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	return reply != nil, nil
+}
+
+// RunningJobUserID returns the id of the user who requested a running job with given status message (on any instance)
+func (r *RedisStore) RunningJobUserID(chatID int64, messageID int) (userID int, exists bool, err error) {
+	ids, err := r.jobIDsOf(chatID, messageID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, id := range ids {
+		if running, err := r.isRunning(id); err != nil {
+			return 0, false, err
+		} else if !running {
+			continue
+		}
+
+		if job, exists, err := r.jobOf(id); err != nil || exists {
+			return job.UserID, exists, err
+		}
+	}
+
+	return 0, false, nil
+}
+
+// RequestCancel requests the instance which runs the job with given status message to cancel it
+func (r *RedisStore) RequestCancel(chatID int64, messageID int) error {
+	_, err := r.do("SET", r.key("cancels:%d:%d", chatID, messageID), 1, "PX", redisCancelRequestTTL.Milliseconds())
+
+	return err
+}
+
+// IsCancelRequested checks if canceling the job with given status message was requested
+func (r *RedisStore) IsCancelRequested(chatID int64, messageID int) (requested bool, err error) {
+	return redis.Bool(r.do("EXISTS", r.key("cancels:%d:%d", chatID, messageID)))
+}
@@ -0,0 +1,1135 @@
+package storage
+
+// local database with sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// for sqlite3
+	_ "github.com/mattn/go-sqlite3"
+
+	// for names of commands and their results
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// Database struct
+type Database struct {
+	db *sql.DB
+	sync.RWMutex
+}
+
+// Stat struct for statistics
+type Stat struct {
+	Key   string
+	Count int
+}
+
+// Request struct for requests from users
+type Request struct {
+	UserID      int
+	Username    string
+	Command     commands.Name
+	RequestedOn time.Time
+}
+
+// History struct for processed requests, with their result messages
+type History struct {
+	UserID      int
+	ChatID      int64
+	MessageID   int // id of the result message
+	Command     commands.Name
+	Summary     string
+	ProcessedOn time.Time
+}
+
+// Metric struct for a daily metric (eg. errors of a service, or latencies of a command)
+type Metric struct {
+	Count int
+	Total int64 // sum of values (eg. latencies in milliseconds)
+}
+
+// Prompt struct for messages with inline keyboards for choosing actions
+type Prompt struct {
+	ChatID    int64
+	MessageID int
+	Language  string // language of the message
+	SentOn    time.Time
+}
+
+// OpenDb opens a database at given filepath
+func OpenDb(filepath string) (database *Database, err error) {
+	var db *sql.DB
+	if db, err = sql.Open("sqlite3", filepath); err != nil {
+		return nil, err
+	}
+
+	// requests table
+	if _, err = db.Exec(`create table if not exists requests(
+		id integer primary key autoincrement,
+		user_id integer not null,
+		username text default null,
+		command text not null,
+		requested_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(`create index if not exists idx_requests1 on requests(user_id, requested_on)`); err != nil {
+		return nil, err
+	}
+
+	// chats table
+	if _, err = db.Exec(`create table if not exists chats(
+		chat_id integer primary key,
+		updated_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+
+	// bans table
+	if _, err = db.Exec(`create table if not exists bans(
+		user_id integer primary key,
+		banned_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+
+	// preferences table
+	if _, err = db.Exec(`create table if not exists preferences(
+		user_id integer not null,
+		key text not null,
+		value text not null,
+		primary key(user_id, key)
+	)`); err != nil {
+		return nil, err
+	}
+
+	// jobs table
+	if _, err = db.Exec(`create table if not exists jobs(
+		id integer primary key autoincrement,
+		kind text not null,
+		chat_id integer not null,
+		user_id integer not null,
+		message_id integer not null,
+		file_ids text not null,
+		command text not null,
+		is_running integer default 0,
+		queued_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if err = addColumnIfNotExists(db, "jobs", "argument", "text default ''"); err != nil {
+		return nil, err
+	}
+	if err = addColumnIfNotExists(db, "jobs", "trace_parent", "text default ''"); err != nil {
+		return nil, err
+	}
+
+	// persons table (for identifying faces)
+	if _, err = db.Exec(`create table if not exists persons(
+		chat_id integer not null,
+		name text not null,
+		person_id text not null,
+		primary key(chat_id, name)
+	)`); err != nil {
+		return nil, err
+	}
+
+	// faces table (for finding similar faces)
+	if _, err = db.Exec(`create table if not exists faces(
+		persisted_face_id text primary key,
+		chat_id integer not null,
+		file_id text not null,
+		saved_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(`create index if not exists idx_faces_chat_file on faces(chat_id, file_id)`); err != nil {
+		return nil, err
+	}
+
+	// states table (for values which should survive restarts, eg. the last processed update id)
+	if _, err = db.Exec(`create table if not exists states(
+		key text primary key,
+		value text not null
+	)`); err != nil {
+		return nil, err
+	}
+
+	// callback queries table (for skipping duplicated callback queries)
+	if _, err = db.Exec(`create table if not exists callback_queries(
+		id text primary key,
+		received_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+
+	// callback targets table (for targets of inline keyboards, which are too long for callback data)
+	if _, err = db.Exec(`create table if not exists callback_targets(
+		token text primary key,
+		file_id text not null,
+		media text not null,
+		expire_at integer not null
+	)`); err != nil {
+		return nil, err
+	}
+
+	// prompts table (for expiring inline keyboards)
+	if _, err = db.Exec(`create table if not exists prompts(
+		chat_id integer not null,
+		message_id integer not null,
+		language text not null,
+		sent_on integer not null,
+		primary key(chat_id, message_id)
+	)`); err != nil {
+		return nil, err
+	}
+
+	// history table (for showing recent analyses to users)
+	if _, err = db.Exec(`create table if not exists history(
+		id integer primary key autoincrement,
+		user_id integer not null,
+		chat_id integer not null,
+		message_id integer not null,
+		command text not null,
+		summary text not null,
+		processed_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(`create index if not exists idx_history1 on history(chat_id, user_id, processed_on)`); err != nil {
+		return nil, err
+	}
+
+	// cached results table (for result cache which survives restarts)
+	if _, err = db.Exec(`create table if not exists cached_results(
+		key text primary key,
+		result text not null,
+		expire_at integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if err = addColumnIfNotExists(db, "cached_results", "user_id", "integer default 0"); err != nil {
+		return nil, err
+	}
+
+	// archives table (for deleting archived results of users)
+	if _, err = db.Exec(`create table if not exists archives(
+		key text primary key,
+		user_id integer not null,
+		archived_on integer not null
+	)`); err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(`create index if not exists idx_archives1 on archives(user_id)`); err != nil {
+		return nil, err
+	}
+
+	// transactions table (for counting transactions of Cognitive Services)
+	if _, err = db.Exec(`create table if not exists transactions(
+		day text not null,
+		service text not null,
+		count integer not null,
+		primary key(day, service)
+	)`); err != nil {
+		return nil, err
+	}
+
+	// daily metrics table (for daily summaries)
+	if _, err = db.Exec(`create table if not exists daily_metrics(
+		day text not null,
+		metric text not null,
+		count integer not null,
+		total integer not null,
+		primary key(day, metric)
+	)`); err != nil {
+		return nil, err
+	}
+
+	return &Database{db: db}, nil
+}
+
+// add a column to given table if it does not exist yet (for migrating old databases)
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf(`pragma table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue interface{}
+		if err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`alter table %s add column %s %s`, table, column, definition))
+
+	return err
+}
+
+// Close closes the database
+func (d *Database) Close() error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.db.Close()
+}
+
+// SaveRequest saves a request from a user
+func (d *Database) SaveRequest(userID int, username string, command commands.Name) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert into requests(user_id, username, command, requested_on) values(?, ?, ?, ?)`,
+		userID,
+		username,
+		string(command),
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// CountRequestsSince counts requests of a user since given time
+func (d *Database) CountRequestsSince(userID int, since time.Time) (count int, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	err = d.db.QueryRow(`select count(id) from requests where user_id = ? and requested_on >= ?`,
+		userID,
+		since.Unix(),
+	).Scan(&count)
+
+	return count, err
+}
+
+// OldestRequestSince returns the time of the oldest request of a user since given time
+func (d *Database) OldestRequestSince(userID int, since time.Time) (oldest time.Time, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var requestedOn int64
+	if err = d.db.QueryRow(`select min(requested_on) from requests where user_id = ? and requested_on >= ?`,
+		userID,
+		since.Unix(),
+	).Scan(&requestedOn); err != nil {
+		return oldest, err
+	}
+
+	return time.Unix(requestedOn, 0), nil
+}
+
+// CountRequestsPerCommand counts requests per command
+func (d *Database) CountRequestsPerCommand() (stats []Stat, err error) {
+	return d.queryStats(`select command, count(id) from requests group by command order by count(id) desc`)
+}
+
+// CountRequestsPerDay counts requests per day, for recent `days` days
+func (d *Database) CountRequestsPerDay(days int) (stats []Stat, err error) {
+	return d.queryStats(`select date(requested_on, 'unixepoch', 'localtime') as day, count(id) from requests group by day order by day desc limit ?`, days)
+}
+
+// CountRequestsPerCommandBetween counts requests per command in given period
+func (d *Database) CountRequestsPerCommandBetween(from, to time.Time) (stats []Stat, err error) {
+	return d.queryStats(`select command, count(id) from requests where requested_on >= ? and requested_on < ? group by command order by count(id) desc`, from.Unix(), to.Unix())
+}
+
+// CountUsersBetween counts unique users who requested in given period
+func (d *Database) CountUsersBetween(from, to time.Time) (count int, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	err = d.db.QueryRow(`select count(distinct user_id) from requests where requested_on >= ? and requested_on < ?`, from.Unix(), to.Unix()).Scan(&count)
+
+	return count, err
+}
+
+// query statistics with given query (should select a key and a count)
+func (d *Database) queryStats(query string, args ...interface{}) (stats []Stat, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(query, args...); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stat Stat
+		if err = rows.Scan(&stat.Key, &stat.Count); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// SaveChat saves a chat which this bot has talked with
+func (d *Database) SaveChat(chatID int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into chats(chat_id, updated_on) values(?, ?)`,
+		chatID,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// GetChatIDs returns ids of all known chats
+func (d *Database) GetChatIDs() (chatIDs []int64, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select chat_id from chats`); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chatID int64
+		if err = rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, rows.Err()
+}
+
+// BanUser bans a user
+func (d *Database) BanUser(userID int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into bans(user_id, banned_on) values(?, ?)`,
+		userID,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// UnbanUser unbans a user
+func (d *Database) UnbanUser(userID int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`delete from bans where user_id = ?`, userID)
+
+	return err
+}
+
+// IsBanned checks if a user is banned
+func (d *Database) IsBanned(userID int) (banned bool, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var count int
+	if err = d.db.QueryRow(`select count(user_id) from bans where user_id = ?`, userID).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetPreference returns a preference value of a user (empty string if not set)
+func (d *Database) GetPreference(userID int, key string) (value string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if err = d.db.QueryRow(`select value from preferences where user_id = ? and key = ?`, userID, key).Scan(&value); err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return value, err
+}
+
+// SetPreference sets a preference value of a user
+func (d *Database) SetPreference(userID int, key, value string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into preferences(user_id, key, value) values(?, ?, ?)`, userID, key, value)
+
+	return err
+}
+
+// EnqueueJob saves a job to the queue
+func (d *Database) EnqueueJob(job Job) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert into jobs(kind, chat_id, user_id, message_id, file_ids, command, argument, trace_parent, queued_on) values(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		string(job.Kind),
+		job.ChatID,
+		job.UserID,
+		job.MessageID,
+		strings.Join(job.FileIDs, ","),
+		string(job.Command),
+		job.Argument,
+		job.TraceParent,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// DequeueJob marks the oldest queued job as running, and returns it
+func (d *Database) DequeueJob() (job Job, exists bool, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	var kind, fileIDs, command string
+	var queuedOn int64
+	if err = d.db.QueryRow(`select id, kind, chat_id, user_id, message_id, file_ids, command, argument, trace_parent, queued_on from jobs where is_running = 0 order by id asc limit 1`).Scan(&job.ID, &kind, &job.ChatID, &job.UserID, &job.MessageID, &fileIDs, &command, &job.Argument, &job.TraceParent, &queuedOn); err != nil {
+		if err == sql.ErrNoRows {
+			return job, false, nil
+		}
+		return job, false, err
+	}
+
+	if _, err = d.db.Exec(`update jobs set is_running = 1 where id = ?`, job.ID); err != nil {
+		return job, false, err
+	}
+
+	job.Kind = JobKind(kind)
+	job.FileIDs = strings.Split(fileIDs, ",")
+	job.Command = commands.Name(command)
+	job.QueuedOn = time.Unix(queuedOn, 0)
+
+	return job, true, nil
+}
+
+// DeleteJob deletes a finished job
+func (d *Database) DeleteJob(id int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`delete from jobs where id = ?`, id)
+
+	return err
+}
+
+// QueuedJobUserID returns the id of the user who requested a queued (not running) job with given status message
+func (d *Database) QueuedJobUserID(chatID int64, messageID int) (userID int, exists bool, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if err = d.db.QueryRow(`select user_id from jobs where chat_id = ? and message_id = ? and is_running = 0`, chatID, messageID).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return userID, true, nil
+}
+
+// DeleteQueuedJob deletes a queued (not running) job with given status message
+func (d *Database) DeleteQueuedJob(chatID int64, messageID int) (deleted bool, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	var result sql.Result
+	if result, err = d.db.Exec(`delete from jobs where chat_id = ? and message_id = ? and is_running = 0`, chatID, messageID); err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+
+	return count > 0, err
+}
+
+// RequeueRunningJobs marks all running jobs as queued again
+//
+// (for resuming jobs which were interrupted by a restart)
+func (d *Database) RequeueRunningJobs() (count int64, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	var result sql.Result
+	if result, err = d.db.Exec(`update jobs set is_running = 0 where is_running = 1`); err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CountQueuedJobs counts jobs waiting in the queue
+func (d *Database) CountQueuedJobs() (count int, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	err = d.db.QueryRow(`select count(*) from jobs where is_running = 0`).Scan(&count)
+
+	return count, err
+}
+
+// GetState returns a saved state (empty string if not saved)
+func (d *Database) GetState(key string) (value string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if err = d.db.QueryRow(`select value from states where key = ?`, key).Scan(&value); err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return value, err
+}
+
+// SetState saves a state
+func (d *Database) SetState(key, value string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into states(key, value) values(?, ?)`, key, value)
+
+	return err
+}
+
+// GetCachedResult returns a cached result which is not expired yet
+func (d *Database) GetCachedResult(key string) (cached CachedResult, exists bool, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var encoded string
+	var expireAt int64
+	if err = d.db.QueryRow(`select result, user_id, expire_at from cached_results where key = ? and expire_at > ?`, key, time.Now().Unix()).Scan(&encoded, &cached.UserID, &expireAt); err != nil {
+		if err == sql.ErrNoRows {
+			return cached, false, nil
+		}
+		return cached, false, err
+	}
+
+	if err = json.Unmarshal([]byte(encoded), &cached.Result); err != nil {
+		return cached, false, err
+	}
+	cached.ExpireAt = time.Unix(expireAt, 0)
+
+	return cached, true, nil
+}
+
+// SetCachedResult saves a result to be cached until it expires
+//
+// (expired ones are deleted)
+func (d *Database) SetCachedResult(key string, cached CachedResult) error {
+	encoded, err := json.Marshal(cached.Result)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err = d.db.Exec(`delete from cached_results where expire_at <= ?`, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`insert or replace into cached_results(key, result, user_id, expire_at) values(?, ?, ?, ?)`, key, string(encoded), cached.UserID, cached.ExpireAt.Unix())
+
+	return err
+}
+
+// SaveCallbackQueryID saves the id of a callback query, and returns false if it was already saved
+//
+// (ids older than given time are deleted)
+func (d *Database) SaveCallbackQueryID(id string, deleteBefore time.Time) (saved bool, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err = d.db.Exec(`delete from callback_queries where received_on < ?`, deleteBefore.Unix()); err != nil {
+		return false, err
+	}
+
+	var result sql.Result
+	if result, err = d.db.Exec(`insert or ignore into callback_queries(id, received_on) values(?, ?)`, id, time.Now().Unix()); err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+
+	return count > 0, err
+}
+
+// SaveArchivedKey saves the key of an archived object of given user
+func (d *Database) SaveArchivedKey(userID int, key string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into archives(key, user_id, archived_on) values(?, ?, ?)`, key, userID, time.Now().Unix())
+
+	return err
+}
+
+// GetArchivedKeys returns keys of archived objects of given user
+func (d *Database) GetArchivedKeys(userID int) (keys []string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select key from archives where user_id = ? order by archived_on asc`, userID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// SaveCallbackTarget saves a target of inline keyboards with given token, until it expires
+//
+// (expired ones are deleted)
+func (d *Database) SaveCallbackTarget(token string, target CallbackTarget, ttl time.Duration) error {
+	d.Lock()
+	defer d.Unlock()
+
+	now := time.Now()
+	if _, err := d.db.Exec(`delete from callback_targets where expire_at < ?`, now.Unix()); err != nil {
+		return err
+	}
+
+	_, err := d.db.Exec(`insert or replace into callback_targets(token, file_id, media, expire_at) values(?, ?, ?, ?)`,
+		token,
+		target.FileID,
+		string(target.Media),
+		now.Add(ttl).Unix(),
+	)
+
+	return err
+}
+
+// GetCallbackTarget returns a target of inline keyboards with given token, which is not expired yet
+func (d *Database) GetCallbackTarget(token string) (target CallbackTarget, exists bool, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var media string
+	if err = d.db.QueryRow(`select file_id, media from callback_targets where token = ? and expire_at >= ?`, token, time.Now().Unix()).Scan(&target.FileID, &media); err != nil {
+		if err == sql.ErrNoRows {
+			return target, false, nil
+		}
+		return target, false, err
+	}
+
+	target.Media = commands.MediaType(media)
+
+	return target, true, nil
+}
+
+// SavePrompt saves a message with inline keyboards for choosing actions
+func (d *Database) SavePrompt(prompt Prompt) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into prompts(chat_id, message_id, language, sent_on) values(?, ?, ?, ?)`, prompt.ChatID, prompt.MessageID, prompt.Language, time.Now().Unix())
+
+	return err
+}
+
+// DeletePrompt deletes a message with inline keyboards which was answered
+func (d *Database) DeletePrompt(chatID int64, messageID int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`delete from prompts where chat_id = ? and message_id = ?`, chatID, messageID)
+
+	return err
+}
+
+// TakePromptsSentBefore deletes messages with inline keyboards which were sent before given time, and returns them
+func (d *Database) TakePromptsSentBefore(before time.Time) (prompts []Prompt, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select chat_id, message_id, language, sent_on from prompts where sent_on < ?`, before.Unix()); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prompt Prompt
+		var sentOn int64
+		if err = rows.Scan(&prompt.ChatID, &prompt.MessageID, &prompt.Language, &sentOn); err != nil {
+			return nil, err
+		}
+		prompt.SentOn = time.Unix(sentOn, 0)
+
+		prompts = append(prompts, prompt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = d.db.Exec(`delete from prompts where sent_on < ?`, before.Unix())
+
+	return prompts, err
+}
+
+// SaveHistory saves a processed request with its result message
+func (d *Database) SaveHistory(history History) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert into history(user_id, chat_id, message_id, command, summary, processed_on) values(?, ?, ?, ?, ?, ?)`,
+		history.UserID,
+		history.ChatID,
+		history.MessageID,
+		string(history.Command),
+		history.Summary,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// GetHistory returns recent processed requests of a user in a chat, newest first
+func (d *Database) GetHistory(chatID int64, userID int, limit int) (history []History, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select message_id, command, summary, processed_on from history where chat_id = ? and user_id = ? order by processed_on desc, id desc limit ?`, chatID, userID, limit); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		h := History{UserID: userID, ChatID: chatID}
+		var command string
+		var processedOn int64
+		if err = rows.Scan(&h.MessageID, &command, &h.Summary, &processedOn); err != nil {
+			return nil, err
+		}
+		h.Command = commands.Name(command)
+		h.ProcessedOn = time.Unix(processedOn, 0)
+
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
+
+// GetUserHistory returns all processed requests of a user in all chats, newest first
+func (d *Database) GetUserHistory(userID int) (history []History, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select chat_id, message_id, command, summary, processed_on from history where user_id = ? order by processed_on desc, id desc`, userID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		h := History{UserID: userID}
+		var command string
+		var processedOn int64
+		if err = rows.Scan(&h.ChatID, &h.MessageID, &command, &h.Summary, &processedOn); err != nil {
+			return nil, err
+		}
+		h.Command = commands.Name(command)
+		h.ProcessedOn = time.Unix(processedOn, 0)
+
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
+}
+
+// GetRequests returns all requests of a user, newest first
+func (d *Database) GetRequests(userID int) (requests []Request, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select ifnull(username, ''), command, requested_on from requests where user_id = ? order by requested_on desc, id desc`, userID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		request := Request{UserID: userID}
+		var command string
+		var requestedOn int64
+		if err = rows.Scan(&request.Username, &command, &requestedOn); err != nil {
+			return nil, err
+		}
+		request.Command = commands.Name(command)
+		request.RequestedOn = time.Unix(requestedOn, 0)
+
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+// GetPreferences returns all preferences of a user
+func (d *Database) GetPreferences(userID int) (preferences map[string]string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select key, value from preferences where user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences = map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		preferences[key] = value
+	}
+
+	return preferences, rows.Err()
+}
+
+// DeleteUserData deletes requests, preferences, history, queued jobs, cached results, and keys of archived objects of a user
+//
+// (bans are kept)
+func (d *Database) DeleteUserData(userID int) error {
+	d.Lock()
+	defer d.Unlock()
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`delete from requests where user_id = ?`,
+		`delete from preferences where user_id = ?`,
+		`delete from history where user_id = ?`,
+		`delete from jobs where user_id = ? and is_running = 0`,
+		`delete from cached_results where user_id = ?`,
+		`delete from archives where user_id = ?`,
+	} {
+		if _, err = tx.Exec(query, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteEnrolledFaces deletes enrolled persons and saved faces of a chat
+func (d *Database) DeleteEnrolledFaces(chatID int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.db.Exec(`delete from persons where chat_id = ?`, chatID); err != nil {
+		return err
+	}
+
+	_, err := d.db.Exec(`delete from faces where chat_id = ?`, chatID)
+
+	return err
+}
+
+// IncreaseTransactions increases the number of transactions of a service on given day,
+// and returns the numbers of transactions on the day and since the first day of its month
+//
+// (days are in the format of "2006-01-02")
+func (d *Database) IncreaseTransactions(service, day, firstDayOfMonth string) (daily, monthly int, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err = d.db.Exec(`insert or ignore into transactions(day, service, count) values(?, ?, 0)`, day, service); err != nil {
+		return 0, 0, err
+	}
+	if _, err = d.db.Exec(`update transactions set count = count + 1 where day = ? and service = ?`, day, service); err != nil {
+		return 0, 0, err
+	}
+
+	if err = d.db.QueryRow(`select count from transactions where day = ? and service = ?`, day, service).Scan(&daily); err != nil {
+		return 0, 0, err
+	}
+	if err = d.db.QueryRow(`select sum(count) from transactions where day >= ? and day <= ? and service = ?`, firstDayOfMonth, day, service).Scan(&monthly); err != nil {
+		return 0, 0, err
+	}
+
+	return daily, monthly, nil
+}
+
+// CountTransactionsPerService counts transactions per service since given day
+func (d *Database) CountTransactionsPerService(since string) (counts map[string]int, err error) {
+	counts = map[string]int{}
+
+	var stats []Stat
+	if stats, err = d.queryStats(`select service, sum(count) from transactions where day >= ? group by service`, since); err != nil {
+		return nil, err
+	}
+	for _, stat := range stats {
+		counts[stat.Key] = stat.Count
+	}
+
+	return counts, nil
+}
+
+// IncreaseMetric increases the count of a daily metric by 1, and its total by given value
+func (d *Database) IncreaseMetric(day, metric string, value int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.db.Exec(`insert or ignore into daily_metrics(day, metric, count, total) values(?, ?, 0, 0)`, day, metric); err != nil {
+		return err
+	}
+
+	_, err := d.db.Exec(`update daily_metrics set count = count + 1, total = total + ? where day = ? and metric = ?`, value, day, metric)
+
+	return err
+}
+
+// GetMetrics returns daily metrics of given day
+func (d *Database) GetMetrics(day string) (metrics map[string]Metric, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select metric, count, total from daily_metrics where day = ?`, day); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics = map[string]Metric{}
+	for rows.Next() {
+		var key string
+		var metric Metric
+		if err = rows.Scan(&key, &metric.Count, &metric.Total); err != nil {
+			return nil, err
+		}
+		metrics[key] = metric
+	}
+
+	return metrics, rows.Err()
+}
+
+// SavePerson saves the id of an enrolled person in a chat
+func (d *Database) SavePerson(chatID int64, name, personID string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into persons(chat_id, name, person_id) values(?, ?, ?)`,
+		chatID,
+		name,
+		personID,
+	)
+
+	return err
+}
+
+// GetPersonID returns the id of an enrolled person in a chat
+//
+// (returns an empty string if there is no such person)
+func (d *Database) GetPersonID(chatID int64, name string) (personID string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if err = d.db.QueryRow(`select person_id from persons where chat_id = ? and name = ?`, chatID, name).Scan(&personID); err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return personID, err
+}
+
+// GetPersonNames returns names of all enrolled persons in a chat, keyed by their ids
+func (d *Database) GetPersonNames(chatID int64) (names map[string]string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select person_id, name from persons where chat_id = ?`, chatID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names = map[string]string{}
+	for rows.Next() {
+		var personID, name string
+		if err = rows.Scan(&personID, &name); err != nil {
+			return nil, err
+		}
+		names[personID] = name
+	}
+
+	return names, rows.Err()
+}
+
+// SaveFace saves the persisted id of a face on an image in a chat
+func (d *Database) SaveFace(chatID int64, fileID, persistedFaceID string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	_, err := d.db.Exec(`insert or replace into faces(persisted_face_id, chat_id, file_id, saved_on) values(?, ?, ?, ?)`,
+		persistedFaceID,
+		chatID,
+		fileID,
+		time.Now().Unix(),
+	)
+
+	return err
+}
+
+// HasFaces checks if faces on an image were already saved in a chat
+func (d *Database) HasFaces(chatID int64, fileID string) (exists bool, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var count int
+	err = d.db.QueryRow(`select count(*) from faces where chat_id = ? and file_id = ?`, chatID, fileID).Scan(&count)
+
+	return count > 0, err
+}
+
+// GetFaceFileIDs returns file ids of images with saved faces in a chat, keyed by persisted ids of the faces
+func (d *Database) GetFaceFileIDs(chatID int64) (fileIDs map[string]string, err error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var rows *sql.Rows
+	if rows, err = d.db.Query(`select persisted_face_id, file_id from faces where chat_id = ?`, chatID); err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fileIDs = map[string]string{}
+	for rows.Next() {
+		var persistedFaceID, fileID string
+		if err = rows.Scan(&persistedFaceID, &fileID); err != nil {
+			return nil, err
+		}
+		fileIDs[persistedFaceID] = fileID
+	}
+
+	return fileIDs, rows.Err()
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestJobQueue(t *testing.T) {
+	database := openTestDb(t)
+
+	for _, job := range []Job{
+		{Kind: "image", ChatID: 1, UserID: 10, MessageID: 100, FileIDs: []string{"file1"}, Command: "Tag"},
+		{Kind: "album", ChatID: 1, UserID: 20, MessageID: 200, FileIDs: []string{"file2", "file3"}, Command: "Describe"},
+	} {
+		if err := database.EnqueueJob(job); err != nil {
+			t.Fatalf("failed to enqueue job: %s", err)
+		}
+	}
+
+	// (oldest one first)
+	job, exists, err := database.DequeueJob()
+	if err != nil || !exists || job.MessageID != 100 || job.Command != "Tag" {
+		t.Fatalf("unexpected job: %+v, %v, %v", job, exists, err)
+	}
+	if _, exists, _ := database.QueuedJobUserID(1, 100); exists {
+		t.Errorf("running job was regarded as queued")
+	}
+	if userID, exists, _ := database.QueuedJobUserID(1, 200); !exists || userID != 20 {
+		t.Errorf("queued job was not found: %d, %v", userID, exists)
+	}
+
+	// (running jobs are queued again, eg. after a restart)
+	if count, err := database.RequeueRunningJobs(); err != nil || count != 1 {
+		t.Errorf("unexpected count of requeued jobs: %d, %v", count, err)
+	}
+	if count, _ := database.CountQueuedJobs(); count != 2 {
+		t.Errorf("unexpected count of queued jobs: %d", count)
+	}
+
+	if deleted, err := database.DeleteQueuedJob(1, 200); err != nil || !deleted {
+		t.Errorf("failed to delete queued job: %v, %v", deleted, err)
+	}
+	job, exists, _ = database.DequeueJob()
+	if !exists || job.MessageID != 100 {
+		t.Fatalf("requeued job was not dequeued: %+v", job)
+	}
+	if err := database.DeleteJob(job.ID); err != nil {
+		t.Errorf("failed to delete job: %s", err)
+	}
+	if _, exists, _ := database.DequeueJob(); exists {
+		t.Errorf("job was left in the queue")
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+// stores of the bot's states: the local database, Redis (for sharing states between multiple instances),
+// and the result cache which can be backed by either of them
+//
+// (the bot only depends on the interfaces below, so stores can be replaced with other implementations)
+
+import (
+	"time"
+
+	// for names of commands and their results
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+)
+
+// storage backends
+const (
+	BackendSqlite = "sqlite"
+	BackendRedis  = "redis"
+)
+
+// IsValidBackend checks if given name is of a known storage backend
+func IsValidBackend(name string) bool {
+	return name == BackendSqlite || name == BackendRedis
+}
+
+// JobKind type
+type JobKind string
+
+// Job struct for queued jobs
+type Job struct {
+	ID        int64
+	Kind      JobKind
+	ChatID    int64
+	UserID    int
+	MessageID int // id of the message to be deleted after processing
+	FileIDs   []string
+	Command   commands.Name
+	Argument  string // extra argument of the command (eg. name of a person)
+	QueuedOn  time.Time
+
+	TraceParent string // W3C traceparent of the update which queued it (for tracing)
+}
+
+// JobQueue interface for the persistent job queue
+//
+// (satisfied by *Database, and *RedisStore for sharing it between multiple instances)
+type JobQueue interface {
+	EnqueueJob(job Job) error
+	DequeueJob() (job Job, exists bool, err error)
+	DeleteJob(id int64) error
+	QueuedJobUserID(chatID int64, messageID int) (userID int, exists bool, err error)
+	DeleteQueuedJob(chatID int64, messageID int) (deleted bool, err error)
+	RequeueRunningJobs() (count int64, err error)
+	CountQueuedJobs() (count int, err error)
+}
+
+// RequestCounter interface for counting requests of users (for quotas)
+//
+// (satisfied by *Database, and *RedisStore for sharing it between multiple instances)
+type RequestCounter interface {
+	SaveRequest(userID int, username string, command commands.Name) error
+	CountRequestsSince(userID int, since time.Time) (count int, err error)
+	OldestRequestSince(userID int, since time.Time) (oldest time.Time, err error)
+}
+
+// Coordinator interface for coordinating multiple instances of the bot
+//
+// (satisfied by *RedisStore)
+type Coordinator interface {
+	Claim(key string, ttl time.Duration) (claimed bool, err error) // (only one instance can claim the same key until it expires)
+	RunningJobUserID(chatID int64, messageID int) (userID int, exists bool, err error)
+	RequestCancel(chatID int64, messageID int) error
+	IsCancelRequested(chatID int64, messageID int) (requested bool, err error)
+	RenewJobLease(id int64) error // (running jobs whose leases have expired are requeued with `RequeueRunningJobs`)
+}
+
+// ResultStore interface for persisting cached results
+//
+// (satisfied by *Database, and *RedisStore for sharing them between multiple instances)
+type ResultStore interface {
+	GetCachedResult(key string) (cached CachedResult, exists bool, err error)
+	SetCachedResult(key string, cached CachedResult) error
+}
+
+// CachedResult struct for cached results
+type CachedResult struct {
+	Result   commands.Result
+	UserID   int // (of the user who requested it, for deleting it with `/forgetme`)
+	ExpireAt time.Time
+}
+
+// UserDataStore interface for stores which keep data of users (for deleting them with `/forgetme`)
+//
+// (satisfied by *Database, *RedisStore, and *ResultCache)
+type UserDataStore interface {
+	DeleteUserData(userID int) error
+}
+
+// CallbackTarget struct for targets of inline keyboards, which are saved on the server
+//
+// (for file ids are too long to be in callback data, which can be 64 bytes at most)
+type CallbackTarget struct {
+	FileID string             `json:"file_id"`
+	Media  commands.MediaType `json:"media"` // (for telling how the file should be processed)
+}
+
+// CallbackTargetStore interface for saving targets of inline keyboards with short tokens
+//
+// (satisfied by *Database, and *RedisStore for sharing them between multiple instances)
+type CallbackTargetStore interface {
+	SaveCallbackTarget(token string, target CallbackTarget, ttl time.Duration) error
+	GetCallbackTarget(token string) (target CallbackTarget, exists bool, err error)
+}
+
+var _ Coordinator = (*RedisStore)(nil)
+
+var _ JobQueue = (*Database)(nil)
+var _ JobQueue = (*RedisStore)(nil)
+var _ RequestCounter = (*Database)(nil)
+var _ RequestCounter = (*RedisStore)(nil)
+var _ CallbackTargetStore = (*Database)(nil)
+var _ CallbackTargetStore = (*RedisStore)(nil)
+var _ ResultStore = (*Database)(nil)
+var _ ResultStore = (*RedisStore)(nil)
+var _ UserDataStore = (*Database)(nil)
+var _ UserDataStore = (*RedisStore)(nil)
+var _ UserDataStore = (*ResultCache)(nil)
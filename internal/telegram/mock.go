@@ -0,0 +1,168 @@
+package telegram
+
+// mock of Telegram bot clients, which records calls instead of sending them
+
+import (
+	"fmt"
+	"sync"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// Call struct for a recorded call of Mock
+type Call struct {
+	Method  string
+	ChatID  interface{}
+	Text    string // (text, caption of files, or id of callback query)
+	File    *bot.InputFile
+	Media   []bot.InputMedia
+	Options map[string]interface{}
+}
+
+// Mock struct for a Messenger which records calls, and succeeds all of them
+//
+// (files for `GetFile` can be set in `Files`, and each sent message gets an increasing message id)
+type Mock struct {
+	lock sync.Mutex
+
+	Calls []Call
+	Files map[string]bot.File // (by file ids)
+
+	lastMessageID int
+}
+
+// NewMock creates a new mock
+func NewMock() *Mock {
+	return &Mock{
+		Files: map[string]bot.File{},
+	}
+}
+
+// record a call, and return a successful response with a new message
+func (m *Mock) record(call Call) bot.APIResponseMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.Calls = append(m.Calls, call)
+	m.lastMessageID++
+
+	return bot.APIResponseMessage{
+		APIResponseBase: bot.APIResponseBase{Ok: true},
+		Result:          &bot.Message{MessageID: m.lastMessageID},
+	}
+}
+
+// CallsOf returns recorded calls of given method
+func (m *Mock) CallsOf(method string) []Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	calls := []Call{}
+	for _, c := range m.Calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// SendMessage records a message
+func (m *Mock) SendMessage(chatID interface{}, text string, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "SendMessage", ChatID: chatID, Text: text, Options: options})
+}
+
+// SendPhoto records a photo
+func (m *Mock) SendPhoto(chatID interface{}, photo bot.InputFile, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "SendPhoto", ChatID: chatID, Text: captionOf(options), File: &photo, Options: options})
+}
+
+// SendDocument records a document
+func (m *Mock) SendDocument(chatID interface{}, document bot.InputFile, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "SendDocument", ChatID: chatID, Text: captionOf(options), File: &document, Options: options})
+}
+
+// SendVoice records a voice
+func (m *Mock) SendVoice(chatID interface{}, voice bot.InputFile, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "SendVoice", ChatID: chatID, Text: captionOf(options), File: &voice, Options: options})
+}
+
+// SendContact records a contact
+func (m *Mock) SendContact(chatID interface{}, phoneNumber, firstName string, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "SendContact", ChatID: chatID, Text: fmt.Sprintf("%s %s", phoneNumber, firstName), Options: options})
+}
+
+// SendChatAction records a chat action
+func (m *Mock) SendChatAction(chatID interface{}, action bot.ChatAction) bot.APIResponseBool {
+	m.record(Call{Method: "SendChatAction", ChatID: chatID, Text: string(action)})
+
+	return okBool()
+}
+
+// EditMessageText records an edit of a message
+func (m *Mock) EditMessageText(text string, options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "EditMessageText", ChatID: options["chat_id"], Text: text, Options: options})
+}
+
+// EditMessageReplyMarkup records an edit of a reply markup
+func (m *Mock) EditMessageReplyMarkup(options map[string]interface{}) bot.APIResponseMessage {
+	return m.record(Call{Method: "EditMessageReplyMarkup", ChatID: options["chat_id"], Options: options})
+}
+
+// DeleteMessage records a deletion of a message
+func (m *Mock) DeleteMessage(chatID interface{}, messageID int) bot.APIResponseBool {
+	m.record(Call{Method: "DeleteMessage", ChatID: chatID, Options: map[string]interface{}{"message_id": messageID}})
+
+	return okBool()
+}
+
+// SendMediaGroup records an album
+func (m *Mock) SendMediaGroup(chatID interface{}, media []bot.InputMedia, options map[string]interface{}) bot.APIResponseMessages {
+	sent := m.record(Call{Method: "SendMediaGroup", ChatID: chatID, Media: media, Options: options})
+
+	return bot.APIResponseMessages{
+		APIResponseBase: sent.APIResponseBase,
+		Result:          []bot.Message{*sent.Result},
+	}
+}
+
+// AnswerCallbackQuery records an answer of a callback query
+func (m *Mock) AnswerCallbackQuery(callbackQueryID string, options map[string]interface{}) bot.APIResponseBool {
+	m.record(Call{Method: "AnswerCallbackQuery", Text: callbackQueryID, Options: options})
+
+	return okBool()
+}
+
+// GetFile returns the file of given id from `Files`
+func (m *Mock) GetFile(fileID string) bot.APIResponseFile {
+	m.lock.Lock()
+	file, exists := m.Files[fileID]
+	m.lock.Unlock()
+
+	if !exists {
+		description := fmt.Sprintf("no such file: %s", fileID)
+		return bot.APIResponseFile{APIResponseBase: bot.APIResponseBase{Ok: false, Description: &description}}
+	}
+
+	return bot.APIResponseFile{APIResponseBase: bot.APIResponseBase{Ok: true}, Result: &file}
+}
+
+// GetFileURL returns a fake url of given file
+func (m *Mock) GetFileURL(file bot.File) string {
+	return fmt.Sprintf("https://telegram.invalid/file/%s", file.FileID)
+}
+
+// caption in given options (empty if there is none)
+func captionOf(options map[string]interface{}) string {
+	if caption, ok := options["caption"].(string); ok {
+		return caption
+	}
+
+	return ""
+}
+
+// successful response of bool
+func okBool() bot.APIResponseBool {
+	return bot.APIResponseBool{APIResponseBase: bot.APIResponseBase{Ok: true}, Result: true}
+}
@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"testing"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+func TestMockRecordsCalls(t *testing.T) {
+	m := NewMock()
+
+	first := m.SendMessage(int64(1), "hello", nil)
+	second := m.SendPhoto(int64(1), bot.InputFileFromBytes([]byte("image")), map[string]interface{}{"caption": "a photo"})
+	m.AnswerCallbackQuery("query-id", nil)
+
+	if !first.Ok || !second.Ok || first.Result.MessageID == second.Result.MessageID {
+		t.Errorf("sent messages did not get new message ids: %+v, %+v", first, second)
+	}
+	if len(m.Calls) != 3 {
+		t.Fatalf("wrong number of recorded calls: %d", len(m.Calls))
+	}
+	if photos := m.CallsOf("SendPhoto"); len(photos) != 1 || photos[0].Text != "a photo" || string(photos[0].File.Bytes) != "image" {
+		t.Errorf("photo was not recorded: %+v", photos)
+	}
+	if answers := m.CallsOf("AnswerCallbackQuery"); len(answers) != 1 || answers[0].Text != "query-id" {
+		t.Errorf("answer was not recorded: %+v", answers)
+	}
+}
+
+func TestMockGetFile(t *testing.T) {
+	m := NewMock()
+	m.Files["file-id"] = bot.File{FileID: "file-id", FileUniqueID: "unique-id"}
+
+	if res := m.GetFile("file-id"); !res.Ok || res.Result.FileUniqueID != "unique-id" {
+		t.Errorf("prepared file was not returned: %+v", res)
+	}
+	if res := m.GetFile("unknown"); res.Ok {
+		t.Errorf("unknown file was returned: %+v", res)
+	}
+}
@@ -0,0 +1,30 @@
+package telegram
+
+// interface of Telegram bot clients, which can be replaced with other implementations (eg. mocks)
+
+import (
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// Messenger interface for sending and editing messages on Telegram
+//
+// (satisfied by *bot.Bot, and *Mock for testing)
+type Messenger interface {
+	SendMessage(chatID interface{}, text string, options map[string]interface{}) bot.APIResponseMessage
+	SendPhoto(chatID interface{}, photo bot.InputFile, options map[string]interface{}) bot.APIResponseMessage
+	SendDocument(chatID interface{}, document bot.InputFile, options map[string]interface{}) bot.APIResponseMessage
+	SendVoice(chatID interface{}, voice bot.InputFile, options map[string]interface{}) bot.APIResponseMessage
+	SendContact(chatID interface{}, phoneNumber, firstName string, options map[string]interface{}) bot.APIResponseMessage
+	SendChatAction(chatID interface{}, action bot.ChatAction) bot.APIResponseBool
+	EditMessageText(text string, options map[string]interface{}) bot.APIResponseMessage
+	EditMessageReplyMarkup(options map[string]interface{}) bot.APIResponseMessage
+	DeleteMessage(chatID interface{}, messageID int) bot.APIResponseBool
+	SendMediaGroup(chatID interface{}, media []bot.InputMedia, options map[string]interface{}) bot.APIResponseMessages
+	AnswerCallbackQuery(callbackQueryID string, options map[string]interface{}) bot.APIResponseBool
+	GetFile(fileID string) bot.APIResponseFile
+	GetFileURL(file bot.File) string
+}
+
+var _ Messenger = (*bot.Bot)(nil)
+var _ Messenger = (*Mock)(nil)
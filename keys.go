@@ -0,0 +1,134 @@
+package main
+
+// functions for failing over to other subscription keys of each service
+//
+// (when a key is rejected with 401, 403, or 429, the next one of `subscription-keys` is used)
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// constants for subscription keys
+const (
+	operationKeysTTL = 10 * time.Minute // keys of asynchronous operations are remembered for this duration
+)
+
+// headers which carry subscription keys
+var subscriptionKeyHeaders = []string{"Ocp-Apim-Subscription-Key", "Prediction-Key"}
+
+// index of the key which is in use, for each service
+var activeKeys = map[string]int{}
+var activeKeysLock sync.Mutex
+
+// operationKey struct for the key which started an asynchronous operation
+type operationKey struct {
+	key     string
+	savedOn time.Time
+}
+
+// keys which started asynchronous operations, keyed by their urls
+//
+// (results of operations should be polled with the same keys)
+var operationKeys = map[string]operationKey{}
+var operationKeysLock sync.Mutex
+
+// all keys of given service, starting with the primary one
+func keysOf(service, primary string) []string {
+	return append([]string{primary}, conf().SubscriptionKeys[service]...)
+}
+
+// replace the subscription key in given headers with the active one of given service
+//
+// (returns new headers and the index of the key, or -1 if the key was not replaced)
+func withActiveKey(service, apiURL string, headers map[string]string) (replaced map[string]string, index int) {
+	var header string
+	for _, h := range subscriptionKeyHeaders {
+		if _, exists := headers[h]; exists {
+			header = h
+			break
+		}
+	}
+	if header == "" {
+		return headers, -1
+	}
+
+	// (results of an asynchronous operation)
+	operationKeysLock.Lock()
+	op, isOperation := operationKeys[apiURL]
+	operationKeysLock.Unlock()
+
+	keys := keysOf(service, headers[header])
+	if !isOperation && len(keys) <= 1 {
+		return headers, -1
+	}
+
+	replaced = map[string]string{}
+	for k, v := range headers {
+		replaced[k] = v
+	}
+
+	if isOperation {
+		replaced[header] = op.key
+		return replaced, -1
+	}
+
+	activeKeysLock.Lock()
+	index = activeKeys[service] % len(keys)
+	activeKeysLock.Unlock()
+
+	replaced[header] = keys[index]
+
+	return replaced, index
+}
+
+// check if given response means that the key was rejected (invalid, expired, or out of quota)
+func isKeyRejected(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+
+	return false
+}
+
+// rotate to the next key of given service, if the rejected key is still the active one
+func rotateKey(service string, rejected int, numKeys int) {
+	activeKeysLock.Lock()
+	defer activeKeysLock.Unlock()
+
+	if activeKeys[service]%numKeys == rejected {
+		activeKeys[service] = (rejected + 1) % numKeys
+
+		logger.Warn(fmt.Sprintf("Key #%d of %s was rejected, failing over to key #%d", rejected+1, service, activeKeys[service]+1))
+	}
+}
+
+// remember the key which started an asynchronous operation of given service, for polling its results
+//
+// (only when the service has multiple keys)
+func saveOperationKey(service string, resp *http.Response, headers map[string]string) {
+	operationURL := resp.Header.Get("Operation-Location")
+	if operationURL == "" || len(conf().SubscriptionKeys[service]) <= 0 {
+		return
+	}
+
+	for _, h := range subscriptionKeyHeaders {
+		if key, exists := headers[h]; exists {
+			operationKeysLock.Lock()
+			operationKeys[operationURL] = operationKey{key: key, savedOn: time.Now()}
+
+			// (forget old ones)
+			for url, op := range operationKeys {
+				if time.Since(op.savedOn) > operationKeysTTL {
+					delete(operationKeys, url)
+				}
+			}
+			operationKeysLock.Unlock()
+
+			return
+		}
+	}
+}
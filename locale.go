@@ -0,0 +1,100 @@
+package main
+
+// functions for localizing messages to the language of each user
+//
+// messages are looked up with their English originals (see locales.go for translations),
+// and the language of a user is chosen with `/language`, or from the language of the user's Telegram client
+
+import (
+	"strings"
+	"sync"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for localization
+const (
+	defaultLanguage = "en"
+
+	languageAuto = "auto" // (follows the language of Telegram client)
+)
+
+// languages of Telegram clients, which were seen most recently
+var clientLanguages = map[int]string{}
+var clientLanguagesLock sync.RWMutex
+
+// supported languages (English first)
+func supportedLanguages() []string {
+	languages := []string{defaultLanguage}
+	for _, l := range localeLanguages {
+		languages = append(languages, l)
+	}
+
+	return languages
+}
+
+// check if given language is supported
+func isSupportedLanguage(language string) bool {
+	for _, l := range supportedLanguages() {
+		if l == language {
+			return true
+		}
+	}
+
+	return false
+}
+
+// supported language for given language code of Telegram (eg. "ko-KR" => "ko")
+func languageForCode(code string) (language string, supported bool) {
+	language = strings.ToLower(strings.SplitN(strings.Replace(code, "_", "-", -1), "-", 2)[0])
+
+	return language, isSupportedLanguage(language)
+}
+
+// remember the language of given user's Telegram client
+func rememberClientLanguage(user *bot.User) {
+	if user == nil || user.LanguageCode == nil {
+		return
+	}
+
+	if language, supported := languageForCode(*user.LanguageCode); supported {
+		clientLanguagesLock.Lock()
+		clientLanguages[user.ID] = language
+		clientLanguagesLock.Unlock()
+	}
+}
+
+// language of messages for given user
+//
+// (chosen one with `/language`, or the language of the user's Telegram client, or English)
+func languageFor(userID int) string {
+	if language := getPreference(userID, preferenceLanguage); isSupportedLanguage(language) {
+		return language
+	}
+
+	clientLanguagesLock.RLock()
+	defer clientLanguagesLock.RUnlock()
+
+	if language, exists := clientLanguages[userID]; exists {
+		return language
+	}
+
+	return defaultLanguage
+}
+
+// localize given message (or format) to given language
+//
+// (returns the original one if there is no translation)
+func localize(language, message string) string {
+	if translated, exists := localizedMessages[language][message]; exists {
+		return translated
+	}
+
+	return message
+}
+
+// localize given message (or format) for given user
+func localizeFor(userID int, message string) string {
+	return localize(languageFor(userID), message)
+}
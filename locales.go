@@ -0,0 +1,280 @@
+package main
+
+// translations of messages
+//
+// (keys are the English originals, and names of commands are kept in English as they are the labels of buttons)
+
+// languages which have translations (other than English)
+var localeLanguages = []string{"ko", "ja"}
+
+// translated messages for each language
+var localizedMessages = map[string]map[string]string{
+	"ko": {
+		messageActionImage:        "이 이미지에 실행할 작업을 선택하세요:",
+		messageActionPDF:          "이 PDF 문서에 실행할 작업을 선택하세요:",
+		messageActionAudio:        "이 오디오에 실행할 작업을 선택하세요:",
+		messageActionVideo:        "이 동영상의 프레임에 실행할 작업을 선택하세요:",
+		messageActionSticker:      "이 스티커에 실행할 작업을 선택하세요:",
+		messageActionAlbum:        "이 이미지 %d장에 실행할 작업을 선택하세요:",
+		messageRerunImage:         "이 이미지에 다른 작업을 실행하기:",
+		messageRerunVideo:         "이 동영상의 프레임에 다른 작업을 실행하기:",
+		messageRerunSticker:       "이 스티커에 다른 작업을 실행하기:",
+		messageSendNextImage:      "'%s'에 사용할 다른 이미지를 보내주세요.",
+		messageSendImageFor:       "'%s'에 사용할 이미지를 보내주세요.",
+		messageActionRatio:        "이 이미지의 가로세로 비율을 선택하세요:",
+		messageProcessingImage:    "받은 이미지에 '%s' 처리 중...",
+		messageProcessingImages:   "받은 이미지들에 '%s' 처리 중...",
+		messageProcessingAlbum:    "받은 이미지 %[2]d장에 '%[1]s' 처리 중...",
+		messageProcessingSticker:  "받은 스티커에 '%s' 처리 중...",
+		messageProcessingVideo:    "받은 동영상의 프레임에 '%s' 처리 중...",
+		messageProcessingAudio:    "받은 오디오에 '%s' 처리 중...",
+		messageProcessingPDF:      "받은 PDF 문서에 '%s' 처리 중...",
+		messageProcessingFaces:    "얼굴 #%[2]s에 '%[1]s' 처리 중...",
+		messageDetectingFaces:     "받은 이미지에서 '%s'에 사용할 얼굴 찾는 중...",
+		messageProcessingCommand:  "'%s' 처리 중...",
+		messageStageDownloading:   "다운로드 중",
+		messageStageCallingAPIs:   "API 호출 중",
+		messageStageParallelCalls: "API %d개 동시 호출 중",
+		messageStageRendering:     "결과 그리는 중",
+		messageStageSending:       "보내는 중",
+		messageStageImageOf:       "이미지 %d/%d",
+		messageStagePageOf:        "페이지 %d/%d",
+		messageResultCaption:      "'%s' 처리 결과",
+		messageAlbumResultCaption: "이미지 #%d: '%s' 처리 결과",
+		messageLanguage:           "메시지가 '%s'(으)로 표시됩니다.",
+		messageLanguageUsage:      "사용법: /language %s",
+		messageAlbumExpired:       "이 앨범은 만료되었습니다. 다시 보내주세요.",
+		messageKeyboardExpired:    "이 키보드는 만료되었습니다. 파일을 다시 보내주세요.",
+		messageHistory:            "이 채팅에서의 최근 분석 %d건 (번호를 누르면 결과로 이동합니다):",
+		messageHistoryEmpty:       "이 채팅에서 아직 분석한 것이 없습니다.",
+		messageHistoryUsage:       "사용법: /history [1-%d]",
+		messageHistoryHere:        "여기가 결과입니다.",
+		messageHistoryDeleted:     "결과 메시지가 더 이상 존재하지 않습니다.",
+		messageArchived:           "보관되었습니다 (링크는 %d시간 후 만료됩니다): %s",
+		messageActionFaces:        "'%s'에 사용할 얼굴을 고른 뒤 적용하세요:",
+		messageFacesExpired:       "이 선택은 만료되었습니다. 이미지를 다시 보내주세요.",
+		messageNoFaceSelected:     "얼굴을 하나 이상 고르세요.",
+		messageUnprocessable:      "처리할 수 없는 메시지입니다.",
+		messageUnknownCommand:     "알 수 없는 명령입니다. 사용법은 /help 를 보내 확인하세요.",
+		messageFailedToGetFile:    "서버에서 파일을 가져오지 못했습니다.",
+		messageFailedToEnqueue:    "요청을 대기열에 넣지 못했습니다. 잠시 후 다시 시도해주세요.",
+		messageSomethingWrong:     "문제가 발생했습니다. 잠시 후 다시 시도해주세요.",
+		messageCanceled:           "취소되었습니다.",
+		messageTimedOut:           "'%s' 처리 중 시간이 초과되었습니다. 잠시 후 다시 시도해주세요.",
+		messageImageTooLarge:      "이미지가 너무 큽니다 (%dx%d). 가로와 세로 %d 픽셀, %d 메가픽셀까지의 이미지만 처리할 수 있습니다.",
+		messageUnsupportedSticker: "정지된 스티커만 처리할 수 있습니다.",
+		messageQuotaExceeded:      "사용량을 초과했습니다. %s 이후에 다시 시도해주세요.",
+		messageNotAllowed:         "죄송합니다. 이 봇을 사용할 수 없습니다.",
+		messageNoDatabase:         "데이터베이스를 사용할 수 없습니다.",
+		messageExported:           "저장된 나의 데이터 (삭제하려면 %s 를 보내세요)",
+		messageExportFailed:       "데이터를 내보내지 못했습니다: %s",
+		messageExportNotSent:      "내보낸 데이터를 보내지 못했습니다: %s",
+		messageForgetMeConfirm:    "이 봇에 저장된 요청, 기록, 설정, 대기 중인 작업, 캐시되거나 보관된 결과와\n이 봇과의 개인 채팅에서 등록한 얼굴이 삭제됩니다.\n\n계속하려면 '%s %s' 를 보내세요.",
+		messageForgetMeFailed:     "데이터를 삭제하지 못했습니다: %s",
+		messageFacesNotForgotten:  "데이터를 삭제했지만, 등록한 얼굴은 삭제하지 못했습니다: %s",
+		messageForgotten:          "데이터를 삭제했습니다.",
+
+		// (errors of commands)
+		"No face detected on this image.":                             "이 이미지에서 얼굴을 찾지 못했습니다.",
+		"No object detected on this image.":                           "이 이미지에서 물체를 찾지 못했습니다.",
+		"Could not find any text to redact on this image.":            "이 이미지에서 가릴 텍스트를 찾지 못했습니다.",
+		"Could not find any receipt on given image.":                  "이 이미지에서 영수증을 찾지 못했습니다.",
+		"Could not find any business card on given image.":            "이 이미지에서 명함을 찾지 못했습니다.",
+		"Could not find any look-alike. Maybe you are one of a kind!": "닮은 사람을 찾지 못했습니다. 유일무이한 얼굴인가 봐요!",
+
+		messageHelp: `이 봇에 이미지를 보낸 뒤, 다음 작업 중 하나를 선택하세요:
+
+- Emotion Recognition (감정 인식)
+- Face Detection (얼굴 찾기)
+- Extract Faces (얼굴들을 앨범으로)
+- Face Collage (얼굴 모음)
+- Count Faces (인원수 세기)
+- Describe This Image (이미지 설명)
+- Read Text (Printed/Handwritten) (텍스트 읽기)
+- Redact Text (텍스트 가리기)
+- Image Info (이미지 정보)
+- Strip Metadata (메타데이터 제거)
+- Tag This Image (태그)
+- Detect Objects (물체 찾기)
+- Smart Crop (1:1, 16:9, 4:3)
+- Color Analysis (색상 분석)
+- What Kind of Image Is This? (클립아트 또는 선화)
+- Scan Receipt (영수증 스캔)
+- Scan Business Card (명함 스캔)
+- Custom Model (직접 만든 Custom Vision 프로젝트)
+- Analyze Everything (모두 분석)
+- Verify Faces (다른 이미지와 비교)
+- Identify Persons (사람 식별)
+- Find Similar Faces (채팅의 이전 이미지들에서)
+- Who Do I Look Like? (닮은 유명인)
+- Safety Check (안전 검사)
+- Moderate (콘텐츠 검토)
+- Censor Eyes (눈 가리기)
+- Mask Faces (얼굴 가리기)
+- Deal With It (선글라스)
+- Emojify Faces (이모지로 가리기)
+- Who Smiles the Most? (가장 많이 웃는 사람)
+
+그러면 결과 메시지나 이미지를 보내드립니다.
+
+결과 이미지를 (텔레그램이 다시 압축하지 않는) 문서로 받으려면 /documents on (또는 off) 을 보내세요.
+
+결과 문서의 형식은 /format png (또는 jpeg, webp) 로,
+JPEG와 WebP 이미지의 품질은 /quality <1-100> 으로 정할 수 있습니다.
+
+/default <작업> (예: /default Face Detection) 을 보내면 이미지를 그 작업으로 바로 처리하고,
+/settings 로 현재 설정을 볼 수 있습니다.
+
+또는, 이미지의 캡션에 작업을 적어서 보내세요. (예: ocr, faces, describe in Korean)
+
+이미지의 캡션으로 (또는 이미지에 답장으로) /remember <이름> 을 보내면 얼굴을 등록하고,
+Identify Persons 가 그 이름을 표시합니다.
+
+메시지 언어는 /language 로 바꿀 수 있습니다.
+
+정적인 스티커는 Describe, Tag, Face Detection 에,
+애니메이션과 동영상은 대표 프레임 처리에,
+PDF 문서는 텍스트 읽기에,
+음성 메시지와 오디오 파일은 받아쓰기에 사용할 수 있습니다.
+
+그룹 채팅에서는 이미지의 캡션에서 이 봇을 멘션하거나,
+이미지에 명령으로 답장하세요.
+
+* Github: https://github.com/meinside/telegram-ms-cognitive-bot
+`,
+	},
+	"ja": {
+		messageActionImage:        "この画像に実行するアクションを選んでください:",
+		messageActionPDF:          "このPDF文書に実行するアクションを選んでください:",
+		messageActionAudio:        "このオーディオに実行するアクションを選んでください:",
+		messageActionVideo:        "この動画のフレームに実行するアクションを選んでください:",
+		messageActionSticker:      "このステッカーに実行するアクションを選んでください:",
+		messageActionAlbum:        "これら%d枚の画像に実行するアクションを選んでください:",
+		messageRerunImage:         "この画像に別のアクションを実行:",
+		messageRerunVideo:         "この動画のフレームに別のアクションを実行:",
+		messageRerunSticker:       "このステッカーに別のアクションを実行:",
+		messageSendNextImage:      "'%s'に使う別の画像を送ってください。",
+		messageSendImageFor:       "'%s'に使う画像を送ってください。",
+		messageActionRatio:        "この画像のアスペクト比を選んでください:",
+		messageProcessingImage:    "受け取った画像に'%s'を処理中...",
+		messageProcessingImages:   "受け取った画像に'%s'を処理中...",
+		messageProcessingAlbum:    "受け取った%[2]d枚の画像に'%[1]s'を処理中...",
+		messageProcessingSticker:  "受け取ったステッカーに'%s'を処理中...",
+		messageProcessingVideo:    "受け取った動画のフレームに'%s'を処理中...",
+		messageProcessingAudio:    "受け取ったオーディオに'%s'を処理中...",
+		messageProcessingPDF:      "受け取ったPDF文書に'%s'を処理中...",
+		messageProcessingFaces:    "顔 #%[2]s に'%[1]s'を処理中...",
+		messageDetectingFaces:     "受け取った画像から'%s'に使う顔を検出中...",
+		messageProcessingCommand:  "'%s'を処理中...",
+		messageStageDownloading:   "ダウンロード中",
+		messageStageCallingAPIs:   "API呼び出し中",
+		messageStageParallelCalls: "%d個のAPIを並列で呼び出し中",
+		messageStageRendering:     "結果を描画中",
+		messageStageSending:       "送信中",
+		messageStageImageOf:       "画像 %d/%d",
+		messageStagePageOf:        "ページ %d/%d",
+		messageResultCaption:      "'%s'の処理結果",
+		messageAlbumResultCaption: "画像 #%d: '%s'の処理結果",
+		messageLanguage:           "メッセージは'%s'で表示されます。",
+		messageLanguageUsage:      "使い方: /language %s",
+		messageAlbumExpired:       "このアルバムは期限切れです。もう一度送ってください。",
+		messageKeyboardExpired:    "このキーボードは期限切れです。ファイルをもう一度送ってください。",
+		messageHistory:            "このチャットでの最近の分析 %d件 (番号を押すと結果に移動します):",
+		messageHistoryEmpty:       "このチャットではまだ何も分析していません。",
+		messageHistoryUsage:       "使い方: /history [1-%d]",
+		messageHistoryHere:        "ここが結果です。",
+		messageHistoryDeleted:     "結果のメッセージはもう存在しません。",
+		messageArchived:           "保管しました（リンクは%d時間後に失効します）: %s",
+		messageActionFaces:        "'%s'に使う顔を選んでから適用してください:",
+		messageFacesExpired:       "この選択は期限切れです。画像をもう一度送ってください。",
+		messageNoFaceSelected:     "顔を一つ以上選んでください。",
+		messageUnprocessable:      "処理できないメッセージです。",
+		messageUnknownCommand:     "不明なコマンドです。使い方は /help を送って確認してください。",
+		messageFailedToGetFile:    "サーバーからファイルを取得できませんでした。",
+		messageFailedToEnqueue:    "リクエストをキューに入れられませんでした。しばらくしてからもう一度お試しください。",
+		messageSomethingWrong:     "問題が発生しました。しばらくしてからもう一度お試しください。",
+		messageCanceled:           "キャンセルしました。",
+		messageTimedOut:           "'%s'の処理中にタイムアウトしました。しばらくしてからもう一度お試しください。",
+		messageImageTooLarge:      "画像が大きすぎます (%dx%d)。幅と高さが %d ピクセル、%d メガピクセルまでの画像のみ処理できます。",
+		messageUnsupportedSticker: "静止画のステッカーのみ処理できます。",
+		messageQuotaExceeded:      "利用上限を超えました。%s 以降にもう一度お試しください。",
+		messageNotAllowed:         "申し訳ありませんが、このボットは利用できません。",
+		messageNoDatabase:         "データベースが利用できません。",
+		messageExported:           "保存されているあなたのデータ (削除するには %s を送ってください)",
+		messageExportFailed:       "データをエクスポートできませんでした: %s",
+		messageExportNotSent:      "エクスポートしたデータを送信できませんでした: %s",
+		messageForgetMeConfirm:    "このボットに保存されたリクエスト、履歴、設定、待機中のジョブ、キャッシュまたは保管された結果と、\nこのボットとの個人チャットで登録した顔が削除されます。\n\n続けるには '%s %s' を送ってください。",
+		messageForgetMeFailed:     "データを削除できませんでした: %s",
+		messageFacesNotForgotten:  "データを削除しましたが、登録した顔は削除できませんでした: %s",
+		messageForgotten:          "データを削除しました。",
+
+		// (errors of commands)
+		"No face detected on this image.":                             "この画像から顔が検出されませんでした。",
+		"No object detected on this image.":                           "この画像から物体が検出されませんでした。",
+		"Could not find any text to redact on this image.":            "この画像から隠すテキストが見つかりませんでした。",
+		"Could not find any receipt on given image.":                  "この画像からレシートが見つかりませんでした。",
+		"Could not find any business card on given image.":            "この画像から名刺が見つかりませんでした。",
+		"Could not find any look-alike. Maybe you are one of a kind!": "似ている人が見つかりませんでした。唯一無二の顔かもしれません!",
+
+		messageHelp: `このボットに画像を送って、次のアクションから一つを選んでください:
+
+- Emotion Recognition (感情認識)
+- Face Detection (顔検出)
+- Extract Faces (顔をアルバムで)
+- Face Collage (顔のコラージュ)
+- Count Faces (人数を数える)
+- Describe This Image (画像の説明)
+- Read Text (Printed/Handwritten) (テキスト読み取り)
+- Redact Text (テキストを隠す)
+- Image Info (画像情報)
+- Strip Metadata (メタデータ削除)
+- Tag This Image (タグ付け)
+- Detect Objects (物体検出)
+- Smart Crop (1:1, 16:9, 4:3)
+- Color Analysis (色の分析)
+- What Kind of Image Is This? (クリップアートか線画か)
+- Scan Receipt (レシートのスキャン)
+- Scan Business Card (名刺のスキャン)
+- Custom Model (独自の Custom Vision プロジェクト)
+- Analyze Everything (すべて分析)
+- Verify Faces (別の画像と比較)
+- Identify Persons (人物の識別)
+- Find Similar Faces (チャットの以前の画像から)
+- Who Do I Look Like? (似ている有名人)
+- Safety Check (安全チェック)
+- Moderate (コンテンツ審査)
+- Censor Eyes (目を隠す)
+- Mask Faces (顔を隠す)
+- Deal With It (サングラス)
+- Emojify Faces (絵文字で隠す)
+- Who Smiles the Most? (一番の笑顔)
+
+結果のメッセージや画像を送り返します。
+
+結果の画像を(Telegramに再圧縮されない)ドキュメントで受け取るには /documents on (または off) を送ってください。
+
+結果ドキュメントの形式は /format png (または jpeg, webp) で、
+JPEGとWebP画像の品質は /quality <1-100> で設定できます。
+
+/default <アクション> (例: /default Face Detection) を送ると画像をそのアクションですぐに処理し、
+/settings で現在の設定を確認できます。
+
+または、画像のキャプションにアクションを書いて送ってください。(例: ocr, faces, describe in Japanese)
+
+画像のキャプションで (または画像への返信で) /remember <名前> を送ると顔を登録し、
+Identify Persons がその名前を表示します。
+
+メッセージの言語は /language で変更できます。
+
+静止画ステッカーは Describe, Tag, Face Detection に、
+アニメーションと動画は代表フレームの処理に、
+PDF文書はテキストの読み取りに、
+ボイスメッセージとオーディオファイルは文字起こしに使えます。
+
+グループチャットでは、画像のキャプションでこのボットにメンションするか、
+画像にコマンドで返信してください。
+
+* Github: https://github.com/meinside/telegram-ms-cognitive-bot
+`,
+	},
+}
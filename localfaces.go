@@ -0,0 +1,186 @@
+package main
+
+// VisionProvider implementation with local (offline) face detection
+//
+// (cascade files can be downloaded from: https://github.com/esimov/pigo/tree/master/cascade)
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for local face detection
+	pigo "github.com/esimov/pigo/core"
+)
+
+// constants for local face detection
+const (
+	localFaceMinSize      = 20
+	localFaceShiftFactor  = 0.1
+	localFaceScaleFactor  = 1.1
+	localFaceIoUThreshold = 0.2
+	localFaceMinQuality   = 5.0 // detections with lower quality than this will be ignored
+
+	localPuplocPerturbs = 63
+)
+
+// VisionProvider implementation with local face detection
+//
+// (only face rectangles and eyes are detected)
+type localFaces struct{}
+
+// loaded cascades
+var localFaceCascade *pigo.Pigo
+var localPuplocCascade *pigo.PuplocCascade
+var localCascadesOnce sync.Once
+var localCascadesErr error
+
+// load cascades from the configured files (only once)
+func loadLocalCascades() error {
+	localCascadesOnce.Do(func() {
+		if conf().LocalFaceCascadeFilepath == "" {
+			localCascadesErr = errors.New("no cascade file for local face detection")
+			return
+		}
+
+		var data []byte
+		if data, localCascadesErr = ioutil.ReadFile(conf().LocalFaceCascadeFilepath); localCascadesErr != nil {
+			return
+		}
+		if localFaceCascade, localCascadesErr = pigo.NewPigo().Unpack(data); localCascadesErr != nil {
+			return
+		}
+
+		// (pupil localization is optional)
+		if conf().LocalPuplocCascadeFilepath != "" {
+			if data, err := ioutil.ReadFile(conf().LocalPuplocCascadeFilepath); err == nil {
+				if localPuplocCascade, err = pigo.NewPuplocCascade().UnpackCascade(data); err != nil {
+					logger.Warn(fmt.Sprintf("Failed to unpack pupil localization cascade: %s", err))
+				}
+			} else {
+				logger.Warn(fmt.Sprintf("Failed to read pupil localization cascade: %s", err))
+			}
+		}
+	})
+
+	return localCascadesErr
+}
+
+// check if local face detection is configured
+func localFacesAvailable() bool {
+	return conf().LocalFaceCascadeFilepath != ""
+}
+
+// DetectFaces detects faces (and pupils, if possible) on given image bytes
+//
+// (face ids and attributes are not supported)
+func (localFaces) DetectFaces(ctx context.Context, imageBytes []byte, returnFaceID, returnFaceLandmarks bool, returnFaceAttributes []string) (result []DetectedFace, err error) {
+	if err = loadLocalCascades(); err != nil {
+		return result, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, err
+	}
+	cols, rows := img.Bounds().Dx(), img.Bounds().Dy()
+
+	params := pigo.ImageParams{
+		Pixels: pigo.RgbToGrayscale(img),
+		Rows:   rows,
+		Cols:   cols,
+		Dim:    cols,
+	}
+	detections := localFaceCascade.RunCascade(pigo.CascadeParams{
+		MinSize:     localFaceMinSize,
+		MaxSize:     int(math.Max(float64(cols), float64(rows))),
+		ShiftFactor: localFaceShiftFactor,
+		ScaleFactor: localFaceScaleFactor,
+		ImageParams: params,
+	}, 0.0)
+	detections = localFaceCascade.ClusterDetections(detections, localFaceIoUThreshold)
+
+	for _, d := range detections {
+		if d.Q < localFaceMinQuality {
+			continue
+		}
+
+		face := DetectedFace{
+			FaceRectangle: cog.Rectangle{
+				Left:   d.Col - d.Scale/2,
+				Top:    d.Row - d.Scale/2,
+				Width:  d.Scale,
+				Height: d.Scale,
+			},
+		}
+
+		if returnFaceLandmarks && localPuplocCascade != nil {
+			face.FaceLandmarks = localEyeLandmarks(d, params)
+		}
+
+		result = append(result, face)
+	}
+
+	return result, nil
+}
+
+// localize pupils of a detected face, and approximate landmarks of eyes around them
+func localEyeLandmarks(d pigo.Detection, params pigo.ImageParams) map[string]cog.Point {
+	scale := float32(d.Scale)
+
+	left := localPuplocCascade.RunDetector(pigo.Puploc{
+		Row:      d.Row - int(0.075*scale),
+		Col:      d.Col - int(0.175*scale),
+		Scale:    scale * 0.25,
+		Perturbs: localPuplocPerturbs,
+	}, params, 0.0, false)
+	right := localPuplocCascade.RunDetector(pigo.Puploc{
+		Row:      d.Row - int(0.075*scale),
+		Col:      d.Col + int(0.185*scale),
+		Scale:    scale * 0.25,
+		Perturbs: localPuplocPerturbs,
+	}, params, 0.0, false)
+	if left == nil || right == nil || left.Row <= 0 || right.Row <= 0 {
+		return nil
+	}
+
+	// (eyes are assumed to be about 1/10 of the face high, and 1/5 of it wide)
+	pl := cog.Point{X: float64(left.Col), Y: float64(left.Row)}
+	pr := cog.Point{X: float64(right.Col), Y: float64(right.Row)}
+	h, w := float64(d.Scale)*0.05, float64(d.Scale)*0.1
+
+	return map[string]cog.Point{
+		"pupilLeft":      pl,
+		"pupilRight":     pr,
+		"eyeLeftTop":     {X: pl.X, Y: pl.Y - h},
+		"eyeLeftBottom":  {X: pl.X, Y: pl.Y + h},
+		"eyeLeftOuter":   {X: pl.X - w, Y: pl.Y},
+		"eyeRightTop":    {X: pr.X, Y: pr.Y - h},
+		"eyeRightBottom": {X: pr.X, Y: pr.Y + h},
+		"eyeRightOuter":  {X: pr.X + w, Y: pr.Y},
+	}
+}
+
+// Tag is not supported
+func (localFaces) Tag(ctx context.Context, image []byte) (TagResult, error) {
+	return TagResult{}, unsupportedFeatureError("local face detection", "Tag")
+}
+
+// Analyze is not supported
+func (localFaces) Analyze(ctx context.Context, image []byte, visualFeatures []string) (AnalyzeResult, error) {
+	return AnalyzeResult{}, unsupportedFeatureError("local face detection", "Analyze")
+}
+
+// Read is not supported
+func (localFaces) Read(ctx context.Context, image []byte, progress func(status string, elapsed time.Duration)) (ReadResult, error) {
+	return ReadResult{}, unsupportedFeatureError("local face detection", "Read")
+}
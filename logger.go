@@ -0,0 +1,509 @@
+package main
+
+// functions for structured logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// for logging on Loggly
+	"github.com/meinside/loggly-go"
+
+	// for config
+	cfg "github.com/meinside/telegram-ms-cognitive-bot/internal/config"
+)
+
+// LogLevel type
+type LogLevel int
+
+// log levels
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of a log level
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// parse given name of a log level (defaults to info)
+func parseLogLevel(name string) LogLevel {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	}
+
+	return LevelInfo
+}
+
+// types of log sinks
+const (
+	LogSinkStdout = "stdout"
+	LogSinkFile   = "file"
+	LogSinkLoggly = "loggly"
+	LogSinkSyslog = "syslog"
+
+	LogSinkTelegram = "telegram"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	defaultLogFileMaxSizeMB  = 10
+	defaultLogFileMaxBackups = 3
+)
+
+// LogSinkConfig struct for configuring a log sink
+type LogSinkConfig = cfg.LogSinkConfig
+
+// LogEntry struct
+type LogEntry struct {
+	Time        time.Time   `json:"time"`
+	Application string      `json:"app"`
+	Level       string      `json:"severity"`
+	Message     string      `json:"message,omitempty"`
+	Object      interface{} `json:"obj,omitempty"`
+}
+
+// text representation of a log entry
+func (e LogEntry) String() string {
+	str := fmt.Sprintf("%s [%s] %s", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level), e.Message)
+	if e.Object != nil {
+		if bytes, err := json.Marshal(e.Object); err == nil {
+			str += " " + string(bytes)
+		}
+	}
+
+	return str
+}
+
+// Logger interface
+type Logger interface {
+	Debug(message string)
+	Info(message string)
+	Warn(message string)
+	Error(message string)
+
+	// log a message with an object
+	Log(level LogLevel, message string, obj interface{})
+
+	// replace level and sinks with those of given logger
+	Replace(other Logger)
+
+	Close()
+}
+
+// LogSink interface for the destination of logs
+type LogSink interface {
+	Write(entry LogEntry) error
+	Close() error
+}
+
+// logger which writes logs to multiple sinks
+type multiLogger struct {
+	level LogLevel
+	sinks []LogSink
+	sync.RWMutex
+}
+
+// create a new logger with given minimum level and sinks
+func newLogger(level LogLevel, sinks ...LogSink) Logger {
+	return &multiLogger{
+		level: level,
+		sinks: sinks,
+	}
+}
+
+// create a new logger with given configs
+//
+// (defaults to a text sink on stdout when no sink is configured)
+func newLoggerWithConfigs(level LogLevel, configs []LogSinkConfig) (Logger, error) {
+	if len(configs) == 0 {
+		configs = []LogSinkConfig{{Type: LogSinkStdout}}
+	}
+
+	sinks := []LogSink{}
+	for _, config := range configs {
+		if sink, err := newLogSink(config); err == nil {
+			sinks = append(sinks, sink)
+		} else {
+			return nil, err
+		}
+	}
+
+	return newLogger(level, sinks...), nil
+}
+
+// create a new logger with log level and sinks of given config
+//
+// (`loggly-token` and `error-report-chat-id` are treated as loggly and telegram sinks, in addition to the stdout sink)
+func newConfiguredLogger(config Config) (Logger, error) {
+	sinks := config.LogSinks
+	if config.LogglyToken != "" {
+		if len(sinks) == 0 {
+			sinks = append(sinks, LogSinkConfig{Type: LogSinkStdout})
+		}
+		sinks = append(sinks, LogSinkConfig{Type: LogSinkLoggly, Token: config.LogglyToken})
+	}
+	if config.ErrorReportChatID != 0 {
+		if len(sinks) == 0 {
+			sinks = append(sinks, LogSinkConfig{Type: LogSinkStdout})
+		}
+		sinks = append(sinks, LogSinkConfig{Type: LogSinkTelegram, ChatID: config.ErrorReportChatID, IntervalSeconds: config.ErrorReportIntervalSeconds})
+	}
+
+	return newLoggerWithConfigs(parseLogLevel(config.LogLevel), sinks)
+}
+
+// create a new log sink with given config
+func newLogSink(config LogSinkConfig) (LogSink, error) {
+	switch config.Type {
+	case LogSinkStdout:
+		return &writerSink{file: os.Stdout, json: config.Format == LogFormatJSON}, nil
+	case LogSinkFile:
+		return newFileSink(config)
+	case LogSinkLoggly:
+		if config.Token == "" {
+			return nil, fmt.Errorf("no token for loggly sink")
+		}
+		return &logglySink{client: loggly.New(config.Token)}, nil
+	case LogSinkSyslog:
+		if writer, err := syslog.Dial(config.Network, config.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, appName); err == nil {
+			return &syslogSink{writer: writer}, nil
+		} else {
+			return nil, err
+		}
+	case LogSinkTelegram:
+		return newTelegramSink(config)
+	}
+
+	return nil, fmt.Errorf("unknown type of log sink: %s", config.Type)
+}
+
+// Debug logs a debug message
+func (l *multiLogger) Debug(message string) {
+	l.Log(LevelDebug, message, nil)
+}
+
+// Info logs an informational message
+func (l *multiLogger) Info(message string) {
+	l.Log(LevelInfo, message, nil)
+}
+
+// Warn logs a warning message
+func (l *multiLogger) Warn(message string) {
+	l.Log(LevelWarn, message, nil)
+}
+
+// Error logs an error message
+func (l *multiLogger) Error(message string) {
+	l.Log(LevelError, message, nil)
+}
+
+// Log logs a message with an object
+func (l *multiLogger) Log(level LogLevel, message string, obj interface{}) {
+	l.RLock()
+	defer l.RUnlock()
+
+	if level < l.level {
+		return
+	}
+
+	entry := LogEntry{
+		Time:        time.Now(),
+		Application: appName,
+		Level:       level.String(),
+		Message:     message,
+		Object:      obj,
+	}
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write log: %s\n", err)
+		}
+	}
+}
+
+// Replace replaces the level and sinks with those of given logger, and closes the old sinks
+//
+// (old sinks are closed after logs which are being written to them, so they are not closed while in use)
+func (l *multiLogger) Replace(other Logger) {
+	o, ok := other.(*multiLogger)
+	if !ok {
+		return
+	}
+
+	o.RLock()
+	level, sinks := o.level, o.sinks
+	o.RUnlock()
+
+	l.Lock()
+	oldSinks := l.sinks
+	l.level, l.sinks = level, sinks
+	l.Unlock()
+
+	for _, sink := range oldSinks {
+		sink.Close()
+	}
+}
+
+// Close closes all sinks
+func (l *multiLogger) Close() {
+	l.RLock()
+	defer l.RUnlock()
+
+	for _, sink := range l.sinks {
+		sink.Close()
+	}
+}
+
+// sink which writes to a file (stdout or a log file)
+type writerSink struct {
+	file *os.File
+	json bool
+	sync.Mutex
+}
+
+// Write writes a log entry
+func (s *writerSink) Write(entry LogEntry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return writeEntry(s.file, entry, s.json)
+}
+
+// Close does nothing for stdout
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// write a log entry to given file in text or JSON
+func writeEntry(file *os.File, entry LogEntry, asJSON bool) error {
+	var line string
+	if asJSON {
+		if bytes, err := json.Marshal(entry); err == nil {
+			line = string(bytes)
+		} else {
+			return err
+		}
+	} else {
+		line = entry.String()
+	}
+
+	_, err := fmt.Fprintln(file, line)
+
+	return err
+}
+
+// sink which writes to a log file, and rotates it by size
+type fileSink struct {
+	filepath   string
+	maxSize    int64
+	maxBackups int
+	json       bool
+
+	file *os.File
+	size int64
+	sync.Mutex
+}
+
+// create a new file sink with given config
+func newFileSink(config LogSinkConfig) (*fileSink, error) {
+	if config.Filepath == "" {
+		return nil, fmt.Errorf("no filepath for file sink")
+	}
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = defaultLogFileMaxSizeMB
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = defaultLogFileMaxBackups
+	}
+
+	sink := &fileSink{
+		filepath:   config.Filepath,
+		maxSize:    int64(config.MaxSizeMB) * 1024 * 1024,
+		maxBackups: config.MaxBackups,
+		json:       config.Format == LogFormatJSON,
+	}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// open (or create) the log file for appending
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+// rotate log files: "file.log" => "file.log.1" => "file.log.2" => ...
+//
+// (on failure, the original file is reopened and kept being written to)
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	for i := s.maxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.filepath, i), fmt.Sprintf("%s.%d", s.filepath, i+1))
+	}
+	if err := os.Rename(s.filepath, s.filepath+".1"); err != nil {
+		return s.reopenAfter(fmt.Errorf("failed to rotate log file: %s", err))
+	}
+	if err := s.open(); err != nil {
+		// move it back
+		os.Rename(s.filepath+".1", s.filepath)
+
+		return s.reopenAfter(fmt.Errorf("failed to open rotated log file: %s", err))
+	}
+
+	return nil
+}
+
+// reopen the original log file after given error of rotation, and return the error
+//
+// (if it also fails, it will be retried on the next write)
+func (s *fileSink) reopenAfter(err error) error {
+	if reopenErr := s.open(); reopenErr != nil {
+		return fmt.Errorf("%s (and failed to reopen: %s)", err, reopenErr)
+	}
+
+	return err
+}
+
+// Write writes a log entry, and rotates the file if needed
+//
+// (failures of rotation are reported, but the entry is still written if the file is open)
+func (s *fileSink) Write(entry LogEntry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	var rotateErr error
+	if s.size >= s.maxSize {
+		if rotateErr = s.rotate(); s.file == nil {
+			return rotateErr
+		}
+	}
+
+	if err := writeEntry(s.file, entry, s.json); err != nil {
+		return err
+	}
+	if info, err := s.file.Stat(); err == nil {
+		s.size = info.Size()
+	}
+
+	return rotateErr
+}
+
+// Close closes the log file
+func (s *fileSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Close()
+}
+
+// sink which sends logs to Loggly
+type logglySink struct {
+	client *loggly.Loggly
+}
+
+// Write sends a log entry
+func (s *logglySink) Write(entry LogEntry) error {
+	return s.client.Log(entry)
+}
+
+// Close does nothing for Loggly
+func (s *logglySink) Close() error {
+	return nil
+}
+
+// sink which writes to syslog
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// Write writes a log entry with its severity
+func (s *syslogSink) Write(entry LogEntry) error {
+	message := entry.Message
+	if entry.Object != nil {
+		if bytes, err := json.Marshal(entry.Object); err == nil {
+			message += " " + string(bytes)
+		}
+	}
+
+	switch entry.Level {
+	case LevelDebug.String():
+		return s.writer.Debug(message)
+	case LevelWarn.String():
+		return s.writer.Warning(message)
+	case LevelError.String():
+		return s.writer.Err(message)
+	}
+
+	return s.writer.Info(message)
+}
+
+// Close closes the connection to syslog
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+// log request from user
+func logRequest(username, fileID string, command CognitiveCommand) {
+	logger.Log(LevelDebug, "Request", struct {
+		Username string           `json:"username"`
+		FileID   string           `json:"file_id"`
+		Command  CognitiveCommand `json:"command"`
+	}{
+		Username: username,
+		FileID:   fileID,
+		Command:  command,
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+// functions for sending texts which are longer than a Telegram message
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for long texts
+const (
+	maxMessageLength = 4096 // max length of a Telegram message
+
+	defaultMaxSplitMessages = 3
+)
+
+// send given text as a message,
+//
+// or split it into messages (up to `max-split-messages`) if it is too long for a message,
+// or send it as a .txt document (with given caption) if it is too long for them
+//
+// (options like inline keyboards are applied only when it is sent as a single message,
+// and returns the id of the first sent message)
+func sendLongText(b Messenger, chatID int64, text, caption string, options map[string]interface{}) (sentMessageID int, err error) {
+	if utf8.RuneCountInString(text) <= maxMessageLength {
+		sent := b.SendMessage(chatID, text, options)
+		if !sent.Ok {
+			return 0, fmt.Errorf("%s", *sent.Description)
+		}
+
+		return sent.Result.MessageID, nil
+	}
+
+	// (replies to the same message, without other options)
+	replyOptions := map[string]interface{}{}
+	if replyTo, exists := options["reply_to_message_id"]; exists {
+		replyOptions["reply_to_message_id"] = replyTo
+	}
+
+	if chunks := splitText(text, maxMessageLength); len(chunks) <= conf().MaxSplitMessages {
+		for _, chunk := range chunks {
+			sent := b.SendMessage(chatID, chunk, replyOptions)
+			if !sent.Ok {
+				return 0, fmt.Errorf("%s", *sent.Description)
+			}
+			if sentMessageID == 0 {
+				sentMessageID = sent.Result.MessageID
+			}
+		}
+
+		return sentMessageID, nil
+	}
+
+	// 'uploading document...'
+	b.SendChatAction(chatID, bot.ChatActionUploadDocument)
+
+	replyOptions["caption"] = caption
+	sent := b.SendDocument(chatID, bot.InputFileFromBytes([]byte(text)), replyOptions)
+	if !sent.Ok {
+		return 0, fmt.Errorf("%s", *sent.Description)
+	}
+
+	return sent.Result.MessageID, nil
+}
+
+// split given text into chunks which are not longer than given length,
+//
+// preferably at line breaks (or spaces, if there is no line break)
+func splitText(text string, length int) (chunks []string) {
+	runes := []rune(text)
+
+	for len(runes) > length {
+		at := length
+		if index := strings.LastIndex(string(runes[:length]), "\n"); index > 0 {
+			at = utf8.RuneCountInString(string(runes[:length])[:index])
+		} else if index := strings.LastIndex(string(runes[:length]), " "); index > 0 {
+			at = utf8.RuneCountInString(string(runes[:length])[:index])
+		}
+
+		if chunk := strings.TrimSpace(string(runes[:at])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = []rune(strings.TrimLeft(string(runes[at:]), "\n "))
+	}
+
+	if chunk := strings.TrimSpace(string(runes)); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
@@ -0,0 +1,162 @@
+package main
+
+// functions for finding celebrity look-alikes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for look-alikes
+const (
+	adminCommandCelebrity = "/celebrity"
+
+	celebrityFaceListID = "celebrities" // (shared by all chats)
+)
+
+func init() {
+	registerCommand(newCommand(LookAlike, "LA", handleLookAlike), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// parse a '/celebrity' command of an admin from given message
+func parseCelebrityCommand(message *bot.Message) (fileID, name string, ok bool) {
+	if message.From == nil || !isAdmin(message.From.ID) {
+		return "", "", false
+	}
+
+	return parseImageCommand(message, adminCommandCelebrity)
+}
+
+// enqueue enrollment of a celebrity with the face on given image
+func processCelebrityCommand(ctx context.Context, b Messenger, message *bot.Message, fileID, name string) {
+	if sent := b.SendMessage(message.Chat.ID, fmt.Sprintf("Enrolling celebrity '%s'...", name), map[string]interface{}{
+		"reply_to_message_id": message.MessageID,
+	}); sent.Ok {
+		if err := enqueueJob(ctx, Job{
+			Kind:      JobKindCelebrity,
+			ChatID:    message.Chat.ID,
+			UserID:    message.From.ID,
+			MessageID: sent.Result.MessageID,
+			FileIDs:   []string{fileID},
+			Command:   LookAlike,
+			Argument:  name,
+		}); err != nil {
+			logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+			b.EditMessageText(messageFailedToEnqueue, map[string]interface{}{
+				"chat_id":    message.Chat.ID,
+				"message_id": sent.Result.MessageID,
+			})
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+	}
+}
+
+// enroll the largest face on given image as a celebrity with given name
+func processCelebrity(b Messenger, chatID int64, messageIDToDelete int, fileURL, name string) {
+	var message string
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout(LookAlike))
+	defer cancel()
+
+	if err := enrollCelebrity(ctx, fileURL, name); err == nil {
+		message = fmt.Sprintf("Enrolled celebrity '%s'.", name)
+	} else {
+		message = fmt.Sprintf("Failed to enroll celebrity '%s': %s", name, err)
+
+		if ctx.Err() == context.DeadlineExceeded {
+			message = fmt.Sprintf(messageTimedOut, adminCommandCelebrity)
+		}
+
+		logger.Error(message)
+	}
+
+	// delete status message, and send the result
+	b.DeleteMessage(chatID, messageIDToDelete)
+	b.SendMessage(chatID, message, nil)
+}
+
+// add the largest face on given image to the celebrity face list (which will be created if needed)
+func enrollCelebrity(ctx context.Context, fileURL, name string) error {
+	imageBytes, err := loadImage(ctx, fileURL)
+	if err != nil {
+		return err
+	}
+
+	faces, err := cognitive.DetectFaces(ctx, imageBytes, false, false, nil)
+	if err != nil {
+		return err
+	}
+	face, exists := largestFace(faces)
+	if !exists {
+		return errors.New("no face detected on this image")
+	}
+
+	if err = cognitive.CreateFaceList(ctx, celebrityFaceListID); err != nil {
+		return err
+	}
+
+	// (name is saved as the user data of the face)
+	_, err = cognitive.AddFaceListFace(ctx, celebrityFaceListID, imageBytes, face.FaceRectangle, name)
+
+	return err
+}
+
+// find the celebrity who looks the most similar to the largest face on given image bytes
+func handleLookAlike(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	faces, err := cognitive.DetectFaces(ctx, imageBytes, true, false, nil)
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	face, exists := largestFace(faces)
+	if !exists {
+		return result, errors.New("No face detected on this image.")
+	}
+
+	// with enrolled celebrities
+	if celebrities, err := cognitive.GetFaceList(ctx, celebrityFaceListID); err == nil && len(celebrities.PersistedFaces) > 0 {
+		names := map[string]string{}
+		for _, f := range celebrities.PersistedFaces {
+			names[f.PersistedFaceID] = f.UserData
+		}
+
+		similars, err := cognitive.FindSimilarFaces(ctx, face.FaceID, celebrityFaceListID, 1, similarModeMatchFace)
+		if err != nil {
+			return result, fmt.Errorf("Failed to find look-alikes: %s", err)
+		}
+		if len(similars) > 0 {
+			if name := names[similars[0].PersistedFaceID]; name != "" {
+				result.Message = fmt.Sprintf("You look like %s! (%.1f%% similar)", name, similars[0].Confidence*100.0)
+
+				return result, nil
+			}
+		}
+	} else if err != nil {
+		// (the list does not exist until any celebrity is enrolled)
+		logger.Debug(fmt.Sprintf("Failed to get celebrity face list: %s", err))
+	}
+
+	// or with Computer Vision's celebrity recognition
+	recognized, err := cognitive.RecognizeCelebrities(ctx, imageBytes)
+	if err != nil {
+		return result, fmt.Errorf("Failed to recognize celebrities: %s", err)
+	}
+	if len(recognized.Result.Celebrities) > 0 {
+		best := recognized.Result.Celebrities[0]
+		for _, c := range recognized.Result.Celebrities[1:] {
+			if c.Confidence > best.Confidence {
+				best = c
+			}
+		}
+		result.Message = fmt.Sprintf("You look like %s! (%.1f%% similar)", best.Name, best.Confidence*100.0)
+
+		return result, nil
+	}
+
+	return result, errors.New("Could not find any look-alike. Maybe you are one of a kind!")
+}
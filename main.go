@@ -1,256 +1,484 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-
-	// for using .ttf
-	"github.com/golang/freetype/truetype"
-
-	// MS Cognitive Services clients
-	cv "github.com/meinside/ms-cognitive-services-go/client/computervision"
-	emotion "github.com/meinside/ms-cognitive-services-go/client/emotion"
-	face "github.com/meinside/ms-cognitive-services-go/client/face"
+	"time"
 
 	// for Telegram bot
 	bot "github.com/meinside/telegram-bot-go"
 
-	// for logging on Loggly
-	"github.com/meinside/loggly-go"
+	// for commands and their registry
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/commands"
+
+	// for config
+	cfg "github.com/meinside/telegram-ms-cognitive-bot/internal/config"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
 )
 
 var client *bot.Bot
-var logger *loggly.Loggly
+var botUsername string
+var logger = newLogger(LevelInfo, &writerSink{file: os.Stdout})
 
 const (
 	appName = "MSCognitiveServicesBot"
 )
 
-// LogglyLog struct
-type LogglyLog struct {
-	Application string      `json:"app"`
-	Severity    string      `json:"severity"`
-	Message     string      `json:"message,omitempty"`
-	Object      interface{} `json:"obj,omitempty"`
-}
-
 // CognitiveCommand type
-type CognitiveCommand string
+type CognitiveCommand = commands.Name
 
-// XXX - First letter of commands should be unique.
+// names of built-in commands (see commands.go for registering them)
 const (
-	Emotion     CognitiveCommand = "Emotion Recognition"
-	Face        CognitiveCommand = "Face Detection"
-	Describe    CognitiveCommand = "Describe This Image"
-	Ocr         CognitiveCommand = "OCR"
-	Handwritten CognitiveCommand = "Handwritten Text Recognition"
-	Tag         CognitiveCommand = "Tag This Image"
+	Emotion  CognitiveCommand = "Emotion Recognition"
+	Face     CognitiveCommand = "Face Detection"
+	Describe CognitiveCommand = "Describe This Image"
+	ReadText CognitiveCommand = "Read Text (Printed/Handwritten)"
+	Tag      CognitiveCommand = "Tag This Image"
 
-	// fun commands
-	CensorEyes CognitiveCommand = "Censor Eyes"
-	MaskFaces  CognitiveCommand = "Mask Faces"
-)
+	AnalyzeEverything CognitiveCommand = "Analyze Everything"
 
-// XXX - When a new command is added, add it here too.
-var allCmds = []CognitiveCommand{
-	Emotion,
-	Face,
-	Describe,
-	Ocr,
-	Handwritten,
-	Tag,
+	// with two photos
+	VerifyFaces CognitiveCommand = "Verify Faces"
 
-	// fun commands
-	CensorEyes,
-	MaskFaces,
-}
-var shortCmdsMap = map[CognitiveCommand]string{}
-var cmdsMap = map[string]CognitiveCommand{}
+	// with persons enrolled in each chat
+	Identify CognitiveCommand = "Identify Persons"
+
+	// with cropped faces
+	ExtractFaces CognitiveCommand = "Extract Faces"
+	FaceCollage  CognitiveCommand = "Face Collage"
+
+	// for headcounts
+	CountFaces CognitiveCommand = "Count Faces"
+
+	// for hiding texts (eg. license plates, emails, or phone numbers)
+	RedactText CognitiveCommand = "Redact Text"
 
-var emotionClient *emotion.Client
-var cvClient *cv.Client
-var faceClient *face.Client
+	// for EXIF metadata (of images sent as documents)
+	ImageInfo     CognitiveCommand = "Image Info"
+	StripMetadata CognitiveCommand = "Strip Metadata"
 
-var font *truetype.Font
+	// with faces on earlier images of each chat
+	FindSimilar CognitiveCommand = "Find Similar Faces"
+
+	// with celebrities enrolled by admins (or recognized by Computer Vision)
+	LookAlike CognitiveCommand = "Who Do I Look Like?"
+
+	// for adult, racy, and gory contents
+	SafetyCheck CognitiveCommand = "Safety Check"
+
+	// with Content Moderator
+	Moderate CognitiveCommand = "Moderate"
+
+	DetectObjects CognitiveCommand = "Detect Objects"
+
+	// with an aspect ratio (see crop.go)
+	SmartCrop CognitiveCommand = "Smart Crop"
+
+	ColorAnalysis CognitiveCommand = "Color Analysis"
+	ImageType     CognitiveCommand = "What Kind of Image Is This?"
+
+	// with Form Recognizer
+	ScanReceipt      CognitiveCommand = "Scan Receipt"
+	ScanBusinessCard CognitiveCommand = "Scan Business Card"
+
+	// with a trained model of Custom Vision
+	CustomModel CognitiveCommand = "Custom Model"
+
+	// for audio
+	Transcribe CognitiveCommand = "Voice Transcription"
+
+	// fun commands
+	CensorEyes   CognitiveCommand = "Censor Eyes"
+	MaskFaces    CognitiveCommand = "Mask Faces"
+	DealWithIt   CognitiveCommand = "Deal With It"
+	EmojifyFaces CognitiveCommand = "Emojify Faces"
+	SmileContest CognitiveCommand = "Who Smiles the Most?"
+)
+
+var db *Database
+var resultCache *ResultCache
+var jobQueue JobQueue                   // (the local database, or redis)
+var requestCounter RequestCounter       // (same as above)
+var coordinator Coordinator             // (nil when running a single instance)
+var callbackTargets CallbackTargetStore // (the local database, or redis)
 
 const (
-	messageActionImage     = "Choose action for this image:"
-	messageUnprocessable   = "Unprocessable message."
-	messageFailedToGetFile = "Failed to get file from the server."
-	messageCanceled        = "Canceled."
-	messageHelp            = `Send any image to this bot, and select one of the following actions:
+	messageActionImage        = "Choose action for this image:"
+	messageActionPDF          = "Choose action for this PDF document:"
+	messageActionAudio        = "Choose action for this audio:"
+	messageActionVideo        = "Choose action for a frame of this video:"
+	messageActionSticker      = "Choose action for this sticker:"
+	messageActionAlbum        = "Choose action for these %d images:"
+	messageRerunImage         = "Run another action on this image:"
+	messageRerunVideo         = "Run another action on a frame of this video:"
+	messageRerunSticker       = "Run another action on this sticker:"
+	messageSendNextImage      = "Send another image for '%s'."
+	messageSendImageFor       = "Send an image for '%s'."
+	messageActionRatio        = "Choose aspect ratio for this image:"
+	messageProcessingImage    = "Processing '%s' on received image..."
+	messageProcessingImages   = "Processing '%s' on received images..."
+	messageProcessingAlbum    = "Processing '%s' on received %d images..."
+	messageProcessingSticker  = "Processing '%s' on received sticker..."
+	messageProcessingVideo    = "Processing '%s' on a frame of received video..."
+	messageProcessingAudio    = "Processing '%s' on received audio..."
+	messageProcessingPDF      = "Processing '%s' on received PDF document..."
+	messageProcessingFaces    = "Processing '%s' on face(s) #%s..."
+	messageDetectingFaces     = "Detecting faces for '%s' on received image..."
+	messageProcessingCommand  = "Processing '%s'..."
+	messageStageDownloading   = "downloading"
+	messageStageCallingAPIs   = "calling APIs"
+	messageStageParallelCalls = "calling %d APIs in parallel"
+	messageStageRendering     = "rendering"
+	messageStageSending       = "sending"
+	messageStageImageOf       = "image %d of %d"
+	messageStagePageOf        = "page %d of %d"
+	messageResultCaption      = "Process result of '%s'"
+	messageAlbumResultCaption = "Image #%d: process result of '%s'"
+	messageLanguage           = "Messages will be shown in '%s'."
+	messageLanguageUsage      = "Usage: /language %s"
+	messageAlbumExpired       = "This album has expired, please send it again."
+	messageKeyboardExpired    = "This keyboard has expired, please send the file again."
+	messageHistory            = "Your last %d analyses in this chat (tap a number to jump to its result):"
+	messageHistoryEmpty       = "Nothing has been analyzed in this chat yet."
+	messageHistoryUsage       = "Usage: /history [1-%d]"
+	messageHistoryHere        = "Here is the result."
+	messageHistoryDeleted     = "The result message no longer exists."
+	messageArchived           = "Archived (link expires in %d hours): %s"
+	messageActionFaces        = "Choose faces for '%s', then apply:"
+	messageFacesExpired       = "This selection has expired, please send the image again."
+	messageNoFaceSelected     = "Choose at least one face."
+	messageUnprocessable      = "Unprocessable message."
+	messageUnknownCommand     = "Unknown command. Send /help for how to use this bot."
+	messageFailedToGetFile    = "Failed to get file from the server."
+	messageFailedToEnqueue    = "Failed to queue the request, please try again later."
+	messageSomethingWrong     = "Something went wrong, please try again later."
+	messageCanceled           = "Canceled."
+	messageTimedOut           = "Timed out while processing '%s', please try again later."
+	messageImageTooLarge      = "This image is too large (%dx%d). Images up to %d pixels in width and height, and %d megapixels are accepted."
+	messageUnsupportedSticker = "Only static stickers are supported."
+	messageQuotaExceeded      = "Quota exceeded, please try again at %s."
+	messageNotAllowed         = "Sorry, you are not allowed to use this bot."
+	messageNoDatabase         = "Database is not available."
+	messageExported           = "Data stored about you (send %s to delete them)"
+	messageExportFailed       = "Failed to export data: %s"
+	messageExportNotSent      = "Failed to send exported data: %s"
+	messageForgetMeConfirm    = "This will delete your requests, history, preferences, queued jobs, and cached or archived results stored in this bot,\nand faces enrolled in the private chat with this bot.\n\nSend '%s %s' to continue."
+	messageForgetMeFailed     = "Failed to delete your data: %s"
+	messageFacesNotForgotten  = "Deleted your data, but failed to delete enrolled faces: %s"
+	messageForgotten          = "Deleted your data."
+	messageHelp               = `Send any image to this bot, and select one of the following actions:
 
 - Emotion Recognition
 - Face Detection
+- Extract Faces (as an album)
+- Face Collage
+- Count Faces
 - Describe This Image
-- OCR
-- Handwritten Text Recognition
+- Read Text (Printed/Handwritten)
+- Redact Text
+- Image Info
+- Strip Metadata
 - Tag This Image
+- Detect Objects
+- Smart Crop (1:1, 16:9, or 4:3)
+- Color Analysis
+- What Kind of Image Is This? (clip art or line drawing)
+- Scan Receipt
+- Scan Business Card
+- Custom Model (with your own Custom Vision project)
+- Analyze Everything
+- Verify Faces (with another image)
+- Identify Persons
+- Find Similar Faces (on earlier images of the chat)
+- Who Do I Look Like? (among celebrities)
+- Safety Check
+- Moderate
 - Censor Eyes
 - Mask Faces
+- Deal With It
+- Emojify Faces
+- Who Smiles the Most?
 
 then it will send the result message and/or image back to you.
 
+Send /documents on (or off) for receiving result images as documents,
+which will not be recompressed by Telegram.
+
+Send /format png (or jpeg, webp) for the format of result documents,
+and /quality <1-100> for the quality of JPEG and WebP images.
+
+Send /default <action> (eg. /default Face Detection) for processing images with it right away,
+and /settings for your current settings.
+
+Or, send an image with an action in its caption (eg. ocr, faces, or describe in Spanish).
+
+Send /remember <name> in the caption of an image (or in a reply to an image)
+for enrolling the face on it, then Identify Persons will label it with the name.
+
+Send /language for choosing the language of messages.
+
+Static stickers can also be sent for Describe, Tag, and Face Detection,
+animations and videos for processing their representative frames,
+PDF documents for reading texts,
+and voice messages or audio files for transcription.
+
+In group chats, mention this bot in the caption of an image,
+or reply to an image with a command.
+
 * Github: https://github.com/meinside/telegram-ms-cognitive-bot
 `
 
 	commandCancel = "cancel"
-
-	fontFilepath = "fonts/RobotoCondensed-Regular.ttf"
 )
 
 const (
 	configFilename = "config.json"
-)
 
-// Config struct
-type Config struct {
-	TelegramAPIToken                string `json:"telegram-api-token"`
-	TelegramMonitorIntervalSeconds  int    `json:"telegram-monitor-interval-seconds"`
-	MsEmotionSubscriptionKey        string `json:"ms-emotion-subscription-key"`
-	MsComputervisionSubscriptionKey string `json:"ms-computervision-subscription-key"`
-	MsFaceSubscriptionKey           string `json:"ms-face-subscription-key"`
-	LogglyToken                     string `json:"loggly-token,omitempty"`
-	IsVerbose                       bool   `json:"is-verbose"`
-}
+	defaultWebhookPort = 443
+	defaultDbFilepath  = "db.sqlite"
 
-var conf Config
+	defaultCacheTTLSeconds = 60 * 60 // 1 hour
+	defaultTimeoutSeconds  = 60
+)
 
-func init() {
-	// read from config file
-	if file, err := ioutil.ReadFile(configFilename); err != nil {
-		panic(err)
-	} else {
-		if err := json.Unmarshal(file, &conf); err != nil {
+// Config struct (see internal/config)
+type Config = cfg.Config
+
+// setup with config at given filepath
+//
+// (`diagnosticsPort` overrides the one in the config when it is positive)
+func setup(configFilepath string, diagnosticsPort int) {
+	// read from config file and environment variables, and load resources with it
+	if config, err := loadConfig(configFilepath); err == nil {
+		if diagnosticsPort > 0 {
+			config.DiagnosticsListenPort = diagnosticsPort
+		}
+
+		if s, err := loadSnapshot(&config); err == nil {
+			current.Store(s)
+		} else {
 			panic(err)
 		}
+	} else {
+		panic(err)
 	}
 
-	// check values
-	if conf.TelegramMonitorIntervalSeconds <= 0 {
-		conf.TelegramMonitorIntervalSeconds = 1
-	}
+	// result cache
+	resultCache = storage.NewResultCache(conf().CacheSize, time.Duration(conf().CacheTTLSeconds)*time.Second)
 
-	// ms cognitive services
-	emotionClient = emotion.NewClient(conf.MsEmotionSubscriptionKey)
-	cvClient = cv.NewClient(conf.MsComputervisionSubscriptionKey)
-	faceClient = face.NewClient(conf.MsFaceSubscriptionKey)
-	var firstLetter string
-	for _, c := range allCmds {
-		firstLetter = string(string(c)[0])
+	// local database
+	if database, err := storage.OpenDb(conf().DbFilepath); err == nil {
+		db = database
 
-		shortCmdsMap[c] = firstLetter
-		cmdsMap[firstLetter] = c
+		if conf().CachePersistent {
+			resultCache.SetStore(db, logCacheError)
+		}
+	} else {
+		panic(err)
+	}
+
+	// shared states between multiple instances (result cache, quotas, and job queue)
+	jobQueue, requestCounter, callbackTargets = db, db, db
+	if conf().StorageBackend == storage.BackendRedis {
+		if store, err := storage.NewRedisStore(conf().RedisURL, conf().RedisKeyPrefix, jobLeaseTTL); err == nil {
+			jobQueue, requestCounter, coordinator, callbackTargets = store, store, store, store
+			resultCache.SetStore(store, logCacheError)
+		} else {
+			panic(err)
+		}
 	}
 
 	// telegram
-	client = bot.NewClient(conf.TelegramAPIToken)
-	client.Verbose = conf.IsVerbose
+	client = bot.NewClient(conf().TelegramAPIToken)
+	client.Verbose = conf().IsVerbose
 
-	// loggly
-	if conf.LogglyToken != "" {
-		logger = loggly.New(conf.LogglyToken)
+	// logger
+	if l, err := newConfiguredLogger(*conf()); err == nil {
+		logger.Replace(l)
+	} else {
+		panic(err)
 	}
 
 	// others
-	if bytes, err := ioutil.ReadFile(fontFilepath); err == nil {
-		if f, err := truetype.Parse(bytes); err == nil {
-			font = f
-		} else {
-			panic(err)
-		}
+	if e, err := loadEmojis(); err == nil {
+		emojis = e
 	} else {
 		panic(err)
 	}
 }
 
 func main() {
+	configFilepath := flag.String("config", configFilename, "path of the config file")
+	diagnosticsPort := flag.Int("diagnostics-port", 0, "port of pprof and runtime diagnostics (overrides diagnostics-listen-port)")
+	flag.Parse()
+
+	setup(*configFilepath, *diagnosticsPort)
+
 	// catch SIGINT and SIGTERM and terminate gracefully
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sig
+
+		if db != nil {
+			saveUpdateIDs()
+			db.Close()
+		}
+		logger.Close()
+
 		os.Exit(1)
 	}()
 
+	// catch SIGHUP and reload config
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloadConfig(*configFilepath); err == nil {
+				logger.Info(fmt.Sprintf("Reloaded config from %s", *configFilepath))
+			} else {
+				logger.Error(fmt.Sprintf("Failed to reload config: %s", err))
+			}
+		}
+	}()
+
 	// get info about this bot
 	if me := client.GetMe(); me.Ok {
-		logMessage(fmt.Sprintf("Starting bot: @%s (%s)", *me.Result.Username, me.Result.FirstName))
-
-		// delete webhook (getting updates will not work when wehbook is set up)
-		if unhooked := client.DeleteWebhook(); unhooked.Ok {
-			// wait for new updates
-			client.StartMonitoringUpdates(
-				0,
-				conf.TelegramMonitorIntervalSeconds,
-				func(b *bot.Bot, update bot.Update, err error) {
-					if err == nil {
-						if update.HasMessage() {
-							processUpdate(b, update) // process message
-						} else if update.HasCallbackQuery() {
-							processCallbackQuery(b, update) // process callback query
-						} else {
-							logError("Update not processable")
-						}
-					} else {
-						logError(fmt.Sprintf("Error while receiving update (%s)", err))
-					}
-				},
-			)
+		botUsername = *me.Result.Username
+
+		logger.Info(fmt.Sprintf("Starting bot: @%s (%s)", botUsername, me.Result.FirstName))
+
+		// register commands for the command menu
+		if registered := client.SetMyCommands(botCommands(), nil); !registered.Ok {
+			logger.Warn("Failed to register commands for the command menu")
+		}
+
+		// start workers for queued jobs
+		startWorkers(client, conf().MaxConcurrentJobs)
+
+		// expire old inline keyboards
+		startExpiringPrompts(client)
+
+		// send daily summaries to admins
+		startDailySummary(client)
+
+		// export traces of updates
+		startTracing()
+
+		// serve HTTP API for other tools
+		startAPIServer()
+
+		// serve pprof and runtime diagnostics for admins
+		startDiagnosticsServer()
+
+		// (for skipping updates which were already processed before a restart)
+		offset := loadLastUpdateID()
+		startSavingUpdateIDs()
+
+		if conf().WebhookHost != "" {
+			// set webhook and wait for new updates
+			if err := setWebhookWithSecretToken(conf().WebhookHost, conf().WebhookPort, conf().WebhookCertFilepath); err == nil {
+				startWebhookServer(client, handleUpdate)
+			} else {
+				panic(fmt.Sprintf("Failed to set webhook: %s", err))
+			}
 		} else {
-			panic("Failed to delete webhook")
+			// (only one instance can get updates with polling)
+			if coordinator != nil {
+				logger.Warn("Updates cannot be shared by multiple instances in polling mode, use webhook mode instead")
+			}
+
+			// delete webhook (getting updates will not work when wehbook is set up)
+			if unhooked := client.DeleteWebhook(); unhooked.Ok {
+				// wait for new updates (after the last processed one)
+				client.StartMonitoringUpdates(
+					offset,
+					conf().TelegramMonitorIntervalSeconds,
+					handleUpdate,
+				)
+			} else {
+				panic("Failed to delete webhook")
+			}
 		}
 	} else {
 		panic("Failed to get info of the bot")
 	}
 }
 
-// log message
-func logMessage(message string) {
-	log.Println(message)
+// handle update from Telegram (both from polling and webhook)
+func handleUpdate(b *bot.Bot, update bot.Update, err error) {
+	if err == nil {
+		if isDuplicatedUpdate(update) {
+			return
+		}
 
-	if logger != nil {
-		logger.Log(LogglyLog{
-			Application: appName,
-			Severity:    "Log",
-			Message:     message,
-		})
-	}
-}
+		ctx, span := startSpan(context.Background(), "telegram update", spanKindServer)
+		span.setAttribute("telegram.update_id", update.UpdateID)
+		defer span.finish(nil)
 
-// log error message
-func logError(message string) {
-	log.Println(message)
+		// (keep receiving updates even if processing this one panics)
+		defer recoverUpdate(b, update)
 
-	if logger != nil {
-		logger.Log(LogglyLog{
-			Application: appName,
-			Severity:    "Error",
-			Message:     message,
-		})
+		if update.HasMessage() {
+			processUpdate(ctx, b, update) // process message
+		} else if update.HasCallbackQuery() {
+			processCallbackQuery(ctx, b, update) // process callback query
+		} else {
+			logger.Error("Update not processable")
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Error while receiving update (%s)", err))
 	}
 }
 
-// log request from user
-func logRequest(username, fileURL string, command CognitiveCommand) {
-	if logger != nil {
-		logger.Log(LogglyLog{
-			Application: appName,
-			Severity:    "Verbose",
-			Object: struct {
-				Username string           `json:"username"`
-				FileURL  string           `json:"file_url"`
-				Command  CognitiveCommand `json:"command"`
-			}{
-				Username: username,
-				FileURL:  fileURL,
-				Command:  command,
-			},
-		})
+// start webhook server and wait for new updates
+//
+// if cert and key files are not given, it will serve plain HTTP
+// (for running behind a reverse proxy which terminates TLS)
+func startWebhookServer(b *bot.Bot, handler func(b *bot.Bot, update bot.Update, err error)) {
+	// (not the default mux, which may have handlers of other packages)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// (reject updates which are not from Telegram)
+		if !isValidWebhookRequest(r) {
+			logger.Warn(fmt.Sprintf("Rejected a webhook request without the secret token from %s", r.RemoteAddr))
+
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update bot.Update
+		err := json.NewDecoder(r.Body).Decode(&update)
+		r.Body.Close()
+
+		handler(b, update, err)
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	addr := fmt.Sprintf(":%d", conf().WebhookListenPort)
+
+	logger.Info(fmt.Sprintf("Starting webhook server on %s", addr))
+
+	var err error
+	if conf().WebhookCertFilepath != "" && conf().WebhookKeyFilepath != "" {
+		err = http.ListenAndServeTLS(addr, conf().WebhookCertFilepath, conf().WebhookKeyFilepath, mux)
+	} else {
+		err = http.ListenAndServe(addr, mux)
 	}
+
+	panic(err)
 }
@@ -0,0 +1,265 @@
+package main
+
+// functions for moderating images and their texts with Content Moderator
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for Content Moderator
+const (
+	contentModeratorPath = "/contentmoderator/moderate/v1.0"
+)
+
+func init() {
+	registerCommand(newCommand(Moderate, "MD", handleModerate), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+}
+
+// ImageModerationResult struct for the result of image evaluation
+type ImageModerationResult struct {
+	AdultClassificationScore float64 `json:"AdultClassificationScore"`
+	IsImageAdultClassified   bool    `json:"IsImageAdultClassified"`
+	RacyClassificationScore  float64 `json:"RacyClassificationScore"`
+	IsImageRacyClassified    bool    `json:"IsImageRacyClassified"`
+}
+
+// TextModerationResult struct for the result of text screening
+type TextModerationResult struct {
+	Terms []struct {
+		Term string `json:"Term"`
+	} `json:"Terms"`
+	PII struct {
+		Email []struct {
+			Text string `json:"Text"`
+		} `json:"Email"`
+		Phone []struct {
+			Text string `json:"Text"`
+		} `json:"Phone"`
+		Address []struct {
+			Text string `json:"Text"`
+		} `json:"Address"`
+		IPA []struct {
+			Text string `json:"Text"`
+		} `json:"IPA"`
+	} `json:"PII"`
+	Classification struct {
+		Category1 struct {
+			Score float64 `json:"Score"`
+		} `json:"Category1"` // sexually explicit
+		Category2 struct {
+			Score float64 `json:"Score"`
+		} `json:"Category2"` // sexually suggestive
+		Category3 struct {
+			Score float64 `json:"Score"`
+		} `json:"Category3"` // offensive
+		ReviewRecommended bool `json:"ReviewRecommended"`
+	} `json:"Classification"`
+}
+
+// ModerationResult struct for the combined result of moderating an image and its text
+type ModerationResult struct {
+	Image ImageModerationResult
+	Text  string   // recognized text
+	Terms []string // profane terms in the text
+	PII   []string // personally identifiable information in the text
+
+	TextScores        [3]float64 // sexually explicit, sexually suggestive, and offensive
+	ReviewRecommended bool
+}
+
+// check if moderation of given result is needed
+func (r ModerationResult) flagged() bool {
+	return r.Image.IsImageAdultClassified || r.Image.IsImageRacyClassified || len(r.Terms) > 0 || len(r.PII) > 0 || r.ReviewRecommended
+}
+
+// base url of Content Moderator API
+func contentModeratorAPIURL() string {
+	return serviceAPIURL(conf().MsContentModeratorEndpoint, conf().MsContentModeratorRegion, contentModeratorPath)
+}
+
+// evaluate given image bytes
+func evaluateImage(ctx context.Context, image []byte) (result ImageModerationResult, err error) {
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/ProcessImage/Evaluate", contentModeratorAPIURL()),
+		conf().MsContentModeratorSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result, err
+}
+
+// recognize text on given image bytes
+func ocrForModeration(ctx context.Context, image []byte) (text string, err error) {
+	var result struct {
+		Text string `json:"Text"`
+	}
+
+	err = postImageBytes(
+		ctx,
+		fmt.Sprintf("%s/ProcessImage/OCR?language=eng", contentModeratorAPIURL()),
+		conf().MsContentModeratorSubscriptionKey,
+		image,
+		&result,
+	)
+
+	return result.Text, err
+}
+
+// screen given text for profanity, PII, and classification
+func screenText(ctx context.Context, text string) (result TextModerationResult, err error) {
+	params := url.Values{}
+	params.Set("classify", "True")
+	params.Set("PII", "True")
+
+	err = postBytes(
+		ctx,
+		fmt.Sprintf("%s/ProcessText/Screen?%s", contentModeratorAPIURL(), params.Encode()),
+		conf().MsContentModeratorSubscriptionKey,
+		"text/plain",
+		[]byte(text),
+		&result,
+	)
+
+	return result, err
+}
+
+// moderate given image bytes, and the text on it
+func moderateImage(ctx context.Context, image []byte) (result ModerationResult, err error) {
+	if result.Image, err = evaluateImage(ctx, image); err != nil {
+		return result, err
+	}
+
+	if result.Text, err = ocrForModeration(ctx, image); err != nil {
+		return result, err
+	}
+	if strings.TrimSpace(result.Text) == "" {
+		return result, nil
+	}
+
+	var screened TextModerationResult
+	if screened, err = screenText(ctx, result.Text); err != nil {
+		return result, err
+	}
+	for _, t := range screened.Terms {
+		result.Terms = append(result.Terms, t.Term)
+	}
+	for _, p := range screened.PII.Email {
+		result.PII = append(result.PII, fmt.Sprintf("email (%s)", p.Text))
+	}
+	for _, p := range screened.PII.Phone {
+		result.PII = append(result.PII, fmt.Sprintf("phone (%s)", p.Text))
+	}
+	for _, p := range screened.PII.Address {
+		result.PII = append(result.PII, fmt.Sprintf("address (%s)", p.Text))
+	}
+	for _, p := range screened.PII.IPA {
+		result.PII = append(result.PII, fmt.Sprintf("ip address (%s)", p.Text))
+	}
+	result.TextScores = [3]float64{
+		screened.Classification.Category1.Score,
+		screened.Classification.Category2.Score,
+		screened.Classification.Category3.Score,
+	}
+	result.ReviewRecommended = screened.Classification.ReviewRecommended
+
+	return result, nil
+}
+
+// moderate given image bytes and its text
+func handleModerate(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	moderated, err := cognitive.Moderate(ctx, imageBytes)
+	if err != nil {
+		return result, fmt.Errorf("Failed to moderate image: %s", err)
+	}
+
+	result.Message = strings.Join(moderationReport(moderated), "\n")
+
+	return result, nil
+}
+
+// lines of report for a moderation result
+func moderationReport(r ModerationResult) []string {
+	mark := func(flagged bool) string {
+		if flagged {
+			return "⚠️"
+		}
+		return "✅"
+	}
+
+	lines := []string{
+		"[Image]",
+		fmt.Sprintf("%s Adult: %.3f%%", mark(r.Image.IsImageAdultClassified), r.Image.AdultClassificationScore*100.0),
+		fmt.Sprintf("%s Racy: %.3f%%", mark(r.Image.IsImageRacyClassified), r.Image.RacyClassificationScore*100.0),
+	}
+
+	if strings.TrimSpace(r.Text) == "" {
+		return append(lines, "", "[Text]", "(no text)")
+	}
+
+	lines = append(lines, "", "[Text]")
+	if len(r.Terms) > 0 {
+		lines = append(lines, fmt.Sprintf("⚠️ Profanity: %s", strings.Join(r.Terms, ", ")))
+	} else {
+		lines = append(lines, "✅ Profanity: none")
+	}
+	if len(r.PII) > 0 {
+		lines = append(lines, fmt.Sprintf("⚠️ PII: %s", strings.Join(r.PII, ", ")))
+	} else {
+		lines = append(lines, "✅ PII: none")
+	}
+	lines = append(lines,
+		fmt.Sprintf("%s Review recommended", mark(r.ReviewRecommended)),
+		fmt.Sprintf("  Sexually explicit: %.3f%%", r.TextScores[0]*100.0),
+		fmt.Sprintf("  Sexually suggestive: %.3f%%", r.TextScores[1]*100.0),
+		fmt.Sprintf("  Offensive: %.3f%%", r.TextScores[2]*100.0),
+	)
+
+	return lines
+}
+
+// check if images in given chat should be moderated automatically
+func isModerationChat(chatID int64) bool {
+	for _, id := range conf().ModerationChatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// moderate given image automatically, and reply with a spoiler-marked warning if it is flagged
+func processModerationWarning(b Messenger, chatID int64, messageID int, fileURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout(Moderate))
+	defer cancel()
+
+	imageBytes, err := loadImage(ctx, fileURL)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to download image for moderation: %s", err))
+		return
+	}
+
+	if moderated, err := cognitive.Moderate(ctx, imageBytes); err == nil {
+		if moderated.flagged() {
+			warning := fmt.Sprintf("⚠️ This image may need moderation:\n<tg-spoiler>%s</tg-spoiler>", html.EscapeString(strings.Join(moderationReport(moderated), "\n")))
+
+			if sent := b.SendMessage(chatID, warning, map[string]interface{}{
+				"reply_to_message_id": messageID,
+				"parse_mode":          bot.ParseModeHTML,
+			}); !sent.Ok {
+				logger.Error(fmt.Sprintf("Failed to send moderation warning: %s", *sent.Description))
+			}
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to moderate image: %s", err))
+	}
+}
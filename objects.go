@@ -0,0 +1,69 @@
+package main
+
+// functions for detecting objects on images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+)
+
+func init() {
+	registerCommand(newCommand(DetectObjects, "O", handleDetectObjects), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// detect objects on given image bytes, and draw labeled rectangles on them
+func handleDetectObjects(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := visionFor(DetectObjects).Analyze(ctx, imageBytes, []string{"Objects"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect objects: %s", err)
+	}
+	if len(analyzed.Objects) <= 0 {
+		return result, errors.New("No object detected on this image.")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+	strs := []string{}
+	for i, o := range analyzed.Objects {
+		rect := o.Rectangle.toRectangle()
+
+		// set color
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		fc.SetSrc(&image.Uniform{color})
+
+		// draw rectangles and names on detected objects
+		drawRectangle(gc, rect)
+		drawLabel(fc, fmt.Sprintf("#%d %s", i+1, o.Object), rect, fontSize)
+
+		strs = append(strs, fmt.Sprintf("[Object #%d] %s (%.3f%%)%s", i+1, o.Object, o.Confidence*100.0, objectParents(o.Parent)))
+	}
+	gc.Save()
+
+	result.Message = strings.Join(strs, "\n")
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// string representation of parent objects (eg. " < mammal < animal")
+func objectParents(parent *ObjectParent) string {
+	str := ""
+	for p := parent; p != nil; p = p.Parent {
+		str += fmt.Sprintf(" < %s", p.Object)
+	}
+
+	return str
+}
@@ -0,0 +1,172 @@
+package main
+
+// functions for correcting orientations of images (with EXIF and angles of recognized texts)
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	// for image manipulation
+	"github.com/disintegration/gift"
+)
+
+// constants for orientations
+const (
+	exifTagOrientation = 0x0112
+
+	minDeskewAngle = 3.0 // in degrees, texts tilted less than this will not be deskewed
+)
+
+// commands which need original image bytes (eg. for reading EXIF), so their images are not corrected
+var originalImageCommands = map[CognitiveCommand]bool{}
+
+// rotate or flip given image bytes to be upright with its EXIF orientation, unless given command needs the original one
+func uprightImageFor(imageBytes []byte, command CognitiveCommand) []byte {
+	if originalImageCommands[command] {
+		return imageBytes
+	}
+
+	return uprightImage(imageBytes)
+}
+
+// rotate or flip given image bytes to be upright with its EXIF orientation
+//
+// (returns given bytes as they are if there is nothing to correct, or failed)
+func uprightImage(imageBytes []byte) []byte {
+	orientation := exifOrientation(imageBytes)
+	if orientation <= 1 || orientation > 8 {
+		return imageBytes
+	}
+
+	if corrected, err := applyFilter(imageBytes, orientationFilter(orientation)); err == nil {
+		return corrected
+	} else {
+		logger.Warn(fmt.Sprintf("Failed to correct orientation (%d) of image: %s", orientation, err))
+	}
+
+	return imageBytes
+}
+
+// rotate given image bytes counter-clockwise with the (clockwise) angle of recognized texts
+func deskewImage(imageBytes []byte, angle float64) ([]byte, error) {
+	return applyFilter(imageBytes, gift.Rotate(float32(angle), color.White, gift.CubicInterpolation))
+}
+
+// check if texts tilted with given angle should be deskewed
+func needsDeskew(angle float64) bool {
+	return math.Abs(angle) >= minDeskewAngle
+}
+
+// apply a filter to given image bytes, and return the encoded result
+func applyFilter(imageBytes []byte, filter gift.Filter) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	g := gift.New(filter)
+	dst := image.NewRGBA(g.Bounds(img.Bounds()))
+	g.Draw(dst, img)
+
+	return encodeImage(dst)
+}
+
+// filter for correcting given EXIF orientation
+func orientationFilter(orientation int) gift.Filter {
+	switch orientation {
+	case 2:
+		return gift.FlipHorizontal()
+	case 3:
+		return gift.Rotate180()
+	case 4:
+		return gift.FlipVertical()
+	case 5:
+		return gift.Transpose()
+	case 6:
+		return gift.Rotate270()
+	case 7:
+		return gift.Transverse()
+	case 8:
+		return gift.Rotate90()
+	}
+
+	return nil
+}
+
+// read EXIF orientation (1-8) from given JPEG bytes
+//
+// (returns 0 if there is no orientation)
+func exifOrientation(data []byte) int {
+	return tiffOrientation(exifTIFF(data))
+}
+
+// find EXIF (TIFF bytes) in the APP1 segment of given JPEG bytes
+//
+// (returns nil if there is no EXIF)
+func exifTIFF(data []byte) []byte {
+	// SOI
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	// find APP1 segment with EXIF
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) { // start of scan, or malformed
+			return nil
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:]
+		}
+
+		i += 2 + length
+	}
+
+	return nil
+}
+
+// read orientation from the first IFD of given TIFF bytes
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+
+		if order.Uint16(tiff[entry:]) == exifTagOrientation {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 0
+}
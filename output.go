@@ -0,0 +1,117 @@
+package main
+
+// functions for encoding result images in the output format of each user
+//
+// (result images are generated as PNG, and converted when they are sent)
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// constants for output formats
+const (
+	outputFormatPNG  = "png"
+	outputFormatJPEG = "jpeg"
+	outputFormatWebP = "webp"
+
+	defaultJPEGQuality = 90
+
+	webpEncoderCommand = "cwebp" // in webp
+)
+
+// check if given output format is supported
+func isValidOutputFormat(format string) bool {
+	switch format {
+	case outputFormatPNG, outputFormatJPEG, outputFormatWebP:
+		return true
+	}
+
+	return false
+}
+
+// check if given JPEG quality is valid
+func isValidJPEGQuality(quality int) bool {
+	return quality >= 1 && quality <= 100
+}
+
+// output format of result documents for given user
+func outputFormatFor(userID int) string {
+	if format := getPreference(userID, preferenceOutputFormat); isValidOutputFormat(format) {
+		return format
+	}
+
+	return conf().OutputFormat
+}
+
+// quality of JPEG (and WebP) images for given user
+func jpegQualityFor(userID int) int {
+	if quality, err := strconv.Atoi(getPreference(userID, preferenceJPEGQuality)); err == nil && isValidJPEGQuality(quality) {
+		return quality
+	}
+
+	return conf().JPEGQuality
+}
+
+// convert given encoded image to given output format
+func convertToFormat(encoded []byte, format string, quality int) ([]byte, error) {
+	switch format {
+	case outputFormatJPEG:
+		return convertToJPEG(encoded, quality)
+	case outputFormatWebP:
+		return convertToWebP(encoded, quality)
+	}
+
+	// (PNG or JPEG, as they were generated)
+	return encoded, nil
+}
+
+// convert given encoded image to JPEG with given quality
+func convertToJPEG(encoded []byte, quality int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	return imaging.EncodeWithPool(func(w io.Writer) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	})
+}
+
+// convert given encoded image to WebP with an external command
+func convertToWebP(encoded []byte, quality int) (converted []byte, err error) {
+	var dir string
+	if dir, err = ioutil.TempDir("", "webp"); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inputFilepath := filepath.Join(dir, "input")
+	outputFilepath := filepath.Join(dir, "output.webp")
+	if err = ioutil.WriteFile(inputFilepath, encoded, 0644); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(webpEncoderCommand, "-quiet", "-q", strconv.Itoa(quality), inputFilepath, "-o", outputFilepath)
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to convert image to WebP: %s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ioutil.ReadFile(outputFilepath)
+}
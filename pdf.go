@@ -0,0 +1,202 @@
+package main
+
+// functions for processing PDF documents
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for PDF documents
+const (
+	pdfMimeType          = "application/pdf"
+	pdfRasterizerCommand = "pdftoppm" // from poppler-utils
+	pdfRasterizeDPI      = 150
+	pdfMaxPages          = 20
+)
+
+// process requested PDF document processing
+func processPDF(b Messenger, chatID int64, userID int, messageIDToDelete int, fileURL string, command CognitiveCommand) {
+	errorMessage := ""
+
+	// edit the status message with progress periodically
+	progress := startProgress(b, chatID, messageIDToDelete, userID, command)
+
+	ctx, cancel := context.WithTimeout(withProgress(jobContext(chatID, messageIDToDelete), progress), commandTimeout(command))
+	defer cancel()
+
+	// 'typing...'
+	b.SendChatAction(chatID, bot.ChatActionTyping)
+
+	switch command {
+	case ReadText:
+		if pages, err := rasterizePDF(ctx, fileURL); err == nil {
+			texts := []string{}
+			for i, page := range pages {
+				progress.setStage(fmt.Sprintf(localizeFor(userID, messageStagePageOf), i+1, len(pages)))
+
+				if recognized, err := cognitive.Read(ctx, page, nil); err == nil {
+					texts = append(texts, fmt.Sprintf("[Page #%d]\n%s", i+1, recognized.Text()))
+				} else {
+					logger.Error(fmt.Sprintf("Failed to recognize text of page #%d: %s", i+1, err))
+
+					texts = append(texts, fmt.Sprintf("[Page #%d]\n(failed to recognize text)", i+1))
+				}
+			}
+			// send recognized text (split, or as a .txt file if it is too long)
+			text := strings.Join(texts, "\n\n")
+			if sentMessageID, err := sendLongText(b, chatID, text, fmt.Sprintf(localizeFor(userID, messageResultCaption), command), nil); err == nil {
+				saveHistory(chatID, userID, sentMessageID, command, text)
+				publishResult(b, chatID, userID, sentMessageID, command, ProcessResult{Message: text})
+			} else {
+				errorMessage = fmt.Sprintf("Failed to send recognized text: %s", err)
+			}
+		} else {
+			errorMessage = fmt.Sprintf("Failed to rasterize PDF document: %s", err)
+		}
+	case ImageType:
+		// classify each page
+		if pages, err := rasterizePDF(ctx, fileURL); err == nil {
+			reports := []string{}
+			for i, page := range pages {
+				progress.setStage(fmt.Sprintf(localizeFor(userID, messageStagePageOf), i+1, len(pages)))
+
+				if result, err := runCommand(ctx, page, command, nil); err == nil {
+					reports = append(reports, fmt.Sprintf("[Page #%d]\n%s", i+1, result.Message))
+				} else {
+					logger.Error(fmt.Sprintf("Failed to process page #%d: %s", i+1, err))
+
+					reports = append(reports, fmt.Sprintf("[Page #%d]\n(%s)", i+1, err))
+				}
+			}
+
+			text := strings.Join(reports, "\n\n")
+			if sentMessageID, err := sendLongText(b, chatID, text, fmt.Sprintf(localizeFor(userID, messageResultCaption), command), nil); err == nil {
+				saveHistory(chatID, userID, sentMessageID, command, text)
+				publishResult(b, chatID, userID, sentMessageID, command, ProcessResult{Message: text})
+			} else {
+				errorMessage = fmt.Sprintf("Failed to send result message: %s", err)
+			}
+		} else {
+			errorMessage = fmt.Sprintf("Failed to rasterize PDF document: %s", err)
+		}
+	default:
+		errorMessage = fmt.Sprintf("Command not supported for PDF documents: %s", command)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), command)
+	} else if isCanceled(ctx) {
+		errorMessage = messageCanceled
+	}
+
+	progress.stop()
+
+	// delete original message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// if there was any error, send it back
+	if errorMessage != "" {
+		b.SendMessage(chatID, localizeFor(userID, errorMessage), nil)
+
+		logJobError(errorMessage, chatID, userID, command, "")
+	}
+}
+
+// download PDF document from given url and rasterize its pages into PNG images
+func rasterizePDF(ctx context.Context, fileURL string) (pages [][]byte, err error) {
+	var dir string
+	if dir, err = ioutil.TempDir("", "pdf"); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// download PDF document
+	pdfFilepath := filepath.Join(dir, "document.pdf")
+	if err = downloadFile(ctx, fileURL, pdfFilepath); err != nil {
+		return nil, err
+	}
+
+	// rasterize pages (page-1.png, page-2.png, ...)
+	if output, err := exec.CommandContext(
+		ctx,
+		pdfRasterizerCommand,
+		"-png",
+		"-r", fmt.Sprintf("%d", pdfRasterizeDPI),
+		"-l", fmt.Sprintf("%d", pdfMaxPages),
+		pdfFilepath,
+		filepath.Join(dir, "page"),
+	).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s (%s)", err, strings.TrimSpace(string(output)))
+	}
+
+	// read rasterized pages in order
+	var filepaths []string
+	if filepaths, err = filepath.Glob(filepath.Join(dir, "page-*.png")); err != nil {
+		return nil, err
+	}
+	sort.Slice(filepaths, func(i, j int) bool {
+		if len(filepaths[i]) == len(filepaths[j]) {
+			return filepaths[i] < filepaths[j]
+		}
+		return len(filepaths[i]) < len(filepaths[j]) // page-2.png < page-10.png
+	})
+	for _, fp := range filepaths {
+		var bytes []byte
+		if bytes, err = ioutil.ReadFile(fp); err != nil {
+			return nil, err
+		}
+		if err = checkImageLimits(bytes); err != nil {
+			return nil, err
+		}
+		pages = append(pages, bytes)
+	}
+
+	if len(pages) <= 0 {
+		return nil, fmt.Errorf("no page was rasterized")
+	}
+
+	return pages, nil
+}
+
+// download file from given url to given filepath
+func downloadFile(ctx context.Context, fileURL, filepath string) (err error) {
+	_, span := startSpan(ctx, "telegram download", spanKindClient)
+	defer func() { span.finish(err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := telegramHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+
+	return err
+}
@@ -0,0 +1,232 @@
+package main
+
+// functions for exporting and deleting data of users (`/export` and `/forgetme`)
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for user data
+const (
+	forgetMeConfirmation = "yes"
+)
+
+// exportedUserData struct for everything stored about a user
+type exportedUserData struct {
+	UserID          int               `json:"userId"`
+	ExportedOn      time.Time         `json:"exportedOn"`
+	Banned          bool              `json:"banned"`
+	Preferences     map[string]string `json:"preferences"`
+	Requests        []exportedRequest `json:"requests"`
+	History         []exportedHistory `json:"history"`
+	Archived        []string          `json:"archived,omitempty"`        // (keys of archived results)
+	EnrolledPersons []string          `json:"enrolledPersons,omitempty"` // (of the private chat with the user)
+}
+
+// exportedRequest struct for a request of a user
+type exportedRequest struct {
+	Username    string           `json:"username,omitempty"`
+	Command     CognitiveCommand `json:"command"`
+	RequestedOn time.Time        `json:"requestedOn"`
+}
+
+// exportedHistory struct for a processed request of a user
+type exportedHistory struct {
+	ChatID      int64            `json:"chatId"`
+	MessageID   int              `json:"messageId"`
+	Command     CognitiveCommand `json:"command"`
+	Summary     string           `json:"summary"`
+	ProcessedOn time.Time        `json:"processedOn"`
+}
+
+// check if given message is `/export`
+//
+// (it is processed separately from other user commands, for it is answered with a document)
+func isExportCommand(message *bot.Message) bool {
+	if message.From == nil || !message.HasText() {
+		return false
+	}
+
+	command, _ := parseCommand(*message.Text)
+
+	return command == userCommandExport
+}
+
+// process `/export`, and send everything stored about the user as a .json document
+func processExportCommand(b Messenger, message *bot.Message) bool {
+	chatID, userID := message.Chat.ID, message.From.ID
+
+	var errorMessage string
+	if db == nil {
+		errorMessage = localizeFor(userID, messageNoDatabase)
+	} else if data, err := exportUserData(userID, isPrivateChatWith(message.Chat, userID)); err != nil {
+		errorMessage = fmt.Sprintf(localizeFor(userID, messageExportFailed), err)
+	} else {
+		// 'uploading document...'
+		b.SendChatAction(chatID, bot.ChatActionUploadDocument)
+
+		if sent := b.SendDocument(chatID, bot.InputFileFromBytes(data), map[string]interface{}{
+			"caption":             fmt.Sprintf(localizeFor(userID, messageExported), userCommandForgetMe),
+			"reply_to_message_id": message.MessageID,
+		}); !sent.Ok {
+			errorMessage = fmt.Sprintf(localizeFor(userID, messageExportNotSent), *sent.Description)
+		}
+	}
+
+	if errorMessage == "" {
+		return true
+	}
+
+	logger.Error(errorMessage)
+
+	if sent := b.SendMessage(chatID, errorMessage, map[string]interface{}{
+		"reply_to_message_id": message.MessageID,
+	}); !sent.Ok {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+	}
+
+	return false
+}
+
+// export everything stored about given user as JSON
+//
+// (enrolled persons are included only when it is requested in the private chat with the user)
+func exportUserData(userID int, includeEnrolledPersons bool) (data []byte, err error) {
+	exported := exportedUserData{
+		UserID:     userID,
+		ExportedOn: time.Now(),
+		Requests:   []exportedRequest{},
+		History:    []exportedHistory{},
+	}
+
+	if exported.Banned, err = db.IsBanned(userID); err != nil {
+		return nil, err
+	}
+	if exported.Preferences, err = db.GetPreferences(userID); err != nil {
+		return nil, err
+	}
+
+	var requests []Request
+	if requests, err = db.GetRequests(userID); err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		exported.Requests = append(exported.Requests, exportedRequest{
+			Username:    request.Username,
+			Command:     request.Command,
+			RequestedOn: request.RequestedOn,
+		})
+	}
+
+	var history []History
+	if history, err = db.GetUserHistory(userID); err != nil {
+		return nil, err
+	}
+	for _, h := range history {
+		exported.History = append(exported.History, exportedHistory{
+			ChatID:      h.ChatID,
+			MessageID:   h.MessageID,
+			Command:     h.Command,
+			Summary:     h.Summary,
+			ProcessedOn: h.ProcessedOn,
+		})
+	}
+
+	if exported.Archived, err = db.GetArchivedKeys(userID); err != nil {
+		return nil, err
+	}
+
+	if includeEnrolledPersons {
+		var names map[string]string
+		if names, err = db.GetPersonNames(int64(userID)); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			exported.EnrolledPersons = append(exported.EnrolledPersons, name)
+		}
+	}
+
+	return json.MarshalIndent(exported, "", "  ")
+}
+
+// process `/forgetme [yes]`, and return the result message
+//
+// (enrolled faces are deleted only when it is requested in the private chat with the user,
+// for the ones in group chats belong to the groups)
+func forgetUser(chat bot.Chat, userID int, argument string) string {
+	// (preferences of the user will be deleted, so the language is kept here)
+	language := languageFor(userID)
+
+	if argument != forgetMeConfirmation {
+		return fmt.Sprintf(localize(language, messageForgetMeConfirm), userCommandForgetMe, forgetMeConfirmation)
+	}
+
+	for _, store := range userDataStores() {
+		if err := store.DeleteUserData(userID); err != nil {
+			return fmt.Sprintf(localize(language, messageForgetMeFailed), err)
+		}
+	}
+
+	if isPrivateChatWith(chat, userID) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf().TimeoutSeconds)*time.Second)
+		defer cancel()
+
+		if err := forgetEnrolledFaces(ctx, chat.ID); err != nil {
+			return fmt.Sprintf(localize(language, messageFacesNotForgotten), err)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Deleted data of user: %d", userID))
+
+	return localize(language, messageForgotten)
+}
+
+// stores which keep data of users, in the order of deletion
+//
+// (archived objects come first, for their keys are saved in the local database)
+func userDataStores() (stores []UserDataStore) {
+	if conf().ArchiveStorage != "" {
+		stores = append(stores, archivedObjects{})
+	}
+	if resultCache != nil {
+		stores = append(stores, resultCache)
+	}
+	if redisStore, ok := requestCounter.(*RedisStore); ok {
+		stores = append(stores, redisStore)
+	}
+
+	return append(stores, db)
+}
+
+// delete persons and faces enrolled in given chat, from both Cognitive Services and the database
+//
+// (Cognitive Services are not called if nothing was enrolled)
+func forgetEnrolledFaces(ctx context.Context, chatID int64) error {
+	if names, err := db.GetPersonNames(chatID); err != nil {
+		return err
+	} else if fileIDs, err := db.GetFaceFileIDs(chatID); err != nil {
+		return err
+	} else if len(names) <= 0 && len(fileIDs) <= 0 {
+		return nil
+	}
+
+	if err := cognitive.DeletePersonGroup(ctx, personGroupID(chatID)); err != nil {
+		return err
+	}
+	if err := cognitive.DeleteFaceList(ctx, faceListID(chatID)); err != nil {
+		return err
+	}
+
+	return db.DeleteEnrolledFaces(chatID)
+}
+
+// check if given chat is the private chat with given user
+func isPrivateChatWith(chat bot.Chat, userID int) bool {
+	return chat.ID == int64(userID)
+}
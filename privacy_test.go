@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+func TestForgetUser(t *testing.T) {
+	useConfig(t, Config{})
+	database := useDatabase(t)
+
+	previousCache := resultCache
+	resultCache = storage.NewResultCache(10, time.Hour)
+	resultCache.SetStore(database, nil)
+	t.Cleanup(func() {
+		resultCache = previousCache
+	})
+
+	const userID = 42
+	chat := bot.Chat{ID: -100, Type: bot.ChatTypeGroup}
+
+	if err := database.SetPreference(userID, preferenceLanguage, "ko"); err != nil {
+		t.Fatalf("failed to set language: %s", err)
+	}
+	if err := database.SaveRequest(userID, "tester", Tag); err != nil {
+		t.Fatalf("failed to save request: %s", err)
+	}
+	resultCache.Set("mine", userID, ProcessResult{Message: "mine"})
+	resultCache.Set("theirs", userID+1, ProcessResult{Message: "theirs"})
+
+	// (not deleted without confirmation)
+	if message := forgetUser(chat, userID, ""); message != fmt.Sprintf(localize("ko", messageForgetMeConfirm), userCommandForgetMe, forgetMeConfirmation) {
+		t.Errorf("unexpected confirmation message: %s", message)
+	}
+	if count, _ := database.CountRequestsSince(userID, time.Time{}); count != 1 {
+		t.Errorf("requests were deleted without confirmation")
+	}
+
+	// (replied in the language of the user, though it is deleted)
+	if message := forgetUser(chat, userID, forgetMeConfirmation); message != localize("ko", messageForgotten) {
+		t.Errorf("unexpected result message: %s", message)
+	}
+
+	if count, _ := database.CountRequestsSince(userID, time.Time{}); count != 0 {
+		t.Errorf("requests were not deleted: %d", count)
+	}
+	if _, exists := resultCache.Get("mine"); exists {
+		t.Errorf("cached result was not deleted")
+	}
+	if _, exists, _ := database.GetCachedResult("mine"); exists {
+		t.Errorf("stored cached result was not deleted")
+	}
+	if _, exists := resultCache.Get("theirs"); !exists {
+		t.Errorf("cached result of another user was deleted")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+// functions for reporting progress of slow operations on status messages
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for progress
+const (
+	progressInterval = 3 * time.Second // status messages are edited at most once per this interval
+)
+
+// progressReporter struct for editing a status message with the current stage and elapsed time
+type progressReporter struct {
+	sync.Mutex
+
+	b         Messenger
+	chatID    int64
+	messageID int
+	language  string
+	status    string // eg. "Processing 'Read Text'..."
+
+	stage   string // eg. "downloading", or a progress message of a command
+	calls   int    // number of requests to the APIs which are in flight
+	started time.Time
+	edited  string // last edited text
+
+	done chan struct{}
+}
+
+// start reporting progress of given command on the status message
+//
+// (reporting stops when `stop` is called, or its job is finished without calling it, eg. on panics)
+func startProgress(b Messenger, chatID int64, messageID int, userID int, command CognitiveCommand) *progressReporter {
+	language := languageFor(userID)
+	finished := jobContext(chatID, messageID).Done()
+
+	p := &progressReporter{
+		b:         b,
+		chatID:    chatID,
+		messageID: messageID,
+		language:  language,
+		status:    fmt.Sprintf(localize(language, messageProcessingCommand), command),
+		started:   time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.edit()
+			case <-p.done:
+				return
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// return a new context for reporting stages (eg. requests to the APIs) with given reporter
+func withProgress(ctx context.Context, p *progressReporter) context.Context {
+	return context.WithValue(ctx, contextKeyProgress, p)
+}
+
+// stop reporting progress
+func (p *progressReporter) stop() {
+	close(p.done)
+}
+
+// set the current stage (or a progress message of a command)
+func (p *progressReporter) setStage(stage string) {
+	p.Lock()
+	p.stage = stage
+	p.Unlock()
+}
+
+// edit the status message with the current stage and elapsed time (if changed)
+func (p *progressReporter) edit() {
+	p.Lock()
+	stage := p.stage
+	if stage == messageStageCallingAPIs && p.calls > 1 {
+		stage = fmt.Sprintf(localize(p.language, messageStageParallelCalls), p.calls)
+	} else {
+		stage = localize(p.language, stage)
+	}
+	var text string
+	if stage != "" {
+		text = fmt.Sprintf("%s\n(%s, %.0fs)", p.status, stage, time.Since(p.started).Seconds())
+	} else {
+		text = fmt.Sprintf("%s\n(%.0fs)", p.status, time.Since(p.started).Seconds())
+	}
+	if text == p.edited {
+		p.Unlock()
+		return
+	}
+	p.edited = text
+	p.Unlock()
+
+	p.b.EditMessageText(text, map[string]interface{}{
+		"chat_id":    p.chatID,
+		"message_id": p.messageID,
+		"reply_markup": bot.InlineKeyboardMarkup{
+			InlineKeyboard: genJobCancelInlineKeyboards(),
+		},
+	})
+}
+
+// report the current stage of processing with given context, if its progress is being reported
+func reportStage(ctx context.Context, stage string) {
+	if p, exists := ctx.Value(contextKeyProgress).(*progressReporter); exists {
+		p.setStage(stage)
+	}
+}
+
+// report the start of a request to the APIs with given context
+func reportCallStarted(ctx context.Context) {
+	if p, exists := ctx.Value(contextKeyProgress).(*progressReporter); exists {
+		p.Lock()
+		p.calls++
+		if isGenericStage(p.stage) {
+			p.stage = messageStageCallingAPIs
+		}
+		p.Unlock()
+	}
+}
+
+// report the end of a request to the APIs with given context
+func reportCallFinished(ctx context.Context) {
+	if p, exists := ctx.Value(contextKeyProgress).(*progressReporter); exists {
+		p.Lock()
+		if p.calls--; p.calls <= 0 {
+			p.calls = 0
+			if p.stage == messageStageCallingAPIs {
+				p.stage = messageStageRendering
+			}
+		}
+		p.Unlock()
+	}
+}
+
+// check if given stage is not a progress message of a command
+//
+// (progress messages of commands, eg. polling status of Read API, are not overwritten by generic stages)
+func isGenericStage(stage string) bool {
+	switch stage {
+	case "", messageStageDownloading, messageStageCallingAPIs, messageStageRendering, messageStageSending:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package main
+
+// functions for expiring old inline keyboards for choosing actions
+//
+// (file ids in them can go stale, and they clutter chats)
+
+import (
+	"fmt"
+	"time"
+)
+
+// constants for prompts
+const (
+	promptExpiryCheckInterval = 1 * time.Minute
+)
+
+// remember a message with inline keyboards for choosing actions, for expiring it later
+func trackPrompt(chatID int64, messageID int, language string) {
+	if db == nil || conf().KeyboardTTLMinutes <= 0 {
+		return
+	}
+
+	if err := db.SavePrompt(Prompt{ChatID: chatID, MessageID: messageID, Language: language}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save prompt: %s", err))
+	}
+}
+
+// forget a message with inline keyboards, which was answered
+func untrackPrompt(chatID int64, messageID int) {
+	if db == nil {
+		return
+	}
+
+	if err := db.DeletePrompt(chatID, messageID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to delete prompt: %s", err))
+	}
+}
+
+// expire old prompts periodically
+func startExpiringPrompts(b Messenger) {
+	if db == nil {
+		return
+	}
+
+	go func() {
+		for range time.Tick(promptExpiryCheckInterval) {
+			expirePrompts(b)
+		}
+	}()
+}
+
+// edit prompts which are older than `keyboard-ttl-minutes` as expired, and remove their inline keyboards
+func expirePrompts(b Messenger) {
+	if conf().KeyboardTTLMinutes <= 0 {
+		return
+	}
+
+	prompts, err := db.TakePromptsSentBefore(time.Now().Add(-time.Duration(conf().KeyboardTTLMinutes) * time.Minute))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get expired prompts: %s", err))
+		return
+	}
+
+	for _, prompt := range prompts {
+		// (fails silently if the message was deleted)
+		b.EditMessageText(localize(prompt.Language, messageKeyboardExpired), map[string]interface{}{
+			"chat_id":    prompt.ChatID,
+			"message_id": prompt.MessageID,
+		})
+	}
+
+	if len(prompts) > 0 {
+		logger.Debug(fmt.Sprintf("Expired %d prompt(s)", len(prompts)))
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+// selection of vision providers (Azure, Google Cloud Vision, AWS Rekognition, or local) per command
+//
+// set `vision-providers` in config to run some commands without Azure keys, eg:
+//
+//	"vision-providers": {
+//		"Tag This Image": "google",
+//		"Face Detection": "aws"
+//	}
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// vision providers
+const (
+	visionProviderAzure  = "azure" // default
+	visionProviderGoogle = "google"
+	visionProviderAWS    = "aws"
+	visionProviderLocal  = "local" // only for faces (see localfaces.go)
+)
+
+// likelihoods of Google Cloud Vision, as scores
+var likelihoodScores = map[string]float64{
+	"VERY_UNLIKELY": 0.05,
+	"UNLIKELY":      0.25,
+	"POSSIBLE":      0.5,
+	"LIKELY":        0.75,
+	"VERY_LIKELY":   0.95,
+}
+
+// minimum score for flagging adult, racy, or gory contents from other providers
+const minFlaggedScore = 0.75
+
+// vision provider for given command
+func visionFor(command CognitiveCommand) VisionProvider {
+	switch conf().VisionProviders[command] {
+	case visionProviderGoogle:
+		return googleVision{}
+	case visionProviderAWS:
+		return awsRekognition{}
+	case visionProviderLocal:
+		return localFaces{}
+	case visionProviderAzure:
+		return cognitive
+	}
+
+	// fall back to local face detection for fun commands, if there is no key for Face API
+	if !hasCredentials(serviceFace, conf().MsFaceSubscriptionKey) && localFacesAvailable() && supportsLocalFaces(command) {
+		return localFaces{}
+	}
+
+	return cognitive
+}
+
+// check if given command can be run with local face detection
+func supportsLocalFaces(command CognitiveCommand) bool {
+	switch command {
+	case Face, ExtractFaces, FaceCollage, CountFaces, CensorEyes, MaskFaces, DealWithIt:
+		return true
+	}
+
+	return false
+}
+
+// check if given vision provider is known
+func isValidVisionProvider(provider string) bool {
+	switch provider {
+	case visionProviderAzure, visionProviderGoogle, visionProviderAWS, visionProviderLocal:
+		return true
+	}
+
+	return false
+}
+
+// error for visual features which are not supported by a provider
+func unsupportedFeatureError(provider, feature string) error {
+	return fmt.Errorf("'%s' is not supported by %s", feature, provider)
+}
+
+// size of given image bytes, for converting normalized coordinates
+func imageSize(imageBytes []byte) (width, height int, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// convert normalized (0.0 - 1.0) points to the ones on an image with given size
+func denormalizePoints(points []cog.Point, width, height int) []cog.Point {
+	converted := []cog.Point{}
+	for _, p := range points {
+		converted = append(converted, cog.Point{X: p.X * float64(width), Y: p.Y * float64(height)})
+	}
+
+	return converted
+}
+
+// bounding rectangle of given points
+func boundingRectangle(points []cog.Point) cog.Rectangle {
+	if len(points) <= 0 {
+		return cog.Rectangle{}
+	}
+
+	minX, minY, maxX, maxY := math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64
+	for _, p := range points {
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+	}
+
+	return cog.Rectangle{
+		Left:   int(minX),
+		Top:    int(minY),
+		Width:  int(maxX - minX),
+		Height: int(maxY - minY),
+	}
+}
+
+// flatten given points to a bounding box of Read API (x1, y1, ..., x4, y4)
+func flattenPoints(points []cog.Point) []float64 {
+	box := []float64{}
+	for _, p := range points {
+		box = append(box, p.X, p.Y)
+	}
+
+	return box
+}
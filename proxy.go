@@ -0,0 +1,78 @@
+package main
+
+// functions for sending requests through HTTP or SOCKS5 proxies
+//
+// (separately for Telegram and Azure, as only one of them may be blocked in some networks)
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// schemes of supported proxies
+var proxySchemes = []string{"http", "https", "socks5"}
+
+// clients for each proxy url
+var proxiedClients = map[string]*http.Client{}
+var proxiedClientsLock sync.Mutex
+
+// check if given url is of a supported proxy
+func validateProxyURL(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+
+	for _, scheme := range proxySchemes {
+		if u.Scheme == scheme {
+			if u.Host == "" {
+				return fmt.Errorf("no host in proxy url")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported proxy scheme '%s'", u.Scheme)
+}
+
+// http client for requests to Telegram (eg. downloading files)
+func telegramHTTPClient() *http.Client {
+	return proxiedClient(conf().TelegramProxyURL)
+}
+
+// http client for requests to Cognitive Services (and Azure AD, other providers)
+func azureHTTPClient() *http.Client {
+	return proxiedClient(conf().AzureProxyURL)
+}
+
+// http client which sends requests through given proxy
+//
+// (returns the default client when the proxy url is empty, clients are reused for the same url)
+func proxiedClient(proxyURL string) *http.Client {
+	if proxyURL == "" {
+		return http.DefaultClient
+	}
+
+	proxiedClientsLock.Lock()
+	defer proxiedClientsLock.Unlock()
+
+	if c, exists := proxiedClients[proxyURL]; exists {
+		return c
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil { // (should not happen, for it is validated when config is loaded)
+		logger.Error(fmt.Sprintf("Failed to parse proxy url, sending requests without it: %s", err))
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+
+	c := &http.Client{Transport: transport}
+	proxiedClients[proxyURL] = c
+
+	return c
+}
@@ -0,0 +1,73 @@
+package main
+
+// functions for publishing completed results (to object storage, and to a webhook)
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// constants for publishing results
+const (
+	publishTimeout = 60 * time.Second
+)
+
+// publish given result in the background:
+// archive it and send a share link of it to the user, then notify the result webhook (if configured)
+//
+// (`messageID` is of the sent result message, and share links are sent as replies to it)
+func publishResult(b Messenger, chatID int64, userID int, messageID int, command CognitiveCommand, result ProcessResult) {
+	if messageID == 0 || (conf().ArchiveStorage == "" && conf().ResultWebhookURL == "") {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+
+		var imageURL string
+
+		if conf().ArchiveStorage != "" {
+			imageKey, jsonKey, err := archive(ctx, chatID, userID, messageID, command, result)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to archive result: %s", err))
+			} else {
+				expiresIn := time.Duration(conf().ArchiveShareLinkHours) * time.Hour
+
+				if imageKey != "" && conf().ResultWebhookURL != "" {
+					if imageURL, err = shareLinkOf(imageKey, expiresIn); err != nil {
+						logger.Error(fmt.Sprintf("Failed to generate link of result image: %s", err))
+					}
+				}
+
+				// (share links are of the annotated image if there is one, or of the JSON result)
+				if conf().ArchiveShareLinks {
+					sharedKey := jsonKey
+					if imageKey != "" {
+						sharedKey = imageKey
+					}
+
+					if link, err := shareLinkOf(sharedKey, expiresIn); err == nil {
+						sendShareLink(b, chatID, userID, messageID, link)
+					} else {
+						logger.Error(fmt.Sprintf("Failed to generate share link: %s", err))
+					}
+				}
+			}
+		}
+
+		if conf().ResultWebhookURL != "" {
+			notifyResultWebhook(ctx, resultWebhookPayload{
+				Source:      resultSourceTelegram,
+				ChatID:      chatID,
+				UserID:      userID,
+				MessageID:   messageID,
+				Command:     command,
+				Message:     result.Message,
+				ImageURL:    imageURL,
+				CompletedAt: time.Now().UTC(),
+			})
+		}
+	}()
+}
@@ -0,0 +1,267 @@
+package main
+
+// functions for the persistent job queue and its workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+
+	// for stores of states
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/storage"
+)
+
+// JobKind type
+type JobKind = storage.JobKind
+
+// kinds of jobs
+const (
+	JobKindImage      JobKind = "image"
+	JobKindSticker    JobKind = "sticker"
+	JobKindVideo      JobKind = "video"
+	JobKindAudio      JobKind = "audio"
+	JobKindPDF        JobKind = "pdf"
+	JobKindAlbum      JobKind = "album"
+	JobKindVerify     JobKind = "verify"
+	JobKindRemember   JobKind = "remember"
+	JobKindCelebrity  JobKind = "celebrity"
+	JobKindFaces      JobKind = "faces"      // (for selecting faces before processing)
+	JobKindSafety     JobKind = "safety"     // (message id is of the image to be warned, not of a status message)
+	JobKindModeration JobKind = "moderation" // (same as above)
+)
+
+// constants for job queue
+const (
+	defaultMaxConcurrentJobs = 4
+
+	jobPollingIntervalSeconds = 5
+
+	jobLeaseTTL           = time.Minute // (running jobs of other instances are requeued when their leases are not renewed in it)
+	jobLeaseRenewInterval = jobLeaseTTL / 3
+	requeueClaimKey       = "requeue-running-jobs"
+)
+
+// signals idle workers that a new job was queued
+var jobQueued = make(chan struct{}, 1)
+
+// enqueue a job, and wake up an idle worker
+//
+// (the trace of given context is continued when the job is run)
+func enqueueJob(ctx context.Context, job Job) error {
+	job.TraceParent = traceParentOf(ctx)
+
+	if err := jobQueue.EnqueueJob(job); err != nil {
+		return err
+	}
+
+	select {
+	case jobQueued <- struct{}{}:
+	default: // a signal is already pending
+	}
+
+	return nil
+}
+
+// start workers which process queued jobs
+//
+// (jobs which were running when the bot stopped will be processed again)
+func startWorkers(b Messenger, numWorkers int) {
+	if count, err := jobQueue.RequeueRunningJobs(); err == nil {
+		if count > 0 {
+			logger.Info(fmt.Sprintf("Resuming %d interrupted job(s)", count))
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to requeue running jobs: %s", err))
+	}
+
+	for i := 0; i < numWorkers; i++ {
+		go work(b)
+	}
+
+	go requeueStaleJobs()
+}
+
+// requeue jobs of crashed instances periodically, forever
+//
+// (only with multiple instances, for running jobs of the local database are all of this instance;
+// only one instance does it in each interval, by claiming it)
+func requeueStaleJobs() {
+	if coordinator == nil {
+		return
+	}
+
+	for {
+		time.Sleep(jobLeaseTTL)
+
+		if claimed, err := coordinator.Claim(requeueClaimKey, jobLeaseTTL/2); err != nil {
+			logger.Error(fmt.Sprintf("Failed to claim requeuing running jobs: %s", err))
+		} else if claimed {
+			if count, err := jobQueue.RequeueRunningJobs(); err == nil {
+				if count > 0 {
+					logger.Info(fmt.Sprintf("Requeued %d job(s) of crashed instance(s)", count))
+
+					select {
+					case jobQueued <- struct{}{}:
+					default:
+					}
+				}
+			} else {
+				logger.Error(fmt.Sprintf("Failed to requeue running jobs: %s", err))
+			}
+		}
+	}
+}
+
+// renew the lease of a running job periodically, until it is stopped
+func renewJobLease(id int64, stop <-chan struct{}) {
+	ticker := time.NewTicker(jobLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := coordinator.RenewJobLease(id); err != nil {
+				logger.Error(fmt.Sprintf("Failed to renew the lease of job %d: %s", id, err))
+			}
+		}
+	}
+}
+
+// process queued jobs one by one, forever
+func work(b Messenger) {
+	for {
+		job, exists, err := jobQueue.DequeueJob()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to dequeue job: %s", err))
+		}
+
+		if !exists {
+			// wait for a new job
+			select {
+			case <-jobQueued:
+			case <-time.After(jobPollingIntervalSeconds * time.Second):
+			}
+
+			continue
+		}
+
+		runJob(b, job)
+
+		if err := jobQueue.DeleteJob(job.ID); err != nil {
+			logger.Error(fmt.Sprintf("Failed to delete finished job: %s", err))
+		}
+	}
+}
+
+// run a job
+func runJob(b Messenger, job Job) {
+	// (continues the trace of the update which queued it)
+	ctx, span := startSpan(withTraceParent(context.Background(), job.TraceParent), fmt.Sprintf("job %s", job.Kind), spanKindConsumer)
+	span.setAttribute("job.id", job.ID)
+	span.setAttribute("job.command", string(job.Command))
+	span.setAttribute("job.queued_ms", time.Since(job.QueuedOn).Milliseconds())
+	defer span.finish(nil)
+
+	// (keep the worker alive even if this job panics)
+	defer recoverJob(b, job)
+
+	// (keep the job leased while running, so other instances don't regard it as of a crashed one)
+	if coordinator != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go renewJobLease(job.ID, stop)
+	}
+
+	// (can be canceled with the cancel button on its status message)
+	done := startRunningJob(ctx, job)
+	defer done()
+
+	// file urls are fetched here, for they may have been expired while being queued
+	//
+	// (unique ids of files are also fetched here, for caching results of the same files which have different file ids)
+	fileURLs, fileUniqueIDs := []string{}, []string{}
+	for _, fileID := range job.FileIDs {
+		_, fileSpan := startSpan(ctx, "telegram getFile", spanKindClient)
+		fileResult := b.GetFile(fileID)
+		if fileResult.Ok {
+			fileSpan.finish(nil)
+
+			fileURLs = append(fileURLs, b.GetFileURL(*fileResult.Result))
+			fileUniqueIDs = append(fileUniqueIDs, fileResult.Result.FileUniqueID)
+		} else {
+			fileSpan.finish(fmt.Errorf("%s", *fileResult.Description))
+
+			logger.Error(fmt.Sprintf("Failed to get file from url: %s", *fileResult.Description))
+
+			// (automatic checks fail silently)
+			if !isAutomaticCheck(job.Kind) {
+				b.DeleteMessage(job.ChatID, job.MessageID)
+				b.SendMessage(job.ChatID, localizeFor(job.UserID, messageFailedToGetFile), nil)
+			}
+
+			return
+		}
+	}
+
+	switch job.Kind {
+	case JobKindImage:
+		processImage(b, job.ChatID, job.UserID, job.MessageID, job.FileIDs[0], fileUniqueIDs[0], fileURLs[0], job.Command, job.Argument, loadImage)
+		sendRerunKeyboard(b, job.ChatID, job.UserID, MediaImage, job.FileIDs[0])
+	case JobKindSticker:
+		processImage(b, job.ChatID, job.UserID, job.MessageID, job.FileIDs[0], fileUniqueIDs[0], fileURLs[0], job.Command, job.Argument, loadSticker)
+		sendRerunKeyboard(b, job.ChatID, job.UserID, MediaSticker, job.FileIDs[0])
+	case JobKindVideo:
+		processImage(b, job.ChatID, job.UserID, job.MessageID, job.FileIDs[0], fileUniqueIDs[0], fileURLs[0], job.Command, job.Argument, extractFrame)
+		sendRerunKeyboard(b, job.ChatID, job.UserID, MediaVideo, job.FileIDs[0])
+	case JobKindAudio:
+		processAudio(b, job.ChatID, job.UserID, job.MessageID, fileURLs[0], job.Command)
+	case JobKindPDF:
+		processPDF(b, job.ChatID, job.UserID, job.MessageID, fileURLs[0], job.Command)
+	case JobKindAlbum:
+		processAlbum(b, job.ChatID, job.UserID, job.MessageID, job.FileIDs, fileUniqueIDs, fileURLs, job.Command)
+	case JobKindVerify:
+		processVerification(b, job.ChatID, job.UserID, job.MessageID, fileURLs)
+	case JobKindFaces:
+		processFaceSelection(b, job.ChatID, job.UserID, job.MessageID, job.FileIDs[0], fileUniqueIDs[0], fileURLs[0], job.Command)
+	case JobKindRemember:
+		processRemember(b, job.ChatID, job.UserID, job.MessageID, fileURLs[0], job.Argument)
+	case JobKindCelebrity:
+		processCelebrity(b, job.ChatID, job.MessageID, fileURLs[0], job.Argument)
+	case JobKindSafety:
+		processSafetyWarning(b, job.ChatID, job.MessageID, fileURLs[0])
+	case JobKindModeration:
+		processModerationWarning(b, job.ChatID, job.MessageID, fileURLs[0])
+	default:
+		logger.Error(fmt.Sprintf("Unknown kind of job: %s", job.Kind))
+	}
+}
+
+// check if given kind of job is an automatic check of images in group chats
+func isAutomaticCheck(kind JobKind) bool {
+	return kind == JobKindSafety || kind == JobKindModeration
+}
+
+// enqueue an automatic check of given image
+func enqueueAutomaticCheck(ctx context.Context, message *bot.Message, fileID string, kind JobKind, command CognitiveCommand) {
+	var userID int
+	if message.From != nil {
+		userID = message.From.ID
+	}
+
+	if err := enqueueJob(ctx, Job{
+		Kind:      kind,
+		ChatID:    message.Chat.ID,
+		UserID:    userID,
+		MessageID: message.MessageID,
+		FileIDs:   []string{fileID},
+		Command:   command,
+	}); err != nil {
+		logger.Error(fmt.Sprintf("Failed to enqueue automatic check: %s", err))
+	}
+}
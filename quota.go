@@ -0,0 +1,121 @@
+package main
+
+// functions for per-user quotas
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// check if given user can request now,
+//
+// and if not, returns when the user can request again
+func checkQuota(userID int) (available bool, retryAt time.Time) {
+	if db == nil {
+		return true, retryAt
+	}
+
+	now := time.Now()
+
+	// requests per minute
+	if conf().QuotaRequestsPerMinute > 0 {
+		minuteAgo := now.Add(-time.Minute)
+
+		if count, err := requestCounter.CountRequestsSince(userID, minuteAgo); err == nil {
+			if count >= conf().QuotaRequestsPerMinute {
+				if oldest, err := requestCounter.OldestRequestSince(userID, minuteAgo); err == nil {
+					return false, oldest.Add(time.Minute)
+				}
+				return false, now.Add(time.Minute)
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to count requests per minute: %s", err))
+		}
+	}
+
+	// requests per day
+	if conf().QuotaRequestsPerDay > 0 {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+		if count, err := requestCounter.CountRequestsSince(userID, today); err == nil {
+			if count >= conf().QuotaRequestsPerDay {
+				return false, today.AddDate(0, 0, 1)
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to count requests per day: %s", err))
+		}
+	}
+
+	return true, retryAt
+}
+
+// save a request of given user (for statistics, and for quotas)
+func saveRequest(userID int, username string, command CognitiveCommand) error {
+	if err := db.SaveRequest(userID, username, command); err != nil {
+		return err
+	}
+
+	// (counted separately when quotas are shared)
+	if requestCounter != RequestCounter(db) {
+		return requestCounter.SaveRequest(userID, username, command)
+	}
+
+	return nil
+}
+
+// check the quota of the user for given callback query which calls paid services, and save it as a request of given command
+//
+// (replies with the quota exceeded message when it is not available)
+func acceptPaidCallback(b Messenger, query bot.CallbackQuery, username string, command CognitiveCommand) bool {
+	if available, retryAt := checkQuota(query.From.ID); !available {
+		b.SendMessage(query.Message.Chat.ID, quotaExceededMessage(languageFor(query.From.ID), retryAt), map[string]interface{}{
+			"reply_to_message_id": query.Message.MessageID,
+		})
+
+		return false
+	}
+
+	if db != nil {
+		if err := saveRequest(query.From.ID, username, command); err != nil {
+			logger.Error(fmt.Sprintf("Failed to save request: %s", err))
+		}
+	}
+
+	return true
+}
+
+// message for exceeded quota (in given language)
+func quotaExceededMessage(language string, retryAt time.Time) string {
+	return fmt.Sprintf(localize(language, messageQuotaExceeded), retryAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+// build up usage message of given user, with quotas if configured
+func userStats(userID int) string {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	lines := []string{"[Your requests]"}
+	for _, period := range []struct {
+		label string
+		since time.Time
+		quota int
+	}{
+		{"Last minute", now.Add(-time.Minute), conf().QuotaRequestsPerMinute},
+		{"Today", today, conf().QuotaRequestsPerDay},
+	} {
+		count, err := requestCounter.CountRequestsSince(userID, period.since)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("  %s: (failed: %s)", period.label, err))
+		} else if period.quota > 0 {
+			lines = append(lines, fmt.Sprintf("  %s: %d / %d", period.label, count, period.quota))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s: %d", period.label, count))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
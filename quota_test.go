@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/telegram"
+)
+
+func TestAcceptPaidCallback(t *testing.T) {
+	useConfig(t, Config{QuotaRequestsPerMinute: 2})
+	useDatabase(t)
+
+	mock := telegram.NewMock()
+	query := *newCallbackQuery(1, "").CallbackQuery
+
+	for i := 0; i < 2; i++ {
+		if !acceptPaidCallback(mock, query, "tester", Tag) {
+			t.Fatalf("callback #%d was rejected within the quota", i+1)
+		}
+	}
+	if len(mock.Calls) != 0 {
+		t.Errorf("messages were sent within the quota: %+v", mock.Calls)
+	}
+
+	if acceptPaidCallback(mock, query, "tester", Tag) {
+		t.Errorf("callback over the quota was accepted")
+	}
+	if sent := mock.CallsOf("SendMessage"); len(sent) != 1 || sent[0].Options["reply_to_message_id"] != 42 {
+		t.Errorf("quota exceeded message was not replied: %+v", mock.Calls)
+	}
+
+	// (quotas are per user)
+	if !acceptPaidCallback(mock, *newCallbackQuery(2, "").CallbackQuery, "another", Tag) {
+		t.Errorf("callback of another user was rejected")
+	}
+}
+
+func TestAcceptPaidCallbackWithoutQuota(t *testing.T) {
+	useConfig(t, Config{})
+	useDatabase(t)
+
+	mock := telegram.NewMock()
+	query := *newCallbackQuery(1, "").CallbackQuery
+
+	for i := 0; i < 10; i++ {
+		if !acceptPaidCallback(mock, query, "tester", Tag) {
+			t.Fatalf("callback #%d was rejected without quotas", i+1)
+		}
+	}
+
+	if count, err := requestCounter.CountRequestsSince(1, time.Now().Add(-time.Hour)); err != nil || count != 10 {
+		t.Errorf("requests were not counted: %d, %v", count, err)
+	}
+}
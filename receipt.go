@@ -0,0 +1,120 @@
+package main
+
+// functions for scanning receipts
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(newCommand(ScanReceipt, "SR", handleScanReceipt), MediaImage, MediaAlbum)
+}
+
+// scan a receipt on given image bytes, and report its merchant, date, items, and total
+func handleScanReceipt(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := cognitive.AnalyzeForm(ctx, formModelReceipt, imageBytes, func(status string, elapsed time.Duration) {
+		if progress != nil {
+			progress(fmt.Sprintf("scanning receipt: %s", status))
+		}
+	})
+	if err != nil {
+		return result, fmt.Errorf("Failed to scan receipt: %s", err)
+	}
+
+	fields := analyzed.Fields()
+	if len(fields) <= 0 {
+		return result, errors.New("Could not find any receipt on given image.")
+	}
+
+	lines := []string{}
+	for _, f := range []struct {
+		name  string
+		label string
+	}{
+		{"MerchantName", "Merchant"},
+		{"MerchantAddress", "Address"},
+		{"MerchantPhoneNumber", "Phone"},
+		{"TransactionDate", "Date"},
+		{"TransactionTime", "Time"},
+	} {
+		if field, exists := fields[f.name]; exists {
+			lines = append(lines, fmt.Sprintf("%s: %s", f.label, field.String()))
+		}
+	}
+
+	// line items
+	items := receiptItems(fields["Items"])
+	if len(items) > 0 {
+		lines = append(lines, "", "[Items]")
+		for _, item := range items {
+			lines = append(lines, fmt.Sprintf("- %s x %s: %s", item[0], item[1], item[2]))
+		}
+	}
+
+	// totals
+	totals := []string{}
+	for _, name := range []string{"Subtotal", "Tax", "Tip", "Total"} {
+		if field, exists := fields[name]; exists {
+			totals = append(totals, fmt.Sprintf("%s: %s", name, field.String()))
+		}
+	}
+	if len(totals) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, totals...)
+	}
+
+	result.Message = strings.TrimSpace(strings.Join(lines, "\n"))
+
+	// attach line items as a CSV file
+	if conf().ReceiptCSV && len(items) > 0 {
+		if result.Attachment, err = receiptCSV(items); err != nil {
+			return result, fmt.Errorf("Failed to generate CSV: %s", err)
+		}
+	}
+
+	return result, nil
+}
+
+// name, quantity, and total price of each line item
+func receiptItems(field FormField) (items [][3]string) {
+	for _, item := range field.ValueArray {
+		name, quantity, price := "?", "1", "?"
+		if f, exists := item.ValueObject["Name"]; exists {
+			name = f.String()
+		}
+		if f, exists := item.ValueObject["Quantity"]; exists {
+			if quantity = f.String(); strings.Contains(quantity, ".") {
+				quantity = strings.TrimSuffix(strings.TrimRight(quantity, "0"), ".")
+			}
+		}
+		if f, exists := item.ValueObject["TotalPrice"]; exists {
+			price = f.String()
+		} else if f, exists := item.ValueObject["Price"]; exists {
+			price = f.String()
+		}
+
+		items = append(items, [3]string{name, quantity, price})
+	}
+
+	return items
+}
+
+// generate CSV bytes of given line items
+func receiptCSV(items [][3]string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+
+	w.Write([]string{"name", "quantity", "total price"})
+	for _, item := range items {
+		w.Write(item[:])
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
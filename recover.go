@@ -0,0 +1,86 @@
+package main
+
+// functions for recovering from panics while processing updates and jobs
+//
+// (a panic in one of them should not take the whole bot down)
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// panicContext struct for the context of a recovered panic
+type panicContext struct {
+	errorContext
+
+	Stack string `json:"stack"`
+}
+
+// recover from a panic while processing given update
+//
+// (should be deferred)
+func recoverUpdate(b Messenger, update bot.Update) {
+	if r := recover(); r != nil {
+		var chatID int64
+		var userID int
+		if update.HasMessage() {
+			chatID = update.Message.Chat.ID
+			if update.Message.From != nil {
+				userID = update.Message.From.ID
+			}
+		} else if update.HasCallbackQuery() {
+			userID = update.CallbackQuery.From.ID
+			if update.CallbackQuery.Message != nil {
+				chatID = update.CallbackQuery.Message.Chat.ID
+			}
+		}
+
+		logger.Log(LevelError, fmt.Sprintf("Recovered from panic while processing update #%d: %v", update.UpdateID, r), panicContext{
+			errorContext: errorContext{ChatID: chatID, UserID: userID},
+			Stack:        string(debug.Stack()),
+		})
+
+		if chatID != 0 {
+			b.SendMessage(chatID, localizeFor(userID, messageSomethingWrong), nil)
+		}
+	}
+}
+
+// recover from a panic while running given job
+//
+// (should be deferred)
+func recoverJob(b Messenger, job Job) {
+	if r := recover(); r != nil {
+		var fileID string
+		if len(job.FileIDs) > 0 {
+			fileID = job.FileIDs[0]
+		}
+
+		logger.Log(LevelError, fmt.Sprintf("Recovered from panic while running job #%d: %v", job.ID, r), panicContext{
+			errorContext: errorContext{ChatID: job.ChatID, UserID: job.UserID, Command: job.Command, FileID: fileID},
+			Stack:        string(debug.Stack()),
+		})
+
+		// (automatic checks fail silently)
+		if !isAutomaticCheck(job.Kind) {
+			b.DeleteMessage(job.ChatID, job.MessageID)
+			b.SendMessage(job.ChatID, localizeFor(job.UserID, messageSomethingWrong), nil)
+		}
+	}
+}
+
+// recover from a panic in a goroutine of parallel API calls, and save it to given error
+//
+// (should be deferred after `wg.Done`, so that the error is saved before the goroutine is done)
+func recoverAsError(section string, err *error) {
+	if r := recover(); r != nil {
+		logger.Log(LevelError, fmt.Sprintf("Recovered from panic while calling API for %s: %v", section, r), panicContext{
+			Stack: string(debug.Stack()),
+		})
+
+		*err = fmt.Errorf("panic: %v", r)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+// functions for redacting texts on images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(newCommand(RedactText, "RT", handleRedactText), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// recognize texts on given image bytes, and fill the regions of them with the mask color
+//
+// (when `redact-text-patterns` are configured, only the words matching any of them are redacted)
+func handleRedactText(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	recognized, err := visionFor(RedactText).Read(ctx, imageBytes, func(status string, elapsed time.Duration) {
+		if progress != nil {
+			progress(fmt.Sprintf("recognizing text: %s", status))
+		}
+	})
+	if err != nil {
+		return result, fmt.Errorf("Failed to recognize text: %s", err)
+	}
+
+	patterns, err := compileRedactPatterns(conf().RedactTextPatterns)
+	if err != nil {
+		return result, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	newImg, gc, _, _ := prepareAnnotation(img)
+	gc.SetLineWidth(1)
+	maskColor := loaded().maskColor
+	gc.SetStrokeColor(maskColor)
+	gc.SetFillColor(maskColor)
+
+	redacted := 0
+	for _, page := range recognized.AnalyzeResult.ReadResults {
+		for _, line := range page.Lines {
+			for _, word := range redactedWords(line, patterns) {
+				drawPolygon(gc, word.BoundingBox)
+
+				redacted++
+			}
+		}
+	}
+	gc.Save()
+
+	if redacted <= 0 {
+		return result, errors.New("Could not find any text to redact on this image.")
+	}
+	result.Message = fmt.Sprintf("Redacted %d word(s).", redacted)
+
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// compile given patterns for redacting texts
+func compileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			compiled = append(compiled, re)
+		} else {
+			return nil, fmt.Errorf("invalid pattern for redacting texts '%s': %s", p, err)
+		}
+	}
+
+	return compiled, nil
+}
+
+// words of given line which should be redacted
+//
+// (all words when there is no pattern, or the words overlapping with any match of patterns)
+func redactedWords(line ReadLine, patterns []*regexp.Regexp) []ReadWord {
+	if len(patterns) <= 0 {
+		return line.Words
+	}
+
+	// ranges of matches in the line
+	matches := [][]int{}
+	for _, re := range patterns {
+		matches = append(matches, re.FindAllStringIndex(line.Text, -1)...)
+	}
+	if len(matches) <= 0 {
+		return nil
+	}
+
+	words := []ReadWord{}
+	offset := 0
+	for _, w := range line.Words {
+		i := strings.Index(line.Text[offset:], w.Text)
+		if i < 0 {
+			continue
+		}
+		start, end := offset+i, offset+i+len(w.Text)
+		offset = end
+
+		for _, m := range matches {
+			if start < m[1] && m[0] < end {
+				words = append(words, w)
+				break
+			}
+		}
+	}
+
+	return words
+}
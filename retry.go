@@ -0,0 +1,124 @@
+package main
+
+// functions for retrying requests to Cognitive Services
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// default values for retrying
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialDelayMs = 500
+	defaultRetryMaxDelayMs     = 10 * 1000
+)
+
+// context key for requests which are not idempotent
+type nonIdempotentContextKey struct{}
+
+// context for requests which are not idempotent (eg. creating persons, or adding faces)
+//
+// (they would create duplicated resources if they were processed but retried, eg. after timeouts)
+func withNonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentContextKey{}, true)
+}
+
+// check if the request with given context is not idempotent
+func isNonIdempotent(ctx context.Context) bool {
+	nonIdempotent, _ := ctx.Value(nonIdempotentContextKey{}).(bool)
+	return nonIdempotent
+}
+
+// check if a request should be retried with given response
+//
+// (throttled or failed on the server side)
+func isRetryable(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// check if a request with given context should be retried with given response or error
+//
+// (requests which are not idempotent are retried only when they surely failed before being processed)
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if isNonIdempotent(ctx) {
+		return failedBeforeProcessing(resp, err)
+	}
+
+	return err != nil || isRetryable(resp)
+}
+
+// check if a request failed before being processed, with given response or error
+//
+// (throttled, or could not even connect to the server)
+func failedBeforeProcessing(resp *http.Response, err error) bool {
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		opErr, ok := err.(*net.OpError)
+
+		return ok && opErr.Op == "dial"
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests
+}
+
+// delay before the next attempt (`attempt` starts from 1)
+//
+// honors `Retry-After` header of the response if any,
+// otherwise backs off exponentially with full jitter
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	maxDelay := time.Duration(conf().RetryMaxDelayMs) * time.Millisecond
+
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if delay > maxDelay {
+				return maxDelay
+			}
+			return delay
+		}
+	}
+
+	backoff := time.Duration(conf().RetryInitialDelayMs) * time.Millisecond << uint(attempt-1)
+	if backoff <= 0 || backoff > maxDelay {
+		backoff = maxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// parse value of `Retry-After` header (in seconds or HTTP date)
+func parseRetryAfter(value string) (delay time.Duration, ok bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if delay = time.Until(at); delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// sleep for given duration, or until given context is done
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
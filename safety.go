@@ -0,0 +1,89 @@
+package main
+
+// functions for checking adult, racy, and gory contents on images
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+func init() {
+	registerCommand(newCommand(SafetyCheck, "SC", handleSafetyCheck), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+}
+
+// check adult, racy, and gory contents on given image bytes
+func handleSafetyCheck(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	analyzed, err := visionFor(SafetyCheck).Analyze(ctx, imageBytes, []string{"Adult"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to check image: %s", err)
+	}
+
+	result.Message = strings.Join(safetyReport(analyzed.Adult), "\n")
+
+	return result, nil
+}
+
+// lines of report for adult, racy, and gory contents
+func safetyReport(adult AdultResult) []string {
+	mark := func(flagged bool) string {
+		if flagged {
+			return "⚠️"
+		}
+		return "✅"
+	}
+
+	return []string{
+		fmt.Sprintf("%s Adult: %.3f%%", mark(adult.IsAdultContent), adult.AdultScore*100.0),
+		fmt.Sprintf("%s Racy: %.3f%%", mark(adult.IsRacyContent), adult.RacyScore*100.0),
+		fmt.Sprintf("%s Gory: %.3f%%", mark(adult.IsGoryContent), adult.GoreScore*100.0),
+	}
+}
+
+// check if images in given chat should be checked automatically
+func isSafetyWarningChat(chatID int64) bool {
+	for _, id := range conf().SafetyWarningChatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check given image automatically, and reply with a spoiler-marked warning if it is flagged
+func processSafetyWarning(b Messenger, chatID int64, messageID int, fileURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout(SafetyCheck))
+	defer cancel()
+
+	if adult, err := checkSafety(ctx, fileURL); err == nil {
+		if adult.IsAdultContent || adult.IsRacyContent || adult.IsGoryContent {
+			warning := fmt.Sprintf("⚠️ This image may be sensitive:\n<tg-spoiler>%s</tg-spoiler>", html.EscapeString(strings.Join(safetyReport(adult), "\n")))
+
+			if sent := b.SendMessage(chatID, warning, map[string]interface{}{
+				"reply_to_message_id": messageID,
+				"parse_mode":          bot.ParseModeHTML,
+			}); !sent.Ok {
+				logger.Error(fmt.Sprintf("Failed to send safety warning: %s", *sent.Description))
+			}
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to check safety of image: %s", err))
+	}
+}
+
+// download and check an image
+func checkSafety(ctx context.Context, fileURL string) (adult AdultResult, err error) {
+	imageBytes, err := loadImage(ctx, fileURL)
+	if err != nil {
+		return adult, err
+	}
+
+	analyzed, err := visionFor(SafetyCheck).Analyze(ctx, imageBytes, []string{"Adult"})
+
+	return analyzed.Adult, err
+}
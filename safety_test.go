@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/telegram"
+)
+
+// new update of an image from given user in a group chat, which is not meant for the bot
+func newGroupImageUpdate(userID int, chatID int64) bot.Update {
+	return bot.Update{
+		Message: &bot.Message{
+			MessageID: 7,
+			From:      &bot.User{ID: userID, FirstName: "Tester"},
+			Chat:      bot.Chat{ID: chatID, Type: bot.ChatTypeGroup},
+			Photo:     []bot.PhotoSize{{FileID: "photo-file-id", Width: 64, Height: 64}},
+		},
+	}
+}
+
+func TestAutomaticChecksInConfiguredChat(t *testing.T) {
+	useConfig(t, Config{SafetyWarningChatIDs: []int64{-100}, ModerationChatIDs: []int64{-100}})
+	database := useDatabase(t)
+
+	processUpdate(context.Background(), telegram.NewMock(), newGroupImageUpdate(1, -100))
+
+	if count, _ := database.CountQueuedJobs(); count != 2 {
+		t.Errorf("both automatic checks should be queued, but %d job(s) were queued", count)
+	}
+}
+
+func TestSkipAutomaticChecksOfBannedUser(t *testing.T) {
+	useConfig(t, Config{SafetyWarningChatIDs: []int64{-100}, ModerationChatIDs: []int64{-100}})
+	database := useDatabase(t)
+
+	if err := database.BanUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	processUpdate(context.Background(), telegram.NewMock(), newGroupImageUpdate(1, -100))
+
+	if count, _ := database.CountQueuedJobs(); count != 0 {
+		t.Errorf("automatic checks of banned user should not be queued, but %d job(s) were queued", count)
+	}
+}
+
+func TestSkipAutomaticChecksOfDisallowedUser(t *testing.T) {
+	useConfig(t, Config{SafetyWarningChatIDs: []int64{-100}, AllowedUserIDs: []int{2}})
+	database := useDatabase(t)
+
+	processUpdate(context.Background(), telegram.NewMock(), newGroupImageUpdate(1, -100))
+
+	if count, _ := database.CountQueuedJobs(); count != 0 {
+		t.Errorf("automatic checks of disallowed user should not be queued, but %d job(s) were queued", count)
+	}
+}
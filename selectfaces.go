@@ -0,0 +1,332 @@
+package main
+
+// functions for censoring or masking only selected faces
+//
+// faces are detected and numbered on a preview first, then only the faces selected from its inline keyboards are processed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for selecting faces
+const (
+	faceSelectionTTL = 1 * time.Hour // selections older than this will be forgotten
+
+	faceSelectionCallbackPrefix = "@" // (not used in file ids)
+	faceSelectionActionAll      = "all"
+	faceSelectionActionApply    = "apply"
+	faceSelectionActionCancel   = "cancel"
+
+	faceSelectionButtonsPerRow = 5
+	faceSelectedMark           = "✅"
+
+	selectedFacesSeparator = "," // (in the argument of a job)
+)
+
+// face selection struct for a preview which is waiting for faces to be selected
+type faceSelection struct {
+	fileID    string
+	command   CognitiveCommand
+	selected  []bool
+	createdOn time.Time
+}
+
+// face selections, keyed by chat and message ids of their previews
+var faceSelections = map[string]*faceSelection{}
+var faceSelectionsLock sync.Mutex
+
+// key of a face selection
+func faceSelectionKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d/%d", chatID, messageID)
+}
+
+// check if faces can be selected for given command
+func isFaceSelectable(command CognitiveCommand) bool {
+	return command == CensorEyes || command == MaskFaces
+}
+
+// return a new context with given indices of selected faces (starting from 1)
+func withSelectedFaces(ctx context.Context, selected string) context.Context {
+	indices := map[int]bool{}
+	for _, s := range strings.Split(selected, selectedFacesSeparator) {
+		if i, err := strconv.Atoi(s); err == nil {
+			indices[i] = true
+		}
+	}
+
+	return context.WithValue(ctx, contextKeySelectedFaces, indices)
+}
+
+// check if the face at given index (starting from 0) is selected in given context
+//
+// (all faces are selected when there is no selection)
+func isFaceSelected(ctx context.Context, index int) bool {
+	if indices, exists := ctx.Value(contextKeySelectedFaces).(map[int]bool); exists {
+		return indices[index+1]
+	}
+
+	return true
+}
+
+// detect faces on given image, and send a numbered preview with inline keyboards for selecting them
+//
+// (when there are less than 2 faces, the command will be processed as it is)
+func processFaceSelection(b Messenger, chatID int64, userID int, messageIDToDelete int, fileID, fileUniqueID, fileURL string, command CognitiveCommand) {
+	errorMessage := ""
+
+	ctx, cancel := context.WithTimeout(jobContext(chatID, messageIDToDelete), commandTimeout(command))
+	defer cancel()
+
+	// 'typing...'
+	b.SendChatAction(chatID, bot.ChatActionTyping)
+
+	if imageBytes, err := loadImage(ctx, fileURL); err == nil {
+		imageBytes = uprightImage(imageBytes)
+
+		if faces, err := visionFor(command).DetectFaces(ctx, imageBytes, false, false, nil); err == nil {
+			if len(faces) < 2 {
+				processImage(b, chatID, userID, messageIDToDelete, fileID, fileUniqueID, fileURL, command, "", func(ctx context.Context, fileURL string) ([]byte, error) {
+					return imageBytes, nil
+				})
+				sendRerunKeyboard(b, chatID, userID, MediaImage, fileID)
+
+				return
+			}
+
+			if img, _, err := image.Decode(bytes.NewReader(imageBytes)); err == nil {
+				// number detected faces
+				newImg, gc, fc, fontSize := prepareAnnotation(img)
+				for i, f := range faces {
+					color := colorForIndex(i)
+					gc.SetStrokeColor(color)
+					fc.SetSrc(&image.Uniform{color})
+
+					drawRectangle(gc, f.FaceRectangle)
+					drawLabel(fc, fmt.Sprintf("#%d", i+1), f.FaceRectangle, fontSize)
+				}
+				gc.Save()
+
+				if preview, err := encodeImage(newImg); err == nil {
+					if preview, err = convertToJPEG(preview, jpegQualityFor(userID)); err == nil {
+						selection := &faceSelection{
+							fileID:    fileID,
+							command:   command,
+							selected:  make([]bool, len(faces)),
+							createdOn: time.Now(),
+						}
+
+						if sent := b.SendPhoto(chatID, bot.InputFileFromBytes(preview), map[string]interface{}{
+							"caption": fmt.Sprintf(localizeFor(userID, messageActionFaces), command),
+							"reply_markup": bot.InlineKeyboardMarkup{
+								InlineKeyboard: genFaceSelectionInlineKeyboards(selection),
+							},
+						}); sent.Ok {
+							saveFaceSelection(chatID, sent.Result.MessageID, selection)
+						} else {
+							errorMessage = fmt.Sprintf("Failed to send image: %s", *sent.Description)
+						}
+					} else {
+						errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
+					}
+				} else {
+					errorMessage = fmt.Sprintf("Failed to encode image: %s", err)
+				}
+			} else {
+				errorMessage = fmt.Sprintf("Failed to decode image: %s", err)
+			}
+		} else {
+			errorMessage = fmt.Sprintf("Failed to detect faces: %s", err)
+		}
+	} else {
+		errorMessage = openImageErrorMessage(userID, err)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), command)
+	} else if isCanceled(ctx) {
+		errorMessage = localizeFor(userID, messageCanceled)
+	}
+
+	// delete status message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// if there was any error, send it back
+	if errorMessage != "" {
+		b.SendMessage(chatID, errorMessage, nil)
+
+		logJobError(errorMessage, chatID, userID, command, fileID)
+	}
+}
+
+// save a face selection, and forget old ones
+func saveFaceSelection(chatID int64, messageID int, selection *faceSelection) {
+	faceSelectionsLock.Lock()
+	defer faceSelectionsLock.Unlock()
+
+	for key, s := range faceSelections {
+		if time.Since(s.createdOn) > faceSelectionTTL {
+			delete(faceSelections, key)
+		}
+	}
+
+	faceSelections[faceSelectionKey(chatID, messageID)] = selection
+}
+
+// generate inline keyboards for toggling faces of given selection
+func genFaceSelectionInlineKeyboards(selection *faceSelection) [][]bot.InlineKeyboardButton {
+	keyboards := [][]bot.InlineKeyboardButton{}
+
+	row := []bot.InlineKeyboardButton{}
+	for i, selected := range selection.selected {
+		text := fmt.Sprintf("#%d", i+1)
+		if selected {
+			text = faceSelectedMark + " " + text
+		}
+		data := genCallbackData(selection.command, faceSelectionCallbackPrefix+strconv.Itoa(i+1))
+		row = append(row, bot.InlineKeyboardButton{Text: text, CallbackData: &data})
+
+		if len(row) >= faceSelectionButtonsPerRow {
+			keyboards = append(keyboards, row)
+			row = []bot.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		keyboards = append(keyboards, row)
+	}
+
+	all := genCallbackData(selection.command, faceSelectionCallbackPrefix+faceSelectionActionAll)
+	apply := genCallbackData(selection.command, faceSelectionCallbackPrefix+faceSelectionActionApply)
+	cancel := genCallbackData(selection.command, faceSelectionCallbackPrefix+faceSelectionActionCancel) // (preview is a photo, so it cannot be edited like other messages)
+
+	return append(keyboards, []bot.InlineKeyboardButton{
+		bot.InlineKeyboardButton{Text: "All", CallbackData: &all},
+		bot.InlineKeyboardButton{Text: "Apply", CallbackData: &apply},
+		bot.InlineKeyboardButton{Text: strings.Title(commandCancel), CallbackData: &cancel},
+	})
+}
+
+// check if given callback data is for selecting faces
+func isFaceSelectionCallback(data string) bool {
+	_, target, err := parseCallbackData(data)
+
+	return err == nil && strings.HasPrefix(target, faceSelectionCallbackPrefix)
+}
+
+// process callback query for selecting faces:
+//
+// toggle a face (or all of them), or enqueue the command for selected faces
+//
+// (applying runs the command again, so it is also checked and saved for quotas)
+func processFaceSelectionCallback(ctx context.Context, b Messenger, query bot.CallbackQuery, username string) {
+	command, target, err := parseCallbackData(*query.Data)
+	if err != nil || query.Message == nil {
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	language := languageFor(query.From.ID)
+	action := strings.TrimPrefix(target, faceSelectionCallbackPrefix)
+
+	if action == faceSelectionActionApply && !acceptPaidCallback(b, query, username, command) {
+		return
+	}
+
+	options := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}
+
+	faceSelectionsLock.Lock()
+	selection, exists := faceSelections[faceSelectionKey(chatID, messageID)]
+	if !exists {
+		faceSelectionsLock.Unlock()
+
+		b.EditMessageReplyMarkup(options)
+		b.SendMessage(chatID, localize(language, messageFacesExpired), nil)
+		return
+	}
+
+	selected := []string{}
+	switch action {
+	case faceSelectionActionCancel:
+		delete(faceSelections, faceSelectionKey(chatID, messageID))
+	case faceSelectionActionAll:
+		for i := range selection.selected {
+			selection.selected[i] = true
+		}
+	case faceSelectionActionApply:
+		for i, s := range selection.selected {
+			if s {
+				selected = append(selected, strconv.Itoa(i+1))
+			}
+		}
+		if len(selected) > 0 {
+			delete(faceSelections, faceSelectionKey(chatID, messageID))
+		}
+	default:
+		if i, err := strconv.Atoi(action); err == nil && i >= 1 && i <= len(selection.selected) {
+			selection.selected[i-1] = !selection.selected[i-1]
+		}
+	}
+	keyboards := genFaceSelectionInlineKeyboards(selection)
+	faceSelectionsLock.Unlock()
+
+	if action == faceSelectionActionCancel {
+		b.DeleteMessage(chatID, messageID)
+		return
+	}
+
+	if action != faceSelectionActionApply {
+		// update toggled buttons
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboards,
+		}
+		if edited := b.EditMessageReplyMarkup(options); !edited.Ok {
+			logger.Error(fmt.Sprintf("Failed to edit inline keyboards: %s", *edited.Description))
+		}
+		return
+	}
+
+	if len(selected) <= 0 {
+		b.SendMessage(chatID, localize(language, messageNoFaceSelected), nil)
+		return
+	}
+
+	// remove inline keyboards, and enqueue the command for selected faces
+	b.EditMessageReplyMarkup(options)
+
+	if sent := b.SendMessage(chatID, fmt.Sprintf(localize(language, messageProcessingFaces), command, strings.Join(selected, ", #")), map[string]interface{}{
+		"reply_to_message_id": messageID,
+		"reply_markup": bot.InlineKeyboardMarkup{
+			InlineKeyboard: genJobCancelInlineKeyboards(),
+		},
+	}); sent.Ok {
+		if err := enqueueJob(ctx, Job{
+			Kind:      JobKindImage,
+			ChatID:    chatID,
+			UserID:    query.From.ID,
+			MessageID: sent.Result.MessageID,
+			FileIDs:   []string{selection.fileID},
+			Command:   command,
+			Argument:  strings.Join(selected, selectedFacesSeparator),
+		}); err != nil {
+			logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+			b.EditMessageText(localize(language, messageFailedToEnqueue), map[string]interface{}{
+				"chat_id":    chatID,
+				"message_id": sent.Result.MessageID,
+			})
+		}
+	} else {
+		logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+// functions for user commands and preferences
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// user commands
+const (
+	userCommandStart     = "/start"
+	userCommandHelp      = "/help"
+	userCommandStats     = "/stats"
+	userCommandCancel    = "/cancel"
+	userCommandDocuments = "/documents"
+	userCommandFormat    = "/format"
+	userCommandQuality   = "/quality"
+	userCommandDefault   = "/default"
+	userCommandSettings  = "/settings"
+	userCommandLanguage  = "/language"
+	userCommandDeveloper = "/developer"
+	userCommandHistory   = "/history"
+	userCommandExport    = "/export"
+	userCommandForgetMe  = "/forgetme"
+)
+
+// preference keys
+const (
+	preferenceSendAsDocument = "send-as-document"
+	preferenceOutputFormat   = "output-format"
+	preferenceJPEGQuality    = "jpeg-quality"
+	preferenceDefaultAction  = "default-action"
+	preferenceLanguage       = "language"
+	preferenceDeveloperMode  = "developer-mode"
+)
+
+// check if given message is a user command
+func isUserCommand(message *bot.Message) bool {
+	if message.From == nil || !message.HasText() {
+		return false
+	}
+
+	command, _ := parseCommand(*message.Text)
+	switch command {
+	case userCommandStart, userCommandHelp, userCommandStats, userCommandCancel,
+		userCommandDocuments, userCommandFormat, userCommandQuality, userCommandDefault, userCommandSettings, userCommandLanguage,
+		userCommandDeveloper, userCommandHistory, userCommandExport, userCommandForgetMe:
+		return true
+	}
+
+	return false
+}
+
+// check if given message is an unknown slash command
+func isUnknownCommand(message *bot.Message) bool {
+	if !message.HasText() {
+		return false
+	}
+
+	command, _ := parseCommand(*message.Text)
+
+	return command != "" && command != userCommandRemember && !isUserCommand(message) && !isAdminCommand(message)
+}
+
+// commands for the command menu of Telegram
+func botCommands() []bot.BotCommand {
+	return []bot.BotCommand{
+		{Command: strings.TrimPrefix(userCommandHelp, "/"), Description: "Show how to use this bot"},
+		{Command: strings.TrimPrefix(userCommandSettings, "/"), Description: "Show your current settings"},
+		{Command: strings.TrimPrefix(userCommandDefault, "/"), Description: "Set a default action for images"},
+		{Command: strings.TrimPrefix(userCommandDocuments, "/"), Description: "Receive result images as documents (on/off)"},
+		{Command: strings.TrimPrefix(userCommandFormat, "/"), Description: "Set the format of result documents"},
+		{Command: strings.TrimPrefix(userCommandQuality, "/"), Description: "Set the quality of JPEG images"},
+		{Command: strings.TrimPrefix(userCommandLanguage, "/"), Description: "Set the language of messages"},
+		{Command: strings.TrimPrefix(userCommandDeveloper, "/"), Description: "Attach raw responses of APIs to results (on/off)"},
+		{Command: strings.TrimPrefix(userCommandHistory, "/"), Description: "Show your recent analyses in this chat"},
+		{Command: strings.TrimPrefix(userCommandStats, "/"), Description: "Show your usage"},
+		{Command: strings.TrimPrefix(userCommandExport, "/"), Description: "Export your data stored in this bot"},
+		{Command: strings.TrimPrefix(userCommandForgetMe, "/"), Description: "Delete your data stored in this bot"},
+		{Command: strings.TrimPrefix(userCommandCancel, "/"), Description: "Cancel the current operation"},
+	}
+}
+
+// process user command, and return the result message
+func processUserCommand(message *bot.Message) string {
+	command, argument := parseCommand(*message.Text)
+	userID := message.From.ID
+
+	// (commands which do not need the database)
+	switch command {
+	case userCommandStart:
+		// deep link with a command (eg. https://t.me/botname?start=ocr)
+		if argument != "" {
+			if action, exists := parseDeepLinkPayload(argument); exists {
+				startConversation(message.Chat.ID, userID, action, nil)
+
+				return fmt.Sprintf(localizeFor(userID, messageSendImageFor), action)
+			}
+		}
+		return localizeFor(userID, messageHelp)
+	case userCommandHelp:
+		return localizeFor(userID, messageHelp)
+	case userCommandCancel:
+		if _, exists := takeConversation(message.Chat.ID, userID); exists {
+			return localizeFor(userID, messageCanceled)
+		}
+		return "Nothing to cancel."
+	}
+
+	if db == nil {
+		return localizeFor(userID, messageNoDatabase)
+	}
+
+	switch command {
+	case userCommandStats:
+		return userStats(userID)
+	case userCommandForgetMe:
+		return forgetUser(message.Chat, userID, argument)
+	case userCommandDocuments:
+		switch argument {
+		case "on", "off":
+			if err := setBoolPreference(userID, preferenceSendAsDocument, argument == "on"); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		case "":
+			// show current setting
+		default:
+			return fmt.Sprintf("Usage: %s on|off", userCommandDocuments)
+		}
+
+		if getBoolPreference(userID, preferenceSendAsDocument) {
+			return "Result images will be sent as documents."
+		}
+		return "Result images will be sent as photos."
+	case userCommandDeveloper:
+		switch argument {
+		case "on", "off":
+			if err := setBoolPreference(userID, preferenceDeveloperMode, argument == "on"); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		case "":
+			// show current setting
+		default:
+			return fmt.Sprintf("Usage: %s on|off", userCommandDeveloper)
+		}
+
+		if isDeveloperMode(userID) {
+			return "Raw JSON responses of Cognitive Services will be attached to results. (Results will not be cached.)"
+		}
+		return "Raw JSON responses will not be attached to results."
+	case userCommandFormat:
+		switch argument {
+		case outputFormatPNG, outputFormatJPEG, outputFormatWebP:
+			if err := db.SetPreference(userID, preferenceOutputFormat, argument); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		case "":
+			// show current setting
+		default:
+			return fmt.Sprintf("Usage: %s %s|%s|%s", userCommandFormat, outputFormatPNG, outputFormatJPEG, outputFormatWebP)
+		}
+
+		return fmt.Sprintf("Result documents will be sent in %s.", strings.ToUpper(outputFormatFor(userID)))
+	case userCommandQuality:
+		if argument != "" {
+			quality, err := strconv.Atoi(argument)
+			if err != nil || !isValidJPEGQuality(quality) {
+				return fmt.Sprintf("Usage: %s 1-100", userCommandQuality)
+			}
+			if err := db.SetPreference(userID, preferenceJPEGQuality, argument); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		}
+
+		return fmt.Sprintf("Quality of JPEG (and WebP) images is %d.", jpegQualityFor(userID))
+	case userCommandDefault:
+		switch argument {
+		case "off":
+			if err := db.SetPreference(userID, preferenceDefaultAction, ""); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		case "":
+			// show current setting
+		default:
+			action, exists := findCommand(argument, MediaImage)
+			if !exists || !isDirectlyRunnable(action) {
+				return fmt.Sprintf("Usage: %s <action>|off\n\n(action can be the name of any action for images, except for %s and %s)", userCommandDefault, VerifyFaces, SmartCrop)
+			}
+			if err := db.SetPreference(userID, preferenceDefaultAction, string(action)); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		}
+
+		if action, exists := defaultActionFor(userID); exists {
+			return fmt.Sprintf("Images will be processed with '%s' right away. (Send %s off for choosing actions again.)", action, userCommandDefault)
+		}
+		return "Actions for images will be chosen from the keyboard."
+	case userCommandLanguage:
+		switch argument {
+		case languageAuto:
+			if err := db.SetPreference(userID, preferenceLanguage, ""); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		case "":
+			// show current setting
+		default:
+			language := strings.ToLower(argument)
+			if !isSupportedLanguage(language) {
+				return fmt.Sprintf(localizeFor(userID, messageLanguageUsage), strings.Join(append(supportedLanguages(), languageAuto), "|"))
+			}
+			if err := db.SetPreference(userID, preferenceLanguage, language); err != nil {
+				return fmt.Sprintf("Failed to save preference: %s", err)
+			}
+		}
+
+		return fmt.Sprintf(localizeFor(userID, messageLanguage), languageFor(userID))
+	case userCommandSettings:
+		documents := "off"
+		if getBoolPreference(userID, preferenceSendAsDocument) {
+			documents = "on"
+		}
+		action := "none"
+		if a, exists := defaultActionFor(userID); exists {
+			action = string(a)
+		}
+		developer := "off"
+		if isDeveloperMode(userID) {
+			developer = "on"
+		}
+		language := getPreference(userID, preferenceLanguage)
+		if language == "" {
+			language = languageAuto
+		}
+
+		return fmt.Sprintf(`Current settings:
+
+%s %s
+%s %s
+%s %d
+%s %s
+%s %s
+%s %s`,
+			userCommandDocuments, documents,
+			userCommandFormat, outputFormatFor(userID),
+			userCommandQuality, jpegQualityFor(userID),
+			userCommandDefault, action,
+			userCommandLanguage, language,
+			userCommandDeveloper, developer,
+		)
+	}
+
+	return localizeFor(userID, messageUnprocessable)
+}
+
+// get a boolean preference of a user
+func getBoolPreference(userID int, key string) bool {
+	if db == nil {
+		return false
+	}
+
+	value, err := db.GetPreference(userID, key)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get preference '%s': %s", key, err))
+	}
+
+	return value == "true"
+}
+
+// get a preference of a user (empty string if not set)
+func getPreference(userID int, key string) string {
+	if db == nil {
+		return ""
+	}
+
+	value, err := db.GetPreference(userID, key)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get preference '%s': %s", key, err))
+	}
+
+	return value
+}
+
+// set a boolean preference of a user
+func setBoolPreference(userID int, key string, value bool) error {
+	return db.SetPreference(userID, key, fmt.Sprintf("%t", value))
+}
@@ -0,0 +1,152 @@
+package main
+
+// functions for finding similar faces on earlier images of each chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// constants for finding similar faces
+const (
+	maxFacesPerSimilarSearch = 10
+	maxSimilarCandidates     = 5
+
+	// modes of finding similar faces
+	similarModeMatchPerson = "matchPerson"
+	similarModeMatchFace   = "matchFace"
+)
+
+func init() {
+	registerCommand(newCommand(FindSimilar, "S", handleFindSimilar), MediaImage)
+
+	// saved faces differ in each chat, and grow over time
+	uncachedCommands[FindSimilar] = true
+}
+
+// id of the face list for given chat
+func faceListID(chatID int64) string {
+	return fmt.Sprintf("chat_%d", chatID)
+}
+
+// find faces on earlier images of the chat which are similar to the faces on given image bytes,
+// then save the faces for later searches
+func handleFindSimilar(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	chatID, exists := chatIDFromContext(ctx)
+	if !exists {
+		return result, errors.New("No chat for finding similar faces.")
+	}
+	fileID, _ := fileIDFromContext(ctx)
+
+	faces, err := cognitive.DetectFaces(ctx, imageBytes, true, false, nil)
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+	if len(faces) > maxFacesPerSimilarSearch {
+		faces = faces[:maxFacesPerSimilarSearch]
+	}
+
+	listID := faceListID(chatID)
+	if err = cognitive.CreateFaceList(ctx, listID); err != nil {
+		return result, fmt.Errorf("Failed to create face list: %s", err)
+	}
+
+	savedFileIDs, err := db.GetFaceFileIDs(chatID)
+	if err != nil {
+		return result, fmt.Errorf("Failed to load saved faces: %s", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+	strs := []string{}
+	related := map[string]bool{}
+	for i, f := range faces {
+		// search only when there are saved faces
+		var similars []SimilarFace
+		if len(savedFileIDs) > 0 {
+			if similars, err = cognitive.FindSimilarFaces(ctx, f.FaceID, listID, maxSimilarCandidates, similarModeMatchPerson); err != nil {
+				return result, fmt.Errorf("Failed to find similar faces: %s", err)
+			}
+		}
+
+		// earlier images with similar faces (except this image)
+		fileIDs := []string{}
+		confidence := 0.0
+		for _, s := range similars {
+			if similarFileID, exists := savedFileIDs[s.PersistedFaceID]; exists && similarFileID != fileID {
+				if !related[similarFileID] {
+					related[similarFileID] = true
+					result.Related = append(result.Related, similarFileID)
+				}
+				fileIDs = append(fileIDs, similarFileID)
+
+				if s.Confidence > confidence {
+					confidence = s.Confidence
+				}
+			}
+		}
+
+		// set color
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		fc.SetSrc(&image.Uniform{color})
+
+		// draw rectangles and numbers on detected faces
+		drawRectangle(gc, f.FaceRectangle)
+		drawLabel(fc, fmt.Sprintf("#%d", i+1), f.FaceRectangle, fontSize)
+
+		if len(fileIDs) > 0 {
+			strs = append(strs, fmt.Sprintf("[Face #%d] Found on %d earlier image(s) (%.3f%%)", i+1, len(fileIDs), confidence*100.0))
+		} else {
+			strs = append(strs, fmt.Sprintf("[Face #%d] Not found on earlier images", i+1))
+		}
+	}
+	gc.Save()
+
+	// save faces on this image for later searches
+	if fileID != "" {
+		saveFaces(ctx, chatID, fileID, listID, imageBytes, faces)
+	}
+
+	result.Message = strings.Join(strs, "\n")
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// save detected faces on an image to the face list of the chat
+//
+// (failures are only logged, for they should not fail the search)
+func saveFaces(ctx context.Context, chatID int64, fileID, listID string, imageBytes []byte, faces []DetectedFace) {
+	if saved, err := db.HasFaces(chatID, fileID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to check saved faces: %s", err))
+		return
+	} else if saved {
+		return
+	}
+
+	for _, f := range faces {
+		if persistedFaceID, err := cognitive.AddFaceListFace(ctx, listID, imageBytes, f.FaceRectangle, ""); err == nil {
+			if err := db.SaveFace(chatID, fileID, persistedFaceID); err != nil {
+				logger.Error(fmt.Sprintf("Failed to save face: %s", err))
+			}
+		} else {
+			logger.Warn(fmt.Sprintf("Failed to add face to face list: %s", err))
+		}
+	}
+}
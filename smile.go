@@ -0,0 +1,115 @@
+package main
+
+// functions for the smile contest of group photos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+
+	"github.com/llgcode/draw2d/draw2dimg"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+)
+
+// color of the crown
+var crownColor = color.RGBA{255, 200, 0, 255} // gold
+
+// medals for the leaderboard
+var smileMedals = []string{"🥇", "🥈", "🥉"}
+
+func init() {
+	registerCommand(newCommand(SmileContest, "SM", handleSmileContest), MediaImage, MediaVideo, MediaAlbum)
+}
+
+// rank faces on given image bytes by their smiles, and crown the winner
+func handleSmileContest(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	faces, err := visionFor(SmileContest).DetectFaces(ctx, imageBytes, false, false, []string{"smile"})
+	if err != nil {
+		return result, fmt.Errorf("Failed to detect faces: %s", err)
+	}
+	if len(faces) <= 0 {
+		return result, errors.New("No face detected on this image.")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return result, fmt.Errorf("Failed to decode image: %s", err)
+	}
+
+	// rank faces (indices of faces, in the order of their smiles)
+	ranks := make([]int, len(faces))
+	for i := range ranks {
+		ranks[i] = i
+	}
+	sort.SliceStable(ranks, func(i, j int) bool {
+		return faces[ranks[i]].FaceAttributes.Smile > faces[ranks[j]].FaceAttributes.Smile
+	})
+
+	newImg, gc, fc, fontSize := prepareAnnotation(img)
+
+	lines := []string{}
+	for rank, i := range ranks {
+		f := faces[i]
+
+		// label faces with their ranks
+		color := colorForIndex(i)
+		gc.SetStrokeColor(color)
+		fc.SetSrc(&image.Uniform{color})
+		drawRectangle(gc, f.FaceRectangle)
+		drawLabel(fc, fmt.Sprintf("#%d", rank+1), f.FaceRectangle, fontSize)
+
+		medal := fmt.Sprintf("%d.", rank+1)
+		if rank < len(smileMedals) {
+			medal = smileMedals[rank]
+		}
+		lines = append(lines, fmt.Sprintf("%s Face #%d: %.1f%% smile", medal, rank+1, f.FaceAttributes.Smile*100.0))
+	}
+
+	// crown the winner
+	drawCrown(gc, faces[ranks[0]].FaceRectangle)
+	gc.Save()
+
+	if len(faces) > 1 {
+		result.Message = fmt.Sprintf("👑 Face #1 smiles the most!\n\n%s", strings.Join(lines, "\n"))
+	} else {
+		result.Message = fmt.Sprintf("👑 The only face wins by default!\n\n%s", strings.Join(lines, "\n"))
+	}
+
+	if result.Image, err = encodeImage(newImg); err != nil {
+		return result, fmt.Errorf("Failed to encode image: %s", err)
+	}
+
+	return result, nil
+}
+
+// draw a crown above given face rectangle
+func drawCrown(gc *draw2dimg.GraphicContext, rect cog.Rectangle) {
+	width := float64(rect.Width) * 0.8
+	height := width * 0.5
+	left := float64(rect.Left) + (float64(rect.Width)-width)/2.0
+	bottom := float64(rect.Top) - conf().StrokeWidth
+
+	gc.SetStrokeColor(crownColor)
+	gc.SetFillColor(crownColor)
+
+	// base, and three spikes
+	gc.MoveTo(left, bottom)
+	gc.LineTo(left, bottom-height)
+	gc.LineTo(left+width*0.25, bottom-height*0.45)
+	gc.LineTo(left+width*0.5, bottom-height)
+	gc.LineTo(left+width*0.75, bottom-height*0.45)
+	gc.LineTo(left+width, bottom-height)
+	gc.LineTo(left+width, bottom)
+	gc.LineTo(left, bottom)
+	gc.Close()
+	gc.FillStroke()
+
+	gc.SetFillColor(color.Transparent)
+}
@@ -0,0 +1,163 @@
+package main
+
+// functions for processing voice messages and audio files
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for Speech-to-Text
+const (
+	speechAPIPath         = "/speech/recognition/conversation/cognitiveservices/v1"
+	defaultSpeechLanguage = "en-US"
+
+	audioConverterCommand = "ffmpeg" // also used for extracting frames from videos
+)
+
+func init() {
+	registerCommand(newCommand(Transcribe, "V", handleTranscribe), MediaAudio)
+}
+
+// SpeechResult struct for the result of speech recognition
+type SpeechResult struct {
+	RecognitionStatus string `json:"RecognitionStatus"`
+	DisplayText       string `json:"DisplayText"`
+	Offset            int64  `json:"Offset"`
+	Duration          int64  `json:"Duration"`
+}
+
+// transcribe given audio bytes
+//
+// (supported content types: "audio/ogg; codecs=opus", "audio/wav; codecs=audio/pcm; samplerate=16000")
+func transcribeBytes(ctx context.Context, audio []byte, contentType string) (result SpeechResult, err error) {
+	language := conf().MsSpeechLanguage
+	if language == "" {
+		language = defaultSpeechLanguage
+	}
+
+	params := url.Values{}
+	params.Set("language", language)
+
+	err = postBytes(
+		ctx,
+		fmt.Sprintf("%s%s?%s", fmt.Sprintf(currentCloud().sttURLFormat, regionOrDefault(conf().MsSpeechRegion)), speechAPIPath, params.Encode()),
+		conf().MsSpeechSubscriptionKey,
+		contentType,
+		audio,
+		&result,
+	)
+
+	return result, err
+}
+
+// process requested audio processing
+func processAudio(b Messenger, chatID int64, userID int, messageIDToDelete int, fileURL string, command CognitiveCommand) {
+	errorMessage := ""
+
+	// edit the status message with progress periodically
+	progress := startProgress(b, chatID, messageIDToDelete, userID, command)
+
+	ctx, cancel := context.WithTimeout(withProgress(jobContext(chatID, messageIDToDelete), progress), commandTimeout(command))
+	defer cancel()
+
+	// 'typing...'
+	b.SendChatAction(chatID, bot.ChatActionTyping)
+
+	progress.setStage(messageStageDownloading)
+	if audioBytes, err := downloadBytes(ctx, fileURL); err == nil {
+		if result, err := runCommand(ctx, audioBytes, command, progress.setStage); err == nil {
+			// send result text
+			if sentMessageID, err := sendLongText(b, chatID, result.Message, fmt.Sprintf(localizeFor(userID, messageResultCaption), command), nil); err == nil {
+				saveHistory(chatID, userID, sentMessageID, command, result.Message)
+				publishResult(b, chatID, userID, sentMessageID, command, result)
+			} else {
+				errorMessage = fmt.Sprintf("Failed to send result: %s", err)
+			}
+		} else {
+			errorMessage = err.Error()
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to open audio: %s", err)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), command)
+	} else if isCanceled(ctx) {
+		errorMessage = messageCanceled
+	}
+
+	progress.stop()
+
+	// delete original message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// if there was any error, send it back
+	if errorMessage != "" {
+		b.SendMessage(chatID, localizeFor(userID, errorMessage), nil)
+
+		logJobError(errorMessage, chatID, userID, command, "")
+	}
+}
+
+// transcribe given audio bytes
+func handleTranscribe(ctx context.Context, audioBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	contentType := "audio/ogg; codecs=opus"
+
+	// voice messages are in ogg/opus, but other audio files need to be converted
+	if !isOgg(audioBytes) {
+		if audioBytes, err = convertToWav(ctx, audioBytes); err != nil {
+			return result, fmt.Errorf("Failed to convert audio: %s", err)
+		}
+		contentType = "audio/wav; codecs=audio/pcm; samplerate=16000"
+	}
+
+	if recognized, err := cognitive.Transcribe(ctx, audioBytes, contentType); err == nil {
+		if recognized.RecognitionStatus == "Success" && len(strings.TrimSpace(recognized.DisplayText)) > 0 {
+			result.Message = recognized.DisplayText
+		} else {
+			return result, fmt.Errorf("Could not transcribe given audio. (%s)", recognized.RecognitionStatus)
+		}
+	} else {
+		return result, fmt.Errorf("Failed to transcribe audio: %s", err)
+	}
+
+	return result, nil
+}
+
+// check if given bytes are of an ogg file
+func isOgg(data []byte) bool {
+	return len(data) >= 4 && string(data[0:4]) == "OggS"
+}
+
+// convert given audio bytes to 16kHz mono PCM wav
+func convertToWav(ctx context.Context, audio []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(
+		ctx,
+		audioConverterCommand,
+		"-i", "pipe:0",
+		"-ac", "1",
+		"-ar", "16000",
+		"-acodec", "pcm_s16le",
+		"-f", "wav",
+		"pipe:1",
+	)
+	cmd.Stdin = bytes.NewReader(audio)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+// functions for processing stickers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	// for decoding WEBP images
+	"golang.org/x/image/webp"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// get file id of the sticker in given message
+//
+// (animated and video stickers are not included, for they cannot be processed)
+func stickerFileID(message *bot.Message) (fileID string, exists bool) {
+	if message.HasSticker() && !isUnsupportedSticker(message) {
+		return message.Sticker.FileID, true
+	}
+
+	return "", false
+}
+
+// check if given message has an animated (TGS) or video (WEBM) sticker
+func isUnsupportedSticker(message *bot.Message) bool {
+	return message.HasSticker() && (message.Sticker.IsAnimated || message.Sticker.IsVideo)
+}
+
+// download a sticker from given url, and convert it to a PNG image
+//
+// (only static WEBP stickers are supported)
+func loadSticker(ctx context.Context, fileURL string) ([]byte, error) {
+	data, err := downloadBytes(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isWEBP(data) {
+		return nil, fmt.Errorf("Only static stickers are supported.")
+	}
+
+	config, err := webp.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err = checkImageDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Cognitive Services do not accept WEBP images
+	return encodeImage(img)
+}
+
+// check if given bytes are of a WEBP image
+func isWEBP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
@@ -0,0 +1,164 @@
+package main
+
+// functions for daily metrics, and daily summaries for admins
+//
+// (sent on `daily-summary-schedule`, to `daily-summary-chat-id` or admins)
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// constants for daily summaries
+const (
+	metricPrefixErrors  = "errors/"  // + service
+	metricPrefixLatency = "latency/" // + command
+
+	dailySummaryClaimTTL = time.Hour // (for sending it only once from multiple instances)
+)
+
+// record a daily metric with given value
+func recordMetric(metric string, value int64) {
+	if db == nil {
+		return
+	}
+
+	if err := db.IncreaseMetric(time.Now().Format(transactionDayFormat), metric, value); err != nil {
+		logger.Error(fmt.Sprintf("Failed to record metric: %s", err))
+	}
+}
+
+// count a failed request to given api url of Cognitive Services
+func countServiceError(apiURL string) {
+	if service := serviceOfURL(apiURL); service != "" {
+		recordMetric(metricPrefixErrors+service, 0)
+	}
+}
+
+// record the latency of a successful command
+func recordLatency(command CognitiveCommand, elapsed time.Duration) {
+	recordMetric(metricPrefixLatency+string(command), elapsed.Milliseconds())
+}
+
+// send daily summaries on the schedule, forever
+//
+// (the schedule is read every minute, so it can be changed with reloading config)
+func startDailySummary(b Messenger) {
+	if db == nil {
+		return
+	}
+
+	go func() {
+		// (at the start of every minute)
+		time.Sleep(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for now := time.Now(); ; now = <-ticker.C {
+			if conf().DailySummarySchedule == "" {
+				continue
+			}
+
+			if schedule, err := parseCronSchedule(conf().DailySummarySchedule); err == nil {
+				if schedule.matches(now) {
+					sendDailySummary(b, now)
+				}
+			} else {
+				logger.Error(fmt.Sprintf("Malformed daily summary schedule: %s", err))
+			}
+		}
+	}()
+}
+
+// send the summary of given day to the admin chat (or admins)
+func sendDailySummary(b Messenger, day time.Time) {
+	if coordinator != nil {
+		if claimed, err := coordinator.Claim(fmt.Sprintf("daily-summary:%s", day.Format("2006-01-02T15:04")), dailySummaryClaimTTL); err != nil || !claimed {
+			return
+		}
+	}
+
+	summary := dailySummary(day)
+
+	chatIDs := []int64{}
+	if conf().DailySummaryChatID != 0 {
+		chatIDs = append(chatIDs, conf().DailySummaryChatID)
+	} else {
+		for _, adminID := range conf().AdminUserIDs {
+			chatIDs = append(chatIDs, int64(adminID))
+		}
+	}
+
+	for _, chatID := range chatIDs {
+		if _, err := sendLongText(b, chatID, summary, "daily summary", nil); err != nil {
+			logger.Error(fmt.Sprintf("Failed to send daily summary to %d: %s", chatID, err))
+		}
+	}
+}
+
+// build up the summary of given day
+func dailySummary(day time.Time) string {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	to := from.AddDate(0, 0, 1)
+	dayString := from.Format(transactionDayFormat)
+
+	lines := []string{fmt.Sprintf("[Daily summary of %s]", dayString)}
+
+	users, err := db.CountUsersBetween(from, to)
+	if err != nil {
+		return fmt.Sprintf("Failed to count users: %s", err)
+	}
+	stats, err := db.CountRequestsPerCommandBetween(from, to)
+	if err != nil {
+		return fmt.Sprintf("Failed to count requests: %s", err)
+	}
+	metrics, err := db.GetMetrics(dayString)
+	if err != nil {
+		return fmt.Sprintf("Failed to load metrics: %s", err)
+	}
+
+	total := 0
+	for _, stat := range stats {
+		total += stat.Count
+	}
+	lines = append(lines, fmt.Sprintf("Requests: %d (from %d users)", total, users))
+	for _, stat := range stats {
+		line := fmt.Sprintf("  %s: %d", stat.Key, stat.Count)
+		if latency, exists := metrics[metricPrefixLatency+stat.Key]; exists && latency.Count > 0 {
+			line += fmt.Sprintf(" (avg. %.1fs)", float64(latency.Total)/float64(latency.Count)/1000)
+		}
+		lines = append(lines, line)
+	}
+
+	errors := []string{}
+	for metric, m := range metrics {
+		if strings.HasPrefix(metric, metricPrefixErrors) {
+			errors = append(errors, fmt.Sprintf("  %s: %d", strings.TrimPrefix(metric, metricPrefixErrors), m.Count))
+		}
+	}
+	sort.Strings(errors)
+	if len(errors) <= 0 {
+		errors = []string{"  (none)"}
+	}
+	lines = append(lines, "Errors of services:")
+	lines = append(lines, errors...)
+
+	if transactions, err := db.CountTransactionsPerService(dayString); err == nil {
+		lines = append(lines, "Transactions:")
+		counted := false
+		for _, service := range countedServices {
+			if count := transactions[service]; count > 0 {
+				lines = append(lines, fmt.Sprintf("  %s: %s", service, withBudget(count, conf().TransactionBudgetsPerDay[service])))
+				counted = true
+			}
+		}
+		if !counted {
+			lines = append(lines, "  (none)")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
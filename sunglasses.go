@@ -0,0 +1,43 @@
+package main
+
+// functions for the sunglasses of 'Deal With It'
+
+import (
+	"bytes"
+	"image"
+
+	// for embedding the default sunglasses
+	_ "embed"
+	"io/ioutil"
+
+	// for MS Cognitive Services
+	cog "github.com/meinside/ms-cognitive-services-go"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// default sunglasses (a transparent .png), embedded in the binary
+//
+//go:embed assets/sunglasses.png
+var defaultSunglassesBytes []byte
+
+// load sunglasses image from given filepath, or the default one if it is empty
+func loadSunglasses(filepath string) (image.Image, error) {
+	imgBytes := defaultSunglassesBytes
+	if filepath != "" {
+		var err error
+		if imgBytes, err = ioutil.ReadFile(filepath); err != nil {
+			return nil, err
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+
+	return img, err
+}
+
+// put sunglasses on given image, scaled and rotated to the pupils
+func drawSunglasses(img *image.RGBA, pupilLeft, pupilRight cog.Point) {
+	imaging.DrawSunglasses(img, loaded().sunglasses, imaging.Point{X: pupilLeft.X, Y: pupilLeft.Y}, imaging.Point{X: pupilRight.X, Y: pupilRight.Y})
+}
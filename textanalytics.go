@@ -0,0 +1,191 @@
+package main
+
+// functions for analyzing recognized texts with Text Analytics API
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for Text Analytics API
+const (
+	textanalyticsPath = "/text/analytics/v2.0"
+
+	// callback data for text analyses
+	textCommandSentiment  = "sentiment"
+	textCommandKeyPhrases = "keyphrases"
+
+	textSectionSentiment  = "[Sentiment]"
+	textSectionKeyPhrases = "[Key Phrases]"
+)
+
+// TextAnalyticsRequest struct for requests of Text Analytics API
+type TextAnalyticsRequest struct {
+	Documents []TextDocument `json:"documents"`
+}
+
+// TextDocument struct
+type TextDocument struct {
+	ID       string `json:"id"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// TextAnalyticsResult struct for the result of Text Analytics API
+type TextAnalyticsResult struct {
+	Documents []struct {
+		ID         string   `json:"id"`
+		Score      float64  `json:"score,omitempty"`
+		KeyPhrases []string `json:"keyPhrases,omitempty"`
+	} `json:"documents"`
+	Errors []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// base url of Text Analytics API
+func textanalyticsAPIURL() string {
+	return serviceAPIURL(conf().MsTextanalyticsEndpoint, conf().MsTextanalyticsRegion, textanalyticsPath)
+}
+
+// check if text analyses (or translation, reading aloud) are available for given command
+func textAnalysesAvailable(command CognitiveCommand) bool {
+	if !hasCredentials(serviceTextAnalytics, conf().MsTextanalyticsSubscriptionKey) && !translationAvailable() && !readAloudAvailable() {
+		return false
+	}
+
+	return command == ReadText
+}
+
+// analyze given text with Text Analytics API (`analysis` = "sentiment" or "keyPhrases")
+func analyzeText(ctx context.Context, analysis, text string) (result TextAnalyticsResult, err error) {
+	var data []byte
+	if data, err = json.Marshal(TextAnalyticsRequest{
+		Documents: []TextDocument{
+			TextDocument{ID: "1", Text: text},
+		},
+	}); err != nil {
+		return result, err
+	}
+
+	if err = postBytes(
+		ctx,
+		fmt.Sprintf("%s/%s", textanalyticsAPIURL(), analysis),
+		conf().MsTextanalyticsSubscriptionKey,
+		"application/json",
+		data,
+		&result,
+	); err != nil {
+		return result, err
+	}
+
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("%s", result.Errors[0].Message)
+	}
+	if len(result.Documents) <= 0 {
+		return result, fmt.Errorf("no analyzed document")
+	}
+
+	return result, nil
+}
+
+// check if given callback data is for text analyses
+func isTextAnalysisCallback(data string) bool {
+	return data == textCommandSentiment || data == textCommandKeyPhrases
+}
+
+// process callback query for text analyses,
+//
+// then append the result to the message and update its inline keyboards
+func processTextAnalysisCallback(b Messenger, query bot.CallbackQuery) {
+	if query.Message == nil || query.Message.Text == nil {
+		return
+	}
+
+	text := *query.Message.Text
+	original := originalText(text)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf().TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	var section string
+	switch *query.Data {
+	case textCommandSentiment:
+		if analyzed, err := cognitive.AnalyzeText(ctx, "sentiment", original); err == nil {
+			section = fmt.Sprintf("%s\n%.3f%% positive", textSectionSentiment, analyzed.Documents[0].Score*100.0)
+		} else {
+			section = fmt.Sprintf("%s\n(failed: %s)", textSectionSentiment, err)
+		}
+	case textCommandKeyPhrases:
+		if analyzed, err := cognitive.AnalyzeText(ctx, "keyPhrases", original); err == nil {
+			section = fmt.Sprintf("%s\n%s", textSectionKeyPhrases, strings.Join(analyzed.Documents[0].KeyPhrases, ", "))
+		} else {
+			section = fmt.Sprintf("%s\n(failed: %s)", textSectionKeyPhrases, err)
+		}
+	}
+	text = fmt.Sprintf("%s\n\n%s", text, section)
+
+	// edit message with appended result
+	options := map[string]interface{}{
+		"chat_id":    query.Message.Chat.ID,
+		"message_id": query.Message.MessageID,
+	}
+	if keyboards := genTextAnalysisInlineKeyboards(text); len(keyboards) > 0 {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboards,
+		}
+	}
+	if edited := b.EditMessageText(text, options); !edited.Ok {
+		logger.Error(fmt.Sprintf("Failed to edit message text: %s", *edited.Description))
+	}
+}
+
+// get the original text (without appended analyses) from given message text
+func originalText(text string) string {
+	for _, section := range []string{textSectionSentiment, textSectionKeyPhrases} {
+		if index := strings.Index(text, "\n\n"+section); index >= 0 {
+			text = text[:index]
+		}
+	}
+
+	return text
+}
+
+// generate inline keyboards for text analyses which are not applied to given text yet
+//
+// (and for translation and reading aloud, which can be applied multiple times)
+func genTextAnalysisInlineKeyboards(text string) [][]bot.InlineKeyboardButton {
+	buttons := []bot.InlineKeyboardButton{}
+
+	if hasCredentials(serviceTextAnalytics, conf().MsTextanalyticsSubscriptionKey) {
+		if !strings.Contains(text, "\n\n"+textSectionSentiment) {
+			data := signCallbackData(textCommandSentiment)
+			buttons = append(buttons, bot.InlineKeyboardButton{Text: "Sentiment", CallbackData: &data})
+		}
+		if !strings.Contains(text, "\n\n"+textSectionKeyPhrases) {
+			data := signCallbackData(textCommandKeyPhrases)
+			buttons = append(buttons, bot.InlineKeyboardButton{Text: "Key Phrases", CallbackData: &data})
+		}
+	}
+	if translationAvailable() {
+		data := signCallbackData(textCommandTranslate)
+		buttons = append(buttons, bot.InlineKeyboardButton{Text: "Translate", CallbackData: &data})
+	}
+	if readAloudAvailable() {
+		data := signCallbackData(textCommandReadAloud)
+		buttons = append(buttons, bot.InlineKeyboardButton{Text: "Read Aloud", CallbackData: &data})
+	}
+
+	if len(buttons) > 0 {
+		return [][]bot.InlineKeyboardButton{buttons}
+	}
+
+	return nil
+}
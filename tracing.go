@@ -0,0 +1,309 @@
+package main
+
+// functions for tracing updates with OpenTelemetry
+//
+// (spans of updates, jobs, downloads, calls to services, rendering, and sending are exported
+// to `tracing-otlp-endpoint` in OTLP/HTTP JSON, so no SDK is needed)
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// constants for tracing
+const (
+	defaultTracingServiceName = "telegram-ms-cognitive-bot"
+
+	tracingExportInterval  = 5 * time.Second
+	tracingExportTimeout   = 10 * time.Second
+	tracingMaxBatchSize    = 256
+	tracingMaxQueuedSpans  = 2048 // (spans are dropped when the exporter falls behind)
+	tracingInstrumentation = "github.com/meinside/telegram-ms-cognitive-bot"
+)
+
+// kinds of spans (as in OTLP)
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	spanKindConsumer = 5
+)
+
+// codes of span statuses (as in OTLP)
+const (
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+// span struct for a traced operation
+//
+// (nil when tracing is disabled, and all of its methods are no-ops then)
+type span struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+// context key for the current span
+type spanContextKey struct{}
+
+// ended spans which are waiting to be exported
+var endedSpans = make(chan *span, tracingMaxQueuedSpans)
+
+// check if tracing is enabled
+func isTracingEnabled() bool {
+	return conf().TracingOTLPEndpoint != ""
+}
+
+// start a new span with given name, as a child of the span in given context (or a new trace if there is none)
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if !isTracingEnabled() {
+		return ctx, nil
+	}
+
+	s := &span{
+		spanID:     randomHex(8),
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.traceID, s.parentSpanID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// set an attribute of the span
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.attributes[key] = value
+}
+
+// end the span with given error (nil on success), and queue it for exporting
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now()
+	s.err = err
+
+	select {
+	case endedSpans <- s:
+	default: // (queue is full)
+	}
+}
+
+// W3C traceparent of the span in given context (empty if there is none)
+//
+// (for continuing the trace in queued jobs)
+func traceParentOf(ctx context.Context) string {
+	if s, ok := ctx.Value(spanContextKey{}).(*span); ok && s != nil {
+		return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+	}
+
+	return ""
+}
+
+// context which continues the trace of given W3C traceparent
+//
+// (returns given context as it is when the traceparent is empty or malformed)
+func withTraceParent(ctx context.Context, traceParent string) context.Context {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+
+	// (a remote parent, which will not be exported from here)
+	return context.WithValue(ctx, spanContextKey{}, &span{traceID: parts[1], spanID: parts[2]})
+}
+
+// name of the service for given api url, or its host for other services (for naming spans)
+func serviceOrHostOf(apiURL string) string {
+	if service := serviceOfURL(apiURL); service != "" {
+		return service
+	}
+	if u, err := url.Parse(apiURL); err == nil {
+		return u.Host
+	}
+
+	return "unknown"
+}
+
+// generate random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// start exporting ended spans periodically
+func startTracing() {
+	go func() {
+		ticker := time.NewTicker(tracingExportInterval)
+		defer ticker.Stop()
+
+		batch := []*span{}
+		for {
+			select {
+			case s := <-endedSpans:
+				if batch = append(batch, s); len(batch) < tracingMaxBatchSize {
+					continue
+				}
+			case <-ticker.C:
+				if len(batch) <= 0 {
+					continue
+				}
+			}
+
+			if err := exportSpans(batch); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to export %d span(s): %s", len(batch), err))
+			}
+			batch = []*span{}
+		}
+	}()
+}
+
+// export given spans to the OTLP endpoint
+func exportSpans(spans []*span) error {
+	if !isTracingEnabled() {
+		return nil // (disabled while they were waiting)
+	}
+
+	serviceName := conf().TracingServiceName
+	if serviceName == "" {
+		serviceName = defaultTracingServiceName
+	}
+
+	otlpSpans := []map[string]interface{}{}
+	for _, s := range spans {
+		otlpSpans = append(otlpSpans, s.otlp())
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{
+						"service.name": serviceName,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": tracingInstrumentation},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingExportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", otlpTracesURL(conf().TracingOTLPEndpoint), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range conf().TracingOTLPHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// url of traces for given OTLP endpoint (eg. "http://localhost:4318" => "http://localhost:4318/v1/traces")
+func otlpTracesURL(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
+
+// the span in OTLP JSON
+func (s *span) otlp() map[string]interface{} {
+	status := map[string]interface{}{"code": spanStatusUnset}
+	if s.err != nil {
+		status = map[string]interface{}{"code": spanStatusError, "message": s.err.Error()}
+	}
+
+	otlp := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attributes),
+		"status":            status,
+	}
+	if s.parentSpanID != "" {
+		otlp["parentSpanId"] = s.parentSpanID
+	}
+
+	return otlp
+}
+
+// attributes in OTLP JSON
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	converted := []interface{}{}
+	for k, v := range attributes {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprintf("%v", v)}
+		}
+
+		converted = append(converted, map[string]interface{}{"key": k, "value": value})
+	}
+
+	return converted
+}
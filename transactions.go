@@ -0,0 +1,181 @@
+package main
+
+// functions for counting transactions of Cognitive Services, and alerting admins when budgets are exceeded
+//
+// (free tiers are limited, and every transaction is billed for paid ones)
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// services of Cognitive Services which are counted separately
+const (
+	serviceFace             = "face"
+	serviceComputerVision   = "computervision"
+	serviceSpeech           = "speech"
+	serviceTextAnalytics    = "textanalytics"
+	serviceTranslator       = "translator"
+	serviceFormRecognizer   = "formrecognizer"
+	serviceContentModerator = "contentmoderator"
+	serviceCustomVision     = "customvision"
+
+	transactionDayFormat = "2006-01-02"
+)
+
+// all services which are counted
+var countedServices = []string{
+	serviceFace,
+	serviceComputerVision,
+	serviceSpeech,
+	serviceTextAnalytics,
+	serviceTranslator,
+	serviceFormRecognizer,
+	serviceContentModerator,
+	serviceCustomVision,
+}
+
+// check if given service is counted
+func isCountedService(service string) bool {
+	for _, s := range countedServices {
+		if s == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// service of Cognitive Services for given api url
+//
+// (returns an empty string for other services)
+func serviceOfURL(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, faceAPIPath):
+		return serviceFace
+	case strings.HasPrefix(u.Path, "/vision/"):
+		return serviceComputerVision
+	case strings.Contains(u.Host, ".stt.speech.") || strings.Contains(u.Host, ".tts.speech."):
+		return serviceSpeech
+	case strings.HasPrefix(u.Path, textanalyticsPath):
+		return serviceTextAnalytics
+	case strings.HasPrefix(apiURL, translatorAPIURL()):
+		return serviceTranslator
+	case strings.HasPrefix(u.Path, "/formrecognizer/"):
+		return serviceFormRecognizer
+	case strings.HasPrefix(u.Path, "/contentmoderator/"):
+		return serviceContentModerator
+	case strings.HasPrefix(u.Path, "/customvision/"):
+		return serviceCustomVision
+	}
+
+	return ""
+}
+
+// context key for polling results of asynchronous operations
+type pollingContextKey struct{}
+
+// context for polling results of asynchronous operations
+//
+// (requests with it are not counted, for only the requests which started the operations are billed)
+func withPolling(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pollingContextKey{}, true)
+}
+
+// check if the request with given context is for polling results of asynchronous operations
+func isPolling(ctx context.Context) bool {
+	polling, _ := ctx.Value(pollingContextKey{}).(bool)
+	return polling
+}
+
+// count a successful transaction to given api url, and alert admins if it exceeds budgets
+func countTransaction(apiURL string) {
+	service := serviceOfURL(apiURL)
+	if db == nil || service == "" {
+		return
+	}
+
+	now := time.Now()
+	today := now.Format(transactionDayFormat)
+	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format(transactionDayFormat)
+
+	daily, monthly, err := db.IncreaseTransactions(service, today, firstDayOfMonth)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to count transaction: %s", err))
+		return
+	}
+
+	// (alerted only once, when it is just exceeded)
+	if budget := conf().TransactionBudgetsPerDay[service]; budget > 0 && daily == budget+1 {
+		alertAdmins(fmt.Sprintf("Daily budget of %s exceeded: %d transactions today (budget: %d)", service, daily, budget))
+	}
+	if budget := conf().TransactionBudgetsPerMonth[service]; budget > 0 && monthly == budget+1 {
+		alertAdmins(fmt.Sprintf("Monthly budget of %s exceeded: %d transactions this month (budget: %d)", service, monthly, budget))
+	}
+}
+
+// send given alert to admins
+func alertAdmins(alert string) {
+	logger.Warn(alert)
+
+	if client == nil {
+		return
+	}
+
+	for _, adminID := range conf().AdminUserIDs {
+		if sent := client.SendMessage(int64(adminID), alert, nil); !sent.Ok {
+			logger.Error(fmt.Sprintf("Failed to send alert to admin %d: %s", adminID, *sent.Description))
+		}
+	}
+}
+
+// build up statistics of transactions per service (today, and this month)
+func transactionStats() []string {
+	now := time.Now()
+	today := now.Format(transactionDayFormat)
+	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format(transactionDayFormat)
+
+	lines := []string{"[Transactions per service (today / this month)]"}
+
+	daily, err := db.CountTransactionsPerService(today)
+	if err != nil {
+		return append(lines, fmt.Sprintf("  (failed: %s)", err))
+	}
+	monthly, err := db.CountTransactionsPerService(firstDayOfMonth)
+	if err != nil {
+		return append(lines, fmt.Sprintf("  (failed: %s)", err))
+	}
+
+	for _, service := range countedServices {
+		if monthly[service] <= 0 {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s: %s / %s", service,
+			withBudget(daily[service], conf().TransactionBudgetsPerDay[service]),
+			withBudget(monthly[service], conf().TransactionBudgetsPerMonth[service]),
+		))
+	}
+	if len(lines) <= 1 {
+		lines = append(lines, "  (none)")
+	}
+
+	return lines
+}
+
+// format given count with its budget, if any
+func withBudget(count, budget int) string {
+	if budget > 0 {
+		return fmt.Sprintf("%d (of %d)", count, budget)
+	}
+
+	return fmt.Sprintf("%d", count)
+}
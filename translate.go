@@ -0,0 +1,232 @@
+package main
+
+// functions for translating recognized texts with Translator API
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for Translator API
+const (
+	translatorAPIVersion = "3.0"
+
+	// callback data for translation ("translate" for choosing a language, "translate:{language}" for translating)
+	textCommandTranslate   = "translate"
+	textCommandTranslateTo = textCommandTranslate + ":"
+
+	translationHeaderPrefix = "[Translation:"
+)
+
+// target languages to choose from, when not configured
+var defaultTranslatorLanguages = []string{"en", "ko", "ja", "zh-Hans", "es", "fr", "de"}
+
+// TranslationResult struct for the result of Translator API
+type TranslationResult struct {
+	DetectedLanguage struct {
+		Language string  `json:"language"`
+		Score    float64 `json:"score"`
+	} `json:"detectedLanguage"`
+	Translations []struct {
+		Text string `json:"text"`
+		To   string `json:"to"`
+	} `json:"translations"`
+}
+
+// check if translation is available
+func translationAvailable() bool {
+	return conf().MsTranslatorSubscriptionKey != ""
+}
+
+// base url of Translator API
+func translatorAPIURL() string {
+	if conf().MsTranslatorEndpoint != "" {
+		return strings.TrimSuffix(conf().MsTranslatorEndpoint, "/")
+	}
+
+	return currentCloud().translatorEndpoint
+}
+
+// translate given text to given language
+func translateText(ctx context.Context, text, to string) (result TranslationResult, err error) {
+	params := url.Values{}
+	params.Set("api-version", translatorAPIVersion)
+	params.Set("to", to)
+
+	headers := map[string]string{
+		"Ocp-Apim-Subscription-Key": conf().MsTranslatorSubscriptionKey,
+	}
+	if conf().MsTranslatorRegion != "" {
+		headers["Ocp-Apim-Subscription-Region"] = conf().MsTranslatorRegion
+	}
+
+	var data []byte
+	if data, err = json.Marshal([]map[string]string{{"Text": text}}); err != nil {
+		return result, err
+	}
+
+	resp, err := doRequestWithHeaders(ctx, "POST", fmt.Sprintf("%s/translate?%s", translatorAPIURL(), params.Encode()), headers, "application/json", data)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	var results []TranslationResult
+	if err = readJSON(resp, &results); err != nil {
+		return result, err
+	}
+	if len(results) <= 0 || len(results[0].Translations) <= 0 {
+		return result, fmt.Errorf("no translated text")
+	}
+
+	return results[0], nil
+}
+
+// argument of a job for translating its result message to given language
+func translationArgument(language string) string {
+	return textCommandTranslateTo + language
+}
+
+// parse the target language from given argument of a job
+func parseTranslationArgument(argument string) (language string, ok bool) {
+	if strings.HasPrefix(argument, textCommandTranslateTo) {
+		return strings.TrimPrefix(argument, textCommandTranslateTo), true
+	}
+
+	return "", false
+}
+
+// translate the message of given result to given language
+//
+// (when it fails, the original message is kept with the reason)
+func translateResult(ctx context.Context, result ProcessResult, language string) ProcessResult {
+	if result.Message == "" {
+		return result
+	}
+
+	if !translationAvailable() {
+		result.Message = fmt.Sprintf("%s\n\n(Translation is not available.)", result.Message)
+
+		return result
+	}
+
+	if translated, err := cognitive.Translate(ctx, result.Message, language); err == nil {
+		result.Message = fmt.Sprintf("%s %s → %s]\n%s", translationHeaderPrefix, translated.DetectedLanguage.Language, language, translated.Translations[0].Text)
+	} else {
+		logger.Error(fmt.Sprintf("Failed to translate result: %s", err))
+
+		result.Message = fmt.Sprintf("%s\n\n(Failed to translate: %s)", result.Message, err)
+	}
+
+	return result
+}
+
+// check if given callback data is for translation
+func isTranslationCallback(data string) bool {
+	return data == textCommandTranslate || strings.HasPrefix(data, textCommandTranslateTo)
+}
+
+// process callback query for translation:
+//
+// show target languages, or reply with the translation of the message
+func processTranslationCallback(b Messenger, query bot.CallbackQuery) {
+	if query.Message == nil || query.Message.Text == nil {
+		return
+	}
+
+	text := *query.Message.Text
+	options := map[string]interface{}{
+		"chat_id":    query.Message.Chat.ID,
+		"message_id": query.Message.MessageID,
+	}
+
+	data := *query.Data
+	if data == textCommandTranslate {
+		// edit inline keyboards for choosing a language
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genLanguageInlineKeyboards(query.From.LanguageCode),
+		}
+		if edited := b.EditMessageReplyMarkup(options); !edited.Ok {
+			logger.Error(fmt.Sprintf("Failed to edit inline keyboards: %s", *edited.Description))
+		}
+
+		return
+	}
+
+	language := strings.TrimPrefix(data, textCommandTranslateTo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf().TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	var message string
+	translated, err := cognitive.Translate(ctx, originalText(text), language)
+	if err == nil {
+		message = fmt.Sprintf("%s %s → %s]\n%s", translationHeaderPrefix, translated.DetectedLanguage.Language, language, translated.Translations[0].Text)
+	} else {
+		message = fmt.Sprintf("Failed to translate text: %s", err)
+
+		logger.Error(message)
+	}
+
+	// reply with the translation (which can be read aloud)
+	replyOptions := map[string]interface{}{
+		"reply_to_message_id": query.Message.MessageID,
+	}
+	if err == nil && readAloudAvailable() {
+		replyOptions["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: genReadAloudInlineKeyboards(),
+		}
+	}
+	if sent := b.SendMessage(query.Message.Chat.ID, message, replyOptions); !sent.Ok {
+		logger.Error(fmt.Sprintf("Failed to send translation: %s", *sent.Description))
+	}
+
+	// restore inline keyboards of the original message
+	if keyboards := genTextAnalysisInlineKeyboards(text); len(keyboards) > 0 {
+		options["reply_markup"] = bot.InlineKeyboardMarkup{
+			InlineKeyboard: keyboards,
+		}
+	}
+	if edited := b.EditMessageReplyMarkup(options); !edited.Ok {
+		logger.Error(fmt.Sprintf("Failed to edit inline keyboards: %s", *edited.Description))
+	}
+}
+
+// generate inline keyboards for choosing a target language
+//
+// (language of the user comes first)
+func genLanguageInlineKeyboards(userLanguage *string) [][]bot.InlineKeyboardButton {
+	languages := []string{}
+	if userLanguage != nil && *userLanguage != "" {
+		languages = append(languages, *userLanguage)
+	}
+	for _, l := range conf().TranslatorLanguages {
+		if userLanguage == nil || !strings.EqualFold(l, *userLanguage) {
+			languages = append(languages, l)
+		}
+	}
+
+	rows := [][]bot.InlineKeyboardButton{}
+	row := []bot.InlineKeyboardButton{}
+	for _, l := range languages {
+		data := signCallbackData(textCommandTranslateTo + l)
+		row = append(row, bot.InlineKeyboardButton{Text: l, CallbackData: &data})
+
+		if len(row) >= 4 {
+			rows = append(rows, row)
+			row = []bot.InlineKeyboardButton{}
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,132 @@
+package main
+
+// functions for reading texts aloud with Text-to-Speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// constants for Text-to-Speech
+const (
+	ttsAPIPath         = "/cognitiveservices/v1"
+	ttsOutputFormat    = "ogg-24khz-16bit-mono-opus" // for voice messages of Telegram
+	defaultSpeechVoice = "en-US-JennyMultilingualNeural"
+
+	maxReadAloudLength = 2000 // texts longer than this will be truncated
+
+	// callback data for reading aloud
+	textCommandReadAloud = "readaloud"
+)
+
+// check if reading aloud is available
+func readAloudAvailable() bool {
+	return conf().MsSpeechSubscriptionKey != ""
+}
+
+// synthesize speech of given text, and return it in ogg/opus
+func synthesizeSpeech(ctx context.Context, text string) (audio []byte, err error) {
+	voice := conf().MsSpeechVoice
+	if voice == "" {
+		voice = defaultSpeechVoice
+	}
+
+	var escaped bytes.Buffer
+	if err = xml.EscapeText(&escaped, []byte(text)); err != nil {
+		return nil, err
+	}
+	ssml := fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US"><voice name="%s">%s</voice></speak>`, voice, escaped.String())
+
+	resp, err := doRequestWithHeaders(ctx, "POST", fmt.Sprintf(currentCloud().ttsURLFormat, regionOrDefault(conf().MsSpeechRegion))+ttsAPIPath, map[string]string{
+		"Ocp-Apim-Subscription-Key": conf().MsSpeechSubscriptionKey,
+		"X-Microsoft-OutputFormat":  ttsOutputFormat,
+		"User-Agent":                appName,
+	}, "application/ssml+xml", []byte(ssml))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, nil
+}
+
+// check if given callback data is for reading aloud
+func isReadAloudCallback(data string) bool {
+	return data == textCommandReadAloud
+}
+
+// process callback query for reading aloud, and reply with a voice message
+func processReadAloudCallback(b Messenger, query bot.CallbackQuery) {
+	if query.Message == nil || query.Message.Text == nil {
+		return
+	}
+
+	text := readAloudText(*query.Message.Text)
+	if len([]rune(text)) > maxReadAloudLength {
+		text = string([]rune(text)[:maxReadAloudLength])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(conf().TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	// 'recording audio...'
+	b.SendChatAction(query.Message.Chat.ID, bot.ChatActionRecordAudio)
+
+	if audio, err := cognitive.Synthesize(ctx, text); err == nil {
+		if sent := b.SendVoice(query.Message.Chat.ID, bot.InputFileFromBytes(audio), map[string]interface{}{
+			"reply_to_message_id": query.Message.MessageID,
+		}); !sent.Ok {
+			logger.Error(fmt.Sprintf("Failed to send voice: %s", *sent.Description))
+		}
+	} else {
+		message := fmt.Sprintf("Failed to read text aloud: %s", err)
+
+		b.SendMessage(query.Message.Chat.ID, message, map[string]interface{}{
+			"reply_to_message_id": query.Message.MessageID,
+		})
+
+		logger.Error(message)
+	}
+}
+
+// get the text to be read aloud from given message text
+//
+// (without appended analyses, or the header of a translation)
+func readAloudText(text string) string {
+	text = originalText(text)
+
+	if strings.HasPrefix(text, translationHeaderPrefix) {
+		if index := strings.Index(text, "\n"); index >= 0 {
+			text = text[index+1:]
+		}
+	}
+
+	return strings.TrimSpace(text)
+}
+
+// generate inline keyboards for reading a text aloud
+func genReadAloudInlineKeyboards() [][]bot.InlineKeyboardButton {
+	data := signCallbackData(textCommandReadAloud)
+
+	return [][]bot.InlineKeyboardButton{
+		[]bot.InlineKeyboardButton{
+			bot.InlineKeyboardButton{Text: "Read Aloud", CallbackData: &data},
+		},
+	}
+}
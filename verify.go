@@ -0,0 +1,153 @@
+package main
+
+// functions for verifying faces on two photos
+
+import (
+	"context"
+	"fmt"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+func init() {
+	registerCommand(newCommand(VerifyFaces, "VF", handleVerifyFaces), MediaImage)
+}
+
+// (verification needs two photos, so it is not processed like other commands)
+func handleVerifyFaces(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	return result, fmt.Errorf("'%s' needs two photos.", VerifyFaces)
+}
+
+// check if given message is from a user who is in a conversation
+func isInConversation(message *bot.Message) bool {
+	return message.From != nil && hasConversation(message.Chat.ID, message.From.ID)
+}
+
+// continue a conversation with the next photo of a user
+//
+// returns true if the photo was consumed by a conversation
+func continueConversation(ctx context.Context, b Messenger, message *bot.Message, fileID string) bool {
+	if message.From == nil {
+		return false
+	}
+
+	conversation, exists := takeConversation(message.Chat.ID, message.From.ID)
+	if !exists {
+		return false
+	}
+
+	switch conversation.Command {
+	case VerifyFaces:
+		// send a status message, which will be deleted after processing
+		if sent := b.SendMessage(message.Chat.ID, fmt.Sprintf(localizeFor(message.From.ID, messageProcessingImages), conversation.Command), map[string]interface{}{
+			"reply_to_message_id": message.MessageID,
+			"reply_markup": bot.InlineKeyboardMarkup{
+				InlineKeyboard: genJobCancelInlineKeyboards(),
+			},
+		}); sent.Ok {
+			if err := enqueueJob(ctx, Job{
+				Kind:      JobKindVerify,
+				ChatID:    message.Chat.ID,
+				UserID:    message.From.ID,
+				MessageID: sent.Result.MessageID,
+				FileIDs:   append(conversation.FileIDs, fileID),
+				Command:   conversation.Command,
+			}); err != nil {
+				logger.Error(fmt.Sprintf("Failed to enqueue job: %s", err))
+
+				b.EditMessageText(localizeFor(message.From.ID, messageFailedToEnqueue), map[string]interface{}{
+					"chat_id":    message.Chat.ID,
+					"message_id": sent.Result.MessageID,
+				})
+			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to send message: %s", *sent.Description))
+		}
+	default:
+		if isDirectlyRunnable(conversation.Command) {
+			// (preselected with a deep link)
+			runImageCommandDirectly(ctx, b, message, fileID, conversation.Command, "")
+		} else {
+			logger.Error(fmt.Sprintf("Unknown command in conversation: %s", conversation.Command))
+		}
+	}
+
+	return true
+}
+
+// verify if the largest faces on two images belong to the same person
+func processVerification(b Messenger, chatID int64, userID int, messageIDToDelete int, fileURLs []string) {
+	errorMessage := ""
+
+	ctx, cancel := context.WithTimeout(jobContext(chatID, messageIDToDelete), commandTimeout(VerifyFaces))
+	defer cancel()
+
+	// 'typing...'
+	b.SendChatAction(chatID, bot.ChatActionTyping)
+
+	faceIDs := []string{}
+	for i, fileURL := range fileURLs {
+		if imageBytes, err := loadImage(ctx, fileURL); err == nil {
+			if faces, err := cognitive.DetectFaces(ctx, imageBytes, true, false, nil); err == nil {
+				if face, exists := largestFace(faces); exists {
+					faceIDs = append(faceIDs, face.FaceID)
+				} else {
+					errorMessage = fmt.Sprintf("No face detected on image #%d.", i+1)
+				}
+			} else {
+				errorMessage = fmt.Sprintf("Failed to detect faces: %s", err)
+			}
+		} else {
+			errorMessage = openImageErrorMessage(userID, err)
+		}
+
+		if errorMessage != "" {
+			break
+		}
+	}
+
+	if errorMessage == "" {
+		if verified, err := cognitive.VerifyFaces(ctx, faceIDs[0], faceIDs[1]); err == nil {
+			var message string
+			if verified.IsIdentical {
+				message = fmt.Sprintf("These faces belong to the same person. (confidence: %.3f%%)", verified.Confidence*100.0)
+			} else {
+				message = fmt.Sprintf("These faces belong to different persons. (confidence of being the same person: %.3f%%)", verified.Confidence*100.0)
+			}
+
+			if sent := b.SendMessage(chatID, message, nil); !sent.Ok {
+				errorMessage = fmt.Sprintf("Failed to send result: %s", *sent.Description)
+			}
+		} else {
+			errorMessage = fmt.Sprintf("Failed to verify faces: %s", err)
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		errorMessage = fmt.Sprintf(localizeFor(userID, messageTimedOut), VerifyFaces)
+	} else if isCanceled(ctx) {
+		errorMessage = localizeFor(userID, messageCanceled)
+	}
+
+	// delete status message
+	b.DeleteMessage(chatID, messageIDToDelete)
+
+	// if there was any error, send it back
+	if errorMessage != "" {
+		b.SendMessage(chatID, errorMessage, nil)
+
+		logJobError(errorMessage, chatID, userID, VerifyFaces, "")
+	}
+}
+
+// the largest one of given faces
+func largestFace(faces []DetectedFace) (largest DetectedFace, exists bool) {
+	for _, face := range faces {
+		if !exists || face.FaceRectangle.Width*face.FaceRectangle.Height > largest.FaceRectangle.Width*largest.FaceRectangle.Height {
+			largest, exists = face, true
+		}
+	}
+
+	return largest, exists
+}
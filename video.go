@@ -0,0 +1,75 @@
+package main
+
+// functions for extracting frames from animations and videos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	// for Telegram bot
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// get file id of the animation or video in given message
+func videoFileID(message *bot.Message) (fileID string, exists bool) {
+	if message.Animation != nil {
+		return message.Animation.FileID, true
+	} else if message.HasVideo() {
+		return message.Video.FileID, true
+	} else if message.HasVideoNote() {
+		return message.VideoNote.FileID, true
+	} else if message.HasDocument() && message.Document.MimeType != nil {
+		mimeType := *message.Document.MimeType
+		if mimeType == "image/gif" || strings.HasPrefix(mimeType, "video/") {
+			return message.Document.FileID, true
+		}
+	}
+
+	return "", false
+}
+
+// download an animation or video from given url, and extract a representative frame of it as a PNG image
+func extractFrame(ctx context.Context, fileURL string) (frame []byte, err error) {
+	var dir string
+	if dir, err = ioutil.TempDir("", "video"); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// download video (ffmpeg cannot seek in some containers when reading from stdin)
+	videoFilepath := filepath.Join(dir, "video")
+	if err = downloadFile(ctx, fileURL, videoFilepath); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(
+		ctx,
+		audioConverterCommand, // ffmpeg
+		"-i", videoFilepath,
+		"-vf", "thumbnail", // pick the most representative frame
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "png",
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() <= 0 {
+		return nil, fmt.Errorf("no frame was extracted")
+	}
+
+	return stdout.Bytes(), checkImageLimits(stdout.Bytes())
+}
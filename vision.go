@@ -0,0 +1,141 @@
+package main
+
+// commands for describing, tagging, and reading texts on images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand(newCommand(Describe, "D", handleDescribe), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+	registerCommand(newCommand(ReadText, "R", handleReadText), MediaImage, MediaVideo, MediaAlbum, MediaPDF)
+	registerCommand(newCommand(Tag, "T", handleTag), MediaImage, MediaVideo, MediaAlbum, MediaSticker)
+}
+
+// describe given image bytes
+func handleDescribe(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	errorMessage := ""
+
+	if described, err := cognitive.Describe(ctx, imageBytes, 0); err == nil {
+		captions := []string{}
+		for _, c := range described.Description.Captions {
+			captions = append(captions, fmt.Sprintf("%s (%.3f%%)", c.Text, c.Confidence*100.0))
+		}
+		result.Message = fmt.Sprintf("%s\n\n(%s)", strings.Join(captions, "\n"), strings.Join(described.Description.Tags, ", "))
+
+		if len(strings.TrimSpace(result.Message)) <= 0 {
+			errorMessage = "Could not describe given image."
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to describe image: %s", err)
+	}
+
+	if errorMessage != "" {
+		return result, errors.New(errorMessage)
+	}
+
+	return result, nil
+}
+
+// recognize printed and handwritten texts on given image bytes
+func handleReadText(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	errorMessage := ""
+
+	reportProgress := func(status string, elapsed time.Duration) {
+		if progress != nil {
+			progress(fmt.Sprintf("recognizing text: %s", status))
+		}
+	}
+
+	recognized, err := visionFor(ReadText).Read(ctx, imageBytes, reportProgress)
+
+	// recognize again with the deskewed image, if texts are tilted
+	if err == nil && len(recognized.AnalyzeResult.ReadResults) > 0 && needsDeskew(recognized.AnalyzeResult.ReadResults[0].Angle) {
+		if deskewed, err := deskewImage(imageBytes, recognized.AnalyzeResult.ReadResults[0].Angle); err == nil {
+			if rerecognized, err := visionFor(ReadText).Read(ctx, deskewed, reportProgress); err == nil {
+				imageBytes, recognized = deskewed, rerecognized
+			} else {
+				logger.Warn(fmt.Sprintf("Failed to recognize text on deskewed image: %s", err))
+			}
+		} else {
+			logger.Warn(fmt.Sprintf("Failed to deskew image: %s", err))
+		}
+	}
+
+	if err == nil {
+		result.Message = recognized.Text()
+
+		if len(strings.TrimSpace(result.Message)) <= 0 {
+			errorMessage = "Could not recognize any text from given image."
+		} else if annotated, err := annotateReadResult(imageBytes, recognized); err == nil {
+			result.Image = annotated
+		} else {
+			// send recognized text only
+			logger.Warn(fmt.Sprintf("Failed to annotate recognized text: %s", err))
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to recognize text: %s", err)
+	}
+
+	if errorMessage != "" {
+		return result, errors.New(errorMessage)
+	}
+
+	return result, nil
+}
+
+// tag given image bytes
+func handleTag(ctx context.Context, imageBytes []byte, progress func(message string)) (result ProcessResult, err error) {
+	errorMessage := ""
+
+	if recognized, err := visionFor(Tag).Tag(ctx, imageBytes); err == nil {
+		tags := []string{}
+		for _, t := range recognized.Tags {
+			tags = append(tags, fmt.Sprintf("%s (%.3f%%)", t.Name, t.Confidence*100.0))
+		}
+		result.Message = strings.Join(tags, "\n")
+
+		if len(strings.TrimSpace(result.Message)) <= 0 {
+			errorMessage = "Could not tag given image."
+		}
+	} else {
+		errorMessage = fmt.Sprintf("Failed to tag image: %s", err)
+	}
+
+	if errorMessage != "" {
+		return result, errors.New(errorMessage)
+	}
+
+	return result, nil
+}
+
+// outline recognized words on given image bytes (in the color of their lines), and return the encoded image
+func annotateReadResult(imageBytes []byte, recognized ReadResult) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// copy to a new image, and prepare for drawing
+	newImg, gc, _, _ := prepareAnnotation(img)
+	gc.SetLineWidth(1)
+
+	for _, page := range recognized.AnalyzeResult.ReadResults {
+		for i, line := range page.Lines {
+			gc.SetStrokeColor(colorForIndex(i))
+
+			for _, word := range line.Words {
+				drawPolygon(gc, word.BoundingBox)
+			}
+		}
+	}
+	gc.Save()
+
+	return encodeImage(newImg)
+}
@@ -0,0 +1,65 @@
+package main
+
+// functions for watermarks on result images
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+
+	// for drawing on images
+	"github.com/meinside/telegram-ms-cognitive-bot/internal/imaging"
+)
+
+// constants for watermarks
+const (
+	watermarkBottomRight = imaging.WatermarkBottomRight // default
+
+	defaultWatermarkOpacity = 0.5
+)
+
+// load the logo of watermarks from given filepath (nil if it is empty)
+func loadWatermarkLogo(filepath string) (image.Image, error) {
+	if filepath == "" {
+		return nil, nil
+	}
+
+	imgBytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+
+	return img, err
+}
+
+// put the configured watermark on given encoded image
+//
+// (returns given one as it is when watermark is not configured)
+func watermarkImage(encoded []byte) ([]byte, error) {
+	watermarkLogo := loaded().watermarkLogo
+	if watermarkLogo == nil && conf().WatermarkText == "" {
+		return encoded, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	newImg := imaging.MutableRGBA(img)
+
+	var mark image.Image
+	if watermarkLogo != nil {
+		mark = imaging.WatermarkLogo(watermarkLogo, newImg.Bounds())
+	} else if mark, err = imaging.WatermarkText(newImg.Bounds(), conf().WatermarkText, loaded().font, conf().FontSizeRatio); err != nil {
+		logger.Error(fmt.Sprintf("Failed to draw string: %s", err))
+	}
+
+	// composite it at the configured position, with the configured opacity
+	imaging.Watermark(newImg, mark, conf().WatermarkPosition, conf().WatermarkOpacity)
+
+	return encodeImage(newImg)
+}
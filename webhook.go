@@ -0,0 +1,70 @@
+package main
+
+// functions for notifying a webhook (`result-webhook-url`) of completed analyses
+//
+// (eg. for Zapier, n8n, or dashboards)
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// sources of results
+const (
+	resultSourceTelegram = "telegram"
+	resultSourceAPI      = "api"
+
+	resultWebhookSignatureHeader = "X-Signature-SHA256"
+)
+
+// resultWebhookPayload struct for payloads which are posted to the result webhook
+type resultWebhookPayload struct {
+	Source      string           `json:"source"`
+	ChatID      int64            `json:"chat_id,omitempty"`
+	UserID      int              `json:"user_id,omitempty"`
+	MessageID   int              `json:"message_id,omitempty"`
+	Command     CognitiveCommand `json:"command"`
+	Message     string           `json:"message,omitempty"`
+	ImageURL    string           `json:"image_url,omitempty"` // link to the archived result image (only when archiving is enabled)
+	CompletedAt time.Time        `json:"completed_at"`
+}
+
+// post given payload to the result webhook
+//
+// (signed with HMAC-SHA256 of `result-webhook-secret`, if it is set)
+func notifyResultWebhook(ctx context.Context, payload resultWebhookPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to marshal result webhook payload: %s", err))
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", conf().ResultWebhookURL, bytes.NewReader(data))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to create result webhook request: %s", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if conf().ResultWebhookSecret != "" {
+		req.Header.Set(resultWebhookSignatureHeader, hex.EncodeToString(hmacSHA256([]byte(conf().ResultWebhookSecret), string(data))))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to notify result webhook: %s", err))
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Error(fmt.Sprintf("Result webhook responded with HTTP %d", resp.StatusCode))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+// functions for accepting updates only from Telegram in webhook mode
+//
+// (webhook is set with a secret token, and Telegram sends it back in `X-Telegram-Bot-Api-Secret-Token` header of each update)
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// constants for webhook
+const (
+	telegramSetWebhookURLFormat = "https://api.telegram.org/bot%s/setWebhook" // token
+
+	webhookSecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// characters (and length) which are allowed in secret tokens of webhooks
+var webhookSecretTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// secret token of webhook
+//
+// (`webhook-secret-token` of config, or derived from the telegram api token if it is empty)
+func webhookSecretToken() string {
+	if conf().WebhookSecretToken != "" {
+		return conf().WebhookSecretToken
+	}
+
+	derived := sha256.Sum256([]byte("webhook:" + conf().TelegramAPIToken))
+	return hex.EncodeToString(derived[:])
+}
+
+// check if given request to the webhook has the secret token
+func isValidWebhookRequest(r *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretTokenHeader)), []byte(webhookSecretToken())) == 1
+}
+
+// replace the telegram api token in given string (eg. of an error with the url)
+func redactToken(s string) string {
+	if conf().TelegramAPIToken == "" {
+		return s
+	}
+
+	return strings.Replace(s, conf().TelegramAPIToken, "<token>", -1)
+}
+
+// set webhook with the secret token
+//
+// (Telegram API is called directly, for the bot library cannot set secret tokens)
+func setWebhookWithSecretToken(host string, port int, certFilepath string) error {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	w.WriteField("url", fmt.Sprintf("https://%s:%d/", host, port))
+	w.WriteField("secret_token", webhookSecretToken())
+
+	// (for self-signed certificates)
+	if certFilepath != "" {
+		file, err := os.Open(certFilepath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		part, err := w.CreateFormFile("certificate", filepath.Base(certFilepath))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(part, file); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	resp, err := telegramHTTPClient().Post(fmt.Sprintf(telegramSetWebhookURLFormat, conf().TelegramAPIToken), w.FormDataContentType(), body)
+	if err != nil {
+		return fmt.Errorf("failed to request: %s", redactToken(err.Error()))
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("malformed response (HTTP %d)", resp.StatusCode)
+	}
+	if !result.Ok {
+		return fmt.Errorf("%s", result.Description)
+	}
+
+	return nil
+}